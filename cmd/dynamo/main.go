@@ -37,6 +37,12 @@ func main() {
 		readQuorum    = flag.Int("read-quorum", 2, "Read quorum (R)")
 		writeQuorum   = flag.Int("write-quorum", 2, "Write quorum (W)")
 		virtualNodes  = flag.Int("vnodes", 150, "Virtual nodes per physical node")
+		partitioner   = flag.String("partitioner", "", "Key and token placement: murmur3, balanced or ordered (default murmur3)")
+		datacenter    = flag.String("datacenter", "", "Datacenter this node runs in")
+		rack          = flag.String("rack", "", "Rack within the datacenter")
+		weight        = flag.Float64("weight", 0, "Capacity relative to other nodes (default 1)")
+		interDCDelay  = flag.Duration("inter-dc-latency", 0, "Artificial delay for requests to other datacenters (testing)")
+		hedgedReads   = flag.Bool("hedged-reads", false, "Read from the R fastest replicas and hedge slow ones")
 		configFile    = flag.String("config", "", "Configuration file path")
 		showVersion   = flag.Bool("version", false, "Show version")
 	)
@@ -77,6 +83,24 @@ func main() {
 	cfg.ReadQuorum = *readQuorum
 	cfg.WriteQuorum = *writeQuorum
 	cfg.VirtualNodes = *virtualNodes
+	if *partitioner != "" {
+		cfg.Partitioner = *partitioner
+	}
+	if *hedgedReads {
+		cfg.HedgedReads = true
+	}
+	if *datacenter != "" {
+		cfg.Datacenter = *datacenter
+	}
+	if *rack != "" {
+		cfg.Rack = *rack
+	}
+	if *weight > 0 {
+		cfg.Weight = *weight
+	}
+	if *interDCDelay > 0 {
+		cfg.InterDCLatency = *interDCDelay
+	}
 
 	// Parse seed nodes
 	if *seedNodes != "" {
@@ -90,7 +114,13 @@ func main() {
 
 	log.Printf("Starting Mini-Dynamo node: %s", cfg.NodeID)
 	log.Printf("Address: %s:%d, Gossip: %d", cfg.Address, cfg.Port, cfg.GossipPort)
+	log.Printf("Topology: datacenter=%s, rack=%s, weight=%g", cfg.Datacenter, cfg.Rack, cfg.Weight)
+	log.Printf("Ring: %d virtual nodes, partitioner %s", cfg.VirtualNodes, cfg.Partitioner)
 	log.Printf("Replication: N=%d, R=%d, W=%d", cfg.ReplicationFactor, cfg.ReadQuorum, cfg.WriteQuorum)
+	log.Printf("Failure detector: %s", cfg.FailureDetector)
+	if cfg.HedgedReads {
+		log.Printf("Hedged reads enabled at p%.0f latency", cfg.HedgePercentile*100)
+	}
 
 	// Initialize storage engine
 	store, err := storage.NewBitcask(cfg.DataDir, cfg.SyncWrites)
@@ -101,19 +131,86 @@ func main() {
 
 	log.Printf("Storage initialized: %d keys loaded", store.Count())
 
-	// Initialize hash ring
-	hashRing := ring.NewHashRing(cfg.VirtualNodes)
+	// Initialize hash ring, restoring the ring this node last knew
+	partitionerImpl, err := ring.NewPartitioner(cfg.Partitioner)
+	if err != nil {
+		log.Fatalf("Invalid partitioner: %v", err)
+	}
+	hashRing := ring.NewHashRingWithPartitioner(cfg.VirtualNodes, partitionerImpl)
+	hashRing.SetDatacenterReplicas(cfg.ReplicasPerDC)
+	ringState := ring.NewStateFile(cfg.DataDir)
+	if snapshot, err := ringState.Load(); err != nil {
+		log.Fatalf("Failed to load ring state: %v", err)
+	} else if snapshot != nil {
+		// Keys were placed by the saved ring's partitioner and cannot be
+		// found with another
+		if name := snapshot.PartitionerName(); name != cfg.Partitioner {
+			log.Fatalf("Data directory was written with partitioner %s, configured %s", name, cfg.Partitioner)
+		}
+		hashRing.Adopt(snapshot)
+		log.Printf("Ring restored: epoch %d, %d nodes", snapshot.Epoch, len(snapshot.Nodes))
+
+		// Weight changes move data, so they go through PUT /admin/weight
+		if weight := hashRing.GetNodeWeight(cfg.NodeID); hashRing.HasNode(cfg.NodeID) && weight != cfg.Weight {
+			log.Printf("Keeping weight %g from the ring state; use PUT /admin/weight to change it", weight)
+			cfg.Weight = weight
+		}
+	}
+	hashRing.SetStateFile(ringState)
+
+	// Initialize coordinator
+	coordinator := replication.NewCoordinator(cfg, hashRing, store)
+
+	// Initialize re-replication of dead nodes' ranges
+	rereplication := replication.NewRereplicationManager(coordinator, cfg.RereplicationDelay)
 
 	// Initialize gossip membership
 	membership := gossip.NewMembershipList(cfg.NodeID)
 
+	// Apply ring state changes, dropping nodes that left the ring at once
+	membership.SetRingStateHandler(func(nodeID string, oldState, newState types.RingState) {
+		log.Printf("Node %s ring state: %s -> %s", nodeID, oldState, newState)
+		coordinator.SetNodeRingState(nodeID, newState)
+		if newState == types.RingLeft {
+			hashRing.RemoveNode(nodeID)
+		}
+	})
+
+	// Apply weights advertised by other nodes, which have already moved
+	// the data for them, at the tokens gossiped with the weight
+	membership.SetWeightHandler(func(nodeID string, weight float64) {
+		log.Printf("Node %s weight: %g", nodeID, weight)
+		var tokens []uint64
+		if member, ok := membership.GetMember(nodeID); ok {
+			tokens = member.Node.TokenRing
+		}
+		coordinator.SetNodeWeight(nodeID, weight, tokens)
+	})
+
+	// Register members discovered through gossip, at the tokens gossiped
+	// with them. Members heard of without tokens are registered again once
+	// their tokens arrive.
+	membership.SetMemberHandler(func(node types.Node) {
+		if node.ID == cfg.NodeID || node.Port == 0 || node.State == types.NodeDead || node.RingState == types.RingLeft {
+			return
+		}
+		log.Printf("Discovered node %s at %s:%d (gossip port %d)", node.ID, node.Address, node.Port, node.GossipPort)
+		coordinator.RegisterNode(&node)
+	})
+
 	// Set up node state change handler
 	onStateChange := func(nodeID string, oldState, newState types.NodeState) {
 		log.Printf("Node %s: %s -> %s", nodeID, oldState.String(), newState.String())
 		if newState == types.NodeDead {
+			rereplication.NodeDead(nodeID)
 			hashRing.RemoveNode(nodeID)
-		} else if newState == types.NodeAlive && oldState == types.NodeDead {
-			hashRing.AddNode(nodeID)
+		} else if newState == types.NodeAlive && oldState == types.NodeDead && coordinator.GetNodeRingState(nodeID) != types.RingLeft {
+			rereplication.NodeAlive(nodeID)
+			// Put the node back at the tokens it holds, not where the
+			// partitioner would place it now
+			if member, ok := membership.GetMember(nodeID); ok {
+				coordinator.RegisterNode(member.Node)
+			}
 		}
 	}
 
@@ -124,29 +221,90 @@ func main() {
 		cfg.DeadTimeout,
 		onStateChange,
 	)
+	if cfg.FailureDetector == gossip.DetectorPhi {
+		detector.SetPhiAccrual(cfg.PhiThreshold)
+	}
 
 	// Initialize gossip protocol
 	gossipProto := gossip.NewProtocol(cfg, membership, detector)
 
-	// Initialize coordinator
-	coordinator := replication.NewCoordinator(cfg, hashRing, store)
+	gossipProto.SetClock(coordinator.Clock())
+	gossipProto.SetRing(coordinator)
 
 	// Register self as node
 	selfNode := &types.Node{
-		ID:      cfg.NodeID,
-		Address: cfg.Address,
-		Port:    cfg.Port,
-		State:   types.NodeAlive,
+		ID:         cfg.NodeID,
+		Address:    cfg.Address,
+		Port:       cfg.Port,
+		GossipPort: cfg.GossipPort,
+		State:      types.NodeAlive,
+		Datacenter: cfg.Datacenter,
+		Rack:       cfg.Rack,
+		Weight:     cfg.Weight,
+	}
+
+	// A node joining an existing cluster with no data streams it in before
+	// serving reads, as does one stopped part way through streaming
+	resume := replication.BootstrapPending(store)
+	bootstrap := cfg.AutoBootstrap && len(cfg.SeedNodes) > 0 && (store.Count() == 0 || resume)
+	if resume && bootstrap {
+		log.Printf("Resuming interrupted bootstrap")
+	}
+	if bootstrap {
+		selfNode.RingState = types.RingJoining
 	}
 	coordinator.RegisterNode(selfNode)
-	hashRing.AddNode(cfg.NodeID)
+
+	// Advertise our address and topology through gossip
+	selfMember := *selfNode
+	membership.AddMember(&selfMember)
+
+	// Initialize read repair
+	readRepairer := replication.NewReadRepairer(
+		coordinator,
+		cfg.ReadRepairChance,
+		cfg.ReadRepairWorkers,
+		cfg.ReadRepairQueueSize,
+		cfg.ReadRepairRate,
+	)
+	coordinator.SetReadRepairer(readRepairer)
 
 	// Initialize hinted handoff store
 	handoffStore := replication.NewHintedHandoffStore(cfg.HandoffTimeout, 1000)
 	handoffManager := replication.NewHandoffManager(handoffStore, coordinator, 30*time.Second)
+	hashRing.Subscribe(cfg.ReplicationFactor, handoffManager.OnRingChange)
+
+	// Initialize transactions
+	txnCoordinator := replication.NewTxnCoordinator(coordinator, cfg.TxnTimeout)
 
 	// Initialize API server
 	server := api.NewServer(cfg, store, coordinator)
+	server.SetTxnCoordinator(txnCoordinator)
+	server.SetFailureDetector(detector)
+
+	// Initialize bootstrapping
+	var bootstrapper *replication.Bootstrapper
+	if bootstrap {
+		bootstrapper = replication.NewBootstrapper(coordinator, func(state types.RingState) {
+			membership.SetRingState(cfg.NodeID, state)
+		})
+		server.SetBootstrapper(bootstrapper)
+	}
+	bootstrapCtx, cancelBootstrap := context.WithCancel(context.Background())
+	defer cancelBootstrap()
+
+	// Initialize graceful decommission
+	decommissioner := replication.NewDecommissioner(coordinator, func(state types.RingState) {
+		membership.SetRingState(cfg.NodeID, state)
+	})
+	server.SetDecommissioner(decommissioner)
+	server.SetRereplicationManager(rereplication)
+
+	// Initialize load-aware rebalancing
+	rebalancer := replication.NewRebalancer(coordinator, cfg.RebalanceMaxStreams, func(weight float64) {
+		membership.SetWeight(cfg.NodeID, weight)
+	})
+	server.SetRebalancer(rebalancer)
 
 	// Start services
 	if err := gossipProto.Start(); err != nil {
@@ -154,12 +312,15 @@ func main() {
 	}
 	detector.Start()
 	handoffManager.Start()
-
-	// Connect to seed nodes
-	for _, seedAddr := range cfg.SeedNodes {
-		log.Printf("Connecting to seed node: %s", seedAddr)
-		// Parse seed address and register
-		gossipProto.AddPeer(seedAddr, seedAddr)
+	readRepairer.Start()
+	txnCoordinator.Start()
+
+	// Join the cluster through the seed nodes
+	if len(cfg.SeedNodes) > 0 {
+		log.Printf("Joining through seed nodes: %v", cfg.SeedNodes)
+		if err := gossipProto.Join(cfg.SeedNodes); err != nil {
+			log.Fatalf("Failed to join: %v", err)
+		}
 	}
 
 	// Start HTTP server in goroutine
@@ -169,6 +330,21 @@ func main() {
 		}
 	}()
 
+	// Stream data for the ranges this node owns once the seed has told us
+	// about the other nodes
+	if bootstrapper != nil {
+		go func() {
+			select {
+			case <-gossipProto.Joined():
+			case <-bootstrapCtx.Done():
+				return
+			}
+			if err := bootstrapper.Run(bootstrapCtx); err != nil {
+				log.Printf("Bootstrap stopped: %v", err)
+			}
+		}()
+	}
+
 	log.Printf("Node %s is ready", cfg.NodeID)
 
 	// Wait for shutdown signal
@@ -182,6 +358,12 @@ func main() {
 	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
 	defer cancel()
 
+	cancelBootstrap()
+	decommissioner.Stop()
+	rebalancer.Stop()
+	rereplication.Stop()
+	txnCoordinator.Stop()
+	readRepairer.Stop()
 	handoffManager.Stop()
 	detector.Stop()
 	gossipProto.Stop()
@@ -0,0 +1,196 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+
+	"github.com/mini-dynamo/mini-dynamo/internal/replication"
+	"github.com/mini-dynamo/mini-dynamo/internal/storage"
+	"github.com/mini-dynamo/mini-dynamo/pkg/types"
+)
+
+// batchRequest is the body of a batch write
+type batchRequest struct {
+	Operations  []types.BatchOperation `json:"operations"`
+	Consistency string                 `json:"consistency,omitempty"`
+	N           int                    `json:"n,omitempty"`
+	W           int                    `json:"w,omitempty"`
+}
+
+// handleBatch writes many puts and deletes at one version. It answers 200
+// when every key met its quorum and 207 with per-key results otherwise.
+func (s *Server) handleBatch(w http.ResponseWriter, r *http.Request) {
+	body, err := io.ReadAll(io.LimitReader(r.Body, 10*1024*1024)) // 10MB limit
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "failed to read request body")
+		return
+	}
+	defer r.Body.Close()
+
+	var req batchRequest
+	if err := json.Unmarshal(body, &req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid request format")
+		return
+	}
+
+	if s.coordinator == nil {
+		s.handleLocalBatch(w, req.Operations)
+		return
+	}
+
+	opts, err := parseConsistencyOptions(r, req.Consistency)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if opts.N == 0 {
+		opts.N = req.N
+	}
+	if opts.W == 0 {
+		opts.W = req.W
+	}
+	session, err := parseSessionToken(r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	for _, op := range req.Operations {
+		if version := session.Versions[op.Key]; version > opts.MinVersion {
+			opts.MinVersion = version
+		}
+	}
+
+	result, err := s.coordinator.Batch(r.Context(), req.Operations, opts)
+	if err != nil {
+		switch {
+		case errors.Is(err, replication.ErrInvalidBatch), errors.Is(err, replication.ErrInvalidConsistency),
+			errors.Is(err, replication.ErrInvalidSession):
+			writeError(w, http.StatusBadRequest, err.Error())
+		default:
+			writeError(w, http.StatusInternalServerError, err.Error())
+		}
+		return
+	}
+
+	for _, keyResult := range result.Results {
+		if keyResult.Success {
+			session.observe(keyResult.Key, result.Timestamp)
+		}
+	}
+	w.Header().Set(sessionHeader, session.encode())
+
+	status := "ok"
+	statusCode := http.StatusOK
+	if result.Failed() > 0 {
+		status = "partial"
+		statusCode = http.StatusMultiStatus
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(statusCode)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"status":  status,
+		"version": result.Timestamp,
+		"results": result.Results,
+	})
+}
+
+// handleLocalBatch applies a batch to local storage when running without
+// a coordinator
+func (s *Server) handleLocalBatch(w http.ResponseWriter, ops []types.BatchOperation) {
+	if err := replication.ValidateBatch(ops); err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	timestamp := s.clock.Now()
+	batch := storage.NewWriteBatch()
+	for _, op := range ops {
+		if op.Op == types.BatchDelete {
+			batch.Delete(op.Key, timestamp)
+		} else {
+			batch.Put(op.Key, []byte(op.Value), timestamp)
+		}
+	}
+
+	if err := s.storage.Write(batch); err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	results := make([]types.BatchKeyResult, 0, len(ops))
+	for _, op := range ops {
+		results = append(results, types.BatchKeyResult{Key: op.Key, Success: true, Acks: 1, Required: 1, Replicas: 1})
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"status":  "ok",
+		"version": timestamp,
+		"results": results,
+	})
+}
+
+// handleInternalBatch applies a group of replicated entries atomically
+func (s *Server) handleInternalBatch(w http.ResponseWriter, r *http.Request) {
+	if s.coordinator == nil {
+		writeError(w, http.StatusServiceUnavailable, "no coordinator")
+		return
+	}
+
+	var req types.BatchReplicationRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid request format")
+		return
+	}
+	defer r.Body.Close()
+
+	s.coordinator.ObserveRingEpoch(req.RingEpoch, req.RingChecksum, req.FromNode)
+	version := s.coordinator.RingVersion()
+
+	if len(req.Entries) > 0 {
+		if err := s.coordinator.ObserveTimestamp(req.Entries[0].Timestamp, req.FromNode); err != nil {
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusConflict)
+			json.NewEncoder(w).Encode(types.ReplicationResponse{
+				Success:      false,
+				Message:      err.Error(),
+				RingEpoch:    version.Epoch,
+				RingChecksum: version.Checksum,
+			})
+			return
+		}
+	}
+
+	var err error
+	if req.ClientWrite {
+		err = s.coordinator.ApplyClientWrite(req.Entries)
+	} else {
+		err = s.coordinator.ApplyBatch(req.Entries)
+	}
+	if errors.Is(err, replication.ErrTxnConflict) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusConflict)
+		json.NewEncoder(w).Encode(types.ReplicationResponse{
+			Success:      false,
+			Message:      err.Error(),
+			RingEpoch:    version.Epoch,
+			RingChecksum: version.Checksum,
+			Locked:       true,
+		})
+		return
+	}
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(types.ReplicationResponse{
+		Success:      true,
+		RingEpoch:    version.Epoch,
+		RingChecksum: version.Checksum,
+	})
+}
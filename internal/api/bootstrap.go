@@ -0,0 +1,48 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/mini-dynamo/mini-dynamo/internal/replication"
+	"github.com/mini-dynamo/mini-dynamo/pkg/types"
+)
+
+// SetBootstrapper reports a joining node's streaming progress in the
+// status endpoint
+func (s *Server) SetBootstrapper(b *replication.Bootstrapper) {
+	s.bootstrap = b
+}
+
+// servesReads reports whether this node holds its data and may answer
+// reads from other nodes
+func (s *Server) servesReads() bool {
+	if s.coordinator == nil {
+		return true
+	}
+	return s.coordinator.GetNodeRingState(s.config.NodeID).ServesReads()
+}
+
+// handleInternalStream returns a page of the entries this node holds in
+// the token ranges a joining node asks for
+func (s *Server) handleInternalStream(w http.ResponseWriter, r *http.Request) {
+	if s.coordinator == nil {
+		writeError(w, http.StatusServiceUnavailable, "no coordinator")
+		return
+	}
+	if !s.servesReads() {
+		writeError(w, http.StatusServiceUnavailable, "node is still bootstrapping")
+		return
+	}
+
+	var req types.StreamRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid request format")
+		return
+	}
+	defer r.Body.Close()
+
+	entries, next := s.coordinator.StreamRanges(req)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(types.StreamResponse{Entries: entries, Next: next})
+}
@@ -0,0 +1,206 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/gorilla/mux"
+	"github.com/mini-dynamo/mini-dynamo/internal/crdt"
+	"github.com/mini-dynamo/mini-dynamo/internal/replication"
+	"github.com/mini-dynamo/mini-dynamo/internal/storage"
+)
+
+// crdtRequest is the body of a CRDT update; fields are used per operation
+type crdtRequest struct {
+	Delta       *int64 `json:"delta,omitempty"`   // counter incr/decr (default 1)
+	Element     string `json:"element,omitempty"` // set add/remove
+	Field       string `json:"field,omitempty"`   // map set/delete
+	Value       string `json:"value,omitempty"`   // map set
+	Consistency string `json:"consistency,omitempty"`
+}
+
+type crdtResponse struct {
+	Key     string      `json:"key"`
+	Type    crdt.Type   `json:"type"`
+	Value   interface{} `json:"value"`
+	Version int64       `json:"version,omitempty"`
+}
+
+// handleCRDTGet returns the merged value of a CRDT key
+func (s *Server) handleCRDTGet(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	key := vars["key"]
+	t := crdt.Type(vars["type"])
+
+	if strings.HasPrefix(key, storage.SystemKeyPrefix) {
+		writeError(w, http.StatusBadRequest, "keys starting with "+storage.SystemKeyPrefix+" are reserved")
+		return
+	}
+	if s.coordinator == nil {
+		writeError(w, http.StatusServiceUnavailable, "CRDTs require a coordinator")
+		return
+	}
+	if _, err := crdt.New(t); err != nil {
+		writeError(w, http.StatusNotFound, err.Error())
+		return
+	}
+
+	opts, err := parseConsistencyOptions(r, "")
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	value, result, err := s.coordinator.GetCRDT(r.Context(), key, t, opts)
+	if err != nil {
+		writeCRDTError(w, err)
+		return
+	}
+
+	response := crdtResponse{Key: key, Type: t, Value: crdtValue(value)}
+	if result != nil {
+		response.Version = result.Timestamp
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
+
+// handleCRDTUpdate applies an operation to a CRDT key
+func (s *Server) handleCRDTUpdate(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	key := vars["key"]
+	t := crdt.Type(vars["type"])
+	op := vars["op"]
+
+	if strings.HasPrefix(key, storage.SystemKeyPrefix) {
+		writeError(w, http.StatusBadRequest, "keys starting with "+storage.SystemKeyPrefix+" are reserved")
+		return
+	}
+	if s.coordinator == nil {
+		writeError(w, http.StatusServiceUnavailable, "CRDTs require a coordinator")
+		return
+	}
+
+	var req crdtRequest
+	body, err := io.ReadAll(io.LimitReader(r.Body, 1024*1024))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "failed to read request body")
+		return
+	}
+	defer r.Body.Close()
+	if len(body) > 0 {
+		if err := json.Unmarshal(body, &req); err != nil {
+			writeError(w, http.StatusBadRequest, "invalid request format")
+			return
+		}
+	}
+
+	update, err := s.crdtOperation(t, op, req)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	opts, err := parseConsistencyOptions(r, req.Consistency)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	value, result, err := s.coordinator.UpdateCRDT(r.Context(), key, t, opts, update)
+	if result != nil {
+		writeAckHeaders(w, result.Acks, result.Required)
+	}
+	if err != nil {
+		writeCRDTError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(crdtResponse{
+		Key:     key,
+		Type:    t,
+		Value:   crdtValue(value),
+		Version: result.Timestamp,
+	})
+}
+
+// crdtOperation builds the update for an operation on a CRDT type
+func (s *Server) crdtOperation(t crdt.Type, op string, req crdtRequest) (func(crdt.CRDT) error, error) {
+	nodeID := s.config.NodeID
+
+	switch {
+	case t == crdt.TypeCounter && (op == "incr" || op == "decr"):
+		delta := int64(1)
+		if req.Delta != nil {
+			delta = *req.Delta
+		}
+		if op == "decr" {
+			delta = -delta
+		}
+		return func(c crdt.CRDT) error {
+			c.(*crdt.PNCounter).Increment(nodeID, delta)
+			return nil
+		}, nil
+
+	case t == crdt.TypeSet && (op == "add" || op == "remove"):
+		if req.Element == "" {
+			return nil, fmt.Errorf("element is required")
+		}
+		tag := fmt.Sprintf("%s:%d", nodeID, s.clock.Now())
+		return func(c crdt.CRDT) error {
+			if op == "add" {
+				c.(*crdt.ORSet).Add(req.Element, tag)
+			} else {
+				c.(*crdt.ORSet).Remove(req.Element)
+			}
+			return nil
+		}, nil
+
+	case t == crdt.TypeMap && (op == "set" || op == "delete"):
+		if req.Field == "" {
+			return nil, fmt.Errorf("field is required")
+		}
+		timestamp := s.clock.Now()
+		return func(c crdt.CRDT) error {
+			if op == "set" {
+				c.(*crdt.LWWMap).Set(req.Field, req.Value, timestamp)
+			} else {
+				c.(*crdt.LWWMap).Delete(req.Field, timestamp)
+			}
+			return nil
+		}, nil
+	}
+
+	return nil, fmt.Errorf("unsupported operation %q for %s", op, t)
+}
+
+// crdtValue returns the client-facing value of a CRDT
+func crdtValue(c crdt.CRDT) interface{} {
+	switch v := c.(type) {
+	case *crdt.PNCounter:
+		return v.Value()
+	case *crdt.ORSet:
+		return v.Elements()
+	case *crdt.LWWMap:
+		return v.Entries()
+	}
+	return nil
+}
+
+// writeCRDTError maps CRDT operation errors to HTTP responses
+func writeCRDTError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, crdt.ErrWrongType):
+		writeError(w, http.StatusConflict, err.Error())
+	case errors.Is(err, replication.ErrInvalidConsistency):
+		writeError(w, http.StatusBadRequest, err.Error())
+	default:
+		writeError(w, http.StatusInternalServerError, err.Error())
+	}
+}
@@ -0,0 +1,39 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/mini-dynamo/mini-dynamo/internal/replication"
+)
+
+// SetDecommissioner enables graceful decommission on this server
+func (s *Server) SetDecommissioner(d *replication.Decommissioner) {
+	s.decom = d
+}
+
+// handleDecommission starts handing this node's ranges to their new
+// owners. It answers 202 at once; progress is reported by /admin/status.
+func (s *Server) handleDecommission(w http.ResponseWriter, r *http.Request) {
+	if s.decom == nil {
+		writeError(w, http.StatusServiceUnavailable, "cluster mode not enabled")
+		return
+	}
+
+	if err := s.decom.Start(); err != nil {
+		if errors.Is(err, replication.ErrCannotDecommission) {
+			writeError(w, http.StatusConflict, err.Error())
+		} else {
+			writeError(w, http.StatusInternalServerError, err.Error())
+		}
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"status":  "decommissioning",
+		"node_id": s.config.NodeID,
+	})
+}
@@ -2,11 +2,20 @@ package api
 
 import (
 	"encoding/json"
+	"errors"
+	"fmt"
 	"io"
 	"net/http"
+	"sort"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/gorilla/mux"
+	"github.com/mini-dynamo/mini-dynamo/internal/gossip"
+	"github.com/mini-dynamo/mini-dynamo/internal/replication"
+	"github.com/mini-dynamo/mini-dynamo/internal/storage"
+	"github.com/mini-dynamo/mini-dynamo/internal/versioning"
 	"github.com/mini-dynamo/mini-dynamo/pkg/types"
 )
 
@@ -14,12 +23,16 @@ import (
 type putRequest struct {
 	Value       string `json:"value"`
 	Consistency string `json:"consistency,omitempty"`
+	N           int    `json:"n,omitempty"`
+	W           int    `json:"w,omitempty"`
 }
 
 type getResponse struct {
-	Key     string `json:"key"`
-	Value   string `json:"value"`
-	Version int64  `json:"version"`
+	Key      string `json:"key"`
+	Value    string `json:"value"`
+	Version  int64  `json:"version"`
+	Acks     int    `json:"acks,omitempty"`
+	Required int    `json:"required,omitempty"`
 }
 
 type errorResponse struct {
@@ -29,12 +42,18 @@ type errorResponse struct {
 }
 
 type statusResponse struct {
-	NodeID    string            `json:"node_id"`
-	Address   string            `json:"address"`
-	Uptime    string            `json:"uptime"`
-	Keys      int64             `json:"keys"`
-	Storage   storageStats      `json:"storage"`
-	Cluster   clusterInfo       `json:"cluster,omitempty"`
+	NodeID       string                       `json:"node_id"`
+	Address      string                       `json:"address"`
+	Uptime       string                       `json:"uptime"`
+	Keys         int64                        `json:"keys"`
+	Storage      storageStats                 `json:"storage"`
+	Cluster      clusterInfo                  `json:"cluster,omitempty"`
+	ReadRepair   *replication.ReadRepairStats `json:"read_repair,omitempty"`
+	RingState    types.RingState              `json:"ring_state,omitempty"`
+	Bootstrap    *replication.StreamStats     `json:"bootstrap,omitempty"`
+	Decommission *replication.StreamStats     `json:"decommission,omitempty"`
+	Ring         *replication.RingSyncStats   `json:"ring,omitempty"`
+	Detector     *gossip.DetectorStats        `json:"failure_detector,omitempty"`
 }
 
 type storageStats struct {
@@ -46,14 +65,28 @@ type storageStats struct {
 }
 
 type clusterInfo struct {
-	Size  int        `json:"size"`
-	Nodes []nodeInfo `json:"nodes"`
+	Size        int        `json:"size"`
+	Nodes       []nodeInfo `json:"nodes"`
+	HedgedReads uint64     `json:"hedged_reads"`
 }
 
 type nodeInfo struct {
-	ID      string `json:"id"`
-	Address string `json:"address"`
-	State   string `json:"state"`
+	ID         string          `json:"id"`
+	Address    string          `json:"address"`
+	State      string          `json:"state"`
+	Datacenter string          `json:"datacenter,omitempty"`
+	Rack       string          `json:"rack,omitempty"`
+	LatencyMs  float64         `json:"latency_ewma_ms"`
+	LatencyP95 float64         `json:"latency_p95_ms"`
+	RingState  types.RingState `json:"ring_state,omitempty"`
+}
+
+type ringNode struct {
+	ID         string  `json:"id"`
+	Datacenter string  `json:"datacenter,omitempty"`
+	Rack       string  `json:"rack,omitempty"`
+	Weight     float64 `json:"weight"`
+	VNodes     int     `json:"vnodes"`
 }
 
 // handleHealth returns the health status of the node
@@ -74,30 +107,55 @@ func (s *Server) handleGet(w http.ResponseWriter, r *http.Request) {
 		writeError(w, http.StatusBadRequest, "key is required")
 		return
 	}
-
-	// Get consistency level from query param
-	consistency := r.URL.Query().Get("consistency")
-	if consistency == "" {
-		consistency = "quorum"
+	if strings.HasPrefix(key, storage.SystemKeyPrefix) {
+		writeError(w, http.StatusBadRequest, "keys starting with "+storage.SystemKeyPrefix+" are reserved")
+		return
 	}
 
 	// If we have a coordinator, use distributed read
 	if s.coordinator != nil {
-		value, version, err := s.coordinator.Get(r.Context(), key, types.ConsistencyLevel(consistency))
+		opts, err := parseConsistencyOptions(r, "")
+		if err != nil {
+			writeError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		session, err := parseSessionToken(r)
 		if err != nil {
-			if err.Error() == "key not found" {
+			writeError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		opts.MinVersion = session.Versions[key]
+
+		result, err := s.coordinator.Get(r.Context(), key, opts)
+		if result != nil {
+			writeAckHeaders(w, result.Acks, result.Required)
+		}
+		if err != nil {
+			if errors.Is(err, replication.ErrNotFound) {
 				writeError(w, http.StatusNotFound, "key not found")
 				return
 			}
+			if errors.Is(err, replication.ErrInvalidConsistency) || errors.Is(err, replication.ErrInvalidSession) {
+				writeError(w, http.StatusBadRequest, err.Error())
+				return
+			}
+			if errors.Is(err, replication.ErrSessionUnavailable) {
+				writeError(w, http.StatusServiceUnavailable, err.Error())
+				return
+			}
 			writeError(w, http.StatusInternalServerError, err.Error())
 			return
 		}
 
+		writeSessionToken(w, session, key, result.Timestamp)
 		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("ETag", formatETag(result.Timestamp))
 		json.NewEncoder(w).Encode(getResponse{
-			Key:     key,
-			Value:   string(value),
-			Version: version,
+			Key:      key,
+			Value:    string(result.Value),
+			Version:  result.Timestamp,
+			Acks:     result.Acks,
+			Required: result.Required,
 		})
 		return
 	}
@@ -110,6 +168,7 @@ func (s *Server) handleGet(w http.ResponseWriter, r *http.Request) {
 	}
 
 	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("ETag", formatETag(timestamp))
 	json.NewEncoder(w).Encode(getResponse{
 		Key:     key,
 		Value:   string(value),
@@ -126,6 +185,10 @@ func (s *Server) handlePut(w http.ResponseWriter, r *http.Request) {
 		writeError(w, http.StatusBadRequest, "key is required")
 		return
 	}
+	if strings.HasPrefix(key, storage.SystemKeyPrefix) {
+		writeError(w, http.StatusBadRequest, "keys starting with "+storage.SystemKeyPrefix+" are reserved")
+		return
+	}
 
 	// Read body
 	body, err := io.ReadAll(io.LimitReader(r.Body, 10*1024*1024)) // 10MB limit
@@ -146,30 +209,72 @@ func (s *Server) handlePut(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	consistency := req.Consistency
-	if consistency == "" {
-		consistency = "quorum"
+	cond, conditional, err := parseCASCondition(r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if conditional && s.coordinator == nil {
+		writeError(w, http.StatusNotImplemented, "conditional writes require a coordinator")
+		return
 	}
 
 	// If we have a coordinator, use distributed write
 	if s.coordinator != nil {
-		err := s.coordinator.Put(r.Context(), key, []byte(req.Value), types.ConsistencyLevel(consistency))
+		opts, err := parseConsistencyOptions(r, req.Consistency)
 		if err != nil {
-			writeError(w, http.StatusInternalServerError, err.Error())
+			writeError(w, http.StatusBadRequest, err.Error())
 			return
 		}
+		if opts.N == 0 {
+			opts.N = req.N
+		}
+		if opts.W == 0 {
+			opts.W = req.W
+		}
+		session, err := parseSessionToken(r)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		opts.MinVersion = session.Versions[key]
 
+		if conditional {
+			s.handleConditionalPut(w, r, key, []byte(req.Value), cond, opts, session)
+			return
+		}
+
+		result, err := s.coordinator.Put(r.Context(), key, []byte(req.Value), opts)
+		if result != nil {
+			writeAckHeaders(w, result.Acks, result.Required)
+		}
+		if err != nil {
+			switch {
+			case errors.Is(err, replication.ErrInvalidConsistency), errors.Is(err, replication.ErrInvalidSession):
+				writeError(w, http.StatusBadRequest, err.Error())
+			case errors.Is(err, replication.ErrTxnConflict):
+				writeError(w, http.StatusConflict, err.Error())
+			default:
+				writeError(w, http.StatusInternalServerError, err.Error())
+			}
+			return
+		}
+
+		writeSessionToken(w, session, key, result.Timestamp)
 		w.Header().Set("Content-Type", "application/json")
 		w.WriteHeader(http.StatusOK)
 		json.NewEncoder(w).Encode(map[string]interface{}{
-			"status": "ok",
-			"key":    key,
+			"status":   "ok",
+			"key":      key,
+			"version":  result.Timestamp,
+			"acks":     result.Acks,
+			"required": result.Required,
 		})
 		return
 	}
 
 	// Fallback to local storage
-	timestamp := time.Now().UnixNano()
+	timestamp := s.clock.Now()
 	if err := s.storage.Put(key, []byte(req.Value), timestamp); err != nil {
 		writeError(w, http.StatusInternalServerError, err.Error())
 		return
@@ -184,6 +289,49 @@ func (s *Server) handlePut(w http.ResponseWriter, r *http.Request) {
 	})
 }
 
+// handleConditionalPut performs a compare-and-set write, answering 412
+// with the current version when the condition does not hold
+func (s *Server) handleConditionalPut(w http.ResponseWriter, r *http.Request, key string, value []byte, cond types.CASCondition, opts types.ConsistencyOptions, session sessionToken) {
+	result, err := s.coordinator.CompareAndSet(r.Context(), key, value, cond, opts)
+	if err != nil {
+		switch {
+		case errors.Is(err, replication.ErrConditionFailed):
+			response := map[string]interface{}{
+				"error":   http.StatusText(http.StatusPreconditionFailed),
+				"code":    http.StatusPreconditionFailed,
+				"message": err.Error(),
+				"key":     key,
+			}
+			if current := result.Current; current != nil && !current.IsDeleted {
+				w.Header().Set("ETag", formatETag(current.Timestamp))
+				response["current_version"] = current.Timestamp
+			}
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusPreconditionFailed)
+			json.NewEncoder(w).Encode(response)
+		case errors.Is(err, replication.ErrInvalidConsistency):
+			writeError(w, http.StatusBadRequest, err.Error())
+		case errors.Is(err, replication.ErrCASContention):
+			writeError(w, http.StatusServiceUnavailable, err.Error())
+		case errors.Is(err, replication.ErrTxnConflict), errors.Is(err, versioning.ErrClockSkew):
+			writeError(w, http.StatusConflict, err.Error())
+		default:
+			writeError(w, http.StatusInternalServerError, err.Error())
+		}
+		return
+	}
+
+	writeSessionToken(w, session, key, result.Timestamp)
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("ETag", formatETag(result.Timestamp))
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"status":  "ok",
+		"key":     key,
+		"version": result.Timestamp,
+		"applied": true,
+	})
+}
+
 // handleDelete removes a key
 func (s *Server) handleDelete(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
@@ -193,8 +341,55 @@ func (s *Server) handleDelete(w http.ResponseWriter, r *http.Request) {
 		writeError(w, http.StatusBadRequest, "key is required")
 		return
 	}
+	if strings.HasPrefix(key, storage.SystemKeyPrefix) {
+		writeError(w, http.StatusBadRequest, "keys starting with "+storage.SystemKeyPrefix+" are reserved")
+		return
+	}
 
-	timestamp := time.Now().UnixNano()
+	// If we have a coordinator, replicate a tombstone like any other write
+	if s.coordinator != nil {
+		opts, err := parseConsistencyOptions(r, "")
+		if err != nil {
+			writeError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		session, err := parseSessionToken(r)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		opts.MinVersion = session.Versions[key]
+
+		result, err := s.coordinator.Delete(r.Context(), key, opts)
+		if result != nil {
+			writeAckHeaders(w, result.Acks, result.Required)
+		}
+		if err != nil {
+			switch {
+			case errors.Is(err, replication.ErrInvalidConsistency), errors.Is(err, replication.ErrInvalidSession):
+				writeError(w, http.StatusBadRequest, err.Error())
+			case errors.Is(err, replication.ErrTxnConflict):
+				writeError(w, http.StatusConflict, err.Error())
+			default:
+				writeError(w, http.StatusInternalServerError, err.Error())
+			}
+			return
+		}
+
+		writeSessionToken(w, session, key, result.Timestamp)
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"status":   "ok",
+			"key":      key,
+			"version":  result.Timestamp,
+			"acks":     result.Acks,
+			"required": result.Required,
+		})
+		return
+	}
+
+	// Fallback to local storage
+	timestamp := s.clock.Now()
 	if err := s.storage.Delete(key, timestamp); err != nil {
 		writeError(w, http.StatusInternalServerError, err.Error())
 		return
@@ -228,19 +423,43 @@ func (s *Server) handleStatus(w http.ResponseWriter, r *http.Request) {
 	// Add cluster info if coordinator is available
 	if s.coordinator != nil {
 		nodes := s.coordinator.GetClusterNodes()
+		latency := s.coordinator.GetLatencyStats()
 		clusterNodes := make([]nodeInfo, len(nodes))
 		for i, n := range nodes {
 			clusterNodes[i] = nodeInfo{
-				ID:      n.ID,
-				Address: n.Address,
-				State:   n.State.String(),
+				ID:         n.ID,
+				Address:    n.Address,
+				State:      n.State.String(),
+				Datacenter: n.Datacenter,
+				Rack:       n.Rack,
+				LatencyMs:  durationMs(latency[n.ID].EWMA),
+				LatencyP95: durationMs(latency[n.ID].P95),
+				RingState:  n.RingState,
 			}
 		}
 		response.Cluster = clusterInfo{
-			Size:  len(nodes),
-			Nodes: clusterNodes,
+			Size:        len(nodes),
+			Nodes:       clusterNodes,
+			HedgedReads: s.coordinator.GetHedgeCount(),
+		}
+		response.ReadRepair = s.coordinator.GetReadRepairStats()
+		response.RingState = s.coordinator.GetNodeRingState(s.config.NodeID)
+		ringStats := s.coordinator.GetRingSyncStats()
+		response.Ring = &ringStats
+	}
+	if s.bootstrap != nil {
+		stats := s.bootstrap.Stats()
+		response.Bootstrap = &stats
+	}
+	if s.decom != nil {
+		if stats := s.decom.Stats(); stats.State != "" {
+			response.Decommission = &stats
 		}
 	}
+	if s.detector != nil {
+		stats := s.detector.Stats()
+		response.Detector = &stats
+	}
 
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(response)
@@ -255,16 +474,161 @@ func (s *Server) handleRing(w http.ResponseWriter, r *http.Request) {
 
 	tokens := s.coordinator.GetRingTokens()
 
+	// Summarize each physical node's placement
+	vnodeCounts := make(map[string]int)
+	for _, t := range tokens {
+		vnodeCounts[t.NodeID]++
+	}
+	nodes := make([]ringNode, 0, len(vnodeCounts))
+	for nodeID, count := range vnodeCounts {
+		topo := s.coordinator.GetNodeTopology(nodeID)
+		nodes = append(nodes, ringNode{
+			ID:         nodeID,
+			Datacenter: topo.Datacenter,
+			Rack:       topo.Rack,
+			Weight:     s.coordinator.GetNodeWeight(nodeID),
+			VNodes:     count,
+		})
+	}
+	sort.Slice(nodes, func(i, j int) bool { return nodes[i].ID < nodes[j].ID })
+
+	response := map[string]interface{}{
+		"epoch":       s.coordinator.RingVersion().Epoch,
+		"partitioner": s.coordinator.GetPartitioner(),
+		"tokens":      tokens,
+		"count":       len(tokens),
+		"nodes":       nodes,
+	}
+
+	// Show where a specific key's replicas are placed
+	if key := r.URL.Query().Get("key"); key != "" {
+		preferenceList, err := s.coordinator.GetPreferenceList(key)
+		if err != nil {
+			writeError(w, http.StatusServiceUnavailable, err.Error())
+			return
+		}
+		placement := make([]ringNode, len(preferenceList))
+		for i, nodeID := range preferenceList {
+			topo := s.coordinator.GetNodeTopology(nodeID)
+			placement[i] = ringNode{
+				ID:         nodeID,
+				Datacenter: topo.Datacenter,
+				Rack:       topo.Rack,
+				Weight:     s.coordinator.GetNodeWeight(nodeID),
+				VNodes:     vnodeCounts[nodeID],
+			}
+		}
+		response["key"] = key
+		response["token"] = s.coordinator.GetKeyToken(key)
+		response["preference_list"] = placement
+	}
+
+	// Show which ranges hold a range of keys, for the ordered partitioner
+	if start, end := r.URL.Query().Get("start"), r.URL.Query().Get("end"); start != "" || end != "" {
+		ranges, err := s.coordinator.GetScanRanges(start, end)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		response["scan_ranges"] = ranges
+	}
+
 	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(map[string]interface{}{
-		"tokens": tokens,
-		"count":  len(tokens),
-	})
+	json.NewEncoder(w).Encode(response)
+}
+
+// handleRingDiff shows the ranges each node gains and loses in a ring
+// change. With add, remove or weight (node:weight) parameters it previews
+// that change without applying it; otherwise it returns the last change
+// applied to the local ring.
+func (s *Server) handleRingDiff(w http.ResponseWriter, r *http.Request) {
+	if s.coordinator == nil {
+		writeError(w, http.StatusServiceUnavailable, "cluster mode not enabled")
+		return
+	}
+
+	change, err := parseRingChange(r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if change == nil {
+		last := s.coordinator.LastRingChange()
+		if last == nil {
+			writeError(w, http.StatusNotFound, "no ring change since startup")
+			return
+		}
+		json.NewEncoder(w).Encode(last)
+		return
+	}
+
+	diff, err := s.coordinator.PreviewRingChange(*change)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	json.NewEncoder(w).Encode(diff)
+}
+
+// parseRingChange reads the add, remove and weight query parameters, which
+// may be repeated or comma-separated. It returns nil if none are given.
+func parseRingChange(r *http.Request) (*replication.RingChange, error) {
+	query := r.URL.Query()
+	list := func(name string) []string {
+		var values []string
+		for _, v := range query[name] {
+			for _, item := range strings.Split(v, ",") {
+				if item = strings.TrimSpace(item); item != "" {
+					values = append(values, item)
+				}
+			}
+		}
+		return values
+	}
+
+	change := &replication.RingChange{Add: list("add"), Remove: list("remove")}
+	for _, v := range list("weight") {
+		i := strings.LastIndex(v, ":")
+		if i <= 0 {
+			return nil, fmt.Errorf("invalid weight %q, expected node:weight", v)
+		}
+		weight, err := strconv.ParseFloat(v[i+1:], 64)
+		if err != nil || weight <= 0 {
+			return nil, fmt.Errorf("invalid weight %q, expected node:weight", v)
+		}
+		if change.Weights == nil {
+			change.Weights = make(map[string]float64)
+		}
+		change.Weights[v[:i]] = weight
+	}
+
+	if len(change.Add) == 0 && len(change.Remove) == 0 && len(change.Weights) == 0 {
+		return nil, nil
+	}
+	return change, nil
+}
+
+// handleInternalRing returns this node's ring for a peer with an older one
+func (s *Server) handleInternalRing(w http.ResponseWriter, r *http.Request) {
+	if s.coordinator == nil {
+		writeError(w, http.StatusServiceUnavailable, "no coordinator")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(s.coordinator.RingSnapshot())
 }
 
 // handleKeys returns all keys (for debugging)
 func (s *Server) handleKeys(w http.ResponseWriter, r *http.Request) {
-	keys := s.storage.Keys()
+	keys := make([]string, 0)
+	for _, key := range s.storage.Keys() {
+		if !strings.HasPrefix(key, storage.SystemKeyPrefix) {
+			keys = append(keys, key)
+		}
+	}
 
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(map[string]interface{}{
@@ -296,8 +660,47 @@ func (s *Server) handleReplication(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Store locally
-	if req.Entry.IsDeleted {
+	// Store locally, keeping the newer version on conflict
+	var version types.RingVersion
+	var superseded bool
+	if s.coordinator != nil {
+		s.coordinator.ObserveRingEpoch(req.RingEpoch, req.RingChecksum, req.FromNode)
+		version = s.coordinator.RingVersion()
+		if err := s.coordinator.ObserveTimestamp(req.Entry.Timestamp, req.FromNode); err != nil {
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusConflict)
+			json.NewEncoder(w).Encode(types.ReplicationResponse{
+				Success:      false,
+				Message:      err.Error(),
+				RingEpoch:    version.Epoch,
+				RingChecksum: version.Checksum,
+			})
+			return
+		}
+		if req.ClientWrite {
+			err = s.coordinator.ApplyClientWrite([]types.KeyValueEntry{req.Entry})
+		} else {
+			var applied bool
+			applied, err = s.coordinator.ApplyEntry(req.Entry)
+			superseded = err == nil && !applied && s.coordinator.Supersedes(req.Entry)
+		}
+		if errors.Is(err, replication.ErrTxnConflict) {
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusConflict)
+			json.NewEncoder(w).Encode(types.ReplicationResponse{
+				Success:      false,
+				Message:      err.Error(),
+				RingEpoch:    version.Epoch,
+				RingChecksum: version.Checksum,
+				Locked:       true,
+			})
+			return
+		}
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+	} else if req.Entry.IsDeleted {
 		if err := s.storage.Delete(req.Entry.Key, req.Entry.Timestamp); err != nil {
 			writeError(w, http.StatusInternalServerError, err.Error())
 			return
@@ -311,10 +714,39 @@ func (s *Server) handleReplication(w http.ResponseWriter, r *http.Request) {
 
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(types.ReplicationResponse{
-		Success: true,
+		Success:      true,
+		RingEpoch:    version.Epoch,
+		RingChecksum: version.Checksum,
+		Superseded:   superseded,
 	})
 }
 
+// handlePaxos returns a handler for one phase of the internal Paxos protocol
+func (s *Server) handlePaxos(phase string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if s.coordinator == nil {
+			writeError(w, http.StatusServiceUnavailable, "no coordinator")
+			return
+		}
+
+		var req types.PaxosRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			writeError(w, http.StatusBadRequest, "invalid request format")
+			return
+		}
+		defer r.Body.Close()
+
+		resp, err := s.coordinator.HandlePaxos(phase, req)
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(resp)
+	}
+}
+
 // handleInternalRead handles internal read requests from other nodes
 func (s *Server) handleInternalRead(w http.ResponseWriter, r *http.Request) {
 	key := r.URL.Query().Get("key")
@@ -322,19 +754,127 @@ func (s *Server) handleInternalRead(w http.ResponseWriter, r *http.Request) {
 		writeError(w, http.StatusBadRequest, "key is required")
 		return
 	}
+	if !s.servesReads() {
+		writeError(w, http.StatusServiceUnavailable, "node is still bootstrapping")
+		return
+	}
 
+	// Tombstones are answered too, so a read can tell a deleted key from
+	// one the replica never held
+	entry := types.KeyValueEntry{Key: key}
 	value, timestamp, err := s.storage.Get(key)
-	if err != nil {
+	switch {
+	case err == nil:
+		entry.Value, entry.Timestamp = value, timestamp
+	case errors.Is(err, storage.ErrKeyDeleted):
+		timestamp, exists := s.storage.Timestamp(key)
+		if !exists {
+			writeError(w, http.StatusNotFound, "key not found")
+			return
+		}
+		entry.Timestamp, entry.IsDeleted = timestamp, true
+	default:
 		writeError(w, http.StatusNotFound, "key not found")
 		return
 	}
 
 	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(types.KeyValueEntry{
-		Key:       key,
-		Value:     value,
-		Timestamp: timestamp,
-	})
+	json.NewEncoder(w).Encode(entry)
+}
+
+// parseConsistencyOptions reads per-request replication settings from the
+// query string, falling back to headers and then to the body's level.
+// Supported: consistency / X-Consistency, n / X-Replicas,
+// r / X-Read-Quorum and w / X-Write-Quorum.
+func parseConsistencyOptions(r *http.Request, bodyLevel string) (types.ConsistencyOptions, error) {
+	var opts types.ConsistencyOptions
+
+	param := func(query, header string) string {
+		if v := r.URL.Query().Get(query); v != "" {
+			return v
+		}
+		return r.Header.Get(header)
+	}
+
+	levelStr := param("consistency", "X-Consistency")
+	if levelStr == "" {
+		levelStr = bodyLevel
+	}
+	level, err := types.ParseConsistencyLevel(levelStr)
+	if err != nil {
+		return opts, err
+	}
+	opts.Level = level
+
+	counts := []struct {
+		query, header string
+		dst           *int
+	}{
+		{"n", "X-Replicas", &opts.N},
+		{"r", "X-Read-Quorum", &opts.R},
+		{"w", "X-Write-Quorum", &opts.W},
+	}
+	for _, c := range counts {
+		v := param(c.query, c.header)
+		if v == "" {
+			continue
+		}
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 {
+			return opts, fmt.Errorf("invalid %s value %q", c.query, v)
+		}
+		*c.dst = n
+	}
+
+	return opts, nil
+}
+
+// parseCASCondition reads the If-Match and If-None-Match headers of a
+// write. If-None-Match only supports "*"; If-Match takes "*" or a single
+// version as returned in the ETag header.
+func parseCASCondition(r *http.Request) (types.CASCondition, bool, error) {
+	var cond types.CASCondition
+
+	ifMatch := strings.TrimSpace(r.Header.Get("If-Match"))
+	ifNoneMatch := strings.TrimSpace(r.Header.Get("If-None-Match"))
+	if ifMatch == "" && ifNoneMatch == "" {
+		return cond, false, nil
+	}
+
+	if ifNoneMatch != "" {
+		if ifNoneMatch != "*" {
+			return cond, false, fmt.Errorf("If-None-Match only supports *")
+		}
+		cond.IfNoneMatch = true
+	}
+
+	if ifMatch == "*" {
+		cond.IfExists = true
+	} else if ifMatch != "" {
+		version, err := strconv.ParseInt(strings.Trim(strings.TrimPrefix(ifMatch, "W/"), `"`), 10, 64)
+		if err != nil || version <= 0 {
+			return cond, false, fmt.Errorf("invalid If-Match version: %s", ifMatch)
+		}
+		cond.IfVersion = version
+	}
+
+	return cond, true, nil
+}
+
+// formatETag formats a version as an entity tag
+func formatETag(version int64) string {
+	return `"` + strconv.FormatInt(version, 10) + `"`
+}
+
+// writeAckHeaders reports the acks achieved by a coordinated operation
+func writeAckHeaders(w http.ResponseWriter, acks, required int) {
+	w.Header().Set("X-Consistency-Acks", strconv.Itoa(acks))
+	w.Header().Set("X-Consistency-Required", strconv.Itoa(required))
+}
+
+// durationMs converts a duration to fractional milliseconds
+func durationMs(d time.Duration) float64 {
+	return float64(d) / float64(time.Millisecond)
 }
 
 // writeError writes a JSON error response
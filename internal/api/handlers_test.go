@@ -0,0 +1,92 @@
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/mini-dynamo/mini-dynamo/internal/config"
+	"github.com/mini-dynamo/mini-dynamo/internal/storage"
+	"github.com/mini-dynamo/mini-dynamo/pkg/types"
+)
+
+func TestParseConsistencyOptions(t *testing.T) {
+	tests := []struct {
+		name      string
+		query     string
+		headers   map[string]string
+		bodyLevel string
+		want      types.ConsistencyOptions
+		wantErr   bool
+	}{
+		{name: "defaults", want: types.ConsistencyOptions{Level: types.ConsistencyQuorum}},
+		{name: "body level", bodyLevel: "one", want: types.ConsistencyOptions{Level: types.ConsistencyOne}},
+		{
+			name:      "query over header and body",
+			query:     "?consistency=all",
+			headers:   map[string]string{"X-Consistency": "one"},
+			bodyLevel: "two",
+			want:      types.ConsistencyOptions{Level: types.ConsistencyAll},
+		},
+		{
+			name:    "header over body",
+			headers: map[string]string{"X-Consistency": "3"},
+			want:    types.ConsistencyOptions{Level: "3"},
+		},
+		{
+			name:  "counts from query",
+			query: "?n=3&r=1&w=2",
+			want:  types.ConsistencyOptions{Level: types.ConsistencyQuorum, N: 3, R: 1, W: 2},
+		},
+		{
+			name:    "counts from headers",
+			query:   "?r=2",
+			headers: map[string]string{"X-Replicas": "2", "X-Read-Quorum": "1", "X-Write-Quorum": "2"},
+			want:    types.ConsistencyOptions{Level: types.ConsistencyQuorum, N: 2, R: 2, W: 2},
+		},
+		{name: "unknown level", query: "?consistency=most", wantErr: true},
+		{name: "zero count", query: "?w=0", wantErr: true},
+		{name: "non-numeric count", headers: map[string]string{"X-Replicas": "all"}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest("GET", "/kv/k"+tt.query, nil)
+			for k, v := range tt.headers {
+				r.Header.Set(k, v)
+			}
+
+			opts, err := parseConsistencyOptions(r, tt.bodyLevel)
+			if tt.wantErr {
+				if err == nil {
+					t.Errorf("Expected an error, got %+v", opts)
+				}
+				return
+			}
+			if err != nil || opts != tt.want {
+				t.Errorf("Expected %+v, got %+v (%v)", tt.want, opts, err)
+			}
+		})
+	}
+}
+
+func TestLocalBatchRejectsReservedKeys(t *testing.T) {
+	store, err := storage.NewBitcask(t.TempDir(), false)
+	if err != nil {
+		t.Fatalf("Failed to create storage: %v", err)
+	}
+	t.Cleanup(func() { store.Close() })
+	s := NewServer(config.DefaultConfig(), store, nil)
+
+	body := `{"operations": [{"op": "put", "key": "a", "value": "1"}, {"op": "delete", "key": "` + storage.SystemKeyPrefix + `bootstrap"}]}`
+	w := httptest.NewRecorder()
+	s.router.ServeHTTP(w, httptest.NewRequest("POST", "/batch", strings.NewReader(body)))
+
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("Expected 400 for a reserved key, got %d", w.Code)
+	}
+	if store.Has("a") {
+		t.Error("Expected nothing in a rejected batch to be written")
+	}
+}
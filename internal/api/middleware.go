@@ -59,7 +59,8 @@ func corsMiddleware(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		w.Header().Set("Access-Control-Allow-Origin", "*")
 		w.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, DELETE, OPTIONS")
-		w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization")
+		w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization, If-Match, If-None-Match, X-Session-Token")
+		w.Header().Set("Access-Control-Expose-Headers", "ETag, X-Session-Token")
 
 		if r.Method == "OPTIONS" {
 			w.WriteHeader(http.StatusOK)
@@ -0,0 +1,205 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/mini-dynamo/mini-dynamo/internal/replication"
+	"github.com/mini-dynamo/mini-dynamo/internal/ring"
+	"github.com/mini-dynamo/mini-dynamo/pkg/types"
+)
+
+// SetRebalancer enables load-aware rebalancing on this server
+func (s *Server) SetRebalancer(rb *replication.Rebalancer) {
+	s.rebalance = rb
+}
+
+// handleRebalancePlan previews the token moves a rebalance would make.
+// The threshold and max_moves query parameters override the config.
+func (s *Server) handleRebalancePlan(w http.ResponseWriter, r *http.Request) {
+	plan, ok := s.planRebalance(w, r)
+	if !ok {
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(plan)
+}
+
+// handleRebalanceStart plans a rebalance and executes it in the
+// background. It answers 202 with the plan; progress is reported by
+// GET /admin/rebalance.
+func (s *Server) handleRebalanceStart(w http.ResponseWriter, r *http.Request) {
+	plan, ok := s.planRebalance(w, r)
+	if !ok {
+		return
+	}
+
+	if err := s.rebalance.Start(plan); err != nil {
+		if errors.Is(err, replication.ErrRebalanceInProgress) {
+			writeError(w, http.StatusConflict, err.Error())
+		} else {
+			writeError(w, http.StatusInternalServerError, err.Error())
+		}
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(plan)
+}
+
+// handleRebalanceStatus returns the progress of the latest rebalance
+func (s *Server) handleRebalanceStatus(w http.ResponseWriter, r *http.Request) {
+	if s.rebalance == nil {
+		writeError(w, http.StatusServiceUnavailable, "cluster mode not enabled")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(s.rebalance.Status())
+}
+
+// planRebalance builds a plan for the request, writing the error response
+// and returning false if it cannot
+func (s *Server) planRebalance(w http.ResponseWriter, r *http.Request) (*ring.RebalancePlan, bool) {
+	if s.rebalance == nil {
+		writeError(w, http.StatusServiceUnavailable, "cluster mode not enabled")
+		return nil, false
+	}
+
+	opts, err := parseRebalanceOptions(r, s.config.RebalanceThreshold, s.config.RebalanceMaxMoves)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return nil, false
+	}
+
+	plan, err := s.rebalance.Plan(r.Context(), opts)
+	if err != nil {
+		writeError(w, http.StatusBadGateway, err.Error())
+		return nil, false
+	}
+	return plan, true
+}
+
+// parseRebalanceOptions reads the threshold and max_moves query
+// parameters, falling back to the given defaults
+func parseRebalanceOptions(r *http.Request, threshold float64, maxMoves int) (ring.RebalanceOptions, error) {
+	opts := ring.RebalanceOptions{Threshold: threshold, MaxMoves: maxMoves}
+
+	if v := r.URL.Query().Get("threshold"); v != "" {
+		t, err := strconv.ParseFloat(v, 64)
+		if err != nil || t < 0 {
+			return opts, fmt.Errorf("invalid threshold value %q", v)
+		}
+		opts.Threshold = t
+	}
+	if v := r.URL.Query().Get("max_moves"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 {
+			return opts, fmt.Errorf("invalid max_moves value %q", v)
+		}
+		opts.MaxMoves = n
+	}
+	return opts, nil
+}
+
+// handleWeight changes this node's weight, moving the ranges it gains or
+// gives up before the new weight takes effect
+func (s *Server) handleWeight(w http.ResponseWriter, r *http.Request) {
+	if s.rebalance == nil {
+		writeError(w, http.StatusServiceUnavailable, "cluster mode not enabled")
+		return
+	}
+
+	var req struct {
+		Weight float64 `json:"weight"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid request format")
+		return
+	}
+	defer r.Body.Close()
+	if req.Weight <= 0 {
+		writeError(w, http.StatusBadRequest, "weight must be positive")
+		return
+	}
+
+	change, err := s.rebalance.ChangeWeight(r.Context(), req.Weight)
+	if err != nil {
+		writeError(w, http.StatusBadGateway, err.Error())
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(change)
+}
+
+// handleInternalWeight applies another node's new weight to the ring, at
+// the tokens it announced
+func (s *Server) handleInternalWeight(w http.ResponseWriter, r *http.Request) {
+	if s.coordinator == nil {
+		writeError(w, http.StatusServiceUnavailable, "no coordinator")
+		return
+	}
+
+	var req types.WeightChangeRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid request format")
+		return
+	}
+	defer r.Body.Close()
+	if req.Weight <= 0 {
+		writeError(w, http.StatusBadRequest, "weight must be positive")
+		return
+	}
+
+	s.coordinator.SetNodeWeight(req.NodeID, req.Weight, req.Tokens)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"status": "ok",
+		"weight": req.Weight,
+	})
+}
+
+// handleInternalLoad reports this node's load to a node planning a
+// rebalance
+func (s *Server) handleInternalLoad(w http.ResponseWriter, r *http.Request) {
+	if s.coordinator == nil {
+		writeError(w, http.StatusServiceUnavailable, "no coordinator")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(s.coordinator.LocalLoad())
+}
+
+// handleInternalReassign applies a token move made by a rebalancing node
+func (s *Server) handleInternalReassign(w http.ResponseWriter, r *http.Request) {
+	if s.coordinator == nil {
+		writeError(w, http.StatusServiceUnavailable, "no coordinator")
+		return
+	}
+
+	var req types.TokenReassignRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid request format")
+		return
+	}
+	defer r.Body.Close()
+
+	if err := s.coordinator.ReassignToken(req.Token, req.NodeID); err != nil {
+		writeError(w, http.StatusConflict, err.Error())
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"status": "ok",
+		"token":  req.Token,
+	})
+}
@@ -0,0 +1,36 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/mini-dynamo/mini-dynamo/internal/replication"
+)
+
+// SetRereplicationManager reports re-replication of dead nodes' ranges in
+// the admin API
+func (s *Server) SetRereplicationManager(m *replication.RereplicationManager) {
+	s.rerepl = m
+}
+
+// handleRereplication returns the progress of every range this node took
+// over from a dead node
+func (s *Server) handleRereplication(w http.ResponseWriter, r *http.Request) {
+	if s.rerepl == nil {
+		writeError(w, http.StatusServiceUnavailable, "cluster mode not enabled")
+		return
+	}
+
+	ranges := s.rerepl.Status()
+	counts := make(map[replication.RangeRepairStatus]int)
+	for _, repair := range ranges {
+		counts[repair.Status]++
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"delay":  s.config.RereplicationDelay.String(),
+		"counts": counts,
+		"ranges": ranges,
+	})
+}
@@ -9,8 +9,10 @@ import (
 
 	"github.com/gorilla/mux"
 	"github.com/mini-dynamo/mini-dynamo/internal/config"
+	"github.com/mini-dynamo/mini-dynamo/internal/gossip"
 	"github.com/mini-dynamo/mini-dynamo/internal/replication"
 	"github.com/mini-dynamo/mini-dynamo/internal/storage"
+	"github.com/mini-dynamo/mini-dynamo/internal/versioning"
 )
 
 // Server represents the HTTP API server
@@ -20,6 +22,13 @@ type Server struct {
 	httpServer  *http.Server
 	storage     storage.Engine
 	coordinator *replication.Coordinator
+	txns        *replication.TxnCoordinator
+	bootstrap   *replication.Bootstrapper
+	decom       *replication.Decommissioner
+	rerepl      *replication.RereplicationManager
+	rebalance   *replication.Rebalancer
+	detector    *gossip.FailureDetector
+	clock       *versioning.HLC
 	startTime   time.Time
 }
 
@@ -33,10 +42,24 @@ func NewServer(cfg *config.Config, store storage.Engine, coord *replication.Coor
 		startTime:   time.Now(),
 	}
 
+	// Share the coordinator's clock so local and replicated writes are ordered
+	if coord != nil {
+		s.clock = coord.Clock()
+	} else {
+		s.clock = versioning.NewHLC(cfg.MaxClockSkew)
+		s.clock.Restore(store.MaxTimestamp())
+	}
+
 	s.setupRoutes()
 	return s
 }
 
+// SetFailureDetector reports how members are suspected, and their phi
+// with the phi accrual detector, in the status endpoint
+func (s *Server) SetFailureDetector(fd *gossip.FailureDetector) {
+	s.detector = fd
+}
+
 // setupRoutes configures all HTTP routes
 func (s *Server) setupRoutes() {
 	// Middleware
@@ -51,16 +74,41 @@ func (s *Server) setupRoutes() {
 	s.router.HandleFunc("/kv/{key}", s.handleGet).Methods("GET")
 	s.router.HandleFunc("/kv/{key}", s.handlePut).Methods("PUT", "POST")
 	s.router.HandleFunc("/kv/{key}", s.handleDelete).Methods("DELETE")
+	s.router.HandleFunc("/batch", s.handleBatch).Methods("POST")
+	s.router.HandleFunc("/txn", s.handleTxn).Methods("POST")
+
+	// CRDT operations
+	s.router.HandleFunc("/crdt/{type}/{key}", s.handleCRDTGet).Methods("GET")
+	s.router.HandleFunc("/crdt/{type}/{key}/{op}", s.handleCRDTUpdate).Methods("POST")
 
 	// Admin endpoints
 	s.router.HandleFunc("/admin/status", s.handleStatus).Methods("GET")
 	s.router.HandleFunc("/admin/ring", s.handleRing).Methods("GET")
+	s.router.HandleFunc("/admin/ring/diff", s.handleRingDiff).Methods("GET")
 	s.router.HandleFunc("/admin/keys", s.handleKeys).Methods("GET")
 	s.router.HandleFunc("/admin/stats", s.handleStats).Methods("GET")
+	s.router.HandleFunc("/admin/decommission", s.handleDecommission).Methods("POST")
+	s.router.HandleFunc("/admin/rereplication", s.handleRereplication).Methods("GET")
+	s.router.HandleFunc("/admin/rebalance/plan", s.handleRebalancePlan).Methods("GET")
+	s.router.HandleFunc("/admin/rebalance", s.handleRebalanceStart).Methods("POST")
+	s.router.HandleFunc("/admin/rebalance", s.handleRebalanceStatus).Methods("GET")
+	s.router.HandleFunc("/admin/weight", s.handleWeight).Methods("PUT")
 
 	// Internal replication endpoints
 	s.router.HandleFunc("/internal/replicate", s.handleReplication).Methods("POST")
+	s.router.HandleFunc("/internal/batch", s.handleInternalBatch).Methods("POST")
+	s.router.HandleFunc("/internal/txn/prepare", s.handleTxnPrepare).Methods("POST")
+	s.router.HandleFunc("/internal/txn/decide", s.handleTxnDecide).Methods("POST")
+	s.router.HandleFunc("/internal/txn/status", s.handleTxnStatus).Methods("POST")
 	s.router.HandleFunc("/internal/read", s.handleInternalRead).Methods("GET")
+	s.router.HandleFunc("/internal/stream", s.handleInternalStream).Methods("POST")
+	s.router.HandleFunc("/internal/load", s.handleInternalLoad).Methods("GET")
+	s.router.HandleFunc("/internal/ring", s.handleInternalRing).Methods("GET")
+	s.router.HandleFunc("/internal/ring/reassign", s.handleInternalReassign).Methods("POST")
+	s.router.HandleFunc("/internal/ring/weight", s.handleInternalWeight).Methods("POST")
+	s.router.HandleFunc("/internal/paxos/prepare", s.handlePaxos("prepare")).Methods("POST")
+	s.router.HandleFunc("/internal/paxos/propose", s.handlePaxos("propose")).Methods("POST")
+	s.router.HandleFunc("/internal/paxos/commit", s.handlePaxos("commit")).Methods("POST")
 }
 
 // Start starts the HTTP server
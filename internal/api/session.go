@@ -0,0 +1,78 @@
+package api
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+)
+
+// sessionHeader carries the session token on requests and responses
+const sessionHeader = "X-Session-Token"
+
+// maxSessionKeys bounds the keys remembered by a session token; the keys
+// with the oldest versions are forgotten first
+const maxSessionKeys = 64
+
+// sessionToken records the newest version of each key a client session has
+// read or written. It is opaque to clients, who pass it back unchanged to
+// get read-your-writes and monotonic reads from any node.
+type sessionToken struct {
+	Versions map[string]int64 `json:"v"`
+}
+
+// parseSessionToken decodes the session token of a request, returning an
+// empty token if none was sent
+func parseSessionToken(r *http.Request) (sessionToken, error) {
+	token := sessionToken{Versions: make(map[string]int64)}
+
+	raw := r.Header.Get(sessionHeader)
+	if raw == "" {
+		return token, nil
+	}
+
+	data, err := base64.RawURLEncoding.DecodeString(raw)
+	if err != nil {
+		return token, fmt.Errorf("invalid session token")
+	}
+	if err := json.Unmarshal(data, &token); err != nil {
+		return token, fmt.Errorf("invalid session token")
+	}
+	if token.Versions == nil {
+		token.Versions = make(map[string]int64)
+	}
+	return token, nil
+}
+
+// observe records a version of a key seen by the session
+func (t sessionToken) observe(key string, version int64) {
+	if version > t.Versions[key] {
+		t.Versions[key] = version
+	}
+	if len(t.Versions) <= maxSessionKeys {
+		return
+	}
+
+	keys := make([]string, 0, len(t.Versions))
+	for k := range t.Versions {
+		keys = append(keys, k)
+	}
+	sort.Slice(keys, func(i, j int) bool { return t.Versions[keys[i]] < t.Versions[keys[j]] })
+	for _, k := range keys[:len(keys)-maxSessionKeys] {
+		delete(t.Versions, k)
+	}
+}
+
+// encode returns the token's header representation
+func (t sessionToken) encode() string {
+	data, _ := json.Marshal(t)
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+// writeSessionToken records a version in the session and returns the
+// updated token to the client
+func writeSessionToken(w http.ResponseWriter, token sessionToken, key string, version int64) {
+	token.observe(key, version)
+	w.Header().Set(sessionHeader, token.encode())
+}
@@ -0,0 +1,153 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+
+	"github.com/mini-dynamo/mini-dynamo/internal/replication"
+	"github.com/mini-dynamo/mini-dynamo/pkg/types"
+)
+
+// txnRequest is the body of a transaction
+type txnRequest struct {
+	Reads       []types.TxnRead        `json:"reads,omitempty"`
+	Writes      []types.BatchOperation `json:"writes"`
+	Consistency string                 `json:"consistency,omitempty"`
+}
+
+// SetTxnCoordinator enables transactions on this server
+func (s *Server) SetTxnCoordinator(txns *replication.TxnCoordinator) {
+	s.txns = txns
+}
+
+// handleTxn runs a transaction, answering 409 with the changed reads when
+// the read set is stale or a key is locked by another transaction
+func (s *Server) handleTxn(w http.ResponseWriter, r *http.Request) {
+	if s.txns == nil {
+		writeError(w, http.StatusServiceUnavailable, "transactions require a coordinator")
+		return
+	}
+
+	body, err := io.ReadAll(io.LimitReader(r.Body, 10*1024*1024)) // 10MB limit
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "failed to read request body")
+		return
+	}
+	defer r.Body.Close()
+
+	var req txnRequest
+	if err := json.Unmarshal(body, &req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid request format")
+		return
+	}
+
+	opts, err := parseConsistencyOptions(r, req.Consistency)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	result, err := s.txns.Execute(r.Context(), req.Reads, req.Writes, opts)
+	if err != nil {
+		switch {
+		case errors.Is(err, replication.ErrInvalidTxn), errors.Is(err, replication.ErrInvalidConsistency),
+			errors.Is(err, replication.ErrInvalidSession):
+			writeError(w, http.StatusBadRequest, err.Error())
+		case errors.Is(err, replication.ErrTxnConflict):
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusConflict)
+			json.NewEncoder(w).Encode(map[string]interface{}{
+				"error":     http.StatusText(http.StatusConflict),
+				"code":      http.StatusConflict,
+				"message":   err.Error(),
+				"id":        result.ID,
+				"status":    result.Status,
+				"conflicts": result.Conflicts,
+			})
+		case errors.Is(err, replication.ErrTxnAborted):
+			writeError(w, http.StatusServiceUnavailable, err.Error())
+		default:
+			writeError(w, http.StatusInternalServerError, err.Error())
+		}
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(result)
+}
+
+// handleTxnPrepare runs the prepare phase of a transaction on this replica
+func (s *Server) handleTxnPrepare(w http.ResponseWriter, r *http.Request) {
+	if s.txns == nil {
+		writeError(w, http.StatusServiceUnavailable, "no coordinator")
+		return
+	}
+
+	var req types.TxnPrepareRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid request format")
+		return
+	}
+	defer r.Body.Close()
+
+	version, err := s.txns.Prepare(req)
+	if err != nil {
+		if errors.Is(err, replication.ErrTxnConflict) || errors.Is(err, replication.ErrTxnDecided) {
+			writeError(w, http.StatusConflict, err.Error())
+			return
+		}
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(types.TxnPrepareResponse{Success: true, Version: version})
+}
+
+// handleTxnDecide applies the outcome of a transaction on this replica
+func (s *Server) handleTxnDecide(w http.ResponseWriter, r *http.Request) {
+	if s.txns == nil {
+		writeError(w, http.StatusServiceUnavailable, "no coordinator")
+		return
+	}
+
+	var req types.TxnDecisionRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid request format")
+		return
+	}
+	defer r.Body.Close()
+
+	if err := s.txns.Decide(req); err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(types.ReplicationResponse{Success: true})
+}
+
+// handleTxnStatus reports the status of a transaction coordinated by this node
+func (s *Server) handleTxnStatus(w http.ResponseWriter, r *http.Request) {
+	if s.txns == nil {
+		writeError(w, http.StatusServiceUnavailable, "no coordinator")
+		return
+	}
+
+	var req types.TxnStatusRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid request format")
+		return
+	}
+	defer r.Body.Close()
+
+	status, timestamp := s.txns.Status(req.TxnID)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(types.TxnStatusResponse{
+		TxnID:     req.TxnID,
+		Status:    status,
+		Timestamp: timestamp,
+	})
+}
@@ -18,6 +18,16 @@ type Config struct {
 	// Cluster configuration
 	SeedNodes []string `json:"seed_nodes"` // Initial nodes to contact for joining
 
+	// Topology
+	Datacenter    string         `json:"datacenter"`      // Datacenter this node runs in
+	Rack          string         `json:"rack"`            // Rack within the datacenter
+	Weight        float64        `json:"weight"`          // Capacity relative to other nodes, scaling its virtual nodes
+	ReplicasPerDC map[string]int `json:"replicas_per_dc"` // Replicas per datacenter (empty = rack-aware across all)
+
+	// InterDCLatency adds an artificial delay to every request sent to a
+	// node in another datacenter, for testing multi-datacenter behavior locally
+	InterDCLatency time.Duration `json:"inter_dc_latency,omitempty"`
+
 	// Storage configuration
 	DataDir         string `json:"data_dir"`
 	MaxFileSize     int64  `json:"max_file_size"`      // Max size before compaction (bytes)
@@ -29,43 +39,104 @@ type Config struct {
 	ReadQuorum        int `json:"read_quorum"`        // R - reads required for success
 	WriteQuorum       int `json:"write_quorum"`       // W - writes required for success
 
+	// Hedged reads
+	HedgedReads     bool          `json:"hedged_reads"`     // Contact only R fastest replicas, hedge slow ones
+	HedgePercentile float64       `json:"hedge_percentile"` // Latency percentile (0-1) that triggers a hedge
+	HedgeMinDelay   time.Duration `json:"hedge_min_delay"`  // Lower bound on the hedge delay
+	LatencyAlpha    float64       `json:"latency_alpha"`    // EWMA smoothing factor for replica latency
+
+	// Read repair
+	ReadRepairChance    float64 `json:"read_repair_chance"`     // Probability (0-1) that a read is checked for repair
+	ReadRepairWorkers   int     `json:"read_repair_workers"`    // Concurrent repair workers
+	ReadRepairQueueSize int     `json:"read_repair_queue_size"` // Pending repairs before new ones are dropped
+	ReadRepairRate      int     `json:"read_repair_rate"`       // Max repairs per second (0 = unlimited)
+
+	// Hybrid logical clock
+	MaxClockSkew    time.Duration `json:"max_clock_skew"`    // Max lead of a remote clock before warning (0 = unbounded)
+	RejectClockSkew bool          `json:"reject_clock_skew"` // Reject replicated writes beyond max_clock_skew instead of warning
+
+	// Session guarantees
+	SessionWaitTimeout time.Duration `json:"session_wait_timeout"` // How long a read waits for a replica as fresh as the session
+
+	// Transactions
+	TxnTimeout time.Duration `json:"txn_timeout"` // Age after which in-doubt transactions are resolved
+
 	// Consistent hashing
-	VirtualNodes int `json:"virtual_nodes"` // Number of virtual nodes per physical node
+	VirtualNodes  int    `json:"virtual_nodes"`  // Number of virtual nodes per physical node
+	Partitioner   string `json:"partitioner"`    // How keys and virtual nodes are placed: murmur3, balanced or ordered
+	AutoBootstrap bool   `json:"auto_bootstrap"` // Stream existing data for owned ranges when joining with an empty store
 
 	// Gossip protocol
 	GossipInterval   time.Duration `json:"gossip_interval"`   // How often to gossip
 	GossipPort       int           `json:"gossip_port"`       // UDP port for gossip
 	SuspectTimeout   time.Duration `json:"suspect_timeout"`   // Time before marking suspect
 	DeadTimeout      time.Duration `json:"dead_timeout"`      // Time before marking dead
+	ProbeInterval    time.Duration `json:"probe_interval"`    // How often one member is probed
+	ProbeTimeout     time.Duration `json:"probe_timeout"`     // Wait for a direct ack before probing indirectly
+	IndirectProbes   int           `json:"indirect_probes"`   // Members asked to probe on our behalf
+	FailureDetector  string        `json:"failure_detector"`  // How silent members are suspected: timeout or phi
+	PhiThreshold     float64       `json:"phi_threshold"`     // Suspicion level at which the phi detector suspects a member
 	
 	// Timeouts
 	RequestTimeout   time.Duration `json:"request_timeout"`   // Timeout for inter-node requests
 	HandoffTimeout   time.Duration `json:"handoff_timeout"`   // How long to keep hinted handoffs
+
+	// Re-replication
+	RereplicationDelay time.Duration `json:"rereplication_delay"` // How long a node stays dead before its ranges are copied elsewhere
+
+	// Rebalancing
+	RebalanceThreshold  float64 `json:"rebalance_threshold"`   // Score above or below the mean at which a node is unbalanced
+	RebalanceMaxMoves   int     `json:"rebalance_max_moves"`   // Token moves in one plan
+	RebalanceMaxStreams int     `json:"rebalance_max_streams"` // Token moves streaming at once
 }
 
 // DefaultConfig returns a configuration with sensible defaults
 func DefaultConfig() *Config {
 	hostname, _ := os.Hostname()
 	return &Config{
-		NodeID:            hostname,
-		Address:           "127.0.0.1",
-		Port:              8080,
-		GRPCPort:          9090,
-		SeedNodes:         []string{},
-		DataDir:           "./data",
-		MaxFileSize:       100 * 1024 * 1024, // 100MB
-		SyncWrites:        false,
-		CompactInterval:   300, // 5 minutes
-		ReplicationFactor: 3,
-		ReadQuorum:        2,
-		WriteQuorum:       2,
-		VirtualNodes:      150,
-		GossipInterval:    time.Second,
-		GossipPort:        7946,
-		SuspectTimeout:    5 * time.Second,
-		DeadTimeout:       30 * time.Second,
-		RequestTimeout:    5 * time.Second,
-		HandoffTimeout:    24 * time.Hour,
+		NodeID:              hostname,
+		Address:             "127.0.0.1",
+		Port:                8080,
+		GRPCPort:            9090,
+		SeedNodes:           []string{},
+		DataDir:             "./data",
+		MaxFileSize:         100 * 1024 * 1024, // 100MB
+		SyncWrites:          false,
+		CompactInterval:     300, // 5 minutes
+		ReplicationFactor:   3,
+		ReadQuorum:          2,
+		WriteQuorum:         2,
+		HedgedReads:         false,
+		HedgePercentile:     0.95,
+		HedgeMinDelay:       10 * time.Millisecond,
+		LatencyAlpha:        0.2,
+		ReadRepairChance:    1.0,
+		ReadRepairWorkers:   4,
+		ReadRepairQueueSize: 1024,
+		ReadRepairRate:      500,
+		MaxClockSkew:        time.Second,
+		SessionWaitTimeout:  time.Second,
+		TxnTimeout:          10 * time.Second,
+		RejectClockSkew:     false,
+		VirtualNodes:        150,
+		Partitioner:         "murmur3",
+		Weight:              1,
+		AutoBootstrap:       true,
+		GossipInterval:      time.Second,
+		GossipPort:          7946,
+		SuspectTimeout:      5 * time.Second,
+		DeadTimeout:         30 * time.Second,
+		ProbeInterval:       time.Second,
+		ProbeTimeout:        500 * time.Millisecond,
+		IndirectProbes:      3,
+		FailureDetector:     "timeout",
+		PhiThreshold:        8,
+		RequestTimeout:      5 * time.Second,
+		HandoffTimeout:      24 * time.Hour,
+		RereplicationDelay:  time.Minute,
+		RebalanceThreshold:  0.1,
+		RebalanceMaxMoves:   16,
+		RebalanceMaxStreams: 2,
 	}
 }
 
@@ -83,6 +154,19 @@ func (c *Config) Validate() error {
 	if c.ReplicationFactor < 1 {
 		return fmt.Errorf("replication_factor must be at least 1")
 	}
+	if len(c.ReplicasPerDC) > 0 {
+		total := 0
+		for dc, n := range c.ReplicasPerDC {
+			if n < 1 {
+				return fmt.Errorf("replicas_per_dc for %s must be at least 1", dc)
+			}
+			total += n
+		}
+		if total != c.ReplicationFactor {
+			return fmt.Errorf("replicas_per_dc must add up to replication_factor (%d), got %d",
+				c.ReplicationFactor, total)
+		}
+	}
 	if c.ReadQuorum < 1 || c.ReadQuorum > c.ReplicationFactor {
 		return fmt.Errorf("read_quorum must be between 1 and replication_factor")
 	}
@@ -95,9 +179,52 @@ func (c *Config) Validate() error {
 		fmt.Printf("Warning: W(%d) + R(%d) <= N(%d), eventual consistency mode\n",
 			c.WriteQuorum, c.ReadQuorum, c.ReplicationFactor)
 	}
+	if c.HedgePercentile <= 0 || c.HedgePercentile > 1 {
+		return fmt.Errorf("hedge_percentile must be between 0 and 1")
+	}
+	if c.ReadRepairChance < 0 || c.ReadRepairChance > 1 {
+		return fmt.Errorf("read_repair_chance must be between 0 and 1")
+	}
+	if c.MaxClockSkew < 0 {
+		return fmt.Errorf("max_clock_skew must not be negative")
+	}
+	if c.TxnTimeout <= 0 {
+		return fmt.Errorf("txn_timeout must be positive")
+	}
+	if c.RereplicationDelay < 0 {
+		return fmt.Errorf("rereplication_delay must not be negative")
+	}
+	if c.RebalanceThreshold < 0 {
+		return fmt.Errorf("rebalance_threshold must not be negative")
+	}
+	if c.RebalanceMaxMoves < 1 || c.RebalanceMaxStreams < 1 {
+		return fmt.Errorf("rebalance_max_moves and rebalance_max_streams must be at least 1")
+	}
 	if c.VirtualNodes < 1 {
 		return fmt.Errorf("virtual_nodes must be at least 1")
 	}
+	if c.Weight <= 0 {
+		return fmt.Errorf("weight must be positive")
+	}
+	if c.ProbeTimeout <= 0 || c.ProbeTimeout >= c.ProbeInterval {
+		return fmt.Errorf("probe_timeout must be positive and less than probe_interval")
+	}
+	if c.IndirectProbes < 0 {
+		return fmt.Errorf("indirect_probes must not be negative")
+	}
+	switch c.Partitioner {
+	case "murmur3", "balanced", "ordered":
+	default:
+		return fmt.Errorf("partitioner must be murmur3, balanced or ordered")
+	}
+	switch c.FailureDetector {
+	case "timeout", "phi":
+	default:
+		return fmt.Errorf("failure_detector must be timeout or phi")
+	}
+	if c.PhiThreshold <= 0 {
+		return fmt.Errorf("phi_threshold must be positive")
+	}
 	return nil
 }
 
@@ -0,0 +1,130 @@
+// Package crdt implements state-based conflict-free replicated data types
+// stored as ordinary values. Replicas merge concurrent versions instead of
+// letting last-write-wins drop one of them.
+package crdt
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+)
+
+// Type identifies a CRDT
+type Type string
+
+const (
+	TypeCounter Type = "counter" // PN-counter
+	TypeSet     Type = "set"     // Observed-remove set
+	TypeMap     Type = "map"     // Last-write-wins element map
+)
+
+// Errors returned when decoding or merging CRDT values
+var (
+	ErrNotCRDT   = errors.New("value is not a CRDT")
+	ErrWrongType = errors.New("CRDT type mismatch")
+)
+
+// CRDT is a state-based replicated data type
+type CRDT interface {
+	// Type returns the CRDT's type
+	Type() Type
+
+	// Merge folds another replica's state of the same type into this one
+	Merge(other CRDT) error
+}
+
+// envelopeMarker prefixes every encoded CRDT so it can be told apart from
+// plain values without decoding
+var envelopeMarker = []byte(`{"crdt":`)
+
+// envelope is the stored representation of a CRDT
+type envelope struct {
+	CRDT  Type            `json:"crdt"`
+	State json.RawMessage `json:"state"`
+}
+
+// registry holds the constructor of every supported CRDT type
+var registry = map[Type]func() CRDT{
+	TypeCounter: func() CRDT { return NewPNCounter() },
+	TypeSet:     func() CRDT { return NewORSet() },
+	TypeMap:     func() CRDT { return NewLWWMap() },
+}
+
+// New returns an empty CRDT of the given type
+func New(t Type) (CRDT, error) {
+	ctor, exists := registry[t]
+	if !exists {
+		return nil, fmt.Errorf("unknown CRDT type %q", t)
+	}
+	return ctor(), nil
+}
+
+// IsCRDT reports whether a stored value holds a CRDT
+func IsCRDT(data []byte) bool {
+	return bytes.HasPrefix(data, envelopeMarker)
+}
+
+// Encode serializes a CRDT for storage
+func Encode(c CRDT) ([]byte, error) {
+	state, err := json.Marshal(c)
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(envelope{CRDT: c.Type(), State: state})
+}
+
+// Decode deserializes a stored CRDT, returning ErrNotCRDT for plain values
+func Decode(data []byte) (CRDT, error) {
+	if !IsCRDT(data) {
+		return nil, ErrNotCRDT
+	}
+
+	var env envelope
+	if err := json.Unmarshal(data, &env); err != nil {
+		return nil, fmt.Errorf("corrupt CRDT value: %w", err)
+	}
+
+	c, err := New(env.CRDT)
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(env.State, c); err != nil {
+		return nil, fmt.Errorf("corrupt %s state: %w", env.CRDT, err)
+	}
+	return c, nil
+}
+
+// Merge merges two encoded CRDTs of the same type
+func Merge(a, b []byte) ([]byte, error) {
+	ca, err := Decode(a)
+	if err != nil {
+		return nil, err
+	}
+	cb, err := Decode(b)
+	if err != nil {
+		return nil, err
+	}
+	if err := ca.Merge(cb); err != nil {
+		return nil, err
+	}
+	return Encode(ca)
+}
+
+// Merger plugs CRDT merging into conflict resolution
+type Merger struct{}
+
+// CanMerge reports whether a value is a CRDT
+func (Merger) CanMerge(value []byte) bool {
+	return IsCRDT(value)
+}
+
+// Merge merges two encoded CRDTs
+func (Merger) Merge(a, b []byte) ([]byte, error) {
+	return Merge(a, b)
+}
+
+// wrongType builds the error for merging mismatched CRDTs
+func wrongType(want Type, got CRDT) error {
+	return fmt.Errorf("%w: cannot merge %s into %s", ErrWrongType, got.Type(), want)
+}
@@ -0,0 +1,103 @@
+package crdt
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestPNCounterConcurrentUpdates(t *testing.T) {
+	a := NewPNCounter()
+	b := NewPNCounter()
+
+	a.Increment("node1", 5)
+	b.Increment("node2", 3)
+	b.Increment("node2", -1)
+
+	a.Merge(b)
+	b.Merge(a)
+
+	if a.Value() != 7 || b.Value() != 7 {
+		t.Errorf("Expected both replicas at 7, got %d and %d", a.Value(), b.Value())
+	}
+
+	// Merging the same state again must not double count
+	a.Merge(b)
+	if a.Value() != 7 {
+		t.Errorf("Merge should be idempotent, got %d", a.Value())
+	}
+}
+
+func TestORSetAddWinsOverConcurrentRemove(t *testing.T) {
+	a := NewORSet()
+	a.Add("x", "node1:1")
+
+	b := NewORSet()
+	b.Merge(a)
+
+	// Concurrently: a removes x, b adds x again
+	a.Remove("x")
+	b.Add("x", "node2:2")
+
+	a.Merge(b)
+	b.Merge(a)
+
+	if !a.Contains("x") || !b.Contains("x") {
+		t.Error("Concurrent add should survive the remove")
+	}
+
+	// A remove that observed every add wins
+	a.Remove("x")
+	b.Merge(a)
+	if b.Contains("x") {
+		t.Error("Observed remove should delete the element")
+	}
+}
+
+func TestLWWMapFieldsResolveIndependently(t *testing.T) {
+	a := NewLWWMap()
+	b := NewLWWMap()
+
+	a.Set("name", "alice", 10)
+	b.Set("email", "bob@example.com", 5)
+	b.Set("name", "bob", 20)
+	a.Delete("email", 30)
+
+	a.Merge(b)
+	b.Merge(a)
+
+	want := map[string]string{"name": "bob"}
+	if !reflect.DeepEqual(a.Entries(), want) || !reflect.DeepEqual(b.Entries(), want) {
+		t.Errorf("Expected %v on both replicas, got %v and %v", want, a.Entries(), b.Entries())
+	}
+}
+
+func TestEncodeDecodeMerge(t *testing.T) {
+	a := NewPNCounter()
+	a.Increment("node1", 2)
+	b := NewPNCounter()
+	b.Increment("node2", 3)
+
+	ea, _ := Encode(a)
+	eb, _ := Encode(b)
+	if !IsCRDT(ea) || IsCRDT([]byte("plain")) {
+		t.Fatal("IsCRDT misclassified a value")
+	}
+
+	merged, err := Merge(ea, eb)
+	if err != nil {
+		t.Fatalf("Merge failed: %v", err)
+	}
+	c, err := Decode(merged)
+	if err != nil {
+		t.Fatalf("Decode failed: %v", err)
+	}
+	if c.(*PNCounter).Value() != 5 {
+		t.Errorf("Expected merged counter 5, got %d", c.(*PNCounter).Value())
+	}
+
+	set, _ := Encode(NewORSet())
+	if _, err := Merge(ea, set); !errors.Is(err, ErrWrongType) {
+		t.Errorf("Expected ErrWrongType merging a counter and a set, got %v", err)
+	}
+}
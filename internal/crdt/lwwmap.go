@@ -0,0 +1,86 @@
+package crdt
+
+// lwwField is a single field of an LWW map
+type lwwField struct {
+	Value     string `json:"value"`
+	Timestamp int64  `json:"ts"`
+	Deleted   bool   `json:"deleted,omitempty"`
+}
+
+// newerThan orders field versions by timestamp, then deletes over writes,
+// then by value, so every replica picks the same winner
+func (f lwwField) newerThan(other lwwField) bool {
+	if f.Timestamp != other.Timestamp {
+		return f.Timestamp > other.Timestamp
+	}
+	if f.Deleted != other.Deleted {
+		return f.Deleted
+	}
+	return f.Value > other.Value
+}
+
+// LWWMap is a map whose fields are resolved independently by
+// last-write-wins, so concurrent writes to different fields all survive
+type LWWMap struct {
+	Fields map[string]lwwField `json:"fields"`
+}
+
+// NewLWWMap creates an empty map
+func NewLWWMap() *LWWMap {
+	return &LWWMap{Fields: make(map[string]lwwField)}
+}
+
+// Type returns TypeMap
+func (m *LWWMap) Type() Type {
+	return TypeMap
+}
+
+// Set writes a field at a timestamp
+func (m *LWWMap) Set(field, value string, timestamp int64) {
+	m.apply(field, lwwField{Value: value, Timestamp: timestamp})
+}
+
+// Delete removes a field at a timestamp
+func (m *LWWMap) Delete(field string, timestamp int64) {
+	m.apply(field, lwwField{Timestamp: timestamp, Deleted: true})
+}
+
+// apply keeps the newer of the current and given field versions
+func (m *LWWMap) apply(field string, f lwwField) {
+	if current, exists := m.Fields[field]; !exists || f.newerThan(current) {
+		m.Fields[field] = f
+	}
+}
+
+// Get returns the value of a field
+func (m *LWWMap) Get(field string) (string, bool) {
+	f, exists := m.Fields[field]
+	if !exists || f.Deleted {
+		return "", false
+	}
+	return f.Value, true
+}
+
+// Entries returns the live fields of the map
+func (m *LWWMap) Entries() map[string]string {
+	entries := make(map[string]string, len(m.Fields))
+	for field, f := range m.Fields {
+		if !f.Deleted {
+			entries[field] = f.Value
+		}
+	}
+	return entries
+}
+
+// Merge keeps the newest version of every field
+func (m *LWWMap) Merge(other CRDT) error {
+	o, ok := other.(*LWWMap)
+	if !ok {
+		return wrongType(TypeMap, other)
+	}
+
+	for field, f := range o.Fields {
+		m.apply(field, f)
+	}
+	return nil
+}
@@ -0,0 +1,96 @@
+package crdt
+
+import "sort"
+
+// ORSet is an observed-remove set. Every add is tagged uniquely and a
+// remove only tombstones the tags it has observed, so an add concurrent
+// with a remove of the same element wins.
+type ORSet struct {
+	Adds    map[string][]string `json:"adds"`    // Element -> live add tags
+	Removed map[string]bool     `json:"removed"` // Tombstoned add tags
+}
+
+// NewORSet creates an empty set
+func NewORSet() *ORSet {
+	return &ORSet{
+		Adds:    make(map[string][]string),
+		Removed: make(map[string]bool),
+	}
+}
+
+// Type returns TypeSet
+func (s *ORSet) Type() Type {
+	return TypeSet
+}
+
+// Add adds an element under a tag that must be unique across the cluster
+func (s *ORSet) Add(element, tag string) {
+	if s.Removed[tag] {
+		return
+	}
+	for _, t := range s.Adds[element] {
+		if t == tag {
+			return
+		}
+	}
+	s.Adds[element] = append(s.Adds[element], tag)
+	sort.Strings(s.Adds[element])
+}
+
+// Remove removes an element by tombstoning every add of it observed so far
+func (s *ORSet) Remove(element string) {
+	for _, tag := range s.Adds[element] {
+		s.Removed[tag] = true
+	}
+	delete(s.Adds, element)
+}
+
+// Contains reports whether an element is in the set
+func (s *ORSet) Contains(element string) bool {
+	return len(s.Adds[element]) > 0
+}
+
+// Elements returns the elements of the set in sorted order
+func (s *ORSet) Elements() []string {
+	elements := make([]string, 0, len(s.Adds))
+	for element, tags := range s.Adds {
+		if len(tags) > 0 {
+			elements = append(elements, element)
+		}
+	}
+	sort.Strings(elements)
+	return elements
+}
+
+// Merge unions the adds and tombstones of both replicas
+func (s *ORSet) Merge(other CRDT) error {
+	o, ok := other.(*ORSet)
+	if !ok {
+		return wrongType(TypeSet, other)
+	}
+
+	for tag := range o.Removed {
+		s.Removed[tag] = true
+	}
+	for element, tags := range o.Adds {
+		for _, tag := range tags {
+			s.Add(element, tag)
+		}
+	}
+
+	// Drop adds tombstoned by the other replica
+	for element, tags := range s.Adds {
+		live := tags[:0]
+		for _, tag := range tags {
+			if !s.Removed[tag] {
+				live = append(live, tag)
+			}
+		}
+		if len(live) == 0 {
+			delete(s.Adds, element)
+		} else {
+			s.Adds[element] = live
+		}
+	}
+	return nil
+}
@@ -0,0 +1,63 @@
+package crdt
+
+// PNCounter is a counter supporting increments and decrements. Each node
+// only grows its own entries, and merging keeps the maximum per node, so
+// concurrent updates on different nodes are never lost.
+type PNCounter struct {
+	P map[string]int64 `json:"p"` // Increments per node
+	N map[string]int64 `json:"n"` // Decrements per node
+}
+
+// NewPNCounter creates a counter at zero
+func NewPNCounter() *PNCounter {
+	return &PNCounter{
+		P: make(map[string]int64),
+		N: make(map[string]int64),
+	}
+}
+
+// Type returns TypeCounter
+func (c *PNCounter) Type() Type {
+	return TypeCounter
+}
+
+// Increment adds delta (which may be negative) on behalf of a node
+func (c *PNCounter) Increment(nodeID string, delta int64) {
+	if delta >= 0 {
+		c.P[nodeID] += delta
+	} else {
+		c.N[nodeID] -= delta
+	}
+}
+
+// Value returns the counter's current value
+func (c *PNCounter) Value() int64 {
+	var value int64
+	for _, p := range c.P {
+		value += p
+	}
+	for _, n := range c.N {
+		value -= n
+	}
+	return value
+}
+
+// Merge keeps the highest increments and decrements seen for each node
+func (c *PNCounter) Merge(other CRDT) error {
+	o, ok := other.(*PNCounter)
+	if !ok {
+		return wrongType(TypeCounter, other)
+	}
+
+	for nodeID, p := range o.P {
+		if p > c.P[nodeID] {
+			c.P[nodeID] = p
+		}
+	}
+	for nodeID, n := range o.N {
+		if n > c.N[nodeID] {
+			c.N[nodeID] = n
+		}
+	}
+	return nil
+}
@@ -0,0 +1,64 @@
+package gossip
+
+import (
+	"net"
+
+	"github.com/mini-dynamo/mini-dynamo/pkg/types"
+)
+
+// Each gossip round exchanges digests rather than whole membership lists,
+// so messages stay small as the cluster grows:
+//
+//	digest      A -> B  version of every member A knows
+//	digest_ack  B -> A  entries A lacks or holds at an older incarnation,
+//	                    digests of members B knows further along, and the
+//	                    members whose entries B wants
+//	delta       A -> B  the entries B wants
+//
+// Heartbeats and states at an incarnation both nodes hold travel in the
+// digests themselves; full entries only move when an incarnation changes.
+// Entries carry the member's ring tokens, so a node that learns of a
+// member through a third node places it where the member placed itself.
+
+// digestMessage summarizes our membership for a gossip round
+func (p *Protocol) digestMessage() types.GossipMessage {
+	msg := types.GossipMessage{Type: types.GossipDigest, Digests: p.membership.Digest()}
+	p.addVersions(&msg)
+	return msg
+}
+
+// answerDigest reconciles a peer's digests with our membership, sending
+// back what the peer is missing and asking for what we are
+func (p *Protocol) answerDigest(msg *types.GossipMessage, from *net.UDPAddr) {
+	push, ahead, want := p.membership.Reconcile(msg.Digests)
+	p.addTokens(push)
+	reply := types.GossipMessage{
+		Type:    types.GossipDigestAck,
+		Members: push,
+		Digests: ahead,
+		Want:    want,
+	}
+	p.addVersions(&reply)
+	p.send(from, reply)
+}
+
+// completeDigest applies what a peer knows further along and sends it the
+// entries it asked for. The entries it sent were merged like any other
+// gossip.
+func (p *Protocol) completeDigest(msg *types.GossipMessage, from *net.UDPAddr) {
+	p.membership.ApplyDigests(msg.Digests)
+	if len(msg.Want) == 0 {
+		return
+	}
+	entries := p.membership.Entries(msg.Want)
+	p.addTokens(entries)
+	p.send(from, types.GossipMessage{Type: types.GossipDelta, Members: entries})
+}
+
+// checkSelf refutes a peer's view of this node if it has us suspect or
+// dead, or at an incarnation we have not reached, as after a restart
+func (p *Protocol) checkSelf(incarnation uint64, state string, from string) {
+	if state != types.NodeAlive.String() || incarnation > p.membership.Incarnation() {
+		p.refute(incarnation, from)
+	}
+}
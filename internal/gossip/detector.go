@@ -2,6 +2,7 @@ package gossip
 
 import (
 	"log"
+	"strings"
 	"sync"
 	"time"
 
@@ -17,6 +18,15 @@ type FailureDetector struct {
 	stopCh         chan struct{}
 	wg             sync.WaitGroup
 	onStateChange  func(nodeID string, oldState, newState types.NodeState)
+	probed         func(nodeID string) bool // Reports members suspected by probes instead of timeouts
+	phi            *phiAccrual              // Suspects alive members instead of the suspect timeout (optional)
+}
+
+// DetectorStats describes how the failure detector suspects members
+type DetectorStats struct {
+	Type         string             `json:"type"`
+	PhiThreshold float64            `json:"phi_threshold,omitempty"`
+	Phi          map[string]float64 `json:"phi,omitempty"` // Current suspicion level per member
 }
 
 // NewFailureDetector creates a new failure detector
@@ -26,13 +36,35 @@ func NewFailureDetector(
 	deadTimeout time.Duration,
 	onStateChange func(nodeID string, oldState, newState types.NodeState),
 ) *FailureDetector {
-	return &FailureDetector{
+	fd := &FailureDetector{
 		membership:     membership,
 		suspectTimeout: suspectTimeout,
 		deadTimeout:    deadTimeout,
 		stopCh:         make(chan struct{}),
 		onStateChange:  onStateChange,
 	}
+	membership.SetStateHandler(fd.gossipedStateChange)
+	return fd
+}
+
+// SetProber hands suspicion of the members a prober can reach to it.
+// Those members are no longer suspected for missing gossip, only for
+// failing the prober's checks; they still die after the dead timeout.
+func (fd *FailureDetector) SetProber(probed func(nodeID string) bool) {
+	fd.mu.Lock()
+	defer fd.mu.Unlock()
+	fd.probed = probed
+}
+
+// SetPhiAccrual suspects alive members with a phi accrual detector instead
+// of the fixed suspect timeout, once their phi exceeds threshold. This
+// includes members a prober reaches, since probe acks count as heartbeats.
+// Members heard from too few times to compute phi still use the timeout,
+// and suspect members die after the dead timeout either way.
+func (fd *FailureDetector) SetPhiAccrual(threshold float64) {
+	fd.mu.Lock()
+	defer fd.mu.Unlock()
+	fd.phi = newPhiAccrual(threshold)
 }
 
 // Start begins the failure detection loop
@@ -69,6 +101,10 @@ func (fd *FailureDetector) checkMembers() {
 	members := fd.membership.GetAllMembers()
 	now := time.Now()
 
+	fd.mu.RLock()
+	probed, phi := fd.probed, fd.phi
+	fd.mu.RUnlock()
+
 	for _, member := range members {
 		// Skip self
 		if member.Node.ID == fd.membership.selfID {
@@ -77,17 +113,30 @@ func (fd *FailureDetector) checkMembers() {
 
 		elapsed := now.Sub(member.LastHeartbeat)
 		oldState := member.Node.State
+		newState := oldState
 
-		switch member.Node.State {
+		switch oldState {
 		case types.NodeAlive:
-			if elapsed > fd.suspectTimeout {
-				fd.transitionTo(member.Node.ID, types.NodeSuspect)
+			if phi != nil {
+				if level, ok := phi.phi(member.Node.ID, now); ok {
+					if level > phi.threshold && fd.transitionTo(member, types.NodeSuspect) {
+						newState = types.NodeSuspect
+						log.Printf("Node %s marked as SUSPECT (phi %.1f after %v)", member.Node.ID, level, elapsed)
+					}
+					break
+				}
+			}
+			if probed != nil && probed(member.Node.ID) {
+				break
+			}
+			if elapsed > fd.suspectTimeout && fd.transitionTo(member, types.NodeSuspect) {
+				newState = types.NodeSuspect
 				log.Printf("Node %s marked as SUSPECT (no heartbeat for %v)", member.Node.ID, elapsed)
 			}
 
 		case types.NodeSuspect:
-			if elapsed > fd.deadTimeout {
-				fd.transitionTo(member.Node.ID, types.NodeDead)
+			if elapsed > fd.deadTimeout && fd.transitionTo(member, types.NodeDead) {
+				newState = types.NodeDead
 				log.Printf("Node %s marked as DEAD (no heartbeat for %v)", member.Node.ID, elapsed)
 			}
 
@@ -96,15 +145,41 @@ func (fd *FailureDetector) checkMembers() {
 		}
 
 		// Notify callback if state changed
-		if oldState != member.Node.State && fd.onStateChange != nil {
-			fd.onStateChange(member.Node.ID, oldState, member.Node.State)
+		if oldState != newState && fd.onStateChange != nil {
+			fd.onStateChange(member.Node.ID, oldState, newState)
 		}
 	}
 }
 
-// transitionTo changes a node's state
-func (fd *FailureDetector) transitionTo(nodeID string, newState types.NodeState) {
-	fd.membership.UpdateState(nodeID, newState)
+// Suspect marks a node as suspect at an incarnation after it failed a
+// probe, or on a rumor that it did. It reports whether the suspicion was
+// news, which is false if the node already refuted it.
+func (fd *FailureDetector) Suspect(nodeID string, incarnation uint64, reason string) bool {
+	oldState, applied := fd.membership.ApplyState(nodeID, incarnation, types.NodeSuspect)
+	if !applied {
+		return false
+	}
+
+	log.Printf("Node %s marked as SUSPECT at incarnation %d (%s)", nodeID, incarnation, reason)
+	if oldState != types.NodeSuspect && fd.onStateChange != nil {
+		fd.onStateChange(nodeID, oldState, types.NodeSuspect)
+	}
+	return true
+}
+
+// transitionTo changes a node's state at the incarnation it was checked
+// at, and reports false if the node refuted in the meantime
+func (fd *FailureDetector) transitionTo(member *MemberInfo, newState types.NodeState) bool {
+	_, applied := fd.membership.ApplyState(member.Node.ID, member.Version, newState)
+	return applied
+}
+
+// gossipedStateChange reports a state change learned through gossip
+func (fd *FailureDetector) gossipedStateChange(nodeID string, oldState, newState types.NodeState) {
+	log.Printf("Node %s marked as %s through gossip", nodeID, strings.ToUpper(newState.String()))
+	if fd.onStateChange != nil {
+		fd.onStateChange(nodeID, oldState, newState)
+	}
 }
 
 // Revive marks a dead node as alive again
@@ -126,19 +201,29 @@ func (fd *FailureDetector) Revive(nodeID string) {
 	}
 }
 
-// RecordHeartbeat records a heartbeat from a node
-func (fd *FailureDetector) RecordHeartbeat(nodeID string) {
-	member, exists := fd.membership.GetMember(nodeID)
-	if !exists {
-		return
-	}
-
-	oldState := member.Node.State
+// RecordHeartbeat records a heartbeat from a node at its incarnation, or 0
+// if it is unknown. A suspect or dead node is revived only if the
+// incarnation is higher than the one it was suspected at, so it has
+// refuted the suspicion.
+func (fd *FailureDetector) RecordHeartbeat(nodeID string, incarnation uint64) {
 	fd.membership.RecordHeartbeat(nodeID)
 
-	// If node was suspect or dead, revive it
-	if oldState != types.NodeAlive {
-		fd.Revive(nodeID)
+	fd.mu.RLock()
+	phi := fd.phi
+	fd.mu.RUnlock()
+	if phi != nil {
+		if _, exists := fd.membership.GetMember(nodeID); exists {
+			phi.heartbeat(nodeID, time.Now())
+		}
+	}
+
+	oldState, applied := fd.membership.ApplyState(nodeID, incarnation, types.NodeAlive)
+	if !applied || oldState == types.NodeAlive {
+		return
+	}
+	log.Printf("Node %s refuted %s at incarnation %d", nodeID, strings.ToUpper(oldState.String()), incarnation)
+	if fd.onStateChange != nil {
+		fd.onStateChange(nodeID, oldState, types.NodeAlive)
 	}
 }
 
@@ -176,3 +261,20 @@ func (fd *FailureDetector) GetDeadNodes() []string {
 	}
 	return dead
 }
+
+// Stats returns the detector type and, for the phi accrual detector, the
+// current phi of every member heard from often enough
+func (fd *FailureDetector) Stats() DetectorStats {
+	fd.mu.RLock()
+	phi := fd.phi
+	fd.mu.RUnlock()
+
+	if phi == nil {
+		return DetectorStats{Type: DetectorTimeout}
+	}
+	return DetectorStats{
+		Type:         DetectorPhi,
+		PhiThreshold: phi.threshold,
+		Phi:          phi.levels(time.Now()),
+	}
+}
@@ -0,0 +1,129 @@
+package gossip
+
+import (
+	"fmt"
+	"log"
+	"net"
+	"strconv"
+	"time"
+
+	"github.com/mini-dynamo/mini-dynamo/pkg/types"
+)
+
+// Join introduces this node to the cluster through seed nodes, given as
+// gossip addresses. A join message is sent to every seed each gossip
+// interval until one answers with the full membership, after which members
+// are gossiped with under their own IDs. Start must be called first.
+func (p *Protocol) Join(seeds []string) error {
+	addrs := make([]*net.UDPAddr, 0, len(seeds))
+	for _, seed := range seeds {
+		addr, err := net.ResolveUDPAddr("udp", seed)
+		if err != nil {
+			return fmt.Errorf("invalid seed %s: %w", seed, err)
+		}
+		addrs = append(addrs, addr)
+	}
+	if len(addrs) == 0 {
+		return nil
+	}
+
+	p.wg.Add(1)
+	go p.joinLoop(addrs)
+	return nil
+}
+
+// Joined returns a channel closed once a seed has accepted our join and
+// its members are registered
+func (p *Protocol) Joined() <-chan struct{} {
+	return p.joined
+}
+
+// joinLoop sends join messages to the seeds until one is accepted
+func (p *Protocol) joinLoop(seeds []*net.UDPAddr) {
+	defer p.wg.Done()
+
+	ticker := time.NewTicker(p.config.GossipInterval)
+	defer ticker.Stop()
+
+	for {
+		msg := p.joinMessage()
+		for _, seed := range seeds {
+			p.send(seed, msg)
+		}
+
+		select {
+		case <-p.stopCh:
+			return
+		case <-p.joined:
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// joinMessage introduces this node with its addresses and tokens
+func (p *Protocol) joinMessage() types.GossipMessage {
+	self := p.membership.ToGossipFormat()[p.config.NodeID]
+	members := map[string]types.NodeInfo{p.config.NodeID: self}
+	p.addTokens(members)
+	return types.GossipMessage{Type: types.GossipJoin, Members: members}
+}
+
+// acceptJoin answers a joining node with our full membership, including
+// every node's tokens. The joining node was merged like any other gossip.
+func (p *Protocol) acceptJoin(nodeID string, from *net.UDPAddr) {
+	if nodeID == "" || nodeID == p.config.NodeID {
+		return
+	}
+	log.Printf("Node %s joining from %s", nodeID, from)
+
+	msg := p.membershipMessage()
+	msg.Type = types.GossipJoinAck
+	p.addTokens(msg.Members)
+	p.send(from, msg)
+}
+
+// completeJoin stops sending join messages once a seed has answered
+func (p *Protocol) completeJoin(seedID string, members int) {
+	select {
+	case <-p.joined:
+	default:
+		close(p.joined)
+		log.Printf("Joined the cluster through %s, %d members", seedID, members)
+	}
+}
+
+// addTokens sets the ring tokens of each member to those in our ring,
+// keeping the gossiped ones for members our ring does not hold
+func (p *Protocol) addTokens(members map[string]types.NodeInfo) {
+	if p.ring == nil {
+		return
+	}
+	for nodeID, info := range members {
+		if tokens := p.ring.NodeTokens(nodeID); len(tokens) > 0 {
+			info.Tokens = tokens
+			members[nodeID] = info
+		}
+	}
+}
+
+// learnPeers records the gossip addresses of members we have no address
+// for, so they are gossiped with and probed
+func (p *Protocol) learnPeers(members map[string]types.NodeInfo) {
+	for nodeID, info := range members {
+		if nodeID == p.config.NodeID || info.Address == "" || info.GossipPort == 0 || p.peerAddr(nodeID) != nil {
+			continue
+		}
+
+		addr, err := net.ResolveUDPAddr("udp", net.JoinHostPort(info.Address, strconv.Itoa(info.GossipPort)))
+		if err != nil {
+			log.Printf("Invalid gossip address for %s: %v", nodeID, err)
+			continue
+		}
+		p.mu.Lock()
+		if _, known := p.peers[nodeID]; !known {
+			p.peers[nodeID] = addr
+		}
+		p.mu.Unlock()
+	}
+}
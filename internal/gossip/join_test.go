@@ -0,0 +1,159 @@
+package gossip
+
+import (
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/mini-dynamo/mini-dynamo/internal/config"
+	"github.com/mini-dynamo/mini-dynamo/pkg/types"
+)
+
+// testRing hands out fixed tokens per node
+type testRing struct {
+	tokens map[string][]uint64
+}
+
+func (r *testRing) RingVersion() types.RingVersion                        { return types.RingVersion{} }
+func (r *testRing) ObserveRingVersion(nodeID string, v types.RingVersion) {}
+func (r *testRing) NodeTokens(nodeID string) []uint64                     { return r.tokens[nodeID] }
+
+// discoveries records the members a membership list reports
+type discoveries struct {
+	mu    sync.Mutex
+	nodes map[string]types.Node
+}
+
+func (d *discoveries) record(node types.Node) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.nodes[node.ID] = node
+}
+
+func (d *discoveries) get(nodeID string) (types.Node, bool) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	node, ok := d.nodes[nodeID]
+	return node, ok
+}
+
+// newJoinTestProtocol starts a gossip protocol on localhost that knows
+// only itself, serving HTTP on port
+func newJoinTestProtocol(t *testing.T, id string, port int, ring *testRing) (*Protocol, *discoveries) {
+	cfg := config.DefaultConfig()
+	cfg.NodeID = id
+	cfg.Address = "127.0.0.1"
+	cfg.Port = port
+	cfg.GossipPort = 0
+	cfg.GossipInterval = 50 * time.Millisecond
+
+	membership := NewMembershipList(id)
+	membership.AddMember(&types.Node{ID: id, Address: cfg.Address, Port: port, State: types.NodeAlive})
+	found := &discoveries{nodes: make(map[string]types.Node)}
+	membership.SetMemberHandler(found.record)
+
+	p := NewProtocol(cfg, membership, NewFailureDetector(membership, time.Hour, time.Hour, nil))
+	p.SetRing(ring)
+	if err := p.Start(); err != nil {
+		t.Fatalf("Failed to start gossip: %v", err)
+	}
+	t.Cleanup(p.Stop)
+	return p, found
+}
+
+func TestJoinThroughSeed(t *testing.T) {
+	ring := &testRing{tokens: map[string][]uint64{
+		"a": {10, 40},
+		"b": {20, 50},
+		"c": {30, 60},
+	}}
+	seed, seedFound := newJoinTestProtocol(t, "a", 8001, ring)
+	b, bFound := newJoinTestProtocol(t, "b", 8002, ring)
+	c, cFound := newJoinTestProtocol(t, "c", 8003, ring)
+
+	seedAddr := seed.conn.LocalAddr().String()
+	for _, p := range []*Protocol{b, c} {
+		if err := p.Join([]string{seedAddr}); err != nil {
+			t.Fatalf("Failed to join: %v", err)
+		}
+	}
+	for _, p := range []*Protocol{b, c} {
+		select {
+		case <-p.Joined():
+		case <-time.After(3 * time.Second):
+			t.Fatalf("%s did not join", p.config.NodeID)
+		}
+	}
+
+	// The seed learns each joining node, and every node learns the others
+	// from the seed or later gossip
+	deadline := time.Now().Add(3 * time.Second)
+	for time.Now().Before(deadline) && (b.peerAddr("c") == nil || c.peerAddr("b") == nil) {
+		time.Sleep(20 * time.Millisecond)
+	}
+
+	for _, tt := range []struct {
+		at    *Protocol
+		found *discoveries
+		node  *Protocol
+	}{
+		{seed, seedFound, b},
+		{seed, seedFound, c},
+		{b, bFound, seed},
+		{b, bFound, c},
+		{c, cFound, seed},
+		{c, cFound, b},
+	} {
+		at, id := tt.at.config.NodeID, tt.node.config.NodeID
+		node, ok := tt.found.get(id)
+		if !ok {
+			t.Errorf("Expected %s to discover %s", at, id)
+			continue
+		}
+		gossipPort := tt.node.conn.LocalAddr().(*net.UDPAddr).Port
+		if node.Address != "127.0.0.1" || node.Port != tt.node.config.Port || node.GossipPort != gossipPort {
+			t.Errorf("Expected %s to see %s at 127.0.0.1:%d, gossip port %d, got %s:%d, gossip port %d",
+				at, id, tt.node.config.Port, gossipPort, node.Address, node.Port, node.GossipPort)
+		}
+		if addr := tt.at.peerAddr(id); addr == nil || addr.Port != gossipPort {
+			t.Errorf("Expected %s to gossip with %s on port %d, got %v", at, id, gossipPort, addr)
+		}
+	}
+
+	// Joining nodes receive the tokens the seed knows
+	if node, _ := bFound.get("a"); len(node.TokenRing) != 2 || node.TokenRing[0] != 10 {
+		t.Errorf("Expected b to learn a's tokens, got %v", node.TokenRing)
+	}
+}
+
+func TestGossipCarriesTokens(t *testing.T) {
+	// Each node's ring holds only its own tokens
+	seed, _ := newJoinTestProtocol(t, "a", 8004, &testRing{tokens: map[string][]uint64{"a": {10, 40}}})
+	b, _ := newJoinTestProtocol(t, "b", 8005, &testRing{tokens: map[string][]uint64{"b": {20, 50}}})
+	c, cFound := newJoinTestProtocol(t, "c", 8006, &testRing{tokens: map[string][]uint64{"c": {30, 60}}})
+
+	// c joins before b, so it learns of b only through later gossip
+	seedAddr := seed.conn.LocalAddr().String()
+	for _, p := range []*Protocol{c, b} {
+		if err := p.Join([]string{seedAddr}); err != nil {
+			t.Fatalf("Failed to join: %v", err)
+		}
+		select {
+		case <-p.Joined():
+		case <-time.After(3 * time.Second):
+			t.Fatalf("%s did not join", p.config.NodeID)
+		}
+	}
+
+	deadline := time.Now().Add(3 * time.Second)
+	for time.Now().Before(deadline) {
+		if node, ok := cFound.get("b"); ok && len(node.TokenRing) > 0 {
+			break
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+	if node, _ := cFound.get("b"); len(node.TokenRing) != 2 || node.TokenRing[0] != 20 {
+		t.Errorf("Expected c to learn b's tokens through gossip, got %v", node.TokenRing)
+	}
+}
@@ -12,14 +12,72 @@ type MemberInfo struct {
 	Node          *types.Node
 	LastHeartbeat time.Time
 	Version       uint64 // Incarnation number for conflict resolution
+	Heartbeat     uint64 // The member's own heartbeat counter, within its incarnation
+}
+
+// beat records a gossiped heartbeat counter that has moved on. Only a
+// running member raises its counter, so this is as good as hearing from it
+// directly, however many hops the counter travelled.
+func (m *MemberInfo) beat(heartbeat uint64) {
+	m.Heartbeat = heartbeat
+	m.LastHeartbeat = time.Now()
+}
+
+// copy returns a copy of the member, including its node, that can be read
+// after the membership lock is released
+func (m *MemberInfo) copy() *MemberInfo {
+	node := *m.Node
+	return &MemberInfo{
+		Node:          &node,
+		LastHeartbeat: m.LastHeartbeat,
+		Version:       m.Version,
+		Heartbeat:     m.Heartbeat,
+	}
+}
+
+// RingStateHandler is called when a member's ring state changes
+type RingStateHandler func(nodeID string, oldState, newState types.RingState)
+
+// MemberHandler is called with a copy of a member when it is discovered
+// through gossip, or when its addresses change
+type MemberHandler func(node types.Node)
+
+// StateHandler is called when gossip changes a member's state
+type StateHandler func(nodeID string, oldState, newState types.NodeState)
+
+// WeightHandler is called when a member advertises a new weight
+type WeightHandler func(nodeID string, weight float64)
+
+// ringStateChange is a ring state change waiting to be reported
+type ringStateChange struct {
+	nodeID             string
+	oldState, newState types.RingState
+}
+
+// nodeStateChange is a member state change waiting to be reported
+type nodeStateChange struct {
+	nodeID             string
+	oldState, newState types.NodeState
+}
+
+// mergeChanges are the changes a merge made, reported once the lock is
+// released
+type mergeChanges struct {
+	ringStates []ringStateChange
+	states     []nodeStateChange
+	discovered []types.Node
 }
 
 // MembershipList manages the cluster membership
 type MembershipList struct {
-	mu       sync.RWMutex
-	members  map[string]*MemberInfo
-	selfID   string
-	version  uint64 // Local incarnation number
+	mu          sync.RWMutex
+	members     map[string]*MemberInfo
+	selfID      string
+	version     uint64 // Local incarnation number
+	onRingState RingStateHandler
+	onState     StateHandler
+	onWeight    WeightHandler
+	onMember    MemberHandler
 }
 
 // NewMembershipList creates a new membership list
@@ -83,11 +141,7 @@ func (ml *MembershipList) GetMember(nodeID string) (*MemberInfo, bool) {
 	}
 
 	// Return a copy
-	return &MemberInfo{
-		Node:          member.Node,
-		LastHeartbeat: member.LastHeartbeat,
-		Version:       member.Version,
-	}, true
+	return member.copy(), true
 }
 
 // GetAllMembers returns all members
@@ -97,11 +151,7 @@ func (ml *MembershipList) GetAllMembers() []*MemberInfo {
 
 	members := make([]*MemberInfo, 0, len(ml.members))
 	for _, m := range ml.members {
-		members = append(members, &MemberInfo{
-			Node:          m.Node,
-			LastHeartbeat: m.LastHeartbeat,
-			Version:       m.Version,
-		})
+		members = append(members, m.copy())
 	}
 	return members
 }
@@ -114,11 +164,7 @@ func (ml *MembershipList) GetAliveMembers() []*MemberInfo {
 	members := make([]*MemberInfo, 0)
 	for _, m := range ml.members {
 		if m.Node.State == types.NodeAlive {
-			members = append(members, &MemberInfo{
-				Node:          m.Node,
-				LastHeartbeat: m.LastHeartbeat,
-				Version:       m.Version,
-			})
+			members = append(members, m.copy())
 		}
 	}
 	return members
@@ -137,16 +183,142 @@ func (ml *MembershipList) UpdateState(nodeID string, state types.NodeState) {
 	}
 }
 
-// RecordHeartbeat updates the heartbeat time for a member
+// ApplyState sets a member's state as reported at an incarnation, if that
+// overrides what is known of it. It returns the member's previous state
+// and whether the report was applied.
+func (ml *MembershipList) ApplyState(nodeID string, incarnation uint64, state types.NodeState) (types.NodeState, bool) {
+	ml.mu.Lock()
+	defer ml.mu.Unlock()
+
+	member, exists := ml.members[nodeID]
+	if !exists || nodeID == ml.selfID || !member.overriddenBy(incarnation, state) {
+		return 0, false
+	}
+
+	oldState := member.Node.State
+	member.Version = incarnation
+	member.Node.State = state
+	if state == types.NodeAlive {
+		member.LastHeartbeat = time.Now()
+	}
+	return oldState, true
+}
+
+// overriddenBy reports whether a state reported at an incarnation takes
+// precedence over the member's: a higher incarnation always wins, and at
+// the same incarnation dead beats suspect, which beats alive. Only the
+// member itself raises its incarnation, so it alone can refute a suspicion.
+func (m *MemberInfo) overriddenBy(incarnation uint64, state types.NodeState) bool {
+	if incarnation != m.Version {
+		return incarnation > m.Version
+	}
+	return state > m.Node.State
+}
+
+// SetMemberHandler sets the function called when gossip reveals a new
+// member or new addresses for one
+func (ml *MembershipList) SetMemberHandler(handler MemberHandler) {
+	ml.mu.Lock()
+	defer ml.mu.Unlock()
+	ml.onMember = handler
+}
+
+// setSelfAddress records the address and gossip port this node listens
+// on, keeping an address set before
+func (ml *MembershipList) setSelfAddress(address string, gossipPort int) {
+	ml.mu.Lock()
+	defer ml.mu.Unlock()
+
+	self := ml.members[ml.selfID].Node
+	if self.Address == "" {
+		self.Address = address
+	}
+	self.GossipPort = gossipPort
+}
+
+// SetStateHandler sets the function called when gossip changes a member's
+// state
+func (ml *MembershipList) SetStateHandler(handler StateHandler) {
+	ml.mu.Lock()
+	defer ml.mu.Unlock()
+	ml.onState = handler
+}
+
+// SetRingStateHandler sets the function called when a member's ring
+// state changes, locally or through gossip
+func (ml *MembershipList) SetRingStateHandler(handler RingStateHandler) {
+	ml.mu.Lock()
+	defer ml.mu.Unlock()
+	ml.onRingState = handler
+}
+
+// SetRingState records a member's progress joining or leaving the ring.
+// A change to this node's own state raises its incarnation, so peers
+// take the new state from digests.
+func (ml *MembershipList) SetRingState(nodeID string, state types.RingState) {
+	ml.mu.Lock()
+	var changes []ringStateChange
+	if member, exists := ml.members[nodeID]; exists && member.Node.RingState != state {
+		changes = append(changes, ringStateChange{nodeID, member.Node.RingState, state})
+		member.Node.RingState = state
+		if nodeID == ml.selfID {
+			ml.incarnate(ml.version)
+		}
+	}
+	handler := ml.onRingState
+	ml.mu.Unlock()
+
+	notifyRingState(handler, changes)
+}
+
+// SetWeightHandler sets the function called when a member's weight
+// changes
+func (ml *MembershipList) SetWeightHandler(handler WeightHandler) {
+	ml.mu.Lock()
+	defer ml.mu.Unlock()
+	ml.onWeight = handler
+}
+
+// SetWeight records a member's capacity relative to other nodes. Like a
+// ring state change, a change to this node's own weight raises its
+// incarnation.
+func (ml *MembershipList) SetWeight(nodeID string, weight float64) {
+	ml.mu.Lock()
+	changed := false
+	if member, exists := ml.members[nodeID]; exists && weight > 0 && member.Node.Weight != weight {
+		member.Node.Weight = weight
+		changed = true
+		if nodeID == ml.selfID {
+			ml.incarnate(ml.version)
+		}
+	}
+	handler := ml.onWeight
+	ml.mu.Unlock()
+
+	if changed && handler != nil {
+		handler(nodeID, weight)
+	}
+}
+
+// notifyRingState reports ring state changes once the lock is released
+func notifyRingState(handler RingStateHandler, changes []ringStateChange) {
+	if handler == nil {
+		return
+	}
+	for _, change := range changes {
+		handler(change.nodeID, change.oldState, change.newState)
+	}
+}
+
+// RecordHeartbeat updates the heartbeat time for a member. It leaves the
+// member's state alone: a suspect or dead member is only alive again once
+// it refutes at a higher incarnation.
 func (ml *MembershipList) RecordHeartbeat(nodeID string) {
 	ml.mu.Lock()
 	defer ml.mu.Unlock()
 
 	if member, exists := ml.members[nodeID]; exists {
 		member.LastHeartbeat = time.Now()
-		if member.Node.State != types.NodeAlive {
-			member.Node.State = types.NodeAlive
-		}
 	}
 }
 
@@ -160,54 +332,133 @@ func (ml *MembershipList) GetStaleMembers(threshold time.Duration) []*MemberInfo
 
 	for _, m := range ml.members {
 		if m.Node.ID != ml.selfID && now.Sub(m.LastHeartbeat) > threshold {
-			stale = append(stale, &MemberInfo{
-				Node:          m.Node,
-				LastHeartbeat: m.LastHeartbeat,
-				Version:       m.Version,
-			})
+			stale = append(stale, m.copy())
 		}
 	}
 	return stale
 }
 
-// Merge merges another membership list into this one
+// Merge merges another membership list into this one. A known member
+// takes the gossiped state only if it overrides its own, by incarnation
+// and then state; gossip about this node is ignored.
 func (ml *MembershipList) Merge(other map[string]types.NodeInfo) {
 	ml.mu.Lock()
-	defer ml.mu.Unlock()
+	changes := ml.merge(other)
+	handler, stateHandler, memberHandler := ml.onRingState, ml.onState, ml.onMember
+	ml.mu.Unlock()
+
+	if memberHandler != nil {
+		for _, node := range changes.discovered {
+			memberHandler(node)
+		}
+	}
+	notifyRingState(handler, changes.ringStates)
+	notifyStates(stateHandler, changes.states)
+}
 
+// notifyStates reports member state changes once the lock is released
+func notifyStates(handler StateHandler, changes []nodeStateChange) {
+	if handler == nil {
+		return
+	}
+	for _, change := range changes {
+		handler(change.nodeID, change.oldState, change.newState)
+	}
+}
+
+// merge applies another membership list and returns the changes it made.
+// The caller must hold mu.
+func (ml *MembershipList) merge(other map[string]types.NodeInfo) mergeChanges {
+	var changes mergeChanges
 	for nodeID, info := range other {
 		if nodeID == ml.selfID {
 			continue // Don't update self from gossip
 		}
 
+		state := parseNodeState(info.State)
 		existing, exists := ml.members[nodeID]
 		if !exists {
 			// New member
-			state := types.NodeAlive
-			if info.State == "suspect" {
-				state = types.NodeSuspect
-			} else if info.State == "dead" {
-				state = types.NodeDead
-			}
-
 			ml.members[nodeID] = &MemberInfo{
 				Node: &types.Node{
-					ID:       nodeID,
-					Address:  info.Address,
-					State:    state,
-					LastSeen: info.LastSeen,
+					ID:         nodeID,
+					Address:    info.Address,
+					Port:       info.Port,
+					GossipPort: info.GossipPort,
+					State:      state,
+					LastSeen:   info.LastSeen,
+					TokenRing:  info.Tokens,
+					Datacenter: info.Datacenter,
+					Rack:       info.Rack,
+					RingState:  info.RingState,
+					Weight:     info.Weight,
 				},
 				LastHeartbeat: info.LastSeen,
-				Version:       1,
+				Version:       info.Incarnation,
+				Heartbeat:     info.Heartbeat,
+			}
+			changes.discovered = append(changes.discovered, *ml.members[nodeID].Node)
+			if info.RingState != "" {
+				changes.ringStates = append(changes.ringStates, ringStateChange{nodeID, "", info.RingState})
 			}
 		} else {
+			newer := info.Incarnation > existing.Version
+			fresher := info.Incarnation == existing.Version && info.LastSeen.After(existing.LastHeartbeat)
+			if existing.overriddenBy(info.Incarnation, state) {
+				if existing.Node.State != state {
+					changes.states = append(changes.states, nodeStateChange{nodeID, existing.Node.State, state})
+				}
+				existing.Version = info.Incarnation
+				existing.Node.State = state
+			}
+			// A member first heard of without tokens is placed once they arrive
+			discovered := false
+			if len(info.Tokens) > 0 && info.Incarnation >= existing.Version {
+				discovered = len(existing.Node.TokenRing) == 0
+				existing.Node.TokenRing = info.Tokens
+			}
+			if newer || (info.Incarnation == existing.Version && info.Heartbeat > existing.Heartbeat) {
+				existing.beat(info.Heartbeat)
+			}
+
 			// Update if newer
-			if info.LastSeen.After(existing.LastHeartbeat) {
-				existing.LastHeartbeat = info.LastSeen
+			if newer || fresher {
+				if info.LastSeen.After(existing.LastHeartbeat) {
+					existing.LastHeartbeat = info.LastSeen
+				}
+				moved := existing.Node.Address != info.Address
 				existing.Node.Address = info.Address
+				if info.Port != 0 && info.Port != existing.Node.Port {
+					existing.Node.Port, moved = info.Port, true
+				}
+				if info.GossipPort != 0 && info.GossipPort != existing.Node.GossipPort {
+					existing.Node.GossipPort, moved = info.GossipPort, true
+				}
+				existing.Node.Datacenter = info.Datacenter
+				existing.Node.Rack = info.Rack
+				if existing.Node.RingState != info.RingState {
+					changes.ringStates = append(changes.ringStates, ringStateChange{nodeID, existing.Node.RingState, info.RingState})
+					existing.Node.RingState = info.RingState
+				}
+				discovered = discovered || moved
+			}
+			if discovered {
+				changes.discovered = append(changes.discovered, *existing.Node)
 			}
 		}
 	}
+	return changes
+}
+
+// parseNodeState converts a gossiped state name to a NodeState
+func parseNodeState(s string) types.NodeState {
+	switch s {
+	case types.NodeSuspect.String():
+		return types.NodeSuspect
+	case types.NodeDead.String():
+		return types.NodeDead
+	}
+	return types.NodeAlive
 }
 
 // ToGossipFormat converts the membership list to gossip message format
@@ -217,16 +468,154 @@ func (ml *MembershipList) ToGossipFormat() map[string]types.NodeInfo {
 
 	result := make(map[string]types.NodeInfo)
 	for nodeID, m := range ml.members {
-		result[nodeID] = types.NodeInfo{
-			ID:       nodeID,
-			Address:  m.Node.Address,
-			State:    m.Node.State.String(),
-			LastSeen: m.LastHeartbeat,
-		}
+		result[nodeID] = m.info(nodeID)
 	}
 	return result
 }
 
+// info converts the member to its gossip entry
+func (m *MemberInfo) info(nodeID string) types.NodeInfo {
+	return types.NodeInfo{
+		ID:          nodeID,
+		Address:     m.Node.Address,
+		Port:        m.Node.Port,
+		GossipPort:  m.Node.GossipPort,
+		State:       m.Node.State.String(),
+		Incarnation: m.Version,
+		Heartbeat:   m.Heartbeat,
+		LastSeen:    m.LastHeartbeat,
+		Datacenter:  m.Node.Datacenter,
+		Rack:        m.Node.Rack,
+		RingState:   m.Node.RingState,
+		Weight:      m.Node.Weight,
+		Tokens:      m.Node.TokenRing,
+	}
+}
+
+// Beat raises this node's heartbeat counter, once per gossip round
+func (ml *MembershipList) Beat() {
+	ml.mu.Lock()
+	defer ml.mu.Unlock()
+	self := ml.members[ml.selfID]
+	self.beat(self.Heartbeat + 1)
+}
+
+// Digest summarizes every member by incarnation, state and heartbeat
+func (ml *MembershipList) Digest() []types.MemberDigest {
+	ml.mu.RLock()
+	defer ml.mu.RUnlock()
+
+	digests := make([]types.MemberDigest, 0, len(ml.members))
+	for nodeID, m := range ml.members {
+		digests = append(digests, m.digest(nodeID))
+	}
+	return digests
+}
+
+// digest summarizes the member
+func (m *MemberInfo) digest(nodeID string) types.MemberDigest {
+	return types.MemberDigest{
+		NodeID:      nodeID,
+		Incarnation: m.Version,
+		State:       m.Node.State.String(),
+		Heartbeat:   m.Heartbeat,
+	}
+}
+
+// ApplyDigests takes the state and heartbeat of members a peer knows at
+// the same incarnation as we do. Only a new incarnation can change a
+// member's details, so nothing else is missed.
+func (ml *MembershipList) ApplyDigests(digests []types.MemberDigest) {
+	ml.mu.Lock()
+	changes := ml.applyDigests(digests)
+	stateHandler := ml.onState
+	ml.mu.Unlock()
+
+	notifyStates(stateHandler, changes)
+}
+
+// applyDigests applies digests and returns the state changes they made.
+// The caller must hold mu.
+func (ml *MembershipList) applyDigests(digests []types.MemberDigest) []nodeStateChange {
+	var changes []nodeStateChange
+	for _, d := range digests {
+		m, exists := ml.members[d.NodeID]
+		if !exists || d.Incarnation != m.Version {
+			continue
+		}
+
+		// Our own counter may lag one we gossiped before a restart
+		if d.NodeID == ml.selfID {
+			if d.Heartbeat > m.Heartbeat {
+				m.Heartbeat = d.Heartbeat
+			}
+			continue
+		}
+
+		if state := parseNodeState(d.State); m.overriddenBy(d.Incarnation, state) {
+			changes = append(changes, nodeStateChange{d.NodeID, m.Node.State, state})
+			m.Node.State = state
+		}
+		if d.Heartbeat > m.Heartbeat {
+			m.beat(d.Heartbeat)
+		}
+	}
+	return changes
+}
+
+// Reconcile compares a peer's digests with our membership, first applying
+// what the peer knows newer at the same incarnation. It returns the
+// entries the peer lacks or holds at an older incarnation, digests of the
+// members we know further along at the same incarnation, and the members
+// the peer holds at a newer incarnation, whose entries we want.
+func (ml *MembershipList) Reconcile(digests []types.MemberDigest) (map[string]types.NodeInfo, []types.MemberDigest, []string) {
+	ml.mu.Lock()
+	changes := ml.applyDigests(digests)
+
+	push := make(map[string]types.NodeInfo)
+	var ahead []types.MemberDigest
+	var want []string
+	seen := make(map[string]bool, len(digests))
+	for _, d := range digests {
+		seen[d.NodeID] = true
+		m, exists := ml.members[d.NodeID]
+		switch {
+		case !exists || d.Incarnation > m.Version:
+			if d.NodeID != ml.selfID {
+				want = append(want, d.NodeID)
+			}
+		case d.Incarnation < m.Version:
+			push[d.NodeID] = m.info(d.NodeID)
+		case parseNodeState(d.State) < m.Node.State || d.Heartbeat < m.Heartbeat:
+			ahead = append(ahead, m.digest(d.NodeID))
+		}
+	}
+	for nodeID, m := range ml.members {
+		if !seen[nodeID] {
+			push[nodeID] = m.info(nodeID)
+		}
+	}
+	stateHandler := ml.onState
+	ml.mu.Unlock()
+
+	notifyStates(stateHandler, changes)
+	return push, ahead, want
+}
+
+// Entries returns the gossip entries of the given members we know
+func (ml *MembershipList) Entries(nodeIDs []string) map[string]types.NodeInfo {
+	ml.mu.RLock()
+	defer ml.mu.RUnlock()
+
+	entries := make(map[string]types.NodeInfo, len(nodeIDs))
+	for _, nodeID := range nodeIDs {
+		if m, exists := ml.members[nodeID]; exists {
+			entries[nodeID] = m.info(nodeID)
+		}
+	}
+	return entries
+}
+
 // Size returns the number of members
 func (ml *MembershipList) Size() int {
 	ml.mu.RLock()
@@ -238,7 +627,36 @@ func (ml *MembershipList) Size() int {
 func (ml *MembershipList) IncrementVersion() {
 	ml.mu.Lock()
 	defer ml.mu.Unlock()
-	ml.version++
+	ml.incarnate(ml.version)
+}
+
+// incarnate sets the local incarnation just above the given one. The
+// caller must hold mu.
+func (ml *MembershipList) incarnate(above uint64) {
+	ml.version = above + 1
+	ml.members[ml.selfID].Version = ml.version
+}
+
+// Incarnation returns the local incarnation number
+func (ml *MembershipList) Incarnation() uint64 {
+	ml.mu.RLock()
+	defer ml.mu.RUnlock()
+	return ml.version
+}
+
+// Refute raises the local incarnation above one this node was suspected
+// or declared dead at, so its alive state overrides the rumor wherever it
+// spreads. It returns the new incarnation, or false if the rumor is older
+// than the current one and already refuted.
+func (ml *MembershipList) Refute(incarnation uint64) (uint64, bool) {
+	ml.mu.Lock()
+	defer ml.mu.Unlock()
+
+	if incarnation < ml.version {
+		return ml.version, false
+	}
+	ml.incarnate(incarnation)
+	return ml.version, true
 }
 
 // GetSelf returns info about the local node
@@ -0,0 +1,153 @@
+package gossip
+
+import (
+	"testing"
+
+	"github.com/mini-dynamo/mini-dynamo/pkg/types"
+)
+
+func TestMergePrecedence(t *testing.T) {
+	tests := []struct {
+		name        string
+		incarnation uint64
+		state       string
+		want        types.NodeState
+		wantVersion uint64
+	}{
+		{"stale alive", 1, "alive", types.NodeSuspect, 2},
+		{"same alive", 2, "alive", types.NodeSuspect, 2},
+		{"same suspect", 2, "suspect", types.NodeSuspect, 2},
+		{"same dead", 2, "dead", types.NodeDead, 2},
+		{"stale dead", 1, "dead", types.NodeSuspect, 2},
+		{"newer alive", 3, "alive", types.NodeAlive, 3},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ml := NewMembershipList("a")
+			ml.Merge(map[string]types.NodeInfo{
+				"b": {ID: "b", State: "suspect", Incarnation: 2},
+			})
+
+			var changes []types.NodeState
+			ml.SetStateHandler(func(nodeID string, oldState, newState types.NodeState) {
+				changes = append(changes, newState)
+			})
+			ml.Merge(map[string]types.NodeInfo{
+				"b": {ID: "b", State: tt.state, Incarnation: tt.incarnation},
+			})
+
+			member, _ := ml.GetMember("b")
+			if member.Node.State != tt.want || member.Version != tt.wantVersion {
+				t.Errorf("Expected %s at incarnation %d, got %s at %d",
+					tt.want, tt.wantVersion, member.Node.State, member.Version)
+			}
+			if changed := tt.want != types.NodeSuspect; changed != (len(changes) == 1) {
+				t.Errorf("Expected a state change to be reported: %v, got %v", changed, changes)
+			}
+		})
+	}
+}
+
+func TestRefute(t *testing.T) {
+	ml := NewMembershipList("a")
+
+	if incarnation, ok := ml.Refute(1); !ok || incarnation != 2 {
+		t.Fatalf("Expected to refute at incarnation 2, got %d (%v)", incarnation, ok)
+	}
+	if _, ok := ml.Refute(1); ok {
+		t.Error("Expected a suspicion at an older incarnation to be ignored")
+	}
+	if info := ml.ToGossipFormat()["a"]; info.Incarnation != 2 || info.State != "alive" {
+		t.Errorf("Expected to gossip alive at incarnation 2, got %s at %d", info.State, info.Incarnation)
+	}
+
+	// Gossip about ourselves never overrides our own state
+	ml.Merge(map[string]types.NodeInfo{"a": {ID: "a", State: "dead", Incarnation: 5}})
+	if self := ml.GetSelf(); self.Node.State != types.NodeAlive || self.Version != 2 {
+		t.Errorf("Expected self to stay alive at incarnation 2, got %s at %d", self.Node.State, self.Version)
+	}
+}
+
+func TestReconcile(t *testing.T) {
+	ml := NewMembershipList("a")
+	ml.Merge(map[string]types.NodeInfo{
+		"b": {ID: "b", State: "alive", Incarnation: 2, Heartbeat: 5},
+		"c": {ID: "c", State: "alive", Incarnation: 1, Heartbeat: 3},
+		"d": {ID: "d", State: "alive", Incarnation: 1, Heartbeat: 1},
+		"f": {ID: "f", State: "alive", Incarnation: 2, Heartbeat: 1},
+	})
+	var changes []string
+	ml.SetStateHandler(func(nodeID string, oldState, newState types.NodeState) {
+		changes = append(changes, nodeID+" "+newState.String())
+	})
+
+	push, ahead, want := ml.Reconcile([]types.MemberDigest{
+		{NodeID: "b", Incarnation: 2, State: "suspect", Heartbeat: 7}, // Peer further along
+		{NodeID: "c", Incarnation: 1, State: "alive", Heartbeat: 1},   // We are further along
+		{NodeID: "d", Incarnation: 3, State: "alive", Heartbeat: 0},   // Peer has a newer incarnation
+		{NodeID: "e", Incarnation: 1, State: "alive", Heartbeat: 4},   // Unknown to us
+		{NodeID: "f", Incarnation: 1, State: "alive", Heartbeat: 9},   // Peer has an older incarnation
+	})
+
+	b, _ := ml.GetMember("b")
+	if b.Node.State != types.NodeSuspect || b.Heartbeat != 7 {
+		t.Errorf("Expected b suspect at heartbeat 7, got %s at %d", b.Node.State, b.Heartbeat)
+	}
+	if len(changes) != 1 || changes[0] != "b suspect" {
+		t.Errorf("Expected b's state change to be reported, got %v", changes)
+	}
+	if len(ahead) != 1 || ahead[0].NodeID != "c" || ahead[0].Heartbeat != 3 {
+		t.Errorf("Expected to send back c's digest at heartbeat 3, got %v", ahead)
+	}
+	if len(want) != 2 || want[0] != "d" || want[1] != "e" {
+		t.Errorf("Expected to want d and e, got %v", want)
+	}
+	if len(push) != 2 || push["a"].ID != "a" || push["f"].Incarnation != 2 {
+		t.Errorf("Expected to push a and f at incarnation 2, got %v", push)
+	}
+}
+
+func TestSelfChangesRaiseIncarnation(t *testing.T) {
+	ml := NewMembershipList("a")
+
+	ml.SetRingState("a", types.RingJoining)
+	ml.SetWeight("a", 2)
+	ml.SetWeight("a", 2) // Unchanged
+	if incarnation := ml.Incarnation(); incarnation != 3 {
+		t.Errorf("Expected incarnation 3 after two changes, got %d", incarnation)
+	}
+
+	// Peers at the old incarnation take the new entry in full
+	peer := NewMembershipList("b")
+	peer.Merge(map[string]types.NodeInfo{"a": {ID: "a", State: "alive", Incarnation: 1}})
+	push, _, _ := ml.Reconcile(peer.Digest())
+	peer.Merge(push)
+	if a, _ := peer.GetMember("a"); a.Node.RingState != types.RingJoining || a.Version != 3 {
+		t.Errorf("Expected b to see a joining at incarnation 3, got %q at %d", a.Node.RingState, a.Version)
+	}
+}
+
+func TestMergeTokens(t *testing.T) {
+	ml := NewMembershipList("a")
+	var discovered [][]uint64
+	ml.SetMemberHandler(func(node types.Node) {
+		discovered = append(discovered, node.TokenRing)
+	})
+
+	// b is heard of without tokens, then placed once they arrive
+	ml.Merge(map[string]types.NodeInfo{"b": {ID: "b", State: "alive", Incarnation: 2}})
+	ml.Merge(map[string]types.NodeInfo{"b": {ID: "b", State: "alive", Incarnation: 2, Tokens: []uint64{10, 20}}})
+	if len(discovered) != 2 || len(discovered[1]) != 2 {
+		t.Fatalf("Expected b to be reported again with its tokens, got %v", discovered)
+	}
+
+	// Tokens from an older incarnation are ignored
+	ml.Merge(map[string]types.NodeInfo{"b": {ID: "b", State: "alive", Incarnation: 1, Tokens: []uint64{30}}})
+	if info := ml.ToGossipFormat()["b"]; len(info.Tokens) != 2 || info.Tokens[0] != 10 {
+		t.Errorf("Expected b gossiped at tokens [10 20], got %v", info.Tokens)
+	}
+	if len(discovered) != 2 {
+		t.Errorf("Expected no further reports, got %v", discovered)
+	}
+}
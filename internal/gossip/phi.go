@@ -0,0 +1,136 @@
+package gossip
+
+import (
+	"math"
+	"sync"
+	"time"
+)
+
+// Failure detectors accepted in the config
+const (
+	DetectorTimeout = "timeout"
+	DetectorPhi     = "phi"
+)
+
+const (
+	phiWindowSize = 1000                   // Inter-arrival times kept per member
+	phiMinSamples = 3                      // Inter-arrival times needed before phi is used
+	phiMinStdDev  = 100 * time.Millisecond // Keeps phi from spiking when heartbeats are very regular
+)
+
+// arrivalWindow is a sliding window of the times between heartbeats from
+// one member, in milliseconds
+type arrivalWindow struct {
+	last      time.Time
+	intervals []float64
+	next      int // Slot the next interval overwrites once the window is full
+	sum       float64
+	sumSq     float64
+}
+
+// add records a heartbeat arriving at now
+func (w *arrivalWindow) add(now time.Time) {
+	if !w.last.IsZero() {
+		interval := float64(now.Sub(w.last)) / float64(time.Millisecond)
+		if len(w.intervals) < phiWindowSize {
+			w.intervals = append(w.intervals, interval)
+		} else {
+			old := w.intervals[w.next]
+			w.sum -= old
+			w.sumSq -= old * old
+			w.intervals[w.next] = interval
+			w.next = (w.next + 1) % phiWindowSize
+		}
+		w.sum += interval
+		w.sumSq += interval * interval
+	}
+	w.last = now
+}
+
+// phi returns the suspicion level at now: -log10 of the probability that
+// a heartbeat arrives this late, with inter-arrival times taken as
+// normally distributed. A phi of 8 means the silence has a one in 10^8
+// chance under the observed distribution. It reports false until the
+// window holds enough samples.
+func (w *arrivalWindow) phi(now time.Time) (float64, bool) {
+	n := float64(len(w.intervals))
+	if len(w.intervals) < phiMinSamples {
+		return 0, false
+	}
+
+	mean := w.sum / n
+	stdDev := math.Sqrt(math.Max(w.sumSq/n-mean*mean, 0))
+	minStdDev := float64(phiMinStdDev) / float64(time.Millisecond)
+	if stdDev < minStdDev {
+		stdDev = minStdDev
+	}
+	elapsed := float64(now.Sub(w.last)) / float64(time.Millisecond)
+
+	// Logistic approximation of the normal distribution's tail, which
+	// stays finite far beyond the mean
+	y := (elapsed - mean) / stdDev
+	e := math.Exp(-y * (1.5976 + 0.070566*y*y))
+	if elapsed > mean {
+		return -math.Log10(e / (1 + e)), true
+	}
+	return -math.Log10(1 - 1/(1+e)), true
+}
+
+// phiAccrual is a phi accrual failure detector (Hayashibara et al.): rather
+// than a fixed timeout, it suspects a member once its silence is unlikely
+// given how regularly it has been heard from, so it adapts to both busy
+// and quiet networks.
+type phiAccrual struct {
+	mu        sync.Mutex
+	threshold float64
+	windows   map[string]*arrivalWindow
+}
+
+// newPhiAccrual creates a phi accrual detector that suspects members whose
+// phi exceeds threshold
+func newPhiAccrual(threshold float64) *phiAccrual {
+	return &phiAccrual{
+		threshold: threshold,
+		windows:   make(map[string]*arrivalWindow),
+	}
+}
+
+// heartbeat records a heartbeat from a member
+func (pa *phiAccrual) heartbeat(nodeID string, now time.Time) {
+	pa.mu.Lock()
+	defer pa.mu.Unlock()
+
+	w, exists := pa.windows[nodeID]
+	if !exists {
+		w = &arrivalWindow{}
+		pa.windows[nodeID] = w
+	}
+	w.add(now)
+}
+
+// phi returns a member's suspicion level at now, or false if it has not
+// been heard from often enough to tell
+func (pa *phiAccrual) phi(nodeID string, now time.Time) (float64, bool) {
+	pa.mu.Lock()
+	defer pa.mu.Unlock()
+
+	w, exists := pa.windows[nodeID]
+	if !exists {
+		return 0, false
+	}
+	return w.phi(now)
+}
+
+// levels returns the suspicion level of every member with enough samples
+func (pa *phiAccrual) levels(now time.Time) map[string]float64 {
+	pa.mu.Lock()
+	defer pa.mu.Unlock()
+
+	levels := make(map[string]float64, len(pa.windows))
+	for nodeID, w := range pa.windows {
+		if phi, ok := w.phi(now); ok {
+			levels[nodeID] = phi
+		}
+	}
+	return levels
+}
@@ -0,0 +1,57 @@
+package gossip
+
+import (
+	"testing"
+	"time"
+)
+
+func TestPhiGrowsWithSilence(t *testing.T) {
+	pa := newPhiAccrual(8)
+	start := time.Now()
+
+	// A heartbeat every second, give or take 50ms
+	now := start
+	for i := 0; i < 20; i++ {
+		now = start.Add(time.Duration(i)*time.Second + time.Duration(i%3-1)*50*time.Millisecond)
+		pa.heartbeat("b", now)
+	}
+
+	var last float64
+	for _, silence := range []time.Duration{500 * time.Millisecond, time.Second, 2 * time.Second, 3 * time.Second} {
+		phi, ok := pa.phi("b", now.Add(silence))
+		if !ok {
+			t.Fatal("Expected phi once enough heartbeats arrived")
+		}
+		if phi < last {
+			t.Errorf("Expected phi to grow with silence, got %.2f after %v, below %.2f", phi, silence, last)
+		}
+		last = phi
+	}
+
+	if phi, _ := pa.phi("b", now.Add(time.Second)); phi > 1 {
+		t.Errorf("Expected a heartbeat on time to be unsuspicious, got phi %.2f", phi)
+	}
+	if phi, _ := pa.phi("b", now.Add(3*time.Second)); phi < pa.threshold {
+		t.Errorf("Expected three missed heartbeats to exceed the threshold, got phi %.2f", phi)
+	}
+}
+
+func TestPhiAdaptsToHeartbeatRate(t *testing.T) {
+	pa := newPhiAccrual(8)
+	start := time.Now()
+
+	// The same silence is suspicious for a chatty member but not a quiet one
+	for i := 0; i < 20; i++ {
+		pa.heartbeat("fast", start.Add(time.Duration(i)*200*time.Millisecond))
+		pa.heartbeat("slow", start.Add(time.Duration(i)*5*time.Second))
+	}
+	fastPhi, _ := pa.phi("fast", start.Add(19*200*time.Millisecond+2*time.Second))
+	slowPhi, _ := pa.phi("slow", start.Add(19*5*time.Second+2*time.Second))
+
+	if fastPhi < pa.threshold || slowPhi > 1 {
+		t.Errorf("Expected 2s of silence to suspect only the fast member, got phi %.2f and %.2f", fastPhi, slowPhi)
+	}
+	if _, ok := pa.phi("unknown", start); ok {
+		t.Error("Expected no phi for a member never heard from")
+	}
+}
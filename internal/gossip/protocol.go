@@ -9,19 +9,36 @@ import (
 	"time"
 
 	"github.com/mini-dynamo/mini-dynamo/internal/config"
+	"github.com/mini-dynamo/mini-dynamo/internal/versioning"
 	"github.com/mini-dynamo/mini-dynamo/pkg/types"
 )
 
+// RingSource advertises the local ring version in gossip and learns of
+// the versions peers advertise. The tokens of each node are sent to nodes
+// joining the cluster.
+type RingSource interface {
+	RingVersion() types.RingVersion
+	ObserveRingVersion(nodeID string, v types.RingVersion)
+	NodeTokens(nodeID string) []uint64
+}
+
 // Protocol implements the gossip protocol for membership dissemination
 type Protocol struct {
 	config     *config.Config
 	membership *MembershipList
 	detector   *FailureDetector
 	conn       *net.UDPConn
+	stream     *net.TCPListener // Receives messages too large for a datagram
 	stopCh     chan struct{}
 	wg         sync.WaitGroup
 	mu         sync.RWMutex
 	peers      map[string]*net.UDPAddr // nodeID -> address
+	clock      *versioning.HLC         // Advanced by and stamped on gossip (optional)
+	ring       RingSource              // Ring version exchanged in gossip (optional)
+	swim       swimState               // SWIM probes in flight and suspicions to spread
+	probeStats ProbeStats
+	joined     chan struct{}                       // Closed once a seed accepts our join
+	drop       func(msg *types.GossipMessage) bool // Discards incoming messages, to simulate lossy links in tests
 }
 
 // NewProtocol creates a new gossip protocol instance
@@ -32,9 +49,24 @@ func NewProtocol(cfg *config.Config, membership *MembershipList, detector *Failu
 		detector:   detector,
 		stopCh:     make(chan struct{}),
 		peers:      make(map[string]*net.UDPAddr),
+		joined:     make(chan struct{}),
+		swim: swimState{
+			pending: make(map[uint64]chan struct{}),
+			relays:  make(map[uint64]relay),
+		},
 	}
 }
 
+// SetClock sets the hybrid logical clock carried by gossip messages
+func (p *Protocol) SetClock(clock *versioning.HLC) {
+	p.clock = clock
+}
+
+// SetRing sets the ring whose version is carried by gossip messages
+func (p *Protocol) SetRing(ring RingSource) {
+	p.ring = ring
+}
+
 // Start begins the gossip protocol
 func (p *Protocol) Start() error {
 	// Create UDP listener
@@ -43,20 +75,29 @@ func (p *Protocol) Start() error {
 		return err
 	}
 
-	conn, err := net.ListenUDP("udp", addr)
+	conn, stream, err := listen(addr)
 	if err != nil {
 		return err
 	}
 	p.conn = conn
+	p.stream = stream
+	p.membership.setSelfAddress(p.config.Address, conn.LocalAddr().(*net.UDPAddr).Port)
 
-	// Start receiver
-	p.wg.Add(1)
+	// Start receivers
+	p.wg.Add(2)
 	go p.receiveLoop()
+	go p.acceptLoop()
 
 	// Start gossip sender
 	p.wg.Add(1)
 	go p.gossipLoop()
 
+	// Probe members directly; those we can reach are no longer suspected
+	// just because gossip about them is late
+	p.detector.SetProber(p.canProbe)
+	p.wg.Add(1)
+	go p.probeLoop()
+
 	log.Printf("Gossip protocol started on %s", p.config.GossipAddress())
 	return nil
 }
@@ -67,6 +108,9 @@ func (p *Protocol) Stop() {
 	if p.conn != nil {
 		p.conn.Close()
 	}
+	if p.stream != nil {
+		p.stream.Close()
+	}
 	p.wg.Wait()
 }
 
@@ -125,21 +169,80 @@ func (p *Protocol) receiveLoop() {
 	}
 }
 
-// handleMessage processes an incoming gossip message
+// handleMessage processes an incoming gossip datagram
 func (p *Protocol) handleMessage(data []byte, from *net.UDPAddr) {
 	var msg types.GossipMessage
 	if err := json.Unmarshal(data, &msg); err != nil {
 		log.Printf("Invalid gossip message from %s: %v", from, err)
 		return
 	}
+	p.process(&msg, from)
+}
+
+// process handles a gossip message received from an address, which is nil
+// if a message that came over TCP has no known gossip address
+func (p *Protocol) process(msg *types.GossipMessage, from *net.UDPAddr) {
+	if p.drop != nil && p.drop(msg) {
+		return
+	}
+
+	// Any message proves the sender is alive, and tells us its address
+	p.learnPeer(msg.FromNode, from)
+	p.detector.RecordHeartbeat(msg.FromNode, msg.Incarnation)
+	p.handleSuspicions(msg.Suspects)
 
-	// Record heartbeat from sender
-	p.detector.RecordHeartbeat(msg.FromNode)
+	switch msg.Type {
+	case types.GossipMembership, types.GossipJoin, types.GossipJoinAck,
+		types.GossipDigest, types.GossipDigestAck, types.GossipDelta:
+	default:
+		p.handleProbe(msg, from)
+		return
+	}
 
-	// Merge membership information
+	// Refute the sender's view of us if it has us suspect or dead
+	if info, ok := msg.Members[p.config.NodeID]; ok {
+		p.checkSelf(info.Incarnation, info.State, msg.FromNode)
+	}
+	for _, d := range msg.Digests {
+		if d.NodeID == p.config.NodeID {
+			p.checkSelf(d.Incarnation, d.State, msg.FromNode)
+		}
+	}
+
+	// Merge membership information and gossip with new members
 	p.membership.Merge(msg.Members)
+	p.learnPeers(msg.Members)
+
+	// A node is the authority on its own ring state and weight
+	if info, ok := msg.Members[msg.FromNode]; ok {
+		p.membership.SetRingState(msg.FromNode, info.RingState)
+		p.membership.SetWeight(msg.FromNode, info.Weight)
+	}
+
+	// Fetch the sender's ring if it is newer than ours
+	if p.ring != nil && msg.Ring != nil {
+		p.ring.ObserveRingVersion(msg.FromNode, *msg.Ring)
+	}
 
-	log.Printf("Received gossip from %s, %d members", msg.FromNode, len(msg.Members))
+	// Keep our clock ahead of the sender's
+	if p.clock != nil && msg.HLC != 0 {
+		if err := p.clock.Update(msg.HLC); err != nil {
+			log.Printf("Warning: gossip clock from %s: %v", msg.FromNode, err)
+		}
+	}
+
+	switch msg.Type {
+	case types.GossipDigest:
+		p.answerDigest(msg, from)
+	case types.GossipDigestAck:
+		p.completeDigest(msg, from)
+	case types.GossipJoin:
+		p.acceptJoin(msg.FromNode, from)
+	case types.GossipJoinAck:
+		p.completeJoin(msg.FromNode, len(msg.Members))
+	case types.GossipMembership:
+		log.Printf("Received gossip from %s, %d members", msg.FromNode, len(msg.Members))
+	}
 }
 
 // gossipLoop periodically sends gossip messages
@@ -159,7 +262,8 @@ func (p *Protocol) gossipLoop() {
 	}
 }
 
-// gossipToRandomPeer sends membership info to a random peer
+// gossipToRandomPeer raises our heartbeat and sends a digest of our
+// membership to a random peer
 func (p *Protocol) gossipToRandomPeer() {
 	p.mu.RLock()
 	peerIDs := make([]string, 0, len(p.peers))
@@ -183,23 +287,28 @@ func (p *Protocol) gossipToRandomPeer() {
 		return
 	}
 
-	// Build gossip message
+	// Send gossip
+	p.membership.Beat()
+	p.send(targetAddr, p.digestMessage())
+}
+
+// membershipMessage builds a gossip message with our membership list
+func (p *Protocol) membershipMessage() types.GossipMessage {
 	msg := types.GossipMessage{
-		FromNode:  p.config.NodeID,
-		Members:   p.membership.ToGossipFormat(),
-		Timestamp: time.Now(),
+		Members: p.membership.ToGossipFormat(),
 	}
+	p.addVersions(&msg)
+	return msg
+}
 
-	data, err := json.Marshal(msg)
-	if err != nil {
-		log.Printf("Failed to marshal gossip: %v", err)
-		return
+// addVersions stamps a message with our clock and ring version
+func (p *Protocol) addVersions(msg *types.GossipMessage) {
+	if p.clock != nil {
+		msg.HLC = p.clock.Last()
 	}
-
-	// Send gossip
-	_, err = p.conn.WriteToUDP(data, targetAddr)
-	if err != nil {
-		log.Printf("Failed to send gossip to %s: %v", targetID, err)
+	if p.ring != nil {
+		version := p.ring.RingVersion()
+		msg.Ring = &version
 	}
 }
 
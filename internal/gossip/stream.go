@@ -0,0 +1,104 @@
+package gossip
+
+import (
+	"encoding/json"
+	"io"
+	"log"
+	"net"
+	"time"
+
+	"github.com/mini-dynamo/mini-dynamo/pkg/types"
+)
+
+const (
+	maxDatagramSize  = 65507           // Largest UDP payload over IPv4
+	maxStreamMessage = 64 << 20        // Largest gossip message accepted over TCP
+	streamTimeout    = 5 * time.Second // Deadline for sending or reading one message over TCP
+)
+
+// listen opens the UDP socket gossip is sent on and a TCP listener on the
+// same port, for messages too large for a datagram. When the port is
+// chosen by the system, another is tried if it is taken for TCP.
+func listen(addr *net.UDPAddr) (*net.UDPConn, *net.TCPListener, error) {
+	for attempt := 0; ; attempt++ {
+		conn, err := net.ListenUDP("udp", addr)
+		if err != nil {
+			return nil, nil, err
+		}
+		udpAddr := conn.LocalAddr().(*net.UDPAddr)
+		stream, err := net.ListenTCP("tcp", &net.TCPAddr{IP: udpAddr.IP, Port: udpAddr.Port})
+		if err == nil {
+			return conn, stream, nil
+		}
+		conn.Close()
+		if addr.Port != 0 || attempt == 10 {
+			return nil, nil, err
+		}
+	}
+}
+
+// acceptLoop reads each TCP connection as one gossip message
+func (p *Protocol) acceptLoop() {
+	defer p.wg.Done()
+
+	for {
+		conn, err := p.stream.Accept()
+		if err != nil {
+			select {
+			case <-p.stopCh:
+				return
+			default:
+				log.Printf("Error accepting gossip stream: %v", err)
+				continue
+			}
+		}
+
+		p.wg.Add(1)
+		go p.readStream(conn)
+	}
+}
+
+// readStream reads one gossip message from a TCP connection. Its sender is
+// answered over UDP like any other, at its known gossip address or else the
+// gossip port its own entry advertises.
+func (p *Protocol) readStream(conn net.Conn) {
+	defer p.wg.Done()
+	defer conn.Close()
+
+	conn.SetReadDeadline(time.Now().Add(streamTimeout))
+	data, err := io.ReadAll(io.LimitReader(conn, maxStreamMessage))
+	if err != nil {
+		log.Printf("Error reading gossip stream from %s: %v", conn.RemoteAddr(), err)
+		return
+	}
+
+	var msg types.GossipMessage
+	if err := json.Unmarshal(data, &msg); err != nil {
+		log.Printf("Invalid gossip message from %s: %v", conn.RemoteAddr(), err)
+		return
+	}
+
+	from := p.peerAddr(msg.FromNode)
+	if info, ok := msg.Members[msg.FromNode]; from == nil && ok && info.GossipPort != 0 {
+		from = &net.UDPAddr{IP: conn.RemoteAddr().(*net.TCPAddr).IP, Port: info.GossipPort}
+	}
+	p.process(&msg, from)
+}
+
+// sendStream sends a gossip message too large for a datagram over TCP, to
+// the port the member gossips on
+func (p *Protocol) sendStream(addr *net.UDPAddr, data []byte) {
+	defer p.wg.Done()
+
+	conn, err := net.DialTimeout("tcp", addr.String(), streamTimeout)
+	if err != nil {
+		log.Printf("Failed to send gossip stream to %s: %v", addr, err)
+		return
+	}
+	defer conn.Close()
+
+	conn.SetWriteDeadline(time.Now().Add(streamTimeout))
+	if _, err := conn.Write(data); err != nil {
+		log.Printf("Failed to send gossip stream to %s: %v", addr, err)
+	}
+}
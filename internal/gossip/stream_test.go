@@ -0,0 +1,43 @@
+package gossip
+
+import (
+	"encoding/json"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/mini-dynamo/mini-dynamo/pkg/types"
+)
+
+func TestLargeJoinAckUsesTCP(t *testing.T) {
+	ring := &testRing{tokens: map[string][]uint64{}}
+	seed, _ := newJoinTestProtocol(t, "a", 8001, ring)
+	b, _ := newJoinTestProtocol(t, "b", 8002, ring)
+
+	// Members the seed knows but nobody gossips with
+	members := make(map[string]types.NodeInfo)
+	for i := 0; i < 600; i++ {
+		id := fmt.Sprintf("member-%03d", i)
+		members[id] = types.NodeInfo{ID: id, Address: "10.0.0.1", Port: 8000 + i, State: "alive", Incarnation: 1}
+	}
+	seed.membership.Merge(members)
+	if data, _ := json.Marshal(seed.membership.ToGossipFormat()); len(data) <= maxDatagramSize {
+		t.Fatalf("Expected the seed's membership to exceed a datagram, got %d bytes", len(data))
+	}
+
+	if err := b.Join([]string{seed.conn.LocalAddr().String()}); err != nil {
+		t.Fatalf("Failed to join: %v", err)
+	}
+	select {
+	case <-b.Joined():
+	case <-time.After(3 * time.Second):
+		t.Fatal("b did not join")
+	}
+
+	if size := b.membership.Size(); size != 602 {
+		t.Errorf("Expected b to learn all 602 members, got %d", size)
+	}
+	if _, ok := seed.membership.GetMember("b"); !ok {
+		t.Error("Expected the seed to learn b")
+	}
+}
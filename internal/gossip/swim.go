@@ -0,0 +1,373 @@
+package gossip
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"math"
+	"math/rand"
+	"net"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/mini-dynamo/mini-dynamo/pkg/types"
+)
+
+// relay is a ping sent on behalf of a member's ping_req, whose ack is
+// forwarded back to it
+type relay struct {
+	addr    *net.UDPAddr // Member that asked
+	seq     uint64       // Sequence number of its probe
+	expires time.Time
+}
+
+// rumor is a suspicion piggybacked on outgoing messages a limited number
+// of times
+type rumor struct {
+	suspicion types.Suspicion
+	left      int // Transmissions remaining
+}
+
+// swimState holds the probes in flight and rumors to disseminate
+type swimState struct {
+	seq     uint64 // Last probe sequence number, updated atomically
+	mu      sync.Mutex
+	pending map[uint64]chan struct{} // Probe sequence number -> closed on ack
+	relays  map[uint64]relay         // Relayed ping sequence number -> requester
+	order   []string                 // Members left to probe this round
+	rumors  []*rumor
+}
+
+// ProbeStats counts the outcomes of SWIM probes sent by this node
+type ProbeStats struct {
+	Probes       uint64 `json:"probes"`
+	DirectAcks   uint64 `json:"direct_acks"`
+	IndirectAcks uint64 `json:"indirect_acks"` // Probes answered only through ping_req
+	Failed       uint64 `json:"failed"`        // Probes that led to suspicion
+	Relayed      uint64 `json:"relayed"`       // Pings sent on behalf of other members
+}
+
+// probeLoop probes one member per probe interval, SWIM style: a direct
+// ping, then ping_req through other members if no ack arrives in time
+func (p *Protocol) probeLoop() {
+	defer p.wg.Done()
+
+	ticker := time.NewTicker(p.config.ProbeInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-p.stopCh:
+			return
+		case <-ticker.C:
+			p.expireRelays()
+			if nodeID := p.nextProbeTarget(); nodeID != "" {
+				p.probe(nodeID)
+			}
+		}
+	}
+}
+
+// nextProbeTarget returns the next member to probe. Members are probed in
+// a shuffled round-robin order, so each is probed once per round and a
+// failure is found within a bounded time.
+func (p *Protocol) nextProbeTarget() string {
+	p.swim.mu.Lock()
+	defer p.swim.mu.Unlock()
+
+	for attempt := 0; attempt < 2; attempt++ {
+		for len(p.swim.order) > 0 {
+			nodeID := p.swim.order[0]
+			p.swim.order = p.swim.order[1:]
+			if p.probeable(nodeID) {
+				return nodeID
+			}
+		}
+
+		// Start a new round
+		for _, m := range p.membership.GetAllMembers() {
+			if m.Node.ID != p.config.NodeID {
+				p.swim.order = append(p.swim.order, m.Node.ID)
+			}
+		}
+		rand.Shuffle(len(p.swim.order), func(i, j int) {
+			p.swim.order[i], p.swim.order[j] = p.swim.order[j], p.swim.order[i]
+		})
+	}
+	return ""
+}
+
+// probeable reports whether a member is alive or suspect and has a known
+// address
+func (p *Protocol) probeable(nodeID string) bool {
+	member, exists := p.membership.GetMember(nodeID)
+	if !exists || member.Node.State == types.NodeDead {
+		return false
+	}
+	return p.canProbe(nodeID)
+}
+
+// canProbe reports whether a member's address is known, so its failures
+// are detected by probes
+func (p *Protocol) canProbe(nodeID string) bool {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	_, exists := p.peers[nodeID]
+	return exists
+}
+
+// probe pings a member and, if it does not answer within the probe
+// timeout, asks up to IndirectProbes other members to ping it. A member
+// that answers neither by the end of the probe interval is suspected.
+func (p *Protocol) probe(nodeID string) {
+	addr := p.peerAddr(nodeID)
+	if addr == nil {
+		return
+	}
+
+	seq := atomic.AddUint64(&p.swim.seq, 1)
+	acked := make(chan struct{})
+	p.swim.mu.Lock()
+	p.swim.pending[seq] = acked
+	p.swim.mu.Unlock()
+	defer func() {
+		p.swim.mu.Lock()
+		delete(p.swim.pending, seq)
+		p.swim.mu.Unlock()
+	}()
+
+	atomic.AddUint64(&p.probeStats.Probes, 1)
+	p.send(addr, types.GossipMessage{Type: types.GossipPing, Seq: seq, Target: nodeID})
+
+	select {
+	case <-acked:
+		// The ack itself was recorded as a heartbeat when it arrived
+		atomic.AddUint64(&p.probeStats.DirectAcks, 1)
+		return
+	case <-time.After(p.config.ProbeTimeout):
+	case <-p.stopCh:
+		return
+	}
+
+	for _, helper := range p.randomPeers(p.config.IndirectProbes, nodeID) {
+		p.send(helper, types.GossipMessage{Type: types.GossipPingReq, Seq: seq, Target: nodeID})
+	}
+
+	select {
+	case <-acked:
+		atomic.AddUint64(&p.probeStats.IndirectAcks, 1)
+		p.detector.RecordHeartbeat(nodeID, 0)
+	case <-time.After(p.config.ProbeInterval - p.config.ProbeTimeout):
+		atomic.AddUint64(&p.probeStats.Failed, 1)
+		member, exists := p.membership.GetMember(nodeID)
+		if !exists {
+			return
+		}
+		if p.detector.Suspect(nodeID, member.Version, "no ack to direct or indirect probes") {
+			p.spreadSuspicion(types.Suspicion{NodeID: nodeID, Incarnation: member.Version, From: p.config.NodeID})
+		}
+	case <-p.stopCh:
+	}
+}
+
+// handleProbe answers SWIM messages: acks pings, relays ping_req probes
+// and completes probes in flight when their ack arrives
+func (p *Protocol) handleProbe(msg *types.GossipMessage, from *net.UDPAddr) {
+	switch msg.Type {
+	case types.GossipPing:
+		p.send(from, types.GossipMessage{Type: types.GossipAck, Seq: msg.Seq, Target: p.config.NodeID})
+
+	case types.GossipPingReq:
+		target := p.peerAddr(msg.Target)
+		if target == nil {
+			return
+		}
+		seq := atomic.AddUint64(&p.swim.seq, 1)
+		p.swim.mu.Lock()
+		p.swim.relays[seq] = relay{addr: from, seq: msg.Seq, expires: time.Now().Add(p.config.ProbeInterval)}
+		p.swim.mu.Unlock()
+		atomic.AddUint64(&p.probeStats.Relayed, 1)
+		p.send(target, types.GossipMessage{Type: types.GossipPing, Seq: seq, Target: msg.Target})
+
+	case types.GossipAck:
+		p.swim.mu.Lock()
+		acked, probing := p.swim.pending[msg.Seq]
+		if probing {
+			delete(p.swim.pending, msg.Seq)
+		}
+		r, relaying := p.swim.relays[msg.Seq]
+		if relaying {
+			delete(p.swim.relays, msg.Seq)
+		}
+		p.swim.mu.Unlock()
+
+		if probing {
+			close(acked)
+		}
+		if relaying {
+			p.send(r.addr, types.GossipMessage{Type: types.GossipAck, Seq: r.seq, Target: msg.FromNode})
+		}
+	}
+}
+
+// expireRelays forgets relayed pings that were never acked
+func (p *Protocol) expireRelays() {
+	now := time.Now()
+	p.swim.mu.Lock()
+	defer p.swim.mu.Unlock()
+	for seq, r := range p.swim.relays {
+		if now.After(r.expires) {
+			delete(p.swim.relays, seq)
+		}
+	}
+}
+
+// transmissions returns how many times a rumor is sent, which grows with
+// the log of the cluster size
+func (p *Protocol) transmissions() int {
+	return 3 * int(math.Ceil(math.Log2(float64(p.membership.Size()+1))))
+}
+
+// spreadSuspicion queues a suspicion to piggyback on the next outgoing
+// messages
+func (p *Protocol) spreadSuspicion(s types.Suspicion) {
+	transmissions := p.transmissions()
+
+	p.swim.mu.Lock()
+	defer p.swim.mu.Unlock()
+	for _, r := range p.swim.rumors {
+		if r.suspicion.NodeID == s.NodeID {
+			r.suspicion, r.left = s, transmissions
+			return
+		}
+	}
+	p.swim.rumors = append(p.swim.rumors, &rumor{suspicion: s, left: transmissions})
+}
+
+// handleSuspicions applies suspicions piggybacked on a message. A node
+// newly suspected here is passed on; a suspicion of this node is refuted.
+func (p *Protocol) handleSuspicions(suspects []types.Suspicion) {
+	for _, s := range suspects {
+		if s.NodeID == p.config.NodeID {
+			p.refute(s.Incarnation, s.From)
+			continue
+		}
+		if p.detector.Suspect(s.NodeID, s.Incarnation, fmt.Sprintf("suspected by %s", s.From)) {
+			p.spreadSuspicion(s)
+		}
+	}
+}
+
+// refute answers a suspicion of this node, or a report of its death, at an
+// incarnation: it raises its own incarnation above it and sends its own
+// entry, now alive at the new incarnation, to several members at once.
+// Every later message and digest carries the new incarnation too.
+func (p *Protocol) refute(incarnation uint64, from string) {
+	refuted, ok := p.membership.Refute(incarnation)
+	if !ok {
+		return
+	}
+	log.Printf("Suspected by %s at incarnation %d, refuting at incarnation %d", from, incarnation, refuted)
+
+	self := p.membership.Entries([]string{p.config.NodeID})
+	for _, addr := range p.randomPeers(p.transmissions(), "") {
+		p.send(addr, types.GossipMessage{Type: types.GossipDelta, Members: self})
+	}
+}
+
+// send stamps a message with the sender and pending suspicions and sends
+// it to an address, over TCP if it does not fit in a datagram
+func (p *Protocol) send(addr *net.UDPAddr, msg types.GossipMessage) {
+	if addr == nil {
+		return
+	}
+	msg.FromNode = p.config.NodeID
+	msg.Incarnation = p.membership.Incarnation()
+	msg.Timestamp = time.Now()
+
+	p.swim.mu.Lock()
+	remaining := p.swim.rumors[:0]
+	for _, r := range p.swim.rumors {
+		msg.Suspects = append(msg.Suspects, r.suspicion)
+		if r.left--; r.left > 0 {
+			remaining = append(remaining, r)
+		}
+	}
+	p.swim.rumors = remaining
+	p.swim.mu.Unlock()
+
+	data, err := json.Marshal(msg)
+	if err != nil {
+		log.Printf("Failed to marshal %s message: %v", msg.Type, err)
+		return
+	}
+	if len(data) > maxDatagramSize {
+		p.wg.Add(1)
+		go p.sendStream(addr, data)
+		return
+	}
+	if _, err := p.conn.WriteToUDP(data, addr); err != nil {
+		log.Printf("Failed to send gossip to %s: %v", addr, err)
+	}
+}
+
+// peerAddr returns the address of a member, or nil if it is unknown
+func (p *Protocol) peerAddr(nodeID string) *net.UDPAddr {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	return p.peers[nodeID]
+}
+
+// randomPeers returns the addresses of up to k random alive members other
+// than the excluded one
+func (p *Protocol) randomPeers(k int, exclude string) []*net.UDPAddr {
+	var candidates []*net.UDPAddr
+	for _, m := range p.membership.GetAliveMembers() {
+		if m.Node.ID == exclude || m.Node.ID == p.config.NodeID {
+			continue
+		}
+		if addr := p.peerAddr(m.Node.ID); addr != nil {
+			candidates = append(candidates, addr)
+		}
+	}
+
+	rand.Shuffle(len(candidates), func(i, j int) {
+		candidates[i], candidates[j] = candidates[j], candidates[i]
+	})
+	if len(candidates) > k {
+		candidates = candidates[:k]
+	}
+	return candidates
+}
+
+// learnPeer records the address a member sends from. A seed registered
+// under that address instead of a member ID is replaced.
+func (p *Protocol) learnPeer(nodeID string, addr *net.UDPAddr) {
+	if nodeID == "" || nodeID == p.config.NodeID || addr == nil {
+		return
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for id, known := range p.peers {
+		if id == nodeID || !known.IP.Equal(addr.IP) || known.Port != addr.Port {
+			continue
+		}
+		if _, member := p.membership.GetMember(id); !member {
+			delete(p.peers, id)
+		}
+	}
+	p.peers[nodeID] = addr
+}
+
+// GetProbeStats returns the outcomes of probes sent by this node
+func (p *Protocol) GetProbeStats() ProbeStats {
+	return ProbeStats{
+		Probes:       atomic.LoadUint64(&p.probeStats.Probes),
+		DirectAcks:   atomic.LoadUint64(&p.probeStats.DirectAcks),
+		IndirectAcks: atomic.LoadUint64(&p.probeStats.IndirectAcks),
+		Failed:       atomic.LoadUint64(&p.probeStats.Failed),
+		Relayed:      atomic.LoadUint64(&p.probeStats.Relayed),
+	}
+}
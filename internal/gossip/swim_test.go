@@ -0,0 +1,134 @@
+package gossip
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"github.com/mini-dynamo/mini-dynamo/internal/config"
+	"github.com/mini-dynamo/mini-dynamo/pkg/types"
+)
+
+// newTestProtocols starts a gossip protocol per node ID on localhost with
+// fast probes. Every node knows every other as a member, but only learns
+// the addresses of those listed in peers. Nodes in drop discard the
+// messages it matches.
+func newTestProtocols(t *testing.T, ids []string, peers map[string][]string, drop map[string]func(*types.GossipMessage) bool) map[string]*Protocol {
+	protocols := make(map[string]*Protocol)
+	for _, id := range ids {
+		cfg := config.DefaultConfig()
+		cfg.NodeID = id
+		cfg.Address = "127.0.0.1"
+		cfg.GossipPort = 0
+		cfg.GossipInterval = time.Hour // Probes only
+		cfg.ProbeInterval = 100 * time.Millisecond
+		cfg.ProbeTimeout = 40 * time.Millisecond
+
+		membership := NewMembershipList(id)
+		for _, other := range ids {
+			if other != id {
+				membership.AddMember(&types.Node{ID: other, State: types.NodeAlive})
+			}
+		}
+		detector := NewFailureDetector(membership, time.Hour, time.Hour, nil)
+		protocols[id] = NewProtocol(cfg, membership, detector)
+		protocols[id].drop = drop[id]
+	}
+
+	for _, p := range protocols {
+		if err := p.Start(); err != nil {
+			t.Fatalf("Failed to start gossip: %v", err)
+		}
+		t.Cleanup(p.Stop)
+	}
+	for id, p := range protocols {
+		for _, peer := range peers[id] {
+			p.AddPeer(peer, protocols[peer].conn.LocalAddr().(*net.UDPAddr).String())
+		}
+	}
+	return protocols
+}
+
+func TestIndirectProbeAvoidsFalseSuspicion(t *testing.T) {
+	protocols := newTestProtocols(t, []string{"a", "b", "c"}, map[string][]string{
+		"a": {"b", "c"},
+		"b": {"a", "c"},
+		"c": {"a", "b"},
+	}, map[string]func(*types.GossipMessage) bool{
+		// Every message between a and c is lost
+		"a": func(msg *types.GossipMessage) bool { return msg.FromNode == "c" },
+		"c": func(msg *types.GossipMessage) bool { return msg.FromNode == "a" },
+	})
+
+	time.Sleep(time.Second)
+
+	if state := protocols["a"].detector.GetNodeState("c"); state != types.NodeAlive {
+		t.Errorf("Expected c to stay alive at a, got %s", state)
+	}
+	stats := protocols["a"].GetProbeStats()
+	if stats.IndirectAcks == 0 || stats.Failed != 0 {
+		t.Errorf("Expected probes of c to succeed through b, got %+v", stats)
+	}
+	if protocols["b"].GetProbeStats().Relayed == 0 {
+		t.Error("Expected b to relay pings for a")
+	}
+}
+
+func TestFailedProbeSpreadsSuspicion(t *testing.T) {
+	// b cannot reach c itself, so it only learns of the failure from a.
+	// c sends nothing and ignores everything, as if it had crashed.
+	protocols := newTestProtocols(t, []string{"a", "b", "c"}, map[string][]string{
+		"a": {"b", "c"},
+		"b": {"a"},
+	}, map[string]func(*types.GossipMessage) bool{
+		"c": func(msg *types.GossipMessage) bool { return true },
+	})
+
+	deadline := time.Now().Add(3 * time.Second)
+	for protocols["b"].detector.GetNodeState("c") != types.NodeSuspect && time.Now().Before(deadline) {
+		time.Sleep(20 * time.Millisecond)
+	}
+
+	if state := protocols["a"].detector.GetNodeState("c"); state != types.NodeSuspect {
+		t.Errorf("Expected a to suspect c, got %s", state)
+	}
+	if state := protocols["b"].detector.GetNodeState("c"); state != types.NodeSuspect {
+		t.Errorf("Expected the suspicion to reach b, got %s", state)
+	}
+}
+
+func TestSuspectedNodeRefutes(t *testing.T) {
+	protocols := newTestProtocols(t, []string{"a", "b", "c"}, map[string][]string{
+		"a": {"b", "c"},
+		"b": {"a", "c"},
+		"c": {"a", "b"},
+	}, nil)
+
+	// A false suspicion of c at its current incarnation reaches c through
+	// the next probes carrying it
+	if !protocols["a"].detector.Suspect("c", 1, "test") {
+		t.Fatal("Expected the suspicion to be applied")
+	}
+	protocols["a"].spreadSuspicion(types.Suspicion{NodeID: "c", Incarnation: 1, From: "a"})
+
+	deadline := time.Now().Add(3 * time.Second)
+	for protocols["c"].membership.Incarnation() == 1 && time.Now().Before(deadline) {
+		time.Sleep(20 * time.Millisecond)
+	}
+	if incarnation := protocols["c"].membership.Incarnation(); incarnation != 2 {
+		t.Fatalf("Expected c to refute at incarnation 2, got %d", incarnation)
+	}
+
+	for _, id := range []string{"a", "b"} {
+		for time.Now().Before(deadline) {
+			if member, _ := protocols[id].membership.GetMember("c"); member.Version == 2 {
+				break
+			}
+			time.Sleep(20 * time.Millisecond)
+		}
+		member, _ := protocols[id].membership.GetMember("c")
+		if member.Node.State != types.NodeAlive || member.Version != 2 {
+			t.Errorf("Expected %s to see c alive at incarnation 2, got %s at %d", id, member.Node.State, member.Version)
+		}
+	}
+}
@@ -0,0 +1,249 @@
+package replication
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/mini-dynamo/mini-dynamo/internal/storage"
+	"github.com/mini-dynamo/mini-dynamo/pkg/types"
+)
+
+// ErrInvalidBatch is returned for a batch with a malformed operation
+var ErrInvalidBatch = errors.New("invalid batch")
+
+// batchGroup is the set of batch entries sharing a preference list
+type batchGroup struct {
+	preferenceList []string
+	requirement    quorumRequirement
+	entries        []types.KeyValueEntry
+}
+
+// Batch writes many puts and deletes at a single version. Operations are
+// grouped by preference list and each group is sent to its replicas in one
+// request, where it is applied atomically; groups succeed or fail
+// independently, so the result reports the acks achieved for every key.
+func (c *Coordinator) Batch(ctx context.Context, ops []types.BatchOperation, opts types.ConsistencyOptions) (*types.BatchResult, error) {
+	if err := validateOperations(ops, ErrInvalidBatch); err != nil {
+		return nil, err
+	}
+
+	if err := c.followSession(opts.MinVersion); err != nil {
+		return nil, err
+	}
+	timestamp := c.clock.Now()
+
+	n, err := c.getReplicaCount(opts)
+	if err != nil {
+		return nil, err
+	}
+
+	// Group the operations by preference list, keeping their order
+	groups := make(map[string]*batchGroup)
+	var order []*batchGroup
+	for _, op := range ops {
+		preferenceList, pending, err := c.writeReplicas(op.Key, n)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get preference list: %w", err)
+		}
+
+		nodes := append(preferenceList, pending...)
+		id := strings.Join(nodes, ",")
+		group, exists := groups[id]
+		if !exists {
+			requirement, err := c.getWriteQuorum(opts, n, preferenceList)
+			if err != nil {
+				return nil, err
+			}
+			group = &batchGroup{
+				preferenceList: nodes,
+				requirement:    requirement.withPending(pending),
+			}
+			groups[id] = group
+			order = append(order, group)
+		}
+
+		entry := types.KeyValueEntry{Key: op.Key, Timestamp: timestamp}
+		if op.Op == types.BatchDelete {
+			entry.IsDeleted = true
+		} else {
+			entry.Value = []byte(op.Value)
+		}
+		group.entries = append(group.entries, entry)
+	}
+
+	// Write the groups in parallel
+	results := make(map[string]types.BatchKeyResult, len(ops))
+	var resultsMu sync.Mutex
+	var wg sync.WaitGroup
+
+	for _, group := range order {
+		wg.Add(1)
+		go func(group *batchGroup) {
+			defer wg.Done()
+
+			var locked atomic.Bool
+			acks := c.writeToNodes(ctx, group.preferenceList, group.requirement, func(ctx context.Context, nodeID string) bool {
+				var err error
+				if nodeID == c.config.NodeID {
+					err = c.ApplyClientWrite(group.entries)
+				} else {
+					err = c.postBatch(ctx, nodeID, types.BatchReplicationRequest{Entries: group.entries, ClientWrite: true})
+				}
+				if errors.Is(err, ErrTxnConflict) {
+					locked.Store(true)
+				}
+				return err == nil
+			})
+
+			acked := make([]string, 0, len(acks))
+			for nodeID, success := range acks {
+				if success {
+					acked = append(acked, nodeID)
+				}
+			}
+
+			keyResult := types.BatchKeyResult{
+				Success:  group.requirement.satisfiedBy(acked, c.datacenterOf),
+				Acks:     len(acked),
+				Required: group.requirement.count(),
+				Replicas: len(group.preferenceList),
+			}
+			switch {
+			case keyResult.Success:
+			case locked.Load():
+				keyResult.Error = "a key in the group is locked by a transaction"
+			default:
+				keyResult.Error = fmt.Sprintf("quorum not met: got %d acks, needed %s", len(acked), group.requirement)
+			}
+
+			resultsMu.Lock()
+			for _, entry := range group.entries {
+				keyResult.Key = entry.Key
+				results[entry.Key] = keyResult
+			}
+			resultsMu.Unlock()
+		}(group)
+	}
+	wg.Wait()
+
+	result := &types.BatchResult{
+		Timestamp: timestamp,
+		Results:   make([]types.BatchKeyResult, 0, len(ops)),
+	}
+	for _, op := range ops {
+		result.Results = append(result.Results, results[op.Key])
+	}
+	return result, nil
+}
+
+// ApplyBatch stores a group of entries in local storage in a single
+// atomic write. Each entry is reconciled with the local version as in
+// ApplyEntry, and entries superseded locally are skipped.
+func (c *Coordinator) ApplyBatch(entries []types.KeyValueEntry) error {
+	c.applyMu.Lock()
+	defer c.applyMu.Unlock()
+
+	batch := storage.NewWriteBatch()
+	for _, entry := range entries {
+		entry, ok := c.reconcile(entry)
+		if !ok {
+			continue
+		}
+		if entry.IsDeleted {
+			batch.Delete(entry.Key, entry.Timestamp)
+		} else {
+			batch.Put(entry.Key, entry.Value, entry.Timestamp)
+		}
+	}
+	return c.storage.Write(batch)
+}
+
+// sendBatch sends a group of entries to a remote node
+func (c *Coordinator) sendBatch(ctx context.Context, nodeID string, entries []types.KeyValueEntry) bool {
+	return c.postBatch(ctx, nodeID, types.BatchReplicationRequest{Entries: entries}) == nil
+}
+
+// postBatch sends a batch replication request to a node. A client write
+// refused because a transaction locks a key is reported as ErrTxnConflict.
+func (c *Coordinator) postBatch(ctx context.Context, nodeID string, req types.BatchReplicationRequest) error {
+	c.nodesMu.RLock()
+	node, exists := c.nodes[nodeID]
+	c.nodesMu.RUnlock()
+
+	if !exists {
+		log.Printf("Node %s not found for batch replication", nodeID)
+		return fmt.Errorf("node %s not found", nodeID)
+	}
+
+	if err := c.simulateInterDCLatency(ctx, nodeID); err != nil {
+		return err
+	}
+
+	url := fmt.Sprintf("http://%s:%d/internal/batch", node.Address, node.Port)
+	req.FromNode = c.config.NodeID
+	req.RingEpoch, req.RingChecksum = c.ring.Version()
+	body, _ := json.Marshal(req)
+
+	httpReq, err := http.NewRequestWithContext(ctx, "POST", url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	httpReq.Header.Set("Content-Type", "application/json")
+
+	start := time.Now()
+	resp, err := c.httpClient.Do(httpReq)
+	if err != nil {
+		c.latency.RecordError(nodeID, time.Since(start))
+		log.Printf("Failed to replicate batch to %s: %v", nodeID, err)
+		return err
+	}
+	defer resp.Body.Close()
+	c.latency.Record(nodeID, time.Since(start))
+
+	var result types.ReplicationResponse
+	if json.NewDecoder(resp.Body).Decode(&result) == nil {
+		c.observeReplicaEpoch(nodeID, result.RingEpoch, result.RingChecksum)
+	}
+	return replicationError(nodeID, resp.StatusCode, result)
+}
+
+// ValidateBatch checks the operations of a batch as Batch does, returning
+// an error wrapping ErrInvalidBatch if any is invalid
+func ValidateBatch(ops []types.BatchOperation) error {
+	return validateOperations(ops, ErrInvalidBatch)
+}
+
+// validateOperations checks that every operation is a put or delete of a
+// distinct, non-reserved key, wrapping invalid in the error returned
+func validateOperations(ops []types.BatchOperation, invalid error) error {
+	if len(ops) == 0 {
+		return fmt.Errorf("%w: no operations", invalid)
+	}
+
+	seen := make(map[string]bool, len(ops))
+	for i, op := range ops {
+		switch {
+		case op.Key == "":
+			return fmt.Errorf("%w: operation %d has no key", invalid, i)
+		case strings.HasPrefix(op.Key, storage.SystemKeyPrefix):
+			return fmt.Errorf("%w: keys starting with %s are reserved", invalid, storage.SystemKeyPrefix)
+		case seen[op.Key]:
+			return fmt.Errorf("%w: key %s appears more than once", invalid, op.Key)
+		case op.Op != types.BatchPut && op.Op != types.BatchDelete:
+			return fmt.Errorf("%w: unknown operation %q for key %s", invalid, op.Op, op.Key)
+		case op.Op == types.BatchPut && op.Value == "":
+			return fmt.Errorf("%w: put of key %s has no value", invalid, op.Key)
+		}
+		seen[op.Key] = true
+	}
+	return nil
+}
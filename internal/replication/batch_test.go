@@ -0,0 +1,105 @@
+package replication
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/mini-dynamo/mini-dynamo/pkg/types"
+)
+
+func TestBatchGroupsByPreferenceList(t *testing.T) {
+	coord, fakes := newMultiDCCoordinator(t, 0)
+
+	var ops []types.BatchOperation
+	groups := make(map[string]bool)
+	for i := 0; i < 20; i++ {
+		key := fmt.Sprintf("key%d", i)
+		ops = append(ops, types.BatchOperation{Op: types.BatchPut, Key: key, Value: "v"})
+		nodes, _ := coord.ring.GetNodes(key, 4)
+		groups[strings.Join(nodes, ",")] = true
+	}
+
+	result, err := coord.Batch(context.Background(), ops, types.ConsistencyOptions{Level: types.ConsistencyAll})
+	if err != nil {
+		t.Fatalf("Batch failed: %v", err)
+	}
+	if result.Failed() != 0 || len(result.Results) != len(ops) {
+		t.Fatalf("Expected %d successful keys, got %+v", len(ops), result.Results)
+	}
+
+	for i, f := range fakes {
+		f.mu.Lock()
+		batches, entries := f.batches, len(f.entries)
+		f.mu.Unlock()
+		if batches != len(groups) {
+			t.Errorf("Replica %d: expected one request per group (%d), got %d", i, len(groups), batches)
+		}
+		if entries != len(ops) {
+			t.Errorf("Replica %d: expected %d entries, got %d", i, len(ops), entries)
+		}
+	}
+}
+
+func TestBatchReportsPerKeyResults(t *testing.T) {
+	coord, fakes := newMultiDCCoordinator(t, 0)
+	fakes[1].server.Close() // node3 is down
+
+	var ops []types.BatchOperation
+	for i := 0; i < 20; i++ {
+		ops = append(ops, types.BatchOperation{Op: types.BatchPut, Key: fmt.Sprintf("key%d", i), Value: "v"})
+	}
+
+	// With a single replica, exactly the keys owned by node3 fail
+	result, err := coord.Batch(context.Background(), ops, types.ConsistencyOptions{N: 1, W: 1})
+	if err != nil {
+		t.Fatalf("Batch failed: %v", err)
+	}
+	for _, r := range result.Results {
+		nodes, _ := coord.ring.GetNodes(r.Key, 1)
+		if want := nodes[0] != "node3"; r.Success != want {
+			t.Errorf("Key %s on %s: expected success=%v, got %+v", r.Key, nodes[0], want, r)
+		}
+	}
+}
+
+func TestBatchAppliesPutsAndDeletes(t *testing.T) {
+	coord, store := newTestCoordinator(t)
+	ctx := context.Background()
+
+	coord.Put(ctx, "gone", []byte("old"), types.ConsistencyOptions{})
+	result, err := coord.Batch(ctx, []types.BatchOperation{
+		{Op: types.BatchPut, Key: "a", Value: "1"},
+		{Op: types.BatchDelete, Key: "gone"},
+	}, types.ConsistencyOptions{})
+	if err != nil || result.Failed() != 0 {
+		t.Fatalf("Batch failed: %v %+v", err, result)
+	}
+
+	value, ts, err := store.Get("a")
+	if err != nil || string(value) != "1" || ts != result.Timestamp {
+		t.Errorf("Expected a = 1 @%d, got %q @%d (%v)", result.Timestamp, value, ts, err)
+	}
+	if store.Has("gone") {
+		t.Error("Expected gone to be deleted")
+	}
+}
+
+func TestBatchRejectsInvalidOperations(t *testing.T) {
+	coord, _ := newTestCoordinator(t)
+
+	invalid := [][]types.BatchOperation{
+		nil,
+		{{Op: types.BatchPut, Key: "a", Value: "1"}, {Op: types.BatchDelete, Key: "a"}},
+		{{Op: "incr", Key: "a"}},
+		{{Op: types.BatchPut, Key: "a"}},
+		{{Op: types.BatchDelete, Key: "__system/paxos/a"}},
+	}
+	for _, ops := range invalid {
+		if _, err := coord.Batch(context.Background(), ops, types.ConsistencyOptions{}); !errors.Is(err, ErrInvalidBatch) {
+			t.Errorf("Expected ErrInvalidBatch for %+v, got %v", ops, err)
+		}
+	}
+}
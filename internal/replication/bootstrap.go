@@ -0,0 +1,401 @@
+package replication
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mini-dynamo/mini-dynamo/internal/ring"
+	"github.com/mini-dynamo/mini-dynamo/internal/storage"
+	"github.com/mini-dynamo/mini-dynamo/pkg/types"
+)
+
+// bootstrapRetryInterval is how long a joining node waits before retrying
+// ranges no replica could stream
+const bootstrapRetryInterval = 5 * time.Second
+
+// streamBatchSize is the number of entries pushed to a node per request
+// when ranges are handed to it
+const streamBatchSize = 500
+
+// bootstrapKey marks a bootstrap in progress, so a node stopped while
+// streaming resumes it on restart instead of serving partial data
+const bootstrapKey = storage.SystemKeyPrefix + "bootstrap"
+
+// BootstrapPending reports whether a bootstrap started on this storage has
+// not completed
+func BootstrapPending(store storage.Engine) bool {
+	return store.Has(bootstrapKey)
+}
+
+// StreamStats reports a node's progress streaming its ranges while it
+// joins or leaves the ring
+type StreamStats struct {
+	State          types.RingState `json:"state"`
+	RangesTotal    int             `json:"ranges_total"`    // Token ranges to move
+	RangesStreamed int             `json:"ranges_streamed"` // Ranges whose data has moved
+	KeysStreamed   int             `json:"keys_streamed"`   // Entries moved
+	Error          string          `json:"error,omitempty"` // Last streaming failure
+}
+
+// streamGroup is the set of ranges that share their current replicas, so
+// they are streamed from one source in a single request
+type streamGroup struct {
+	sources []string
+	ranges  []types.StreamRange
+}
+
+// Bootstrapper brings a node that joined the ring with no data up to
+// date. It computes the token ranges the node now owns, streams the
+// existing entries for them from the current replicas and only then
+// marks the node ready to serve reads. Writes reach the node throughout,
+// so nothing written while it streams is lost.
+type Bootstrapper struct {
+	coordinator *Coordinator
+	onState     func(types.RingState)
+	mu          sync.Mutex
+	stats       StreamStats
+}
+
+// NewBootstrapper creates a bootstrapper for the local node. onState, if
+// set, is called on every state change so it can be advertised.
+func NewBootstrapper(coord *Coordinator, onState func(types.RingState)) *Bootstrapper {
+	return &Bootstrapper{
+		coordinator: coord,
+		onState:     onState,
+	}
+}
+
+// Run streams the node's ranges and returns once the node is ready, or
+// with the context's error if it is cancelled first. Ranges that no
+// replica can stream are retried until they succeed. Until Run completes,
+// BootstrapPending reports the node's storage as incomplete.
+func (b *Bootstrapper) Run(ctx context.Context) error {
+	c := b.coordinator
+	b.setState(types.RingJoining)
+
+	// Durable before any entry arrives, so a crash leaves the node to
+	// stream again rather than count as bootstrapped
+	if err := c.storage.Put(bootstrapKey, []byte(c.config.NodeID), c.clock.Now()); err != nil {
+		return fmt.Errorf("failed to record bootstrap: %w", err)
+	}
+	if err := c.storage.Sync(); err != nil {
+		return fmt.Errorf("failed to record bootstrap: %w", err)
+	}
+
+	groups := b.planStreams()
+	total := 0
+	for _, group := range groups {
+		total += len(group.ranges)
+	}
+	b.mu.Lock()
+	b.stats.RangesTotal = total
+	b.mu.Unlock()
+	log.Printf("Bootstrapping %s: streaming %d token ranges from %d replica sets", c.config.NodeID, total, len(groups))
+
+	b.setState(types.RingStreaming)
+	for len(groups) > 0 {
+		var failed []*streamGroup
+		for _, group := range groups {
+			if err := b.stream(ctx, group); err != nil {
+				if ctx.Err() != nil {
+					return ctx.Err()
+				}
+				log.Printf("Bootstrap streaming failed: %v", err)
+				b.mu.Lock()
+				b.stats.Error = err.Error()
+				b.mu.Unlock()
+				failed = append(failed, group)
+			}
+		}
+
+		groups = failed
+		if len(groups) > 0 {
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			case <-time.After(bootstrapRetryInterval):
+			}
+		}
+	}
+
+	if err := c.storage.Delete(bootstrapKey, c.clock.Now()); err != nil {
+		return fmt.Errorf("failed to complete bootstrap: %w", err)
+	}
+
+	b.mu.Lock()
+	b.stats.Error = ""
+	b.mu.Unlock()
+	b.setState(types.RingReady)
+	log.Printf("Bootstrap of %s complete: %d keys streamed", c.config.NodeID, b.Stats().KeysStreamed)
+	return nil
+}
+
+// Stats returns the bootstrap progress
+func (b *Bootstrapper) Stats() StreamStats {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.stats
+}
+
+// setState records a new state locally and reports it
+func (b *Bootstrapper) setState(state types.RingState) {
+	b.mu.Lock()
+	b.stats.State = state
+	b.mu.Unlock()
+
+	b.coordinator.SetNodeRingState(b.coordinator.config.NodeID, state)
+	if b.onState != nil {
+		b.onState(state)
+	}
+}
+
+// planStreams finds the token ranges the local node owns and groups them
+// by the replicas that hold them until the node is ready
+func (b *Bootstrapper) planStreams() []*streamGroup {
+	c := b.coordinator
+	self := c.config.NodeID
+	n := c.config.ReplicationFactor
+	pending, _ := c.transitioningNodes()
+
+	groups := make(map[string]*streamGroup)
+	var order []*streamGroup
+	for _, r := range ring.NewVNodeManager(c.ring).GetTokenRanges() {
+		owners, err := c.ring.GetNodesForToken(r.EndToken, n, nil)
+		if err != nil || !containsNode(owners, self) {
+			continue
+		}
+
+		sources, err := c.ring.GetNodesForToken(r.EndToken, n, pending)
+		if err != nil {
+			// Every node is joining, so there is no data to stream
+			continue
+		}
+
+		id := strings.Join(sources, ",")
+		group, exists := groups[id]
+		if !exists {
+			group = &streamGroup{sources: sources}
+			groups[id] = group
+			order = append(order, group)
+		}
+		group.ranges = append(group.ranges, types.StreamRange{Start: r.StartToken, End: r.EndToken})
+	}
+	return order
+}
+
+// stream fetches the entries for a group of ranges and applies them
+func (b *Bootstrapper) stream(ctx context.Context, group *streamGroup) error {
+	keys, err := b.coordinator.streamFrom(ctx, group.sources, group.ranges, nil)
+	if err != nil {
+		return err
+	}
+
+	b.mu.Lock()
+	b.stats.RangesStreamed += len(group.ranges)
+	b.stats.KeysStreamed += keys
+	b.mu.Unlock()
+	return nil
+}
+
+// streamFrom fetches the entries for token ranges from the sources, a page
+// at a time, and applies them locally. It returns how many entries were
+// applied, passing each to observe if set.
+func (c *Coordinator) streamFrom(ctx context.Context, sources []string, ranges []types.StreamRange, observe func(types.KeyValueEntry)) (int, error) {
+	return c.pageRanges(ctx, sources, ranges, func(source string, entries []types.KeyValueEntry) error {
+		if err := c.ApplyBatch(entries); err != nil {
+			return fmt.Errorf("failed to apply entries from %s: %w", source, err)
+		}
+		if observe != nil {
+			for _, entry := range entries {
+				observe(entry)
+			}
+		}
+		return nil
+	})
+}
+
+// relayRanges copies the entries of token ranges from their current
+// replicas to a node that is taking them over, returning how many were
+// copied. Entries are read locally when this node is a source.
+func (c *Coordinator) relayRanges(ctx context.Context, sources []string, target string, ranges []types.StreamRange) (int, error) {
+	if containsNode(sources, c.config.NodeID) {
+		sources = []string{c.config.NodeID}
+	}
+
+	return c.pageRanges(ctx, sources, ranges, func(_ string, entries []types.KeyValueEntry) error {
+		if target == c.config.NodeID {
+			return c.ApplyBatch(entries)
+		}
+		if !c.sendBatch(ctx, target, entries) {
+			return fmt.Errorf("failed to send %d ranges to %s", len(ranges), target)
+		}
+		return nil
+	})
+}
+
+// pageRanges reads the entries of token ranges from the first source that
+// answers, streamBatchSize at a time, and passes every page to handle. A
+// source failing part way is replaced by the next one from the same key.
+// It returns how many entries were handled.
+func (c *Coordinator) pageRanges(ctx context.Context, sources []string, ranges []types.StreamRange, handle func(source string, entries []types.KeyValueEntry) error) (int, error) {
+	req := types.StreamRequest{Ranges: ranges, FromNode: c.config.NodeID, Limit: streamBatchSize}
+	handled := 0
+
+	var lastErr error
+	for _, source := range sources {
+		for {
+			var resp types.StreamResponse
+			if source == c.config.NodeID {
+				resp.Entries, resp.Next = c.StreamRanges(req)
+			} else if err := c.postInternal(ctx, source, "/internal/stream", req, &resp); err != nil {
+				lastErr = err
+				break
+			}
+
+			if len(resp.Entries) > 0 {
+				if err := handle(source, resp.Entries); err != nil {
+					return handled, err
+				}
+				handled += len(resp.Entries)
+			}
+			if resp.Next == "" {
+				return handled, nil
+			}
+			req.After = resp.Next
+		}
+	}
+	if lastErr == nil {
+		return handled, fmt.Errorf("no replica to stream %d ranges from", len(ranges))
+	}
+	return handled, fmt.Errorf("no replica of %s could stream %d ranges: %w", strings.Join(sources, ","), len(ranges), lastErr)
+}
+
+// streamSnapshotIdle is how long the keys of a stream are kept after its
+// last page was served, in case the stream resumes
+const streamSnapshotIdle = time.Minute
+
+// streamSnapshots holds, per stream being served, the keys in its ranges
+// in key order. A stream is identified by the requesting node and ranges.
+type streamSnapshots struct {
+	mu        sync.Mutex
+	snapshots map[string]*streamSnapshot
+}
+
+type streamSnapshot struct {
+	keys     []string
+	lastUsed time.Time
+}
+
+// StreamRanges returns the entries this node holds in the requested token
+// ranges, tombstones included so deletes reach the new owners, in key
+// order starting after req.After. At most req.Limit entries are returned
+// if it is positive, along with the key to resume after if there are more.
+// System keys are not streamed. The keys are collected and sorted once,
+// when the stream starts, and later pages are cut from them; keys first
+// written after that are not streamed, just as keys behind the cursor
+// never were.
+func (c *Coordinator) StreamRanges(req types.StreamRequest) ([]types.KeyValueEntry, string) {
+	id := streamID(req)
+	c.streams.mu.Lock()
+	now := time.Now()
+	for sid, snap := range c.streams.snapshots {
+		if now.Sub(snap.lastUsed) > streamSnapshotIdle {
+			delete(c.streams.snapshots, sid)
+		}
+	}
+	snap, exists := c.streams.snapshots[id]
+	c.streams.mu.Unlock()
+
+	// A new stream, or one whose snapshot expired, collects the keys
+	if !exists || req.After == "" {
+		snap = &streamSnapshot{keys: c.rangeKeys(req.Ranges)}
+	}
+
+	keys := snap.keys[sort.SearchStrings(snap.keys, req.After):]
+	if len(keys) > 0 && keys[0] == req.After {
+		keys = keys[1:]
+	}
+
+	next := ""
+	if req.Limit > 0 && len(keys) > req.Limit {
+		keys = keys[:req.Limit]
+		next = keys[req.Limit-1]
+	}
+
+	c.streams.mu.Lock()
+	if c.streams.snapshots == nil {
+		c.streams.snapshots = make(map[string]*streamSnapshot)
+	}
+	if next == "" {
+		delete(c.streams.snapshots, id)
+	} else {
+		snap.lastUsed = now
+		c.streams.snapshots[id] = snap
+	}
+	c.streams.mu.Unlock()
+
+	entries := make([]types.KeyValueEntry, 0, len(keys))
+	for _, key := range keys {
+		value, timestamp, err := c.storage.Get(key)
+		switch {
+		case err == nil:
+			entries = append(entries, types.KeyValueEntry{Key: key, Value: value, Timestamp: timestamp})
+		case errors.Is(err, storage.ErrKeyDeleted):
+			if timestamp, exists := c.storage.Timestamp(key); exists {
+				entries = append(entries, types.KeyValueEntry{Key: key, Timestamp: timestamp, IsDeleted: true})
+			}
+		}
+	}
+	return entries, next
+}
+
+// rangeKeys returns the keys, tombstones included, this node holds in the
+// token ranges, in key order. System keys are left out.
+func (c *Coordinator) rangeKeys(ranges []types.StreamRange) []string {
+	tokenRanges := make([]ring.TokenRange, len(ranges))
+	for i, r := range ranges {
+		tokenRanges[i] = ring.TokenRange{StartToken: r.Start, EndToken: r.End}
+	}
+
+	var keys []string
+	for _, key := range append(c.storage.Keys(), c.storage.Tombstones()...) {
+		if strings.HasPrefix(key, storage.SystemKeyPrefix) {
+			continue
+		}
+		token := c.ring.KeyToken(key)
+		for _, r := range tokenRanges {
+			if r.Contains(token) {
+				keys = append(keys, key)
+				break
+			}
+		}
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// streamID identifies a stream by the node reading it and its ranges
+func streamID(req types.StreamRequest) string {
+	var b strings.Builder
+	b.WriteString(req.FromNode)
+	for _, r := range req.Ranges {
+		fmt.Fprintf(&b, "/%d-%d", r.Start, r.End)
+	}
+	return b.String()
+}
+
+// containsNode reports whether nodeID is in nodes
+func containsNode(nodes []string, nodeID string) bool {
+	for _, n := range nodes {
+		if n == nodeID {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,277 @@
+package replication
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"testing"
+	"time"
+
+	"github.com/mini-dynamo/mini-dynamo/internal/config"
+	"github.com/mini-dynamo/mini-dynamo/internal/ring"
+	"github.com/mini-dynamo/mini-dynamo/internal/storage"
+	"github.com/mini-dynamo/mini-dynamo/pkg/types"
+)
+
+// newJoiningCoordinator builds a coordinator for node1 joining a cluster
+// of two fake replicas that already hold data
+func newJoiningCoordinator(t *testing.T) (*Coordinator, []*fakeReplica) {
+	store, err := storage.NewBitcask(t.TempDir(), false)
+	if err != nil {
+		t.Fatalf("Failed to create storage: %v", err)
+	}
+	t.Cleanup(func() { store.Close() })
+
+	cfg := config.DefaultConfig()
+	cfg.NodeID = "node1"
+	cfg.ReplicationFactor = 2
+	cfg.ReadQuorum = 1
+	cfg.WriteQuorum = 1
+
+	fakes := []*fakeReplica{newFakeReplica(t), newFakeReplica(t)}
+
+	coord := NewCoordinator(cfg, ring.NewHashRing(20), store)
+	coord.RegisterNode(&types.Node{ID: "node1", State: types.NodeAlive, RingState: types.RingJoining})
+	registerPlaced(coord, fakes[0].node(t, "node2", ""))
+	registerPlaced(coord, fakes[1].node(t, "node3", ""))
+	return coord, fakes
+}
+
+func TestBootstrapStreamsOwnedRanges(t *testing.T) {
+	coord, fakes := newJoiningCoordinator(t)
+
+	// Before node1 joined, node2 and node3 held every key
+	for i := 0; i < 100; i++ {
+		entry := types.KeyValueEntry{Key: fmt.Sprintf("key%d", i), Value: []byte("v"), Timestamp: int64(i + 1)}
+		for _, f := range fakes {
+			f.entries[entry.Key] = entry
+		}
+	}
+
+	var states []types.RingState
+	b := NewBootstrapper(coord, func(state types.RingState) { states = append(states, state) })
+	if err := b.Run(context.Background()); err != nil {
+		t.Fatalf("Bootstrap failed: %v", err)
+	}
+
+	if fmt.Sprint(states) != fmt.Sprint([]types.RingState{types.RingJoining, types.RingStreaming, types.RingReady}) {
+		t.Errorf("Unexpected state transitions: %v", states)
+	}
+	if state := coord.GetNodeRingState("node1"); state != types.RingReady {
+		t.Errorf("Expected node1 to be ready, got %q", state)
+	}
+
+	// node1 holds exactly the keys it owns
+	owned := 0
+	for i := 0; i < 100; i++ {
+		key := fmt.Sprintf("key%d", i)
+		nodes, _ := coord.ring.GetNodes(key, 2)
+		if containsNode(nodes, "node1") {
+			owned++
+			if _, timestamp, err := coord.storage.Get(key); err != nil || timestamp != int64(i+1) {
+				t.Errorf("Owned key %s not streamed (timestamp %d, err %v)", key, timestamp, err)
+			}
+		} else if coord.storage.Has(key) {
+			t.Errorf("Key %s streamed but not owned by node1", key)
+		}
+	}
+
+	stats := b.Stats()
+	if owned == 0 || stats.KeysStreamed != owned {
+		t.Errorf("Expected %d keys streamed, got %+v", owned, stats)
+	}
+	if stats.RangesStreamed != stats.RangesTotal || stats.RangesTotal == 0 {
+		t.Errorf("Expected every range streamed, got %+v", stats)
+	}
+}
+
+func TestBootstrapFallsBackToAnotherReplica(t *testing.T) {
+	coord, fakes := newJoiningCoordinator(t)
+	for i := 0; i < 50; i++ {
+		key := fmt.Sprintf("key%d", i)
+		fakes[1].entries[key] = types.KeyValueEntry{Key: key, Value: []byte("v"), Timestamp: 1}
+	}
+	fakes[0].server.Close() // node2 is down
+
+	b := NewBootstrapper(coord, nil)
+	if err := b.Run(context.Background()); err != nil {
+		t.Fatalf("Bootstrap failed: %v", err)
+	}
+	if stats := b.Stats(); stats.KeysStreamed == 0 || stats.State != types.RingReady {
+		t.Errorf("Expected keys streamed from node3, got %+v", stats)
+	}
+}
+
+func TestJoiningNodeReceivesWritesButNotReads(t *testing.T) {
+	coord, fakes := newJoiningCoordinator(t)
+	coord.SetNodeRingState("node1", types.RingReady)
+	coord.SetNodeRingState("node2", types.RingJoining)
+
+	for i := 0; i < 50; i++ {
+		key := fmt.Sprintf("key%d", i)
+		owners, _ := coord.ring.GetNodes(key, 2)
+		if !containsNode(owners, "node2") {
+			continue
+		}
+
+		readers, err := coord.readReplicas(key, 2)
+		if err != nil {
+			t.Fatalf("readReplicas failed: %v", err)
+		}
+		if containsNode(readers, "node2") {
+			t.Fatalf("Key %s: joining node2 in read replicas %v", key, readers)
+		}
+
+		result, err := coord.Put(context.Background(), key, []byte("v"), types.ConsistencyOptions{Level: types.ConsistencyAll})
+		if err != nil {
+			t.Fatalf("Put failed: %v", err)
+		}
+		if result.Replicas != 3 || result.Required != 3 {
+			t.Errorf("Key %s: expected 2 ready replicas plus node2, got %+v", key, result)
+		}
+		fakes[0].mu.Lock()
+		_, received := fakes[0].entries[key]
+		fakes[0].mu.Unlock()
+		if !received {
+			t.Errorf("Key %s: write not sent to joining node2", key)
+		}
+		return
+	}
+	t.Fatal("No key owned by node2")
+}
+
+func TestBootstrapStreamsTombstonesInPages(t *testing.T) {
+	coord, fakes := newJoiningCoordinator(t)
+
+	// More keys than fit in one page, and a delete node1 would otherwise
+	// never learn of
+	for i := 0; i < 3*streamBatchSize; i++ {
+		entry := types.KeyValueEntry{Key: fmt.Sprintf("key%04d", i), Value: []byte("v"), Timestamp: 10}
+		for _, f := range fakes {
+			f.entries[entry.Key] = entry
+		}
+	}
+	var deleted string
+	for i := 0; deleted == ""; i++ {
+		key := fmt.Sprintf("key%04d", i)
+		if nodes, _ := coord.ring.GetNodes(key, 2); containsNode(nodes, "node1") {
+			deleted = key
+		}
+	}
+	coord.storage.Put(deleted, []byte("stale"), 5)
+	for _, f := range fakes {
+		f.entries[deleted] = types.KeyValueEntry{Key: deleted, Timestamp: 20, IsDeleted: true}
+	}
+
+	b := NewBootstrapper(coord, nil)
+	groups := len(b.planStreams())
+	if err := b.Run(context.Background()); err != nil {
+		t.Fatalf("Bootstrap failed: %v", err)
+	}
+
+	if _, _, err := coord.storage.Get(deleted); err != storage.ErrKeyDeleted {
+		t.Errorf("Expected %s to be deleted, got %v", deleted, err)
+	}
+	owned := 0
+	for i := 0; i < 3*streamBatchSize; i++ {
+		key := fmt.Sprintf("key%04d", i)
+		if nodes, _ := coord.ring.GetNodes(key, 2); containsNode(nodes, "node1") {
+			owned++
+			if key != deleted && !coord.storage.Has(key) {
+				t.Errorf("Owned key %s not streamed", key)
+			}
+		}
+	}
+	if stats := b.Stats(); stats.KeysStreamed != owned {
+		t.Errorf("Expected %d entries streamed, got %d", owned, stats.KeysStreamed)
+	}
+
+	// Each replica set served its ranges a page at a time
+	pages := fakes[0].streams + fakes[1].streams
+	if pages <= groups || pages < (owned+streamBatchSize-1)/streamBatchSize {
+		t.Errorf("Expected %d entries from %d replica sets to take more pages, got %d", owned, groups, pages)
+	}
+}
+
+func TestStreamRangesPages(t *testing.T) {
+	coord, store := newTestCoordinator(t)
+	for i := 0; i < 5; i++ {
+		store.Put(fmt.Sprintf("key%d", i), []byte("v"), int64(i+1))
+	}
+	store.Delete("key2", 10)
+	store.Put(storage.SystemKeyPrefix+"state", []byte("x"), 1)
+
+	all := []types.StreamRange{{Start: 0, End: math.MaxUint64}}
+	var keys []string
+	after := ""
+	for pages := 1; ; pages++ {
+		entries, next := coord.StreamRanges(types.StreamRequest{Ranges: all, FromNode: "node2", After: after, Limit: 2})
+		for _, entry := range entries {
+			keys = append(keys, fmt.Sprintf("%s@%d/%v", entry.Key, entry.Timestamp, entry.IsDeleted))
+		}
+		if next == "" {
+			break
+		}
+		if pages > 5 {
+			t.Fatal("Paging did not terminate")
+		}
+		after = next
+	}
+
+	want := "[key0@1/false key1@2/false key2@10/true key3@4/false key4@5/false]"
+	if fmt.Sprint(keys) != want {
+		t.Errorf("Expected %s, got %v", want, keys)
+	}
+}
+
+func TestStreamRangesPagesFromSnapshot(t *testing.T) {
+	coord, store := newTestCoordinator(t)
+	for i := 0; i < 4; i++ {
+		store.Put(fmt.Sprintf("key%d", i), []byte("v"), int64(i+1))
+	}
+
+	req := types.StreamRequest{Ranges: []types.StreamRange{{Start: 0, End: math.MaxUint64}}, FromNode: "node2", Limit: 2}
+	entries, next := coord.StreamRanges(req)
+	if len(entries) != 2 || next != "key1" {
+		t.Fatalf("Expected 2 entries up to key1, got %d up to %q", len(entries), next)
+	}
+
+	// Later pages are cut from the keys collected for the first one
+	store.Put("key15", []byte("v"), 10)
+	req.After = next
+	entries, next = coord.StreamRanges(req)
+	if len(entries) != 2 || entries[0].Key != "key2" || next != "" {
+		t.Fatalf("Expected key2 and key3 ending the stream, got %v ending at %q", entries, next)
+	}
+
+	// A new stream collects the keys afresh
+	req.After = ""
+	req.Limit = 0
+	if entries, _ = coord.StreamRanges(req); len(entries) != 5 {
+		t.Errorf("Expected 5 entries in a new stream, got %d", len(entries))
+	}
+}
+
+func TestBootstrapPendingUntilComplete(t *testing.T) {
+	// Streaming is interrupted while no replica answers
+	coord, fakes := newJoiningCoordinator(t)
+	for _, f := range fakes {
+		f.server.Close()
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if err := NewBootstrapper(coord, nil).Run(ctx); err == nil {
+		t.Fatal("Expected bootstrap to stop with the context")
+	}
+	if !BootstrapPending(coord.storage) {
+		t.Error("Expected an interrupted bootstrap to be pending")
+	}
+
+	coord, _ = newJoiningCoordinator(t)
+	if err := NewBootstrapper(coord, nil).Run(context.Background()); err != nil {
+		t.Fatalf("Bootstrap failed: %v", err)
+	}
+	if BootstrapPending(coord.storage) {
+		t.Error("Expected a completed bootstrap not to be pending")
+	}
+}
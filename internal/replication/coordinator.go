@@ -4,20 +4,122 @@ import (
 	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"log"
 	"net/http"
 	"sort"
+	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/mini-dynamo/mini-dynamo/internal/config"
+	"github.com/mini-dynamo/mini-dynamo/internal/crdt"
 	"github.com/mini-dynamo/mini-dynamo/internal/ring"
 	"github.com/mini-dynamo/mini-dynamo/internal/storage"
+	"github.com/mini-dynamo/mini-dynamo/internal/versioning"
 	"github.com/mini-dynamo/mini-dynamo/pkg/types"
 )
 
+// Errors returned by coordinated operations
+var (
+	ErrNotFound           = errors.New("key not found")
+	ErrInvalidConsistency = errors.New("invalid consistency")
+	ErrSessionUnavailable = errors.New("no replica is as fresh as the session")
+	ErrInvalidSession     = errors.New("session version is ahead of this node's clock")
+)
+
+// sessionPollInterval is how often a read re-polls replicas while waiting
+// for one to reach the session's version
+const sessionPollInterval = 20 * time.Millisecond
+
+// maxSessionLead bounds how far ahead of local time a session version may
+// be when max_clock_skew is unbounded
+const maxSessionLead = time.Minute
+
+// errReplicaNotFound is returned when a replica responds but does not hold the key
+var errReplicaNotFound = errors.New("key not found on replica")
+
+// replicaRead is the outcome of reading a key from a single replica
+type replicaRead struct {
+	NodeID string
+	Entry  *types.KeyValueEntry // nil if the replica does not have the key, a tombstone if it was deleted
+	Err    error                // set if the replica could not be read
+}
+
+// live returns the value the replica holds, or nil if it holds none or
+// only a tombstone
+func (r replicaRead) live() *types.KeyValueEntry {
+	if r.Entry == nil || r.Entry.IsDeleted {
+		return nil
+	}
+	return r.Entry
+}
+
+// quorumRequirement describes the acks that satisfy a consistency level
+type quorumRequirement struct {
+	Total int            // Acks needed across all replicas
+	PerDC map[string]int // Acks needed within each listed datacenter
+}
+
+// satisfiedBy reports whether the acking nodes meet the requirement
+func (q quorumRequirement) satisfiedBy(acked []string, datacenterOf func(string) string) bool {
+	if len(acked) < q.Total {
+		return false
+	}
+	if len(q.PerDC) == 0 {
+		return true
+	}
+
+	perDC := make(map[string]int)
+	for _, nodeID := range acked {
+		perDC[datacenterOf(nodeID)]++
+	}
+	for dc, needed := range q.PerDC {
+		if perDC[dc] < needed {
+			return false
+		}
+	}
+	return true
+}
+
+// count returns the total number of acks the requirement asks for
+func (q quorumRequirement) count() int {
+	total := q.Total
+	for _, needed := range q.PerDC {
+		total += needed
+	}
+	return total
+}
+
+// withPending raises the requirement by one ack per joining node written
+// to, so acks from nodes still streaming do not stand in for ready replicas
+func (q quorumRequirement) withPending(pending []string) quorumRequirement {
+	q.Total += len(pending)
+	return q
+}
+
+// String describes the requirement for error messages
+func (q quorumRequirement) String() string {
+	if len(q.PerDC) == 0 {
+		return fmt.Sprintf("%d", q.Total)
+	}
+
+	dcs := make([]string, 0, len(q.PerDC))
+	for dc := range q.PerDC {
+		dcs = append(dcs, dc)
+	}
+	sort.Strings(dcs)
+
+	parts := make([]string, len(dcs))
+	for i, dc := range dcs {
+		parts[i] = fmt.Sprintf("%d in %s", q.PerDC[dc], dc)
+	}
+	return strings.Join(parts, ", ")
+}
+
 // Coordinator handles distributed read/write operations
 type Coordinator struct {
 	config     *config.Config
@@ -26,28 +128,74 @@ type Coordinator struct {
 	httpClient *http.Client
 	nodes      map[string]*types.Node
 	nodesMu    sync.RWMutex
+	latency    *LatencyTracker
+	hedges     uint64 // Number of hedged read requests sent
+	repairer   *ReadRepairer
+	applyMu    sync.Mutex // Serializes local last-write-wins applies
+	paxosMu    sync.Mutex // Serializes Paxos acceptor state changes
+	clock      *versioning.HLC
+	resolver   *versioning.Resolver
+	crdtLocks  keyLocks        // Serializes CRDT read-modify-writes coordinated here, per key
+	txns       *TxnCoordinator // Holds the transaction locks client writes respect
+	streams    streamSnapshots // Sorted keys of the range streams served by this node
+	started    time.Time
+	ringSync   ringSync
+	changes    ringChanges
 }
 
 // NewCoordinator creates a new coordinator
 func NewCoordinator(cfg *config.Config, hashRing *ring.HashRing, store storage.Engine) *Coordinator {
-	return &Coordinator{
+	c := &Coordinator{
 		config:  cfg,
 		ring:    hashRing,
 		storage: store,
 		httpClient: &http.Client{
 			Timeout: cfg.RequestTimeout,
 		},
-		nodes: make(map[string]*types.Node),
+		nodes:   make(map[string]*types.Node),
+		latency: NewLatencyTracker(cfg.LatencyAlpha, 128, cfg.RequestTimeout),
+		clock:   versioning.NewHLC(cfg.MaxClockSkew),
+		started: time.Now(),
 	}
+
+	// Issue versions above every one already stored
+	c.clock.Restore(store.MaxTimestamp())
+
+	// Merge CRDT values instead of letting last-write-wins drop updates
+	c.resolver = versioning.NewResolver(versioning.LastWriteWins)
+	c.resolver.RegisterMerger(crdt.Merger{})
+
+	hashRing.Subscribe(cfg.ReplicationFactor, c.recordRingChange)
+	return c
 }
 
-// RegisterNode adds a node to the coordinator's knowledge
+// RegisterNode adds a node to the coordinator's knowledge. A node that is
+// not in the ring yet is placed at its TokenRing, as a joining node learns
+// from its seed and others from gossip. Only this node is placed by the
+// partitioner: another node's tokens depend on the ring it joined and on
+// later weight changes and moves, so a remote node without tokens stays
+// out of the ring until they arrive or a ring holding it is adopted.
 func (c *Coordinator) RegisterNode(node *types.Node) {
 	c.nodesMu.Lock()
 	defer c.nodesMu.Unlock()
 
 	c.nodes[node.ID] = node
-	c.ring.AddNode(node.ID)
+	c.ring.SetNodeTopology(node.ID, node.Datacenter, node.Rack)
+
+	self := node.ID == c.config.NodeID
+	placed := c.ring.HasNode(node.ID)
+	if node.Weight > 0 && node.Weight != c.ring.GetNodeWeight(node.ID) && (self || !placed || len(node.TokenRing) > 0) {
+		c.ring.SetNodeWeightAt(node.ID, node.Weight, node.TokenRing)
+	}
+	switch {
+	case placed:
+	case len(node.TokenRing) > 0:
+		c.ring.AddNodeAt(node.ID, node.TokenRing)
+	case self:
+		c.ring.AddNode(node.ID)
+	default:
+		log.Printf("Node %s is not placed in the ring until its tokens are known", node.ID)
+	}
 }
 
 // UnregisterNode removes a node from the coordinator
@@ -71,266 +219,1003 @@ func (c *Coordinator) GetClusterNodes() []*types.Node {
 	return nodes
 }
 
+// GetPreferenceList returns the replicas responsible for a key
+func (c *Coordinator) GetPreferenceList(key string) ([]string, error) {
+	return c.ring.GetNodes(key, c.config.ReplicationFactor)
+}
+
+// SetNodeRingState records a node's progress joining or leaving the
+// ring. Nodes that are not ready receive writes but are left out of reads,
+// and departing nodes stop receiving writes once their ranges move.
+func (c *Coordinator) SetNodeRingState(nodeID string, state types.RingState) {
+	c.nodesMu.Lock()
+	defer c.nodesMu.Unlock()
+
+	if node, exists := c.nodes[nodeID]; exists {
+		updated := *node
+		updated.RingState = state
+		c.nodes[nodeID] = &updated
+	}
+}
+
+// SetNodeWeight applies a node's weight to the ring, moving its virtual
+// nodes to the tokens it placed them at, or adding or removing them in
+// proportion if the tokens are not known. It does not move data; a node
+// changing its own weight goes through Rebalancer.ChangeWeight.
+func (c *Coordinator) SetNodeWeight(nodeID string, weight float64, tokens []uint64) {
+	c.nodesMu.Lock()
+	defer c.nodesMu.Unlock()
+
+	if node, exists := c.nodes[nodeID]; exists {
+		updated := *node
+		updated.Weight = weight
+		c.nodes[nodeID] = &updated
+	}
+	c.ring.SetNodeWeightAt(nodeID, weight, tokens)
+}
+
+// GetNodeRingState returns a node's progress joining or leaving the ring
+func (c *Coordinator) GetNodeRingState(nodeID string) types.RingState {
+	c.nodesMu.RLock()
+	defer c.nodesMu.RUnlock()
+
+	if node, exists := c.nodes[nodeID]; exists {
+		return node.RingState
+	}
+	return ""
+}
+
+// transitioningNodes returns the nodes in the ring that do not serve reads
+// yet, and those that are giving up their ranges
+func (c *Coordinator) transitioningNodes() (pending, departing map[string]bool) {
+	c.nodesMu.RLock()
+	defer c.nodesMu.RUnlock()
+
+	for nodeID, node := range c.nodes {
+		if !node.RingState.ServesReads() {
+			if pending == nil {
+				pending = make(map[string]bool)
+			}
+			pending[nodeID] = true
+		}
+		if node.RingState.Departing() {
+			if departing == nil {
+				departing = make(map[string]bool)
+			}
+			departing[nodeID] = true
+		}
+	}
+	return pending, departing
+}
+
+// readReplicas returns the preference list of a key among the nodes that
+// serve reads
+func (c *Coordinator) readReplicas(key string, n int) ([]string, error) {
+	pending, _ := c.transitioningNodes()
+	return c.ring.GetNodesExcluding(key, n, pending)
+}
+
+// writeReplicas returns the preference list of a key among the nodes that
+// serve reads, and separately the nodes that will own the key once every
+// node joining or leaving the ring is done. Writes go to both so nothing
+// written while ranges move is lost.
+func (c *Coordinator) writeReplicas(key string, n int) (natural []string, pending []string, err error) {
+	excluded, departing := c.transitioningNodes()
+	natural, err = c.ring.GetNodesExcluding(key, n, excluded)
+	if err != nil || (len(excluded) == 0 && len(departing) == 0) {
+		return natural, nil, err
+	}
+
+	owners, err := c.ring.GetNodesExcluding(key, n, departing)
+	if err != nil {
+		// Every node is leaving, so there are no future owners
+		return natural, nil, nil
+	}
+	for _, nodeID := range owners {
+		if !containsNode(natural, nodeID) {
+			pending = append(pending, nodeID)
+		}
+	}
+	return natural, pending, nil
+}
+
+// GetNodeTopology returns the datacenter and rack of a node
+func (c *Coordinator) GetNodeTopology(nodeID string) ring.Topology {
+	return c.ring.GetNodeTopology(nodeID)
+}
+
+// GetNodeWeight returns a node's weight in the ring
+func (c *Coordinator) GetNodeWeight(nodeID string) float64 {
+	return c.ring.GetNodeWeight(nodeID)
+}
+
+// GetPartitioner returns the name of the ring's partitioner
+func (c *Coordinator) GetPartitioner() string {
+	return c.ring.Partitioner().Name()
+}
+
+// GetKeyToken returns the position of a key on the ring
+func (c *Coordinator) GetKeyToken(key string) uint64 {
+	return c.ring.KeyToken(key)
+}
+
+// GetScanRanges returns the token ranges holding a range of keys, which
+// requires the ordered partitioner
+func (c *Coordinator) GetScanRanges(start, end string) ([]ring.TokenRange, error) {
+	return c.ring.ScanRanges(start, end)
+}
+
 // GetRingTokens returns the hash ring tokens
 func (c *Coordinator) GetRingTokens() []ring.VNode {
 	return c.ring.GetRingTokens()
 }
 
-// Put stores a key-value pair with quorum writes
-func (c *Coordinator) Put(ctx context.Context, key string, value []byte, consistency types.ConsistencyLevel) error {
-	timestamp := time.Now().UnixNano()
+// SetReadRepairer enables read repair through the given repairer
+func (c *Coordinator) SetReadRepairer(rr *ReadRepairer) {
+	c.repairer = rr
+}
+
+// GetReadRepairStats returns read repair counters, or nil if read repair is disabled
+func (c *Coordinator) GetReadRepairStats() *ReadRepairStats {
+	if c.repairer == nil {
+		return nil
+	}
+	stats := c.repairer.Stats()
+	return &stats
+}
+
+// ApplyEntry stores an entry in local storage unless a newer version of
+// the key (including a tombstone) is already present. Mergeable values
+// such as CRDTs are merged with the local value instead. It returns
+// whether the entry was written.
+func (c *Coordinator) ApplyEntry(entry types.KeyValueEntry) (bool, error) {
+	c.applyMu.Lock()
+	defer c.applyMu.Unlock()
+
+	entry, ok := c.reconcile(entry)
+	if !ok {
+		return false, nil
+	}
+
+	if entry.IsDeleted {
+		return true, c.storage.Delete(entry.Key, entry.Timestamp)
+	}
+	return true, c.storage.Put(entry.Key, entry.Value, entry.Timestamp)
+}
+
+// reconcile returns the entry to store in place of an incoming one, merged
+// with the local value when both are mergeable, or false if the local
+// version supersedes it. The caller must hold applyMu.
+func (c *Coordinator) reconcile(entry types.KeyValueEntry) (types.KeyValueEntry, bool) {
+	if !entry.IsDeleted {
+		if local, timestamp, err := c.storage.Get(entry.Key); err == nil {
+			if merged, ok := c.resolver.MergeValues(local, entry.Value); ok {
+				if bytes.Equal(merged, local) {
+					return entry, false
+				}
+				if timestamp > entry.Timestamp {
+					entry.Timestamp = timestamp
+				}
+				entry.Value = merged
+				return entry, true
+			}
+		}
+	}
 
-	// Get preference list (N nodes for this key)
-	preferenceList, err := c.ring.GetNodes(key, c.config.ReplicationFactor)
+	if timestamp, exists := c.storage.Timestamp(entry.Key); exists && timestamp > entry.Timestamp {
+		return entry, false
+	}
+	return entry, true
+}
+
+// Supersedes reports whether this node holds a newer version of the
+// entry's key, value or tombstone, than the entry
+func (c *Coordinator) Supersedes(entry types.KeyValueEntry) bool {
+	timestamp, exists := c.storage.Timestamp(entry.Key)
+	return exists && timestamp > entry.Timestamp
+}
+
+// Clock returns the node's hybrid logical clock
+func (c *Coordinator) Clock() *versioning.HLC {
+	return c.clock
+}
+
+// ObserveTimestamp advances the clock past a timestamp received from
+// another node. Timestamps beyond the skew bound are logged, or rejected
+// with ErrClockSkew when reject_clock_skew is set.
+func (c *Coordinator) ObserveTimestamp(timestamp int64, fromNode string) error {
+	err := c.clock.Update(timestamp)
+	if err == nil {
+		return nil
+	}
+
+	if c.config.RejectClockSkew {
+		log.Printf("Rejecting timestamp from %s: %v", fromNode, err)
+		return err
+	}
+	log.Printf("Warning: timestamp from %s: %v", fromNode, err)
+	return nil
+}
+
+// GetLatencyStats returns the observed latency of every replica
+func (c *Coordinator) GetLatencyStats() map[string]LatencyStats {
+	return c.latency.Stats()
+}
+
+// GetHedgeCount returns the number of hedged read requests sent
+func (c *Coordinator) GetHedgeCount() uint64 {
+	return atomic.LoadUint64(&c.hedges)
+}
+
+// Put stores a key-value pair with quorum writes. The returned result
+// reports the acks achieved even when the quorum was not met.
+func (c *Coordinator) Put(ctx context.Context, key string, value []byte, opts types.ConsistencyOptions) (*types.WriteResult, error) {
+	return c.write(ctx, types.KeyValueEntry{Key: key, Value: value}, opts)
+}
+
+// Delete removes a key with quorum writes, replicating a tombstone the way
+// Put replicates a value
+func (c *Coordinator) Delete(ctx context.Context, key string, opts types.ConsistencyOptions) (*types.WriteResult, error) {
+	return c.write(ctx, types.KeyValueEntry{Key: key, IsDeleted: true}, opts)
+}
+
+// write applies a client write of a value or tombstone to the key's
+// replicas, stamping it with a new version. Replicas refuse it while a
+// transaction locks the key.
+func (c *Coordinator) write(ctx context.Context, entry types.KeyValueEntry, opts types.ConsistencyOptions) (*types.WriteResult, error) {
+	key := entry.Key
+
+	// Writes in a session must supersede every version it has observed
+	if err := c.followSession(opts.MinVersion); err != nil {
+		return nil, err
+	}
+	timestamp := c.clock.Now()
+	entry.Timestamp = timestamp
+
+	// Resolve the replica count for this request
+	n, err := c.getReplicaCount(opts)
 	if err != nil {
-		return fmt.Errorf("failed to get preference list: %w", err)
+		return nil, err
 	}
 
-	// Determine required acks based on consistency level
-	requiredAcks := c.getWriteQuorum(consistency)
+	// Get preference list (N nodes for this key), plus any joining owners
+	preferenceList, pending, err := c.writeReplicas(key, n)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get preference list: %w", err)
+	}
 
-	entry := types.KeyValueEntry{
-		Key:       key,
-		Value:     value,
-		Timestamp: timestamp,
+	// Determine required acks based on consistency level
+	requirement, err := c.getWriteQuorum(opts, n, preferenceList)
+	if err != nil {
+		return nil, err
 	}
+	requirement = requirement.withPending(pending)
+	preferenceList = append(preferenceList, pending...)
 
-	// Write to all nodes in parallel
-	results := c.replicateToNodes(ctx, preferenceList, entry) 
+	// Write to all nodes in parallel, returning once the requirement is met
+	var locked atomic.Bool
+	results := c.writeToNodes(ctx, preferenceList, requirement, func(ctx context.Context, nodeID string) bool {
+		var err error
+		if nodeID == c.config.NodeID {
+			err = c.ApplyClientWrite([]types.KeyValueEntry{entry})
+		} else {
+			err = c.replicate(ctx, nodeID, types.ReplicationRequest{Entry: entry, ClientWrite: true})
+		}
+		if errors.Is(err, ErrTxnConflict) {
+			locked.Store(true)
+		}
+		return err == nil
+	})
 
-	// Count successes
-	successCount := 0
-	for _, success := range results {
+	acked := make([]string, 0, len(results))
+	for nodeID, success := range results {
 		if success {
-			successCount++
+			acked = append(acked, nodeID)
 		}
 	}
 
-	if successCount < requiredAcks {
-		return fmt.Errorf("quorum not met: got %d acks, needed %d", successCount, requiredAcks)
+	result := &types.WriteResult{
+		Timestamp: timestamp,
+		Acks:      len(acked),
+		Required:  requirement.count(),
+		Replicas:  len(preferenceList),
+	}
+
+	if !requirement.satisfiedBy(acked, c.datacenterOf) {
+		if locked.Load() {
+			return result, fmt.Errorf("%w: key %s is locked by a transaction", ErrTxnConflict, key)
+		}
+		return result, fmt.Errorf("quorum not met: got %d acks, needed %s", len(acked), requirement)
 	}
 
-	return nil
+	return result, nil
 }
 
 // Get retrieves a value with quorum reads
-func (c *Coordinator) Get(ctx context.Context, key string, consistency types.ConsistencyLevel) ([]byte, int64, error) {
-	// Get preference list
-	preferenceList, err := c.ring.GetNodes(key, c.config.ReplicationFactor)
+func (c *Coordinator) Get(ctx context.Context, key string, opts types.ConsistencyOptions) (*types.ReadResult, error) {
+	// A session version no write could have produced is refused up front
+	// rather than waited for
+	if err := c.followSession(opts.MinVersion); err != nil {
+		return nil, err
+	}
+
+	// Resolve the replica count for this request
+	n, err := c.getReplicaCount(opts)
+	if err != nil {
+		return nil, err
+	}
+
+	// Get preference list, leaving out nodes still streaming their data
+	preferenceList, err := c.readReplicas(key, n)
 	if err != nil {
-		return nil, 0, fmt.Errorf("failed to get preference list: %w", err)
+		return nil, fmt.Errorf("failed to get preference list: %w", err)
 	}
 
 	// Determine required reads based on consistency level
-	requiredReads := c.getReadQuorum(consistency)
+	requirement, err := c.getReadQuorum(opts, n, preferenceList)
+	if err != nil {
+		return nil, err
+	}
 
-	// Read from nodes in parallel
-	responses := c.readFromNodes(ctx, preferenceList, key)
+	if opts.Level == types.ConsistencyLinearizable {
+		return c.readLinearizable(ctx, key, preferenceList, requirement.Total)
+	}
+
+	// Local quorum reads never leave the coordinator's datacenter
+	readNodes := preferenceList
+	if opts.R == 0 && opts.Level == types.ConsistencyLocalQuorum {
+		readNodes = c.filterDatacenter(preferenceList, c.config.Datacenter)
+	}
+
+	// Read from replicas, either hedged or fanned out to all of them
+	var responses []replicaRead
+	if c.config.HedgedReads && len(requirement.PerDC) <= 1 {
+		responses = c.readHedged(ctx, readNodes, key, requirement.count())
+	} else {
+		responses = c.readFromNodes(ctx, readNodes, key)
+	}
+
+	// Session guarantees: steer to the remaining replicas and then wait
+	// until one of them is as fresh as the session has seen
+	if opts.MinVersion > 0 && !hasVersion(responses, opts.MinVersion) {
+		responses, err = c.awaitVersion(ctx, key, preferenceList, responses, opts.MinVersion)
+		if err != nil {
+			return &types.ReadResult{Required: requirement.count(), Replicas: len(preferenceList)}, err
+		}
+	}
 
 	// Collect successful responses
 	successfulResponses := make([]types.KeyValueEntry, 0)
+	found := make([]string, 0, len(responses))
 	for _, resp := range responses {
-		if resp != nil {
-			successfulResponses = append(successfulResponses, *resp)
+		if entry := resp.live(); entry != nil {
+			successfulResponses = append(successfulResponses, *entry)
+			found = append(found, resp.NodeID)
 		}
 	}
 
-	if len(successfulResponses) < requiredReads {
-		return nil, 0, fmt.Errorf("key not found")
+	result := &types.ReadResult{
+		Acks:     len(successfulResponses),
+		Required: requirement.count(),
+		Replicas: len(preferenceList),
 	}
 
-	// Find the most recent value (Last Write Wins)
-	sort.Slice(successfulResponses, func(i, j int) bool {
-		return successfulResponses[i].Timestamp > successfulResponses[j].Timestamp
-	})
+	if !requirement.satisfiedBy(found, c.datacenterOf) {
+		return result, ErrNotFound
+	}
 
-	latest := successfulResponses[0]
+	// Merge CRDTs, otherwise pick the most recent value (Last Write Wins)
+	latest := c.resolver.Resolve(successfulResponses)
 
-	// Perform read repair if there are stale copies
-	go c.readRepair(context.Background(), preferenceList, latest)
+	// Queue repairs for replicas that returned a stale copy or none at all
+	if c.repairer != nil {
+		c.repairer.Check(responses, latest)
+	}
 
-	return latest.Value, latest.Timestamp, nil
+	result.Value = latest.Value
+	result.Timestamp = latest.Timestamp
+	return result, nil
 }
 
-// replicateToNodes sends write requests to multiple nodes
-func (c *Coordinator) replicateToNodes(ctx context.Context, nodes []string, entry types.KeyValueEntry) map[string]bool {
-	results := make(map[string]bool)
-	var mu sync.Mutex
+// followSession advances the clock past the newest version a session has
+// observed, so the next write supersedes it. Session tokens come from
+// clients, so a version further ahead of local time than max_clock_skew
+// (or maxSessionLead if that is unbounded) is refused rather than letting
+// it drag the clock forward or issuing a write below it.
+func (c *Coordinator) followSession(minVersion int64) error {
+	if minVersion <= 0 {
+		return nil
+	}
+
+	bound := c.config.MaxClockSkew
+	if bound == 0 {
+		bound = maxSessionLead
+	}
+	if lead := time.Duration(minVersion - time.Now().UnixNano()); lead > bound {
+		return fmt.Errorf("%w: version %d is %v ahead (max %v)", ErrInvalidSession, minVersion, lead, bound)
+	}
+	if err := c.clock.Update(minVersion); err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidSession, err)
+	}
+	return nil
+}
+
+// awaitVersion reads a key from the replicas not yet contacted and then
+// polls the whole preference list until some replica holds at least
+// minVersion or the session wait timeout expires
+func (c *Coordinator) awaitVersion(ctx context.Context, key string, preferenceList []string, responses []replicaRead, minVersion int64) ([]replicaRead, error) {
+	contacted := make(map[string]bool, len(responses))
+	for _, resp := range responses {
+		contacted[resp.NodeID] = true
+	}
+
+	remaining := make([]string, 0, len(preferenceList))
+	for _, nodeID := range preferenceList {
+		if !contacted[nodeID] {
+			remaining = append(remaining, nodeID)
+		}
+	}
+	if len(remaining) > 0 {
+		responses = append(responses, c.readFromNodes(ctx, remaining, key)...)
+		if hasVersion(responses, minVersion) {
+			return responses, nil
+		}
+	}
+
+	deadline := time.Now().Add(c.config.SessionWaitTimeout)
+	for time.Now().Before(deadline) {
+		select {
+		case <-time.After(sessionPollInterval):
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+
+		responses = c.readFromNodes(ctx, preferenceList, key)
+		if hasVersion(responses, minVersion) {
+			return responses, nil
+		}
+	}
+
+	return nil, fmt.Errorf("%w: no replica of %s reached version %d within %v",
+		ErrSessionUnavailable, key, minVersion, c.config.SessionWaitTimeout)
+}
+
+// hasVersion reports whether any replica returned at least minVersion
+func hasVersion(responses []replicaRead, minVersion int64) bool {
+	for _, resp := range responses {
+		if entry := resp.live(); entry != nil && entry.Timestamp >= minVersion {
+			return true
+		}
+	}
+	return false
+}
+
+// readLinearizable reads a key from a majority of replicas and, before
+// answering, writes the newest version back until a majority holds it.
+// A later majority read then always meets a replica with this version or a
+// newer one, even if the write that produced it never completed. The newest
+// version may be a tombstone, which is written back like a value and then
+// answered as not found.
+func (c *Coordinator) readLinearizable(ctx context.Context, key string, preferenceList []string, majority int) (*types.ReadResult, error) {
+	responses := c.readFromNodes(ctx, preferenceList, key)
+
+	reachable := 0
+	var latest *types.KeyValueEntry
+	for _, resp := range responses {
+		if resp.Err != nil {
+			continue
+		}
+		reachable++
+		if resp.Entry != nil && (latest == nil || resp.Entry.Timestamp > latest.Timestamp) {
+			latest = resp.Entry
+		}
+	}
+
+	result := &types.ReadResult{
+		Required: majority,
+		Replicas: len(preferenceList),
+	}
+
+	if reachable < majority {
+		return result, fmt.Errorf("quorum not met: %d replicas reachable, needed %d", reachable, majority)
+	}
+	if latest == nil {
+		result.Acks = reachable
+		return result, ErrNotFound
+	}
+
+	// Write back to every replica not known to hold the latest version
+	holders := 0
+	stale := make([]string, 0, len(preferenceList))
+	answered := make(map[string]bool, len(responses))
+	for _, resp := range responses {
+		answered[resp.NodeID] = true
+		if resp.Err == nil && !isStale(resp.Entry, *latest) {
+			holders++
+		} else {
+			stale = append(stale, resp.NodeID)
+		}
+	}
+	for _, nodeID := range preferenceList {
+		if !answered[nodeID] {
+			stale = append(stale, nodeID)
+		}
+	}
+
+	if holders < majority {
+		acks := c.writeBackToNodes(ctx, stale, *latest, quorumRequirement{Total: majority - holders})
+		for _, success := range acks {
+			if success {
+				holders++
+			}
+		}
+	} else if c.repairer != nil {
+		c.repairer.Check(responses, *latest)
+	}
+
+	result.Acks = holders
+	if holders < majority {
+		return result, fmt.Errorf("write-back not met: %d replicas hold version %d, needed %d",
+			holders, latest.Timestamp, majority)
+	}
+	if latest.IsDeleted {
+		return result, ErrNotFound
+	}
+
+	result.Value = latest.Value
+	result.Timestamp = latest.Timestamp
+	return result, nil
+}
+
+// replicateToNodes sends write requests to multiple nodes and returns as
+// soon as the requirement is met or every node has answered. Writes still
+// in flight complete in the background, detached from the caller's context.
+func (c *Coordinator) replicateToNodes(ctx context.Context, nodes []string, entry types.KeyValueEntry, requirement quorumRequirement) map[string]bool {
+	return c.writeToNodes(ctx, nodes, requirement, func(ctx context.Context, nodeID string) bool {
+		// Check if it's the local node
+		if nodeID == c.config.NodeID {
+			_, err := c.ApplyEntry(entry)
+			return err == nil
+		}
+		return c.sendReplication(ctx, nodeID, entry)
+	})
+}
+
+// writeBackToNodes writes the version a linearizable read settled on back
+// to replicas, returning as soon as the requirement is met. A replica that
+// kept a newer version instead does not hold this one and does not count.
+func (c *Coordinator) writeBackToNodes(ctx context.Context, nodes []string, entry types.KeyValueEntry, requirement quorumRequirement) map[string]bool {
+	return c.writeToNodes(ctx, nodes, requirement, func(ctx context.Context, nodeID string) bool {
+		if nodeID == c.config.NodeID {
+			applied, err := c.ApplyEntry(entry)
+			return err == nil && (applied || !c.Supersedes(entry))
+		}
+		result, err := c.postReplication(ctx, nodeID, types.ReplicationRequest{Entry: entry})
+		return err == nil && !result.Superseded
+	})
+}
+
+// writeToNodes runs a write against every node in parallel and returns as
+// soon as the requirement is met or every node has answered
+func (c *Coordinator) writeToNodes(ctx context.Context, nodes []string, requirement quorumRequirement, write func(ctx context.Context, nodeID string) bool) map[string]bool {
+	type ack struct {
+		nodeID  string
+		success bool
+	}
+
+	bgCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), c.config.RequestTimeout)
+	acks := make(chan ack, len(nodes))
 	var wg sync.WaitGroup
 
 	for _, nodeID := range nodes {
 		wg.Add(1)
 		go func(nodeID string) {
 			defer wg.Done()
+			acks <- ack{nodeID: nodeID, success: write(bgCtx, nodeID)}
+		}(nodeID)
+	}
 
-			success := false
+	go func() {
+		wg.Wait()
+		cancel()
+	}()
 
-			// Check if it's the local node
-			if nodeID == c.config.NodeID {
-				err := c.storage.Put(entry.Key, entry.Value, entry.Timestamp)
-				success = err == nil
-			} else {
-				success = c.sendReplication(ctx, nodeID, entry)
+	results := make(map[string]bool, len(nodes))
+	acked := make([]string, 0, len(nodes))
+	for len(results) < len(nodes) {
+		select {
+		case a := <-acks:
+			results[a.nodeID] = a.success
+			if a.success {
+				acked = append(acked, a.nodeID)
+				if requirement.satisfiedBy(acked, c.datacenterOf) {
+					return results
+				}
 			}
-
-			mu.Lock()
-			results[nodeID] = success
-			mu.Unlock()
-		}(nodeID)
+		case <-ctx.Done():
+			return results
+		}
 	}
 
-	wg.Wait()
 	return results
 }
 
-// readFromNodes reads from multiple nodes in parallel
-func (c *Coordinator) readFromNodes(ctx context.Context, nodes []string, key string) []*types.KeyValueEntry {
-	responses := make([]*types.KeyValueEntry, len(nodes))
+// readFromNodes reads from multiple nodes in parallel and waits for all of them
+func (c *Coordinator) readFromNodes(ctx context.Context, nodes []string, key string) []replicaRead {
+	responses := make([]replicaRead, len(nodes))
 	var wg sync.WaitGroup
 
 	for i, nodeID := range nodes {
 		wg.Add(1)
 		go func(idx int, nodeID string) {
 			defer wg.Done()
+			responses[idx] = c.readFromNode(ctx, nodeID, key)
+		}(i, nodeID)
+	}
 
-			var entry *types.KeyValueEntry
-
-			// Check if it's the local node
-			if nodeID == c.config.NodeID {
-				value, timestamp, err := c.storage.Get(key)
-				if err == nil {
-					entry = &types.KeyValueEntry{
-						Key:       key,
-						Value:     value,
-						Timestamp: timestamp,
-					}
+	wg.Wait()
+	return responses
+}
+
+// readHedged contacts only the required number of replicas, fastest first,
+// and sends an extra request to the next replica whenever a response is
+// slower than the configured latency percentile or a replica fails
+func (c *Coordinator) readHedged(ctx context.Context, nodes []string, key string, required int) []replicaRead {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	ordered := c.latency.SortByLatency(nodes)
+	results := make(chan replicaRead, len(ordered))
+	next := 0
+
+	launch := func() bool {
+		if next >= len(ordered) {
+			return false
+		}
+		nodeID := ordered[next]
+		next++
+		go func() {
+			results <- c.readFromNode(ctx, nodeID, key)
+		}()
+		return true
+	}
+
+	inflight := 0
+	for i := 0; i < required && launch(); i++ {
+		inflight++
+	}
+
+	timer := time.NewTimer(c.hedgeDelay(ordered[:next]))
+	defer timer.Stop()
+
+	responses := make([]replicaRead, 0, len(ordered))
+	found := 0
+
+	for inflight > 0 {
+		select {
+		case resp := <-results:
+			inflight--
+			responses = append(responses, resp)
+			if resp.live() != nil {
+				found++
+				if found >= required {
+					return responses
 				}
-			} else {
-				entry = c.fetchFromNode(ctx, nodeID, key)
+			} else if launch() {
+				// Replace a failed or empty replica right away
+				inflight++
 			}
 
-			responses[idx] = entry
-		}(i, nodeID)
+		case <-timer.C:
+			if launch() {
+				inflight++
+				atomic.AddUint64(&c.hedges, 1)
+			}
+			timer.Reset(c.hedgeDelay(ordered[:next]))
+
+		case <-ctx.Done():
+			return responses
+		}
 	}
 
-	wg.Wait()
 	return responses
 }
 
+// hedgeDelay returns how long to wait for the contacted replicas before
+// hedging, based on the slowest of their latency percentiles
+func (c *Coordinator) hedgeDelay(contacted []string) time.Duration {
+	delay := c.config.HedgeMinDelay
+	for _, nodeID := range contacted {
+		if p, ok := c.latency.Percentile(nodeID, c.config.HedgePercentile); ok && p > delay {
+			delay = p
+		}
+	}
+	return delay
+}
+
+// readFromNode reads a key from a single replica, recording its latency
+func (c *Coordinator) readFromNode(ctx context.Context, nodeID string, key string) replicaRead {
+	start := time.Now()
+	result := replicaRead{NodeID: nodeID}
+
+	// Check if it's the local node
+	if nodeID == c.config.NodeID {
+		value, timestamp, err := c.storage.Get(key)
+		if err == nil {
+			result.Entry = &types.KeyValueEntry{
+				Key:       key,
+				Value:     value,
+				Timestamp: timestamp,
+			}
+		} else if err == storage.ErrKeyDeleted {
+			if timestamp, exists := c.storage.Timestamp(key); exists {
+				result.Entry = &types.KeyValueEntry{Key: key, Timestamp: timestamp, IsDeleted: true}
+			}
+		} else if err != storage.ErrKeyNotFound {
+			result.Err = err
+		}
+	} else {
+		result.Entry, result.Err = c.fetchFromNode(ctx, nodeID, key)
+		if result.Err == errReplicaNotFound {
+			result.Err = nil
+		}
+	}
+
+	if result.Err != nil {
+		// Cancellations after a hedge won say nothing about the replica
+		if ctx.Err() == nil {
+			c.latency.RecordError(nodeID, time.Since(start))
+		}
+	} else {
+		c.latency.Record(nodeID, time.Since(start))
+	}
+
+	return result
+}
+
 // sendReplication sends a replication request to a remote node
 func (c *Coordinator) sendReplication(ctx context.Context, nodeID string, entry types.KeyValueEntry) bool {
+	return c.replicate(ctx, nodeID, types.ReplicationRequest{Entry: entry}) == nil
+}
+
+// replicate sends a replication request to a node. A client write refused
+// because a transaction locks the key is reported as ErrTxnConflict.
+func (c *Coordinator) replicate(ctx context.Context, nodeID string, req types.ReplicationRequest) error {
+	_, err := c.postReplication(ctx, nodeID, req)
+	return err
+}
+
+// postReplication sends a replication request to a node and returns its
+// answer
+func (c *Coordinator) postReplication(ctx context.Context, nodeID string, req types.ReplicationRequest) (types.ReplicationResponse, error) {
 	c.nodesMu.RLock()
 	node, exists := c.nodes[nodeID]
 	c.nodesMu.RUnlock()
 
 	if !exists {
 		log.Printf("Node %s not found for replication", nodeID)
-		return false
+		return types.ReplicationResponse{}, fmt.Errorf("node %s not found", nodeID)
+	}
+
+	if err := c.simulateInterDCLatency(ctx, nodeID); err != nil {
+		return types.ReplicationResponse{}, err
 	}
 
 	url := fmt.Sprintf("http://%s:%d/internal/replicate", node.Address, node.Port)
 
-	req := types.ReplicationRequest{
-		Entry:    entry,
-		FromNode: c.config.NodeID,
-	}
+	req.FromNode = c.config.NodeID
+	req.RingEpoch, req.RingChecksum = c.ring.Version()
 
 	body, _ := json.Marshal(req)
 
 	httpReq, err := http.NewRequestWithContext(ctx, "POST", url, bytes.NewReader(body))
 	if err != nil {
-		return false
+		return types.ReplicationResponse{}, err
 	}
 	httpReq.Header.Set("Content-Type", "application/json")
 
+	start := time.Now()
 	resp, err := c.httpClient.Do(httpReq)
 	if err != nil {
+		c.latency.RecordError(nodeID, time.Since(start))
 		log.Printf("Failed to replicate to %s: %v", nodeID, err)
-		return false
+		return types.ReplicationResponse{}, err
 	}
 	defer resp.Body.Close()
+	c.latency.Record(nodeID, time.Since(start))
+
+	var result types.ReplicationResponse
+	if json.NewDecoder(resp.Body).Decode(&result) == nil {
+		c.observeReplicaEpoch(nodeID, result.RingEpoch, result.RingChecksum)
+	}
+	return result, replicationError(nodeID, resp.StatusCode, result)
+}
 
-	return resp.StatusCode == http.StatusOK
+// replicationError turns a replica's answer to a write into an error
+func replicationError(nodeID string, status int, result types.ReplicationResponse) error {
+	switch {
+	case status == http.StatusOK:
+		return nil
+	case result.Locked:
+		return fmt.Errorf("%w: %s", ErrTxnConflict, result.Message)
+	}
+	return fmt.Errorf("node %s returned status %d", nodeID, status)
 }
 
 // fetchFromNode fetches a key from a remote node
-func (c *Coordinator) fetchFromNode(ctx context.Context, nodeID string, key string) *types.KeyValueEntry {
+func (c *Coordinator) fetchFromNode(ctx context.Context, nodeID string, key string) (*types.KeyValueEntry, error) {
 	c.nodesMu.RLock()
 	node, exists := c.nodes[nodeID]
 	c.nodesMu.RUnlock()
 
 	if !exists {
-		return nil
+		return nil, fmt.Errorf("node %s not found", nodeID)
+	}
+
+	if err := c.simulateInterDCLatency(ctx, nodeID); err != nil {
+		return nil, err
 	}
 
 	url := fmt.Sprintf("http://%s:%d/internal/read?key=%s", node.Address, node.Port, key)
 
 	httpReq, err := http.NewRequestWithContext(ctx, "GET", url, nil)
 	if err != nil {
-		return nil
+		return nil, err
 	}
 
 	resp, err := c.httpClient.Do(httpReq)
 	if err != nil {
-		return nil
+		return nil, err
 	}
 	defer resp.Body.Close()
 
+	if resp.StatusCode == http.StatusNotFound {
+		return nil, errReplicaNotFound
+	}
 	if resp.StatusCode != http.StatusOK {
-		return nil
+		return nil, fmt.Errorf("node %s returned status %d", nodeID, resp.StatusCode)
 	}
 
 	body, err := io.ReadAll(resp.Body)
 	if err != nil {
-		return nil
+		return nil, err
 	}
 
 	var entry types.KeyValueEntry
 	if err := json.Unmarshal(body, &entry); err != nil {
+		return nil, err
+	}
+	if err := c.clock.Update(entry.Timestamp); err != nil {
+		log.Printf("Warning: version of key %s on %s: %v", key, nodeID, err)
+	}
+
+	return &entry, nil
+}
+
+// simulateInterDCLatency delays a request to a node in another datacenter
+// when an artificial inter-datacenter latency is configured for testing
+func (c *Coordinator) simulateInterDCLatency(ctx context.Context, nodeID string) error {
+	if c.config.InterDCLatency <= 0 || c.datacenterOf(nodeID) == c.config.Datacenter {
 		return nil
 	}
 
-	return &entry
+	select {
+	case <-time.After(c.config.InterDCLatency):
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
 }
 
-// readRepair updates stale nodes with the latest value
-func (c *Coordinator) readRepair(ctx context.Context, nodes []string, latest types.KeyValueEntry) {
-	for _, nodeID := range nodes {
-		if nodeID == c.config.NodeID {
-			// Update local storage if needed
-			value, timestamp, err := c.storage.Get(latest.Key)
-			if err != nil || timestamp < latest.Timestamp {
-				c.storage.Put(latest.Key, latest.Value, latest.Timestamp)
-			} else if timestamp == latest.Timestamp && !bytes.Equal(value, latest.Value) {
-				c.storage.Put(latest.Key, latest.Value, latest.Timestamp)
-			}
-		} else {
-			// Send repair to remote node
-			c.sendReplication(ctx, nodeID, latest)
+// getReplicaCount returns the number of replicas a request uses,
+// validated against the replication factor
+func (c *Coordinator) getReplicaCount(opts types.ConsistencyOptions) (int, error) {
+	if opts.N == 0 {
+		return c.config.ReplicationFactor, nil
+	}
+	if opts.N < 1 || opts.N > c.config.ReplicationFactor {
+		return 0, fmt.Errorf("%w: n=%d must be between 1 and replication factor %d",
+			ErrInvalidConsistency, opts.N, c.config.ReplicationFactor)
+	}
+	return opts.N, nil
+}
+
+// getWriteQuorum returns the write acks needed out of n replicas
+func (c *Coordinator) getWriteQuorum(opts types.ConsistencyOptions, n int, replicas []string) (quorumRequirement, error) {
+	if opts.W != 0 && opts.Level == types.ConsistencyLinearizable {
+		return quorumRequirement{}, fmt.Errorf("%w: w cannot be combined with linearizable", ErrInvalidConsistency)
+	}
+	if opts.W == 0 && isDatacenterLevel(opts.Level) {
+		return c.datacenterQuorum(opts.Level, replicas)
+	}
+	required, err := c.resolveQuorum(opts.Level, opts.W, "w", c.config.WriteQuorum, n)
+	return quorumRequirement{Total: required}, err
+}
+
+// getReadQuorum returns the read responses needed out of n replicas
+func (c *Coordinator) getReadQuorum(opts types.ConsistencyOptions, n int, replicas []string) (quorumRequirement, error) {
+	if opts.R != 0 && opts.Level == types.ConsistencyLinearizable {
+		return quorumRequirement{}, fmt.Errorf("%w: r cannot be combined with linearizable", ErrInvalidConsistency)
+	}
+	if opts.R == 0 && isDatacenterLevel(opts.Level) {
+		return c.datacenterQuorum(opts.Level, replicas)
+	}
+	required, err := c.resolveQuorum(opts.Level, opts.R, "r", c.config.ReadQuorum, n)
+	return quorumRequirement{Total: required}, err
+}
+
+// datacenterQuorum builds the per-datacenter requirement for
+// local_quorum (the coordinator's datacenter) and each_quorum (every
+// datacenter holding a replica)
+func (c *Coordinator) datacenterQuorum(level types.ConsistencyLevel, replicas []string) (quorumRequirement, error) {
+	perDC := make(map[string]int)
+	for _, nodeID := range replicas {
+		perDC[c.datacenterOf(nodeID)]++
+	}
+
+	requirement := quorumRequirement{PerDC: make(map[string]int)}
+	switch level {
+	case types.ConsistencyLocalQuorum:
+		local := perDC[c.config.Datacenter]
+		if local == 0 {
+			return requirement, fmt.Errorf("no replicas in local datacenter %s", c.config.Datacenter)
+		}
+		requirement.PerDC[c.config.Datacenter] = local/2 + 1
+	case types.ConsistencyEachQuorum:
+		for dc, count := range perDC {
+			requirement.PerDC[dc] = count/2 + 1
 		}
 	}
+	return requirement, nil
 }
 
-// getWriteQuorum returns the number of write acks needed
-func (c *Coordinator) getWriteQuorum(consistency types.ConsistencyLevel) int {
-	switch consistency {
-	case types.ConsistencyOne:
-		return 1
-	case types.ConsistencyAll:
-		return c.config.ReplicationFactor
-	default: // quorum
-		return c.config.WriteQuorum
+// datacenterOf returns the datacenter a node belongs to
+func (c *Coordinator) datacenterOf(nodeID string) string {
+	return c.ring.GetNodeTopology(nodeID).Datacenter
+}
+
+// filterDatacenter returns the nodes located in the given datacenter
+func (c *Coordinator) filterDatacenter(nodes []string, datacenter string) []string {
+	filtered := make([]string, 0, len(nodes))
+	for _, nodeID := range nodes {
+		if c.datacenterOf(nodeID) == datacenter {
+			filtered = append(filtered, nodeID)
+		}
 	}
+	return filtered
+}
+
+// isDatacenterLevel reports whether a level is evaluated per datacenter
+func isDatacenterLevel(level types.ConsistencyLevel) bool {
+	return level == types.ConsistencyLocalQuorum || level == types.ConsistencyEachQuorum
 }
 
-// getReadQuorum returns the number of read responses needed
-func (c *Coordinator) getReadQuorum(consistency types.ConsistencyLevel) int {
-	switch consistency {
-	case types.ConsistencyOne:
-		return 1
-	case types.ConsistencyAll:
-		return c.config.ReplicationFactor
-	default: // quorum
-		return c.config.ReadQuorum
+// resolveQuorum turns an explicit count or consistency level into a number
+// of acks, checking that it can be satisfied by n replicas
+func (c *Coordinator) resolveQuorum(level types.ConsistencyLevel, explicit int, name string, configured int, n int) (int, error) {
+	required := explicit
+	if required == 0 {
+		switch level {
+		case types.ConsistencyAll:
+			required = n
+		case types.ConsistencyQuorum, "":
+			required = configured
+			if n != c.config.ReplicationFactor {
+				required = n/2 + 1
+			}
+		case types.ConsistencyLinearizable:
+			required = n/2 + 1
+		default:
+			required = level.ReplicaCount()
+			if required == 0 {
+				return 0, fmt.Errorf("%w: unknown consistency level %q", ErrInvalidConsistency, level)
+			}
+		}
+	}
+
+	if required < 1 || required > n {
+		return 0, fmt.Errorf("%w: %s=%d must be between 1 and %d replicas",
+			ErrInvalidConsistency, name, required, n)
 	}
+	return required, nil
 }
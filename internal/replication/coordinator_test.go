@@ -0,0 +1,656 @@
+package replication
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"sort"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/mini-dynamo/mini-dynamo/internal/config"
+	"github.com/mini-dynamo/mini-dynamo/internal/ring"
+	"github.com/mini-dynamo/mini-dynamo/internal/storage"
+	"github.com/mini-dynamo/mini-dynamo/internal/versioning"
+	"github.com/mini-dynamo/mini-dynamo/pkg/types"
+)
+
+// fakeReplica is an in-memory node serving the internal replication API
+type fakeReplica struct {
+	mu      sync.Mutex
+	entries map[string]types.KeyValueEntry
+	batches int // Batch requests received
+	streams int // Stream pages served
+	moves   int // Token reassignments and weight changes received
+	weights []types.WeightChangeRequest
+	load    types.NodeLoadReport
+	snap    *ring.Snapshot // Ring served to peers, whose epoch replication answers carry
+	delay   time.Duration  // Added to every read, to simulate a slow replica
+	server  *httptest.Server
+}
+
+func newFakeReplica(t *testing.T) *fakeReplica {
+	f := &fakeReplica{entries: make(map[string]types.KeyValueEntry)}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/internal/replicate", func(w http.ResponseWriter, r *http.Request) {
+		var req types.ReplicationRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		f.mu.Lock()
+		resp := types.ReplicationResponse{Success: true}
+		if held, exists := f.entries[req.Entry.Key]; exists && held.Timestamp > req.Entry.Timestamp {
+			resp.Superseded = true
+		} else {
+			f.entries[req.Entry.Key] = req.Entry
+		}
+		if f.snap != nil {
+			resp.RingEpoch, resp.RingChecksum = f.snap.Epoch, f.snap.Checksum()
+		}
+		f.mu.Unlock()
+		json.NewEncoder(w).Encode(resp)
+	})
+	mux.HandleFunc("/internal/batch", func(w http.ResponseWriter, r *http.Request) {
+		var req types.BatchReplicationRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		f.mu.Lock()
+		f.batches++
+		for _, entry := range req.Entries {
+			f.entries[entry.Key] = entry
+		}
+		f.mu.Unlock()
+		json.NewEncoder(w).Encode(types.ReplicationResponse{Success: true})
+	})
+	mux.HandleFunc("/internal/txn/prepare", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(types.ReplicationResponse{Success: true})
+	})
+	mux.HandleFunc("/internal/txn/decide", func(w http.ResponseWriter, r *http.Request) {
+		var req types.TxnDecisionRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		f.mu.Lock()
+		for _, entry := range req.Entries {
+			f.entries[entry.Key] = entry
+		}
+		f.mu.Unlock()
+		json.NewEncoder(w).Encode(types.ReplicationResponse{Success: true})
+	})
+	mux.HandleFunc("/internal/stream", func(w http.ResponseWriter, r *http.Request) {
+		var req types.StreamRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		var resp types.StreamResponse
+		f.mu.Lock()
+		f.streams++
+		for key, entry := range f.entries {
+			if key <= req.After {
+				continue
+			}
+			for _, sr := range req.Ranges {
+				if (ring.TokenRange{StartToken: sr.Start, EndToken: sr.End}).Contains(ring.GetKeyHash(key)) {
+					resp.Entries = append(resp.Entries, entry)
+					break
+				}
+			}
+		}
+		f.mu.Unlock()
+		sort.Slice(resp.Entries, func(i, j int) bool { return resp.Entries[i].Key < resp.Entries[j].Key })
+		if req.Limit > 0 && len(resp.Entries) > req.Limit {
+			resp.Entries = resp.Entries[:req.Limit]
+			resp.Next = resp.Entries[req.Limit-1].Key
+		}
+		json.NewEncoder(w).Encode(resp)
+	})
+	mux.HandleFunc("/internal/ring", func(w http.ResponseWriter, r *http.Request) {
+		f.mu.Lock()
+		defer f.mu.Unlock()
+		if f.snap == nil {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		json.NewEncoder(w).Encode(f.snap)
+	})
+	mux.HandleFunc("/internal/load", func(w http.ResponseWriter, r *http.Request) {
+		f.mu.Lock()
+		defer f.mu.Unlock()
+		json.NewEncoder(w).Encode(f.load)
+	})
+	ringChange := func(w http.ResponseWriter, r *http.Request) {
+		f.mu.Lock()
+		f.moves++
+		f.mu.Unlock()
+		json.NewEncoder(w).Encode(map[string]string{"status": "ok"})
+	}
+	mux.HandleFunc("/internal/ring/reassign", ringChange)
+	mux.HandleFunc("/internal/ring/weight", func(w http.ResponseWriter, r *http.Request) {
+		var req types.WeightChangeRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		f.mu.Lock()
+		f.weights = append(f.weights, req)
+		f.mu.Unlock()
+		ringChange(w, r)
+	})
+	mux.HandleFunc("/internal/read", func(w http.ResponseWriter, r *http.Request) {
+		f.mu.Lock()
+		entry, exists := f.entries[r.URL.Query().Get("key")]
+		delay := f.delay
+		f.mu.Unlock()
+		select {
+		case <-time.After(delay):
+		case <-r.Context().Done():
+			return
+		}
+		if !exists {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		json.NewEncoder(w).Encode(entry)
+	})
+
+	f.server = httptest.NewServer(mux)
+	t.Cleanup(f.server.Close)
+	return f
+}
+
+// node returns the cluster node describing this replica
+func (f *fakeReplica) node(t *testing.T, id, datacenter string) *types.Node {
+	host, portStr, err := net.SplitHostPort(f.server.Listener.Addr().String())
+	if err != nil {
+		t.Fatalf("Bad listener address: %v", err)
+	}
+	port, _ := strconv.Atoi(portStr)
+	return &types.Node{ID: id, Address: host, Port: port, State: types.NodeAlive, Datacenter: datacenter}
+}
+
+// registerPlaced registers a remote node at the tokens the partitioner
+// gives it in the coordinator's ring, as the node would announce them
+func registerPlaced(coord *Coordinator, node *types.Node) {
+	placed := coord.ring.Clone()
+	placed.SetNodeTopology(node.ID, node.Datacenter, node.Rack)
+	placed.AddNode(node.ID)
+	node.TokenRing = placed.NodeTokens(node.ID)
+	coord.RegisterNode(node)
+}
+
+// newMultiDCCoordinator builds a coordinator in dc1 with one local and one
+// fake replica in dc1 and two fake replicas in dc2
+func newMultiDCCoordinator(t *testing.T, interDCLatency time.Duration) (*Coordinator, []*fakeReplica) {
+	store, err := storage.NewBitcask(t.TempDir(), false)
+	if err != nil {
+		t.Fatalf("Failed to create storage: %v", err)
+	}
+	t.Cleanup(func() { store.Close() })
+
+	cfg := config.DefaultConfig()
+	cfg.NodeID = "node1"
+	cfg.Datacenter = "dc1"
+	cfg.ReplicationFactor = 4
+	cfg.ReadQuorum = 3
+	cfg.WriteQuorum = 3
+	cfg.InterDCLatency = interDCLatency
+
+	fakes := []*fakeReplica{newFakeReplica(t), newFakeReplica(t), newFakeReplica(t)}
+
+	coord := NewCoordinator(cfg, ring.NewHashRing(20), store)
+	coord.RegisterNode(&types.Node{ID: "node1", State: types.NodeAlive, Datacenter: "dc1"})
+	registerPlaced(coord, fakes[0].node(t, "node2", "dc1"))
+	registerPlaced(coord, fakes[1].node(t, "node3", "dc2"))
+	registerPlaced(coord, fakes[2].node(t, "node4", "dc2"))
+	return coord, fakes
+}
+
+func TestLocalQuorumAvoidsRemoteDatacenter(t *testing.T) {
+	latency := 300 * time.Millisecond
+	coord, _ := newMultiDCCoordinator(t, latency)
+	ctx := context.Background()
+	opts := types.ConsistencyOptions{Level: types.ConsistencyLocalQuorum}
+
+	start := time.Now()
+	result, err := coord.Put(ctx, "k", []byte("v"), opts)
+	if err != nil {
+		t.Fatalf("local_quorum write failed: %v", err)
+	}
+	if elapsed := time.Since(start); elapsed >= latency {
+		t.Errorf("local_quorum write waited for the remote datacenter (%v)", elapsed)
+	}
+	if result.Required != 2 {
+		t.Errorf("Expected 2 required acks in dc1, got %d", result.Required)
+	}
+
+	start = time.Now()
+	read, err := coord.Get(ctx, "k", opts)
+	if err != nil {
+		t.Fatalf("local_quorum read failed: %v", err)
+	}
+	if elapsed := time.Since(start); elapsed >= latency {
+		t.Errorf("local_quorum read waited for the remote datacenter (%v)", elapsed)
+	}
+	if string(read.Value) != "v" {
+		t.Errorf("Expected 'v', got '%s'", read.Value)
+	}
+}
+
+func TestEachQuorumWaitsForEveryDatacenter(t *testing.T) {
+	latency := 200 * time.Millisecond
+	coord, _ := newMultiDCCoordinator(t, latency)
+
+	start := time.Now()
+	result, err := coord.Put(context.Background(), "k", []byte("v"),
+		types.ConsistencyOptions{Level: types.ConsistencyEachQuorum})
+	if err != nil {
+		t.Fatalf("each_quorum write failed: %v", err)
+	}
+	if elapsed := time.Since(start); elapsed < latency {
+		t.Errorf("each_quorum write returned before the remote datacenter acked (%v)", elapsed)
+	}
+	if result.Required != 4 {
+		t.Errorf("Expected 4 required acks (2 per datacenter), got %d", result.Required)
+	}
+}
+
+func TestInvalidConsistencyOverrides(t *testing.T) {
+	coord, _ := newMultiDCCoordinator(t, 0)
+	ctx := context.Background()
+
+	invalid := []types.ConsistencyOptions{
+		{N: 5},
+		{W: 5},
+		{N: 2, W: 3},
+		{Level: "7"},
+	}
+	for _, opts := range invalid {
+		if _, err := coord.Put(ctx, "k", []byte("v"), opts); err == nil {
+			t.Errorf("Expected %+v to be rejected", opts)
+		}
+	}
+
+	result, err := coord.Put(ctx, "k", []byte("v"), types.ConsistencyOptions{Level: types.ConsistencyTwo})
+	if err != nil || result.Required != 2 {
+		t.Errorf("Expected level two to require 2 acks, got %+v (%v)", result, err)
+	}
+}
+
+func TestHedgedReadAfterPercentileDelay(t *testing.T) {
+	store, err := storage.NewBitcask(t.TempDir(), false)
+	if err != nil {
+		t.Fatalf("Failed to create storage: %v", err)
+	}
+	t.Cleanup(func() { store.Close() })
+
+	cfg := config.DefaultConfig()
+	cfg.NodeID = "node1"
+	cfg.ReplicationFactor = 3
+	cfg.ReadQuorum = 1
+	cfg.WriteQuorum = 1
+	cfg.HedgedReads = true
+	cfg.HedgePercentile = 0.95
+	cfg.HedgeMinDelay = time.Millisecond
+
+	slow, fast := newFakeReplica(t), newFakeReplica(t)
+	coord := NewCoordinator(cfg, ring.NewHashRing(10), store)
+	coord.RegisterNode(&types.Node{ID: "node1", State: types.NodeAlive})
+	registerPlaced(coord, slow.node(t, "node2", ""))
+	registerPlaced(coord, fast.node(t, "node3", ""))
+
+	entry := types.KeyValueEntry{Key: "k", Value: []byte("v"), Timestamp: 100}
+	store.Put(entry.Key, entry.Value, entry.Timestamp)
+	slow.entries["k"], fast.entries["k"] = entry, entry
+	slow.delay = 2 * time.Second
+
+	// node2 has been the fastest so far, so it is read first, and a hedge
+	// goes out once its p95 of 100ms passes
+	for i := 0; i < minPercentileSamples; i++ {
+		coord.latency.Record("node2", 100*time.Millisecond)
+		coord.latency.Record("node1", 150*time.Millisecond)
+		coord.latency.Record("node3", 150*time.Millisecond)
+	}
+
+	start := time.Now()
+	result, err := coord.Get(context.Background(), "k", types.ConsistencyOptions{})
+	elapsed := time.Since(start)
+	if err != nil {
+		t.Fatalf("Hedged read failed: %v", err)
+	}
+	if string(result.Value) != "v" {
+		t.Errorf("Expected 'v', got '%s'", result.Value)
+	}
+	if elapsed < 100*time.Millisecond {
+		t.Errorf("Hedge sent before the percentile delay (%v)", elapsed)
+	}
+	if elapsed >= time.Second {
+		t.Errorf("Read waited for the slow replica (%v)", elapsed)
+	}
+	if hedges := coord.GetHedgeCount(); hedges != 1 {
+		t.Errorf("Expected 1 hedge, got %d", hedges)
+	}
+}
+
+func TestPerRequestQuorum(t *testing.T) {
+	coord, _ := newTestCoordinator(t)
+	coord.config.ReplicationFactor = 5
+	coord.config.ReadQuorum = 4
+	coord.config.WriteQuorum = 2
+
+	tests := []struct {
+		name    string
+		opts    types.ConsistencyOptions
+		n, r, w int
+		wantErr bool
+	}{
+		{name: "configured", opts: types.ConsistencyOptions{}, n: 5, r: 4, w: 2},
+		{name: "quorum at RF", opts: types.ConsistencyOptions{Level: types.ConsistencyQuorum}, n: 5, r: 4, w: 2},
+		{name: "quorum of n", opts: types.ConsistencyOptions{Level: types.ConsistencyQuorum, N: 3}, n: 3, r: 2, w: 2},
+		{name: "default level with n", opts: types.ConsistencyOptions{N: 4}, n: 4, r: 3, w: 3},
+		{name: "all of n", opts: types.ConsistencyOptions{Level: types.ConsistencyAll, N: 2}, n: 2, r: 2, w: 2},
+		{name: "one", opts: types.ConsistencyOptions{Level: types.ConsistencyOne}, n: 5, r: 1, w: 1},
+		{name: "two", opts: types.ConsistencyOptions{Level: types.ConsistencyTwo}, n: 5, r: 2, w: 2},
+		{name: "numeric", opts: types.ConsistencyOptions{Level: "4"}, n: 5, r: 4, w: 4},
+		{name: "linearizable", opts: types.ConsistencyOptions{Level: types.ConsistencyLinearizable}, n: 5, r: 3, w: 3},
+		{name: "explicit r and w", opts: types.ConsistencyOptions{N: 3, R: 1, W: 3}, n: 3, r: 1, w: 3},
+		{name: "explicit over level", opts: types.ConsistencyOptions{Level: types.ConsistencyAll, R: 1, W: 2}, n: 5, r: 1, w: 2},
+		{name: "n above RF", opts: types.ConsistencyOptions{N: 6}, wantErr: true},
+		{name: "r above n", opts: types.ConsistencyOptions{N: 3, R: 4}, wantErr: true},
+		{name: "w above n", opts: types.ConsistencyOptions{N: 2, W: 3}, wantErr: true},
+		{name: "level above n", opts: types.ConsistencyOptions{Level: types.ConsistencyThree, N: 2}, wantErr: true},
+		{name: "numeric above n", opts: types.ConsistencyOptions{Level: "6"}, wantErr: true},
+		{name: "unknown level", opts: types.ConsistencyOptions{Level: "most"}, wantErr: true},
+		{name: "r with linearizable", opts: types.ConsistencyOptions{Level: types.ConsistencyLinearizable, R: 2}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			n, err := coord.getReplicaCount(tt.opts)
+			var r, w quorumRequirement
+			if err == nil {
+				r, err = coord.getReadQuorum(tt.opts, n, nil)
+			}
+			if err == nil {
+				w, err = coord.getWriteQuorum(tt.opts, n, nil)
+			}
+
+			if tt.wantErr {
+				if !errors.Is(err, ErrInvalidConsistency) {
+					t.Errorf("Expected ErrInvalidConsistency, got n=%d r=%d w=%d (%v)", n, r.Total, w.Total, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if n != tt.n || r.Total != tt.r || w.Total != tt.w {
+				t.Errorf("Expected n=%d r=%d w=%d, got n=%d r=%d w=%d", tt.n, tt.r, tt.w, n, r.Total, w.Total)
+			}
+		})
+	}
+}
+
+func TestPutFollowsObservedClock(t *testing.T) {
+	coord, _ := newTestCoordinator(t)
+	ctx := context.Background()
+
+	// A replica whose clock runs ahead wrote a version we have seen
+	ahead := time.Now().Add(200 * time.Millisecond).UnixNano()
+	if err := coord.ObserveTimestamp(ahead, "node2"); err != nil {
+		t.Fatalf("ObserveTimestamp within bound failed: %v", err)
+	}
+
+	result, err := coord.Put(ctx, "k", []byte("v"), types.ConsistencyOptions{})
+	if err != nil {
+		t.Fatalf("Put failed: %v", err)
+	}
+	if result.Timestamp <= ahead {
+		t.Errorf("Write version %d should be newer than observed %d", result.Timestamp, ahead)
+	}
+}
+
+func TestPutFollowsStoredVersions(t *testing.T) {
+	store, err := storage.NewBitcask(t.TempDir(), false)
+	if err != nil {
+		t.Fatalf("Failed to create storage: %v", err)
+	}
+	t.Cleanup(func() { store.Close() })
+
+	// Before a restart, logical ticks ran ahead of the wall clock, and a
+	// tombstone was written above every value
+	stored := time.Now().Add(time.Hour).UnixNano()
+	store.Put("a", []byte("v"), stored-1)
+	store.Delete("b", stored)
+
+	cfg := config.DefaultConfig()
+	cfg.NodeID = "node1"
+	cfg.ReplicationFactor = 1
+	cfg.ReadQuorum = 1
+	cfg.WriteQuorum = 1
+	coord := NewCoordinator(cfg, ring.NewHashRing(10), store)
+	coord.RegisterNode(&types.Node{ID: "node1", State: types.NodeAlive})
+
+	result, err := coord.Put(context.Background(), "b", []byte("v"), types.ConsistencyOptions{})
+	if err != nil {
+		t.Fatalf("Put failed: %v", err)
+	}
+	if result.Timestamp <= stored {
+		t.Errorf("Write version %d should be newer than stored %d", result.Timestamp, stored)
+	}
+	if value, _, err := store.Get("b"); err != nil || string(value) != "v" {
+		t.Errorf("Expected the write to replace the tombstone, got %q (%v)", value, err)
+	}
+}
+
+func TestObserveTimestampRejectsSkew(t *testing.T) {
+	coord, _ := newTestCoordinator(t)
+	future := time.Now().Add(time.Hour).UnixNano()
+
+	if err := coord.ObserveTimestamp(future, "node2"); err != nil {
+		t.Errorf("Skew should only warn by default, got %v", err)
+	}
+
+	coord.config.RejectClockSkew = true
+	if err := coord.ObserveTimestamp(future, "node2"); !errors.Is(err, versioning.ErrClockSkew) {
+		t.Errorf("Expected ErrClockSkew, got %v", err)
+	}
+}
+
+func TestLinearizableReadWritesBack(t *testing.T) {
+	coord, fakes := newMultiDCCoordinator(t, 0)
+	ctx := context.Background()
+
+	// A failed write reached only a single replica
+	partial := types.KeyValueEntry{Key: "k", Value: []byte("partial"), Timestamp: coord.Clock().Now()}
+	fakes[1].entries["k"] = partial
+
+	result, err := coord.Get(ctx, "k", types.ConsistencyOptions{Level: types.ConsistencyLinearizable})
+	if err != nil {
+		t.Fatalf("Linearizable read failed: %v", err)
+	}
+	if string(result.Value) != "partial" || result.Required != 3 {
+		t.Errorf("Expected 'partial' with 3 required, got '%s' (%+v)", result.Value, result)
+	}
+
+	// A majority must now hold the value, so every later read sees it
+	holders := 0
+	if ts, ok := coord.storage.Timestamp("k"); ok && ts == partial.Timestamp {
+		holders++
+	}
+	for _, f := range fakes {
+		f.mu.Lock()
+		if e, ok := f.entries["k"]; ok && e.Timestamp == partial.Timestamp {
+			holders++
+		}
+		f.mu.Unlock()
+	}
+	if holders < 3 {
+		t.Errorf("Expected the value on a majority after the read, found %d", holders)
+	}
+
+	if _, err := coord.Get(ctx, "k", types.ConsistencyOptions{Level: types.ConsistencyLinearizable, R: 1}); !errors.Is(err, ErrInvalidConsistency) {
+		t.Errorf("Expected r with linearizable to be rejected, got %v", err)
+	}
+}
+
+func TestLinearizableReadOfDeletedKey(t *testing.T) {
+	coord, fakes := newMultiDCCoordinator(t, 0)
+	ctx := context.Background()
+
+	// A delete reached only a single replica; another still holds the value
+	written := coord.Clock().Now()
+	coord.storage.Put("k", []byte("v"), written)
+	deleted := types.KeyValueEntry{Key: "k", Timestamp: coord.Clock().Now(), IsDeleted: true}
+	fakes[0].entries["k"] = deleted
+
+	if _, err := coord.Get(ctx, "k", types.ConsistencyOptions{Level: types.ConsistencyLinearizable}); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("Expected the delete to win, got %v", err)
+	}
+
+	// The tombstone was written back to a majority
+	holders := 0
+	if ts, ok := coord.storage.Timestamp("k"); ok && ts == deleted.Timestamp && !coord.storage.Has("k") {
+		holders++
+	}
+	for _, f := range fakes {
+		f.mu.Lock()
+		if e, ok := f.entries["k"]; ok && e.Timestamp == deleted.Timestamp && e.IsDeleted {
+			holders++
+		}
+		f.mu.Unlock()
+	}
+	if holders < 3 {
+		t.Errorf("Expected the tombstone on a majority after the read, found %d", holders)
+	}
+}
+
+func TestWriteBackSkipsSupersededReplicas(t *testing.T) {
+	coord, fakes := newMultiDCCoordinator(t, 0)
+	ctx := context.Background()
+
+	old := types.KeyValueEntry{Key: "k", Value: []byte("old"), Timestamp: coord.Clock().Now()}
+	newer := types.KeyValueEntry{Key: "k", Timestamp: coord.Clock().Now(), IsDeleted: true}
+	fakes[0].entries["k"] = newer
+	coord.storage.Delete("k", newer.Timestamp)
+
+	// Both replicas keep the newer tombstone, so neither holds the version
+	acks := coord.writeBackToNodes(ctx, []string{"node1", "node2", "node3"}, old, quorumRequirement{Total: 3})
+	if acks["node1"] || acks["node2"] {
+		t.Errorf("Expected replicas holding a newer version not to count, got %v", acks)
+	}
+	if !acks["node3"] {
+		t.Errorf("Expected the replica that applied the write-back to count, got %v", acks)
+	}
+}
+
+func TestSessionWriteBoundsVersion(t *testing.T) {
+	coord, _ := newTestCoordinator(t)
+	ctx := context.Background()
+
+	// A version just ahead of local time is followed
+	ahead := time.Now().Add(10 * time.Millisecond).UnixNano()
+	result, err := coord.Put(ctx, "k", []byte("v"), types.ConsistencyOptions{MinVersion: ahead})
+	if err != nil {
+		t.Fatalf("Session write failed: %v", err)
+	}
+	if result.Timestamp <= ahead {
+		t.Errorf("Write version %d should supersede the session's %d", result.Timestamp, ahead)
+	}
+
+	// One beyond max_clock_skew is refused, and leaves the clock alone
+	future := time.Now().Add(time.Hour).UnixNano()
+	if _, err := coord.Put(ctx, "k", []byte("v"), types.ConsistencyOptions{MinVersion: future}); !errors.Is(err, ErrInvalidSession) {
+		t.Errorf("Expected ErrInvalidSession, got %v", err)
+	}
+	ops := []types.BatchOperation{{Op: types.BatchPut, Key: "k", Value: "v"}}
+	if _, err := coord.Batch(ctx, ops, types.ConsistencyOptions{MinVersion: future}); !errors.Is(err, ErrInvalidSession) {
+		t.Errorf("Expected ErrInvalidSession for a batch, got %v", err)
+	}
+
+	// Reads refuse it too, instead of waiting for a replica to reach it
+	start := time.Now()
+	if _, err := coord.Get(ctx, "k", types.ConsistencyOptions{MinVersion: future}); !errors.Is(err, ErrInvalidSession) {
+		t.Errorf("Expected ErrInvalidSession for a read, got %v", err)
+	}
+	if elapsed := time.Since(start); elapsed >= coord.config.SessionWaitTimeout {
+		t.Errorf("Expected the read to be refused without waiting, took %v", elapsed)
+	}
+	if last := coord.Clock().Last(); last >= future {
+		t.Errorf("A refused session version moved the clock to %d", last)
+	}
+
+	// Without a skew bound, versions are still bounded against local time
+	coord.config.MaxClockSkew = 0
+	coord.clock = versioning.NewHLC(0)
+	if _, err := coord.Put(ctx, "k", []byte("v"), types.ConsistencyOptions{MinVersion: future}); !errors.Is(err, ErrInvalidSession) {
+		t.Errorf("Expected ErrInvalidSession with unbounded skew, got %v", err)
+	}
+	near := time.Now().Add(maxSessionLead / 2).UnixNano()
+	if _, err := coord.Put(ctx, "k", []byte("v"), types.ConsistencyOptions{MinVersion: near}); err != nil {
+		t.Errorf("Expected a version within %v to be followed, got %v", maxSessionLead, err)
+	}
+}
+
+func TestSessionReadWaitsForVersion(t *testing.T) {
+	coord, store := newTestCoordinator(t)
+	coord.config.SessionWaitTimeout = time.Second
+	ctx := context.Background()
+
+	store.Put("k", []byte("old"), 100)
+
+	// The session wrote version 200, which reaches this replica later
+	go func() {
+		time.Sleep(100 * time.Millisecond)
+		coord.ApplyEntry(types.KeyValueEntry{Key: "k", Value: []byte("new"), Timestamp: 200})
+	}()
+
+	result, err := coord.Get(ctx, "k", types.ConsistencyOptions{Level: types.ConsistencyOne, MinVersion: 200})
+	if err != nil {
+		t.Fatalf("Session read failed: %v", err)
+	}
+	if string(result.Value) != "new" {
+		t.Errorf("Expected read-your-writes value 'new', got '%s'", result.Value)
+	}
+
+	coord.config.SessionWaitTimeout = 50 * time.Millisecond
+	_, err = coord.Get(ctx, "k", types.ConsistencyOptions{Level: types.ConsistencyOne, MinVersion: 300})
+	if !errors.Is(err, ErrSessionUnavailable) {
+		t.Errorf("Expected ErrSessionUnavailable, got %v", err)
+	}
+}
+
+func TestRegisterNodePlacesRemoteNodesAtTheirTokens(t *testing.T) {
+	coord, _ := newTestCoordinator(t)
+
+	// Without tokens a remote node waits for them rather than being placed
+	// where the local partitioner would put it
+	coord.RegisterNode(&types.Node{ID: "node2", State: types.NodeAlive})
+	if coord.ring.HasNode("node2") {
+		t.Fatal("Expected node2 to stay out of the ring without tokens")
+	}
+
+	tokens := []uint64{100, 200, 300}
+	coord.RegisterNode(&types.Node{ID: "node2", State: types.NodeAlive, TokenRing: tokens})
+	if got := sortedTokens(coord.ring.NodeTokens("node2")); !reflect.DeepEqual(got, tokens) {
+		t.Errorf("Expected node2 at %v, got %v", tokens, got)
+	}
+
+	// A weight gossiped with tokens places the node at them
+	weighted := []uint64{100, 200, 300, 400, 500, 600}
+	coord.RegisterNode(&types.Node{ID: "node2", State: types.NodeAlive, Weight: 2, TokenRing: weighted})
+	if got := sortedTokens(coord.ring.NodeTokens("node2")); !reflect.DeepEqual(got, weighted) {
+		t.Errorf("Expected node2 at %v, got %v", weighted, got)
+	}
+}
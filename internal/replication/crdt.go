@@ -0,0 +1,194 @@
+package replication
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+
+	"github.com/mini-dynamo/mini-dynamo/internal/crdt"
+	"github.com/mini-dynamo/mini-dynamo/internal/storage"
+	"github.com/mini-dynamo/mini-dynamo/pkg/types"
+)
+
+// counterContributionPrefix is where a node persists its own entries of
+// each counter it has updated
+const counterContributionPrefix = storage.SystemKeyPrefix + "crdt/counter/"
+
+// GetCRDT reads a CRDT key, merging the states returned by the replicas.
+// A key that does not exist yields an empty CRDT of the requested type.
+func (c *Coordinator) GetCRDT(ctx context.Context, key string, t crdt.Type, opts types.ConsistencyOptions) (crdt.CRDT, *types.ReadResult, error) {
+	result, err := c.Get(ctx, key, opts)
+	if errors.Is(err, ErrNotFound) {
+		empty, err := crdt.New(t)
+		return empty, result, err
+	}
+	if err != nil {
+		return nil, result, err
+	}
+
+	value, err := crdt.Decode(result.Value)
+	if errors.Is(err, crdt.ErrNotCRDT) {
+		return nil, result, fmt.Errorf("%w: key %s does not hold a %s", crdt.ErrWrongType, key, t)
+	}
+	if err != nil {
+		return nil, result, err
+	}
+	if value.Type() != t {
+		return nil, result, fmt.Errorf("%w: key %s holds a %s, not a %s", crdt.ErrWrongType, key, value.Type(), t)
+	}
+	return value, result, nil
+}
+
+// UpdateCRDT applies an operation to a CRDT key. The merged state is read,
+// updated on behalf of this node and written back; replicas merge the
+// write with what they hold, so concurrent updates coordinated by other
+// nodes are kept. The read need not reach an up-to-date replica, and this
+// node need not be a replica at all, so an answer can hold an older entry
+// of this node's than one already stored elsewhere; the update would then
+// be lost to the max-merge. Counters therefore start from this node's own
+// record of its entries, which it keeps whether or not it stores the key.
+// The record is rolled back if no replica took the update.
+func (c *Coordinator) UpdateCRDT(ctx context.Context, key string, t crdt.Type, opts types.ConsistencyOptions, update func(crdt.CRDT) error) (crdt.CRDT, *types.WriteResult, error) {
+	// A node's own entries in a CRDT must only grow, so its updates to a
+	// key must not interleave
+	unlock := c.crdtLocks.lock(key)
+	defer unlock()
+
+	value, _, err := c.GetCRDT(ctx, key, t, opts)
+	if err != nil {
+		return nil, nil, err
+	}
+	if local := c.localCRDT(key, t); local != nil {
+		if err := value.Merge(local); err != nil {
+			return nil, nil, err
+		}
+	}
+	counter, isCounter := value.(*crdt.PNCounter)
+	before := crdt.NewPNCounter()
+	if isCounter {
+		own, err := c.counterContribution(key)
+		if err != nil {
+			return nil, nil, err
+		}
+		counter.Merge(own)
+		before.Merge(counter)
+	}
+
+	if err := update(value); err != nil {
+		return nil, nil, err
+	}
+
+	// Record the new entries before any replica can see them, so no later
+	// update starts below them
+	if isCounter {
+		if err := c.saveCounterContribution(key, counter); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	data, err := crdt.Encode(value)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	result, err := c.Put(ctx, key, data, opts)
+
+	// An update no replica took can never surface, so the record must not
+	// keep it. One taken by some replicas may, even though the write failed;
+	// so may one still in flight when the caller gave up.
+	if isCounter && err != nil && (result == nil || result.Acks == 0) && ctx.Err() == nil {
+		if rollbackErr := c.saveCounterContribution(key, before); rollbackErr != nil {
+			log.Printf("Failed to roll back counter contribution for %s: %v", key, rollbackErr)
+		}
+	}
+	return value, result, err
+}
+
+// localCRDT returns this node's stored copy of a CRDT key, or nil if it
+// holds none of the given type
+func (c *Coordinator) localCRDT(key string, t crdt.Type) crdt.CRDT {
+	data, _, err := c.storage.Get(key)
+	if err != nil {
+		return nil
+	}
+	value, err := crdt.Decode(data)
+	if err != nil || value.Type() != t {
+		return nil
+	}
+	return value
+}
+
+// counterContribution returns this node's recorded entries of a counter,
+// empty if it never updated the counter
+func (c *Coordinator) counterContribution(key string) (*crdt.PNCounter, error) {
+	own := crdt.NewPNCounter()
+	data, _, err := c.storage.Get(counterContributionPrefix + key)
+	if errors.Is(err, storage.ErrKeyNotFound) || errors.Is(err, storage.ErrKeyDeleted) {
+		return own, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, own); err != nil {
+		return nil, fmt.Errorf("corrupt counter contribution for %s: %w", key, err)
+	}
+	return own, nil
+}
+
+// saveCounterContribution records this node's entries of a counter
+func (c *Coordinator) saveCounterContribution(key string, counter *crdt.PNCounter) error {
+	own := crdt.NewPNCounter()
+	nodeID := c.config.NodeID
+	if p, exists := counter.P[nodeID]; exists {
+		own.P[nodeID] = p
+	}
+	if n, exists := counter.N[nodeID]; exists {
+		own.N[nodeID] = n
+	}
+
+	data, err := json.Marshal(own)
+	if err != nil {
+		return err
+	}
+	return c.storage.Put(counterContributionPrefix+key, data, c.clock.Now())
+}
+
+// keyLocks serializes work on individual keys. A key's mutex exists only
+// while some caller holds or waits for it.
+type keyLocks struct {
+	mu    sync.Mutex
+	locks map[string]*keyLock
+}
+
+type keyLock struct {
+	mu   sync.Mutex
+	refs int
+}
+
+// lock blocks until the key is free and returns the function releasing it
+func (l *keyLocks) lock(key string) func() {
+	l.mu.Lock()
+	if l.locks == nil {
+		l.locks = make(map[string]*keyLock)
+	}
+	kl, ok := l.locks[key]
+	if !ok {
+		kl = &keyLock{}
+		l.locks[key] = kl
+	}
+	kl.refs++
+	l.mu.Unlock()
+
+	kl.mu.Lock()
+	return func() {
+		kl.mu.Unlock()
+		l.mu.Lock()
+		if kl.refs--; kl.refs == 0 {
+			delete(l.locks, key)
+		}
+		l.mu.Unlock()
+	}
+}
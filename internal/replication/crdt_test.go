@@ -0,0 +1,236 @@
+package replication
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/mini-dynamo/mini-dynamo/internal/config"
+	"github.com/mini-dynamo/mini-dynamo/internal/crdt"
+	"github.com/mini-dynamo/mini-dynamo/internal/ring"
+	"github.com/mini-dynamo/mini-dynamo/internal/storage"
+	"github.com/mini-dynamo/mini-dynamo/pkg/types"
+)
+
+func TestApplyEntryMergesCRDTs(t *testing.T) {
+	coord, store := newTestCoordinator(t)
+
+	// Two coordinators incremented the same counter concurrently
+	a := crdt.NewPNCounter()
+	a.Increment("node1", 2)
+	b := crdt.NewPNCounter()
+	b.Increment("node2", 3)
+	ea, _ := crdt.Encode(a)
+	eb, _ := crdt.Encode(b)
+
+	coord.ApplyEntry(types.KeyValueEntry{Key: "c", Value: ea, Timestamp: 200})
+	coord.ApplyEntry(types.KeyValueEntry{Key: "c", Value: eb, Timestamp: 100})
+
+	value, ts, _ := store.Get("c")
+	merged, err := crdt.Decode(value)
+	if err != nil {
+		t.Fatalf("Stored value is not a CRDT: %v", err)
+	}
+	if merged.(*crdt.PNCounter).Value() != 5 || ts != 200 {
+		t.Errorf("Expected merged counter 5 @200, got %d @%d", merged.(*crdt.PNCounter).Value(), ts)
+	}
+}
+
+func TestUpdateCRDT(t *testing.T) {
+	coord, _ := newTestCoordinator(t)
+	ctx := context.Background()
+
+	incr := func(c crdt.CRDT) error {
+		c.(*crdt.PNCounter).Increment("node1", 1)
+		return nil
+	}
+	for i := 0; i < 3; i++ {
+		if _, _, err := coord.UpdateCRDT(ctx, "c", crdt.TypeCounter, types.ConsistencyOptions{}, incr); err != nil {
+			t.Fatalf("UpdateCRDT failed: %v", err)
+		}
+	}
+
+	value, _, err := coord.GetCRDT(ctx, "c", crdt.TypeCounter, types.ConsistencyOptions{})
+	if err != nil || value.(*crdt.PNCounter).Value() != 3 {
+		t.Errorf("Expected counter 3, got %v (%v)", value, err)
+	}
+
+	if _, _, err := coord.GetCRDT(ctx, "c", crdt.TypeSet, types.ConsistencyOptions{}); err == nil {
+		t.Error("Expected reading a counter as a set to fail")
+	}
+}
+
+func TestUpdateCRDTWithLaggingReplica(t *testing.T) {
+	store, err := storage.NewBitcask(t.TempDir(), false)
+	if err != nil {
+		t.Fatalf("Failed to create storage: %v", err)
+	}
+	t.Cleanup(func() { store.Close() })
+
+	cfg := config.DefaultConfig()
+	cfg.NodeID = "node1"
+	cfg.ReplicationFactor = 2
+	cfg.ReadQuorum = 1
+	cfg.WriteQuorum = 1
+	cfg.HedgedReads = true
+	cfg.HedgeMinDelay = time.Second
+
+	lagging := newFakeReplica(t)
+	coord := NewCoordinator(cfg, ring.NewHashRing(10), store)
+	coord.RegisterNode(&types.Node{ID: "node1", State: types.NodeAlive})
+	registerPlaced(coord, lagging.node(t, "node2", ""))
+
+	// node2 missed the last two increments and, being the fastest, is the
+	// only replica the read waits for
+	counter := func(n int64) []byte {
+		c := crdt.NewPNCounter()
+		c.Increment("node1", n)
+		data, _ := crdt.Encode(c)
+		return data
+	}
+	store.Put("c", counter(3), 300)
+	lagging.entries["c"] = types.KeyValueEntry{Key: "c", Value: counter(1), Timestamp: 100}
+	for i := 0; i < minPercentileSamples; i++ {
+		coord.latency.Record("node2", time.Millisecond)
+		coord.latency.Record("node1", 500*time.Millisecond)
+	}
+
+	value, _, err := coord.UpdateCRDT(context.Background(), "c", crdt.TypeCounter, types.ConsistencyOptions{}, func(c crdt.CRDT) error {
+		c.(*crdt.PNCounter).Increment("node1", 1)
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("UpdateCRDT failed: %v", err)
+	}
+	if got := value.(*crdt.PNCounter).Value(); got != 4 {
+		t.Errorf("Expected counter 4, got %d", got)
+	}
+
+	local := coord.localCRDT("c", crdt.TypeCounter)
+	if local == nil || local.(*crdt.PNCounter).Value() != 4 {
+		t.Errorf("Expected the local replica to hold 4, got %v", local)
+	}
+}
+
+func TestUpdateCRDTThroughNonReplica(t *testing.T) {
+	store, err := storage.NewBitcask(t.TempDir(), false)
+	if err != nil {
+		t.Fatalf("Failed to create storage: %v", err)
+	}
+	t.Cleanup(func() { store.Close() })
+
+	cfg := config.DefaultConfig()
+	cfg.NodeID = "node1"
+	cfg.ReplicationFactor = 2
+	cfg.ReadQuorum = 1
+	cfg.WriteQuorum = 1
+	cfg.HedgedReads = true
+	cfg.HedgeMinDelay = time.Second
+
+	// node1 coordinates but holds no replica of the key
+	current, stale := newFakeReplica(t), newFakeReplica(t)
+	coord := NewCoordinator(cfg, ring.NewHashRing(10), store)
+	registerPlaced(coord, current.node(t, "node2", ""))
+	registerPlaced(coord, stale.node(t, "node3", ""))
+
+	incr := func(c crdt.CRDT) error {
+		c.(*crdt.PNCounter).Increment("node1", 1)
+		return nil
+	}
+	for i := 0; i < 3; i++ {
+		if _, _, err := coord.UpdateCRDT(context.Background(), "c", crdt.TypeCounter, types.ConsistencyOptions{}, incr); err != nil {
+			t.Fatalf("UpdateCRDT failed: %v", err)
+		}
+	}
+
+	// node3 missed the last two increments and, being the fastest, is the
+	// only replica the read waits for
+	one := crdt.NewPNCounter()
+	one.Increment("node1", 1)
+	data, _ := crdt.Encode(one)
+	stale.mu.Lock()
+	stale.entries["c"] = types.KeyValueEntry{Key: "c", Value: data, Timestamp: 1}
+	stale.mu.Unlock()
+	for i := 0; i < minPercentileSamples; i++ {
+		coord.latency.Record("node3", time.Millisecond)
+		coord.latency.Record("node2", 500*time.Millisecond)
+	}
+
+	value, _, err := coord.UpdateCRDT(context.Background(), "c", crdt.TypeCounter, types.ConsistencyOptions{}, incr)
+	if err != nil {
+		t.Fatalf("UpdateCRDT failed: %v", err)
+	}
+	if got := value.(*crdt.PNCounter).Value(); got != 4 {
+		t.Errorf("Expected counter 4, got %d", got)
+	}
+	if store.Has("c") {
+		t.Error("Expected the non-replica coordinator not to store the key")
+	}
+}
+
+func TestUpdateCRDTRollsBackFailedIncrement(t *testing.T) {
+	coord, _ := newTestCoordinator(t)
+	txns := NewTxnCoordinator(coord, time.Minute)
+	ctx := context.Background()
+
+	incr := func(c crdt.CRDT) error {
+		c.(*crdt.PNCounter).Increment("node1", 1)
+		return nil
+	}
+	if _, _, err := coord.UpdateCRDT(ctx, "c", crdt.TypeCounter, types.ConsistencyOptions{}, incr); err != nil {
+		t.Fatalf("UpdateCRDT failed: %v", err)
+	}
+
+	// A transaction locks the key, so no replica takes the next increment
+	txns.Prepare(types.TxnPrepareRequest{TxnID: "other", Coordinator: "node1", Keys: []string{"c"}})
+	if _, _, err := coord.UpdateCRDT(ctx, "c", crdt.TypeCounter, types.ConsistencyOptions{}, incr); !errors.Is(err, ErrTxnConflict) {
+		t.Fatalf("Expected the increment to be refused, got %v", err)
+	}
+	if own, err := coord.counterContribution("c"); err != nil || own.Value() != 1 {
+		t.Errorf("Expected the failed increment to leave the contribution at 1, got %v (%v)", own, err)
+	}
+
+	txns.Decide(types.TxnDecisionRequest{TxnID: "other"})
+	value, _, err := coord.UpdateCRDT(ctx, "c", crdt.TypeCounter, types.ConsistencyOptions{}, incr)
+	if err != nil || value.(*crdt.PNCounter).Value() != 2 {
+		t.Errorf("Expected counter 2 after the failed increment, got %v (%v)", value, err)
+	}
+}
+
+func TestKeyLocks(t *testing.T) {
+	var locks keyLocks
+
+	unlockA := locks.lock("a")
+	done := make(chan struct{})
+	go func() {
+		// Another key is not held up
+		locks.lock("b")()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("Locking another key blocked")
+	}
+
+	acquired := make(chan struct{})
+	go func() {
+		unlock := locks.lock("a")
+		close(acquired)
+		unlock()
+	}()
+	select {
+	case <-acquired:
+		t.Fatal("Locked a key that was already held")
+	case <-time.After(50 * time.Millisecond):
+	}
+	unlockA()
+	<-acquired
+
+	locks.mu.Lock()
+	defer locks.mu.Unlock()
+	if len(locks.locks) != 0 {
+		t.Errorf("Expected released locks to be dropped, %d remain", len(locks.locks))
+	}
+}
@@ -0,0 +1,206 @@
+package replication
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+
+	"github.com/mini-dynamo/mini-dynamo/internal/ring"
+	"github.com/mini-dynamo/mini-dynamo/pkg/types"
+)
+
+// ErrCannotDecommission is returned when the node is not in a state it
+// can leave the ring from
+var ErrCannotDecommission = errors.New("cannot decommission")
+
+// handoffGroup is the set of ranges that move to the same new owner
+type handoffGroup struct {
+	target string
+	ranges []types.StreamRange
+}
+
+// Decommissioner takes the local node out of the ring gracefully. It
+// streams every range the node owns to the owners computed from the ring
+// without it and then marks the node left, so peers drop it at once
+// instead of waiting for the failure detector. Writes reach the new owners
+// while the ranges move, so nothing written during the handoff is lost.
+type Decommissioner struct {
+	coordinator *Coordinator
+	onState     func(types.RingState)
+	mu          sync.Mutex
+	stats       StreamStats
+	running     bool
+	cancel      context.CancelFunc
+	wg          sync.WaitGroup
+}
+
+// NewDecommissioner creates a decommissioner for the local node. onState,
+// if set, is called on every state change so it can be advertised.
+func NewDecommissioner(coord *Coordinator, onState func(types.RingState)) *Decommissioner {
+	return &Decommissioner{
+		coordinator: coord,
+		onState:     onState,
+	}
+}
+
+// Start begins the decommission in the background. It fails with
+// ErrCannotDecommission if one is already running, the node has left, or
+// it is still joining.
+func (d *Decommissioner) Start() error {
+	state := d.coordinator.GetNodeRingState(d.coordinator.config.NodeID)
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	switch {
+	case d.running:
+		return fmt.Errorf("%w: already in progress", ErrCannotDecommission)
+	case state == types.RingLeft:
+		return fmt.Errorf("%w: node has already left the ring", ErrCannotDecommission)
+	case !state.ServesReads():
+		return fmt.Errorf("%w: node is %s", ErrCannotDecommission, state)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	d.running = true
+	d.cancel = cancel
+	d.stats = StreamStats{}
+
+	d.wg.Add(1)
+	go func() {
+		defer d.wg.Done()
+		defer cancel()
+		if err := d.Run(ctx); err != nil {
+			log.Printf("Decommission failed: %v", err)
+		}
+		d.mu.Lock()
+		d.running = false
+		d.mu.Unlock()
+	}()
+	return nil
+}
+
+// Stop cancels a running decommission and waits for it to return
+func (d *Decommissioner) Stop() {
+	d.mu.Lock()
+	cancel := d.cancel
+	d.mu.Unlock()
+
+	if cancel != nil {
+		cancel()
+	}
+	d.wg.Wait()
+}
+
+// Run hands off the node's ranges and marks it left. On failure the node
+// goes back to ready and keeps its ranges.
+func (d *Decommissioner) Run(ctx context.Context) error {
+	c := d.coordinator
+	d.setState(types.RingLeaving)
+
+	groups, err := d.planHandoff()
+	if err == nil {
+		total := 0
+		for _, group := range groups {
+			total += len(group.ranges)
+		}
+		d.mu.Lock()
+		d.stats.RangesTotal = total
+		d.mu.Unlock()
+		log.Printf("Decommissioning %s: handing off %d token ranges to %d nodes", c.config.NodeID, total, len(groups))
+
+		for _, group := range groups {
+			if err = d.handoff(ctx, group); err != nil {
+				break
+			}
+		}
+	}
+
+	if err != nil {
+		d.mu.Lock()
+		d.stats.Error = err.Error()
+		d.mu.Unlock()
+		d.setState(types.RingReady)
+		return err
+	}
+
+	d.setState(types.RingLeft)
+	log.Printf("Decommission of %s complete: %d keys handed off", c.config.NodeID, d.Stats().KeysStreamed)
+	return nil
+}
+
+// Stats returns the decommission progress
+func (d *Decommissioner) Stats() StreamStats {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.stats
+}
+
+// setState records a new state locally and reports it
+func (d *Decommissioner) setState(state types.RingState) {
+	d.mu.Lock()
+	d.stats.State = state
+	d.mu.Unlock()
+
+	d.coordinator.SetNodeRingState(d.coordinator.config.NodeID, state)
+	if d.onState != nil {
+		d.onState(state)
+	}
+}
+
+// planHandoff finds the token ranges the local node owns and groups them
+// by the nodes that will own them once it has left
+func (d *Decommissioner) planHandoff() ([]*handoffGroup, error) {
+	c := d.coordinator
+	self := c.config.NodeID
+	n := c.config.ReplicationFactor
+	pending, departing := c.transitioningNodes()
+
+	groups := make(map[string]*handoffGroup)
+	var order []*handoffGroup
+	for _, r := range ring.NewVNodeManager(c.ring).GetTokenRanges() {
+		owners, err := c.ring.GetNodesForToken(r.EndToken, n, pending)
+		if err != nil || !containsNode(owners, self) {
+			continue
+		}
+
+		newOwners, err := c.ring.GetNodesForToken(r.EndToken, n, departing)
+		if err != nil {
+			return nil, fmt.Errorf("no node would own the data of %s: %w", self, err)
+		}
+
+		for _, target := range newOwners {
+			if containsNode(owners, target) {
+				continue
+			}
+			group, exists := groups[target]
+			if !exists {
+				group = &handoffGroup{target: target}
+				groups[target] = group
+				order = append(order, group)
+			}
+			group.ranges = append(group.ranges, types.StreamRange{Start: r.StartToken, End: r.EndToken})
+		}
+	}
+	return order, nil
+}
+
+// handoff sends the entries of a group of ranges to their new owner
+func (d *Decommissioner) handoff(ctx context.Context, group *handoffGroup) error {
+	c := d.coordinator
+	keys, err := c.relayRanges(ctx, []string{c.config.NodeID}, group.target, group.ranges)
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.stats.KeysStreamed += keys
+	if err != nil {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		return err
+	}
+	d.stats.RangesStreamed += len(group.ranges)
+	return nil
+}
@@ -0,0 +1,115 @@
+package replication
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/mini-dynamo/mini-dynamo/pkg/types"
+)
+
+func TestDecommissionHandsOffRanges(t *testing.T) {
+	coord, fakes := newJoiningCoordinator(t)
+	coord.SetNodeRingState("node1", types.RingReady)
+
+	byID := map[string]*fakeReplica{"node2": fakes[0], "node3": fakes[1]}
+	for i := 0; i < 100; i++ {
+		key := fmt.Sprintf("key%d", i)
+		if _, err := coord.ApplyEntry(types.KeyValueEntry{Key: key, Value: []byte("v"), Timestamp: int64(i + 1)}); err != nil {
+			t.Fatalf("ApplyEntry failed: %v", err)
+		}
+	}
+
+	// Record where each key owned by node1 must move
+	moves := make(map[string]string)
+	for i := 0; i < 100; i++ {
+		key := fmt.Sprintf("key%d", i)
+		owners, _ := coord.ring.GetNodes(key, 2)
+		if !containsNode(owners, "node1") {
+			continue
+		}
+		newOwners, _ := coord.ring.GetNodesExcluding(key, 2, map[string]bool{"node1": true})
+		for _, n := range newOwners {
+			if !containsNode(owners, n) {
+				moves[key] = n
+			}
+		}
+	}
+
+	var states []types.RingState
+	d := NewDecommissioner(coord, func(state types.RingState) { states = append(states, state) })
+	if err := d.Run(context.Background()); err != nil {
+		t.Fatalf("Decommission failed: %v", err)
+	}
+
+	if fmt.Sprint(states) != fmt.Sprint([]types.RingState{types.RingLeaving, types.RingLeft}) {
+		t.Errorf("Unexpected state transitions: %v", states)
+	}
+	if len(moves) == 0 {
+		t.Fatal("node1 owns no keys that move")
+	}
+	for key, target := range moves {
+		f := byID[target]
+		f.mu.Lock()
+		_, received := f.entries[key]
+		f.mu.Unlock()
+		if !received {
+			t.Errorf("Key %s not handed off to %s", key, target)
+		}
+	}
+	if stats := d.Stats(); stats.KeysStreamed != len(moves) || stats.RangesStreamed != stats.RangesTotal {
+		t.Errorf("Expected %d keys handed off, got %+v", len(moves), stats)
+	}
+}
+
+func TestDecommissionFailureKeepsNode(t *testing.T) {
+	coord, fakes := newJoiningCoordinator(t)
+	coord.SetNodeRingState("node1", types.RingReady)
+	for i := 0; i < 50; i++ {
+		coord.ApplyEntry(types.KeyValueEntry{Key: fmt.Sprintf("key%d", i), Value: []byte("v"), Timestamp: 1})
+	}
+	fakes[0].server.Close()
+	fakes[1].server.Close()
+
+	d := NewDecommissioner(coord, nil)
+	if err := d.Run(context.Background()); err == nil {
+		t.Fatal("Expected decommission to fail with every new owner down")
+	}
+	if state := coord.GetNodeRingState("node1"); state != types.RingReady {
+		t.Errorf("Expected node1 back to ready, got %q", state)
+	}
+	if stats := d.Stats(); stats.Error == "" {
+		t.Error("Expected the failure in the stats")
+	}
+}
+
+func TestDecommissionRejectedWhileJoining(t *testing.T) {
+	coord, _ := newJoiningCoordinator(t)
+
+	err := NewDecommissioner(coord, nil).Start()
+	if !errors.Is(err, ErrCannotDecommission) {
+		t.Fatalf("Expected ErrCannotDecommission, got %v", err)
+	}
+}
+
+func TestLeavingNodeWritesReachNewOwners(t *testing.T) {
+	coord, _ := newJoiningCoordinator(t)
+	coord.SetNodeRingState("node1", types.RingLeaving)
+
+	for i := 0; i < 50; i++ {
+		key := fmt.Sprintf("key%d", i)
+		owners, _ := coord.ring.GetNodes(key, 2)
+		if !containsNode(owners, "node1") {
+			continue
+		}
+
+		natural, pending, err := coord.writeReplicas(key, 2)
+		if err != nil {
+			t.Fatalf("writeReplicas failed: %v", err)
+		}
+		if !containsNode(natural, "node1") || len(pending) != 1 || containsNode(pending, "node1") {
+			t.Errorf("Key %s: expected node1 plus one new owner, got %v and %v", key, natural, pending)
+		}
+	}
+}
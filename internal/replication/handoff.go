@@ -6,6 +6,7 @@ import (
 	"sync"
 	"time"
 
+	"github.com/mini-dynamo/mini-dynamo/internal/ring"
 	"github.com/mini-dynamo/mini-dynamo/pkg/types"
 )
 
@@ -248,3 +249,38 @@ func (m *HandoffManager) deliverPendingHandoffs() {
 		}
 	}
 }
+
+// OnRingChange moves hints for keys their target no longer replicates to
+// the nodes that gained those keys. Hints for ranges nobody gains stay
+// with their target.
+func (m *HandoffManager) OnRingChange(diff *ring.RingDiff) {
+	for _, node := range diff.Nodes {
+		if len(node.Lost) == 0 {
+			continue
+		}
+
+		for _, hint := range m.store.GetHints(node.NodeID) {
+			token := m.coordinator.ring.KeyToken(hint.Entry.Key)
+			for _, move := range diff.Moves {
+				if !move.Range().Contains(token) {
+					continue
+				}
+				if !containsNode(move.Before, node.NodeID) || containsNode(move.After, node.NodeID) {
+					break
+				}
+
+				moved := false
+				for _, target := range move.After {
+					if !containsNode(move.Before, target) {
+						m.store.Store(target, hint.Entry)
+						moved = true
+					}
+				}
+				if moved {
+					m.store.RemoveHint(node.NodeID, hint.Entry.Key)
+				}
+				break
+			}
+		}
+	}
+}
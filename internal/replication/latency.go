@@ -0,0 +1,189 @@
+package replication
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+// minPercentileSamples is the number of samples needed before a node's
+// percentile latency is trusted over the configured minimum hedge delay
+const minPercentileSamples = 10
+
+// LatencyStats is a point-in-time view of a node's observed latency
+type LatencyStats struct {
+	EWMA    time.Duration `json:"ewma"`
+	P50     time.Duration `json:"p50"`
+	P95     time.Duration `json:"p95"`
+	P99     time.Duration `json:"p99"`
+	Samples uint64        `json:"samples"`
+	Errors  uint64        `json:"errors"`
+}
+
+// nodeLatency holds the latency history for a single node
+type nodeLatency struct {
+	ewma    float64         // Exponentially weighted moving average (ns)
+	samples []time.Duration // Ring buffer of recent samples
+	next    int             // Next write position in samples
+	count   uint64          // Total samples recorded
+	errors  uint64          // Total failed requests
+}
+
+// LatencyTracker keeps per-node latency statistics used to pick the
+// fastest replicas and to decide when a read should be hedged
+type LatencyTracker struct {
+	mu         sync.RWMutex
+	alpha      float64 // EWMA smoothing factor (0-1]
+	window     int     // Number of samples kept for percentiles
+	minPenalty float64 // Lowest latency charged for a failure (ns)
+	nodes      map[string]*nodeLatency
+}
+
+// NewLatencyTracker creates a new latency tracker. A failed request is
+// charged at least minPenalty, however quickly it failed.
+func NewLatencyTracker(alpha float64, window int, minPenalty time.Duration) *LatencyTracker {
+	if alpha <= 0 || alpha > 1 {
+		alpha = 0.2
+	}
+	if window < 1 {
+		window = 128
+	}
+	return &LatencyTracker{
+		alpha:      alpha,
+		window:     window,
+		minPenalty: float64(minPenalty),
+		nodes:      make(map[string]*nodeLatency),
+	}
+}
+
+// getOrCreate returns the latency record for a node (caller holds lock)
+func (t *LatencyTracker) getOrCreate(nodeID string) *nodeLatency {
+	nl, exists := t.nodes[nodeID]
+	if !exists {
+		nl = &nodeLatency{samples: make([]time.Duration, 0, t.window)}
+		t.nodes[nodeID] = nl
+	}
+	return nl
+}
+
+// Record adds a successful request latency for a node
+func (t *LatencyTracker) Record(nodeID string, d time.Duration) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	nl := t.getOrCreate(nodeID)
+	if nl.count == 0 {
+		nl.ewma = float64(d)
+	} else {
+		nl.ewma = t.alpha*float64(d) + (1-t.alpha)*nl.ewma
+	}
+
+	if len(nl.samples) < t.window {
+		nl.samples = append(nl.samples, d)
+	} else {
+		nl.samples[nl.next] = d
+	}
+	nl.next = (nl.next + 1) % t.window
+	nl.count++
+}
+
+// RecordError records a failed request, penalizing the node's average so
+// that it is tried last until it recovers. A node that is down fails fast,
+// so the penalty does not shrink below the tracker's minimum.
+func (t *LatencyTracker) RecordError(nodeID string, d time.Duration) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	nl := t.getOrCreate(nodeID)
+	nl.errors++
+	penalty := max(float64(d)*2, t.minPenalty)
+	if penalty > nl.ewma {
+		nl.ewma = t.alpha*penalty + (1-t.alpha)*nl.ewma
+	}
+}
+
+// EWMA returns the moving average latency of a node (0 if unknown)
+func (t *LatencyTracker) EWMA(nodeID string) time.Duration {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+
+	if nl, exists := t.nodes[nodeID]; exists {
+		return time.Duration(nl.ewma)
+	}
+	return 0
+}
+
+// Percentile returns the p-th percentile (0-1) latency of a node and
+// whether enough samples exist for it to be meaningful
+func (t *LatencyTracker) Percentile(nodeID string, p float64) (time.Duration, bool) {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+
+	nl, exists := t.nodes[nodeID]
+	if !exists || len(nl.samples) < minPercentileSamples {
+		return 0, false
+	}
+	return percentile(nl.samples, p), true
+}
+
+// SortByLatency returns the nodes ordered from fastest to slowest.
+// Nodes without any history sort first so they get measured.
+func (t *LatencyTracker) SortByLatency(nodes []string) []string {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+
+	sorted := make([]string, len(nodes))
+	copy(sorted, nodes)
+
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return t.ewmaLocked(sorted[i]) < t.ewmaLocked(sorted[j])
+	})
+	return sorted
+}
+
+// ewmaLocked returns the moving average of a node (caller holds lock)
+func (t *LatencyTracker) ewmaLocked(nodeID string) float64 {
+	if nl, exists := t.nodes[nodeID]; exists {
+		return nl.ewma
+	}
+	return 0
+}
+
+// Stats returns a snapshot of the latency statistics for every node
+func (t *LatencyTracker) Stats() map[string]LatencyStats {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+
+	result := make(map[string]LatencyStats, len(t.nodes))
+	for nodeID, nl := range t.nodes {
+		result[nodeID] = LatencyStats{
+			EWMA:    time.Duration(nl.ewma),
+			P50:     percentile(nl.samples, 0.50),
+			P95:     percentile(nl.samples, 0.95),
+			P99:     percentile(nl.samples, 0.99),
+			Samples: nl.count,
+			Errors:  nl.errors,
+		}
+	}
+	return result
+}
+
+// percentile computes the p-th percentile of a set of samples
+func percentile(samples []time.Duration, p float64) time.Duration {
+	if len(samples) == 0 {
+		return 0
+	}
+
+	sorted := make([]time.Duration, len(samples))
+	copy(sorted, samples)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+
+	idx := int(p*float64(len(sorted))+0.5) - 1
+	if idx < 0 {
+		idx = 0
+	}
+	if idx >= len(sorted) {
+		idx = len(sorted) - 1
+	}
+	return sorted[idx]
+}
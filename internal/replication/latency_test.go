@@ -0,0 +1,141 @@
+package replication
+
+import (
+	"testing"
+	"time"
+
+	"github.com/mini-dynamo/mini-dynamo/internal/config"
+)
+
+func TestLatencyEWMA(t *testing.T) {
+	lt := NewLatencyTracker(0.5, 10, 200*time.Millisecond)
+
+	if d := lt.EWMA("node1"); d != 0 {
+		t.Errorf("Expected 0 for an unknown node, got %v", d)
+	}
+
+	// The first sample seeds the average, later ones move it by alpha
+	lt.Record("node1", 100*time.Millisecond)
+	if d := lt.EWMA("node1"); d != 100*time.Millisecond {
+		t.Errorf("Expected 100ms after the first sample, got %v", d)
+	}
+	lt.Record("node1", 200*time.Millisecond)
+	if d := lt.EWMA("node1"); d != 150*time.Millisecond {
+		t.Errorf("Expected 150ms, got %v", d)
+	}
+
+	// Errors push the average up, but never down
+	lt.RecordError("node1", 250*time.Millisecond)
+	if d := lt.EWMA("node1"); d != 325*time.Millisecond {
+		t.Errorf("Expected an error to raise the average to 325ms, got %v", d)
+	}
+	lt.RecordError("node1", time.Millisecond)
+	if d := lt.EWMA("node1"); d != 325*time.Millisecond {
+		t.Errorf("Expected a fast error to leave the average alone, got %v", d)
+	}
+	if stats := lt.Stats()["node1"]; stats.Samples != 2 || stats.Errors != 2 {
+		t.Errorf("Expected 2 samples and 2 errors, got %+v", stats)
+	}
+}
+
+func TestSortByLatency(t *testing.T) {
+	lt := NewLatencyTracker(0.2, 10, time.Second)
+	lt.Record("slow", 300*time.Millisecond)
+	lt.Record("fast", 10*time.Millisecond)
+	lt.Record("medium", 50*time.Millisecond)
+
+	nodes := []string{"slow", "new1", "medium", "fast", "new2"}
+	sorted := lt.SortByLatency(nodes)
+
+	// Unmeasured nodes come first, in their original order
+	want := []string{"new1", "new2", "fast", "medium", "slow"}
+	for i := range want {
+		if sorted[i] != want[i] {
+			t.Fatalf("Expected %v, got %v", want, sorted)
+		}
+	}
+	if nodes[0] != "slow" {
+		t.Errorf("SortByLatency must not reorder its input, got %v", nodes)
+	}
+}
+
+func TestFastFailureSortsLast(t *testing.T) {
+	lt := NewLatencyTracker(0.2, 10, time.Second)
+	lt.Record("healthy1", 20*time.Millisecond)
+	lt.Record("healthy2", 50*time.Millisecond)
+	lt.Record("down", 100*time.Microsecond)
+
+	// Connection refused comes back far faster than a healthy reply
+	lt.RecordError("down", 50*time.Microsecond)
+
+	sorted := lt.SortByLatency([]string{"down", "healthy1", "healthy2"})
+	if sorted[2] != "down" {
+		t.Errorf("Expected the failed node to sort last, got %v", sorted)
+	}
+}
+
+func TestPercentile(t *testing.T) {
+	lt := NewLatencyTracker(0.2, 100, time.Second)
+
+	for i := 1; i < minPercentileSamples; i++ {
+		lt.Record("node1", time.Duration(i)*time.Millisecond)
+	}
+	if _, ok := lt.Percentile("node1", 0.5); ok {
+		t.Error("Expected no percentile before enough samples")
+	}
+	if _, ok := lt.Percentile("unknown", 0.5); ok {
+		t.Error("Expected no percentile for an unknown node")
+	}
+
+	for i := minPercentileSamples; i <= 100; i++ {
+		lt.Record("node1", time.Duration(i)*time.Millisecond)
+	}
+	tests := []struct {
+		p    float64
+		want time.Duration
+	}{
+		{0, time.Millisecond},
+		{0.5, 50 * time.Millisecond},
+		{0.95, 95 * time.Millisecond},
+		{0.99, 99 * time.Millisecond},
+		{1, 100 * time.Millisecond},
+	}
+	for _, tt := range tests {
+		if got, ok := lt.Percentile("node1", tt.p); !ok || got != tt.want {
+			t.Errorf("p%v: expected %v, got %v (%v)", tt.p*100, tt.want, got, ok)
+		}
+	}
+
+	// The window keeps only the latest samples
+	for i := 0; i < 100; i++ {
+		lt.Record("node1", time.Second)
+	}
+	if got, _ := lt.Percentile("node1", 0); got != time.Second {
+		t.Errorf("Expected old samples to leave the window, got a minimum of %v", got)
+	}
+}
+
+func TestHedgeDelay(t *testing.T) {
+	cfg := config.DefaultConfig()
+	cfg.HedgePercentile = 0.95
+	cfg.HedgeMinDelay = 5 * time.Millisecond
+	c := &Coordinator{config: cfg, latency: NewLatencyTracker(cfg.LatencyAlpha, 128, cfg.RequestTimeout)}
+
+	// Until there are enough samples the minimum delay applies
+	if d := c.hedgeDelay([]string{"node2"}); d != 5*time.Millisecond {
+		t.Errorf("Expected the 5ms minimum without samples, got %v", d)
+	}
+
+	for i := 0; i < minPercentileSamples; i++ {
+		c.latency.Record("node2", 20*time.Millisecond)
+		c.latency.Record("node3", 50*time.Millisecond)
+	}
+
+	// The slowest replica contacted sets the delay
+	if d := c.hedgeDelay([]string{"node2"}); d != 20*time.Millisecond {
+		t.Errorf("Expected node2's p95 of 20ms, got %v", d)
+	}
+	if d := c.hedgeDelay([]string{"node2", "node3"}); d != 50*time.Millisecond {
+		t.Errorf("Expected node3's p95 of 50ms, got %v", d)
+	}
+}
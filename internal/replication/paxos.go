@@ -0,0 +1,455 @@
+package replication
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"math/rand"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/mini-dynamo/mini-dynamo/internal/storage"
+	"github.com/mini-dynamo/mini-dynamo/pkg/types"
+)
+
+// Errors returned by compare-and-set writes
+var (
+	ErrConditionFailed = errors.New("condition not met")
+	ErrCASContention   = errors.New("compare-and-set did not complete due to contention")
+)
+
+// paxosKeyPrefix is where replicas persist per-key Paxos acceptor state
+const paxosKeyPrefix = storage.SystemKeyPrefix + "paxos/"
+
+// maxCASAttempts bounds the Paxos rounds a single compare-and-set may run
+const maxCASAttempts = 10
+
+// Paxos phases, also the last element of their internal endpoint paths
+const (
+	paxosPrepare = "prepare"
+	paxosPropose = "propose"
+	paxosCommit  = "commit"
+)
+
+// paxosState is the acceptor state of a single key
+type paxosState struct {
+	Promised      types.Ballot         `json:"promised"`
+	Accepted      types.Ballot         `json:"accepted"`
+	AcceptedEntry *types.KeyValueEntry `json:"accepted_entry,omitempty"`
+	Committed     types.Ballot         `json:"committed"`
+}
+
+// paxosReply is the outcome of a Paxos request to a single replica
+type paxosReply struct {
+	NodeID   string
+	Response types.PaxosResponse
+	Err      error
+}
+
+// CompareAndSet writes a value only if the key's current value meets the
+// condition. The condition is evaluated and the value written in a single
+// Paxos round among a majority of the key's preference list, so
+// compare-and-set writes on a key are linearizable. When the condition
+// fails, the result holds the current value and ErrConditionFailed is
+// returned. ErrCASContention means the write may or may not have been
+// applied: a proposal accepted by only some replicas can still be
+// committed by a later round.
+func (c *Coordinator) CompareAndSet(ctx context.Context, key string, value []byte, cond types.CASCondition, opts types.ConsistencyOptions) (*types.CASResult, error) {
+	n, err := c.getReplicaCount(opts)
+	if err != nil {
+		return nil, err
+	}
+
+	// Joining nodes take no part in consensus but receive committed values
+	nodes, pending, err := c.writeReplicas(key, n)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get preference list: %w", err)
+	}
+	quorum := len(nodes)/2 + 1
+
+	// Versions we proposed in attempts that failed, and whether any of them
+	// was accepted somewhere, so it may yet be committed
+	proposed := make(map[int64]bool)
+	uncertain := false
+
+	for attempt := 0; attempt < maxCASAttempts; attempt++ {
+		if attempt > 0 {
+			if err := paxosBackoff(ctx, attempt); err != nil {
+				return nil, err
+			}
+		}
+
+		ballot := types.Ballot{Timestamp: c.clock.Now(), NodeID: c.config.NodeID}
+
+		// Phase 1: prepare
+		prepared := c.paxosQuorum(ctx, nodes, paxosPrepare, types.PaxosRequest{Key: key, Ballot: ballot}, quorum)
+		if !prepared.Reached {
+			// A transaction holds the key; retrying will not help until it
+			// is decided
+			if prepared.Locked && !uncertain {
+				return nil, fmt.Errorf("%w: key %s is locked by a transaction", ErrTxnConflict, key)
+			}
+			continue
+		}
+		promises := prepared.OK
+
+		// Finish any proposal a failed proposer left accepted but uncommitted
+		if inProgress := unfinishedProposal(promises); inProgress != nil {
+			c.finishProposal(ctx, nodes, ballot, *inProgress, quorum)
+			continue
+		}
+
+		current := latestCurrent(promises)
+
+		// An earlier attempt that reached only some acceptors may have been
+		// committed since, by us or by a proposer finishing it
+		if current != nil && proposed[current.Timestamp] && bytes.Equal(current.Value, value) {
+			return c.casApplied(ctx, pending, *current), nil
+		}
+
+		if !cond.Holds(current) {
+			// Our write may have been committed and already overwritten
+			if uncertain {
+				return nil, ErrCASContention
+			}
+			return &types.CASResult{Applied: false, Current: current}, ErrConditionFailed
+		}
+
+		// The new version must supersede the current one. A current version
+		// beyond the skew bound cannot be superseded, however often we retry.
+		if current != nil && ballot.Timestamp <= current.Timestamp {
+			if err := c.clock.Update(current.Timestamp); err != nil {
+				return nil, fmt.Errorf("current version of key %s: %w", key, err)
+			}
+			continue
+		}
+
+		entry := types.KeyValueEntry{Key: key, Value: value, Timestamp: ballot.Timestamp}
+
+		// Phase 2: propose
+		// Replicas that did not reject it, including those yet to answer,
+		// may have accepted the proposal
+		if proposal := c.paxosQuorum(ctx, nodes, paxosPropose, types.PaxosRequest{Key: key, Ballot: ballot, Entry: &entry}, quorum); !proposal.Reached {
+			proposed[entry.Timestamp] = true
+			uncertain = uncertain || proposal.Rejected < len(nodes)
+			continue
+		}
+
+		// Phase 3: commit. A quorum accepted the value, so it is chosen and
+		// the next round on the key completes it even if this commit falls
+		// short; the outcome is only unknown to the caller.
+		if !c.paxosQuorum(ctx, nodes, paxosCommit, types.PaxosRequest{Key: key, Ballot: ballot, Entry: &entry}, quorum).Reached {
+			return nil, fmt.Errorf("%w: commit of key %s not acknowledged by a quorum", ErrCASContention, key)
+		}
+		return c.casApplied(ctx, pending, entry), nil
+	}
+
+	return nil, ErrCASContention
+}
+
+// casApplied sends a committed compare-and-set value to joining replicas
+// and reports it applied
+func (c *Coordinator) casApplied(ctx context.Context, pending []string, entry types.KeyValueEntry) *types.CASResult {
+	if len(pending) > 0 {
+		c.replicateToNodes(ctx, pending, entry, quorumRequirement{Total: len(pending)})
+	}
+	return &types.CASResult{Applied: true, Timestamp: entry.Timestamp}
+}
+
+// finishProposal re-proposes and commits an accepted proposal under a
+// newer ballot
+func (c *Coordinator) finishProposal(ctx context.Context, nodes []string, ballot types.Ballot, entry types.KeyValueEntry, quorum int) {
+	log.Printf("Completing unfinished Paxos proposal for key %s", entry.Key)
+
+	req := types.PaxosRequest{Key: entry.Key, Ballot: ballot, Entry: &entry}
+	if c.paxosQuorum(ctx, nodes, paxosPropose, req, quorum).Reached {
+		c.paxosQuorum(ctx, nodes, paxosCommit, req, quorum)
+	}
+}
+
+// paxosOutcome is what a Paxos phase learned from the replicas it heard
+type paxosOutcome struct {
+	OK       []types.PaxosResponse // Successful responses
+	Rejected int                   // Replicas that explicitly refused
+	Locked   bool                  // A refusal was due to a transaction lock
+	Reached  bool                  // A quorum replied OK
+}
+
+// paxosQuorum sends a Paxos request to every node and returns as soon as
+// the outcome is known; later replies drain into the buffered channel.
+func (c *Coordinator) paxosQuorum(ctx context.Context, nodes []string, phase string, req types.PaxosRequest, quorum int) paxosOutcome {
+	req.FromNode = c.config.NodeID
+
+	// Replicas still outstanding when the outcome is known get to finish
+	bgCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), c.config.RequestTimeout)
+	replies := make(chan paxosReply, len(nodes))
+	var wg sync.WaitGroup
+	for _, nodeID := range nodes {
+		wg.Add(1)
+		go func(nodeID string) {
+			defer wg.Done()
+			resp, err := c.sendPaxos(bgCtx, nodeID, phase, req)
+			replies <- paxosReply{NodeID: nodeID, Response: resp, Err: err}
+		}(nodeID)
+	}
+	go func() {
+		wg.Wait()
+		cancel()
+	}()
+
+	outcome := paxosOutcome{OK: make([]types.PaxosResponse, 0, len(nodes))}
+	failed := 0
+	for range nodes {
+		var reply paxosReply
+		select {
+		case reply = <-replies:
+		case <-ctx.Done():
+			return outcome
+		}
+		switch {
+		case reply.Err != nil:
+			failed++
+		case reply.Response.OK:
+			outcome.OK = append(outcome.OK, reply.Response)
+		default:
+			outcome.Rejected++
+			outcome.Locked = outcome.Locked || reply.Response.Locked
+			// Learn about the competing ballot so the next attempt outbids it
+			c.clock.Update(reply.Response.Promised.Timestamp)
+		}
+
+		if len(outcome.OK) >= quorum {
+			outcome.Reached = true
+			return outcome
+		}
+		if outcome.Rejected+failed > len(nodes)-quorum {
+			return outcome
+		}
+	}
+
+	return outcome
+}
+
+// sendPaxos delivers a Paxos request to a replica, handling local requests
+// directly
+func (c *Coordinator) sendPaxos(ctx context.Context, nodeID string, phase string, req types.PaxosRequest) (types.PaxosResponse, error) {
+	if nodeID == c.config.NodeID {
+		return c.HandlePaxos(phase, req)
+	}
+
+	c.nodesMu.RLock()
+	node, exists := c.nodes[nodeID]
+	c.nodesMu.RUnlock()
+
+	if !exists {
+		return types.PaxosResponse{}, fmt.Errorf("node %s not found", nodeID)
+	}
+
+	if err := c.simulateInterDCLatency(ctx, nodeID); err != nil {
+		return types.PaxosResponse{}, err
+	}
+
+	url := fmt.Sprintf("http://%s:%d/internal/paxos/%s", node.Address, node.Port, phase)
+	body, _ := json.Marshal(req)
+
+	httpReq, err := http.NewRequestWithContext(ctx, "POST", url, bytes.NewReader(body))
+	if err != nil {
+		return types.PaxosResponse{}, err
+	}
+	httpReq.Header.Set("Content-Type", "application/json")
+
+	resp, err := c.httpClient.Do(httpReq)
+	if err != nil {
+		return types.PaxosResponse{}, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return types.PaxosResponse{}, fmt.Errorf("node %s returned status %d", nodeID, resp.StatusCode)
+	}
+
+	var paxosResp types.PaxosResponse
+	if err := json.NewDecoder(resp.Body).Decode(&paxosResp); err != nil {
+		return types.PaxosResponse{}, err
+	}
+	return paxosResp, nil
+}
+
+// HandlePaxos runs the acceptor side of a Paxos phase on this replica
+func (c *Coordinator) HandlePaxos(phase string, req types.PaxosRequest) (types.PaxosResponse, error) {
+	c.clock.Update(req.Ballot.Timestamp)
+
+	c.paxosMu.Lock()
+	defer c.paxosMu.Unlock()
+
+	state, err := c.loadPaxosState(req.Key)
+	if err != nil {
+		return types.PaxosResponse{}, err
+	}
+
+	switch phase {
+	case paxosPrepare:
+		// A transaction holding the key must be decided before its value
+		// can change
+		if _, locked := c.txnLock(req.Key); locked {
+			resp := state.response(false)
+			resp.Locked = true
+			return resp, nil
+		}
+		if state.Promised.Less(req.Ballot) {
+			state.Promised = req.Ballot
+			if err := c.savePaxosState(req.Key, state); err != nil {
+				return types.PaxosResponse{}, err
+			}
+			resp := state.response(true)
+			resp.Current = c.localEntry(req.Key)
+			return resp, nil
+		}
+		return state.response(false), nil
+
+	case paxosPropose:
+		if req.Entry == nil {
+			return types.PaxosResponse{}, fmt.Errorf("propose requires an entry")
+		}
+		if req.Ballot.Less(state.Promised) {
+			return state.response(false), nil
+		}
+		state.Promised = req.Ballot
+		state.Accepted = req.Ballot
+		state.AcceptedEntry = req.Entry
+		if err := c.savePaxosState(req.Key, state); err != nil {
+			return types.PaxosResponse{}, err
+		}
+		return state.response(true), nil
+
+	case paxosCommit:
+		if req.Entry == nil {
+			return types.PaxosResponse{}, fmt.Errorf("commit requires an entry")
+		}
+		err := c.ApplyClientWrite([]types.KeyValueEntry{*req.Entry})
+		if errors.Is(err, ErrTxnConflict) {
+			resp := state.response(false)
+			resp.Locked = true
+			return resp, nil
+		}
+		if err != nil {
+			return types.PaxosResponse{}, err
+		}
+		if state.Committed.Less(req.Ballot) {
+			state.Committed = req.Ballot
+		}
+		if !req.Ballot.Less(state.Accepted) {
+			state.Accepted = types.Ballot{}
+			state.AcceptedEntry = nil
+		}
+		if err := c.savePaxosState(req.Key, state); err != nil {
+			return types.PaxosResponse{}, err
+		}
+		return state.response(true), nil
+	}
+
+	return types.PaxosResponse{}, fmt.Errorf("unknown paxos phase %q", phase)
+}
+
+// response builds a Paxos response from the acceptor state
+func (s paxosState) response(ok bool) types.PaxosResponse {
+	return types.PaxosResponse{
+		OK:            ok,
+		Promised:      s.Promised,
+		Accepted:      s.Accepted,
+		AcceptedEntry: s.AcceptedEntry,
+		Committed:     s.Committed,
+	}
+}
+
+// loadPaxosState reads the acceptor state of a key (caller holds paxosMu)
+func (c *Coordinator) loadPaxosState(key string) (paxosState, error) {
+	var state paxosState
+
+	data, _, err := c.storage.Get(paxosKeyPrefix + key)
+	if err == storage.ErrKeyNotFound || err == storage.ErrKeyDeleted {
+		return state, nil
+	}
+	if err != nil {
+		return state, err
+	}
+
+	if err := json.Unmarshal(data, &state); err != nil {
+		return state, fmt.Errorf("corrupt paxos state for key %s: %w", key, err)
+	}
+	return state, nil
+}
+
+// savePaxosState persists the acceptor state of a key (caller holds paxosMu)
+func (c *Coordinator) savePaxosState(key string, state paxosState) error {
+	data, err := json.Marshal(state)
+	if err != nil {
+		return err
+	}
+	return c.storage.Put(paxosKeyPrefix+key, data, c.clock.Now())
+}
+
+// localEntry returns the local version of a key, including tombstones,
+// or nil if the key was never written
+func (c *Coordinator) localEntry(key string) *types.KeyValueEntry {
+	timestamp, exists := c.storage.Timestamp(key)
+	if !exists {
+		return nil
+	}
+
+	value, _, err := c.storage.Get(key)
+	if err != nil {
+		return &types.KeyValueEntry{Key: key, Timestamp: timestamp, IsDeleted: true}
+	}
+	return &types.KeyValueEntry{Key: key, Value: value, Timestamp: timestamp}
+}
+
+// unfinishedProposal returns the newest accepted proposal that is more
+// recent than every commit seen in the promises, if any
+func unfinishedProposal(promises []types.PaxosResponse) *types.KeyValueEntry {
+	var committed, accepted types.Ballot
+	var entry *types.KeyValueEntry
+
+	for _, p := range promises {
+		if committed.Less(p.Committed) {
+			committed = p.Committed
+		}
+		if p.AcceptedEntry != nil && accepted.Less(p.Accepted) {
+			accepted = p.Accepted
+			entry = p.AcceptedEntry
+		}
+	}
+
+	if entry == nil || !committed.Less(accepted) {
+		return nil
+	}
+	return entry
+}
+
+// latestCurrent returns the newest current value among the promises
+func latestCurrent(promises []types.PaxosResponse) *types.KeyValueEntry {
+	var latest *types.KeyValueEntry
+	for _, p := range promises {
+		if p.Current != nil && (latest == nil || p.Current.Timestamp > latest.Timestamp) {
+			latest = p.Current
+		}
+	}
+	return latest
+}
+
+// paxosBackoff waits a random, growing delay before retrying a contended
+// Paxos round
+func paxosBackoff(ctx context.Context, attempt int) error {
+	delay := time.Duration(rand.Int63n(int64(attempt) * int64(10*time.Millisecond)))
+
+	select {
+	case <-time.After(delay):
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
@@ -0,0 +1,375 @@
+package replication
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/mini-dynamo/mini-dynamo/internal/config"
+	"github.com/mini-dynamo/mini-dynamo/internal/ring"
+	"github.com/mini-dynamo/mini-dynamo/internal/storage"
+	"github.com/mini-dynamo/mini-dynamo/internal/versioning"
+	"github.com/mini-dynamo/mini-dynamo/pkg/types"
+)
+
+func TestCompareAndSetCreateIfAbsent(t *testing.T) {
+	coord, store := newTestCoordinator(t)
+	ctx := context.Background()
+	ifAbsent := types.CASCondition{IfNoneMatch: true}
+
+	result, err := coord.CompareAndSet(ctx, "k", []byte("first"), ifAbsent, types.ConsistencyOptions{})
+	if err != nil || !result.Applied {
+		t.Fatalf("Create-if-absent on a new key failed: %+v (%v)", result, err)
+	}
+
+	result, err = coord.CompareAndSet(ctx, "k", []byte("second"), ifAbsent, types.ConsistencyOptions{})
+	if !errors.Is(err, ErrConditionFailed) {
+		t.Fatalf("Expected ErrConditionFailed, got %v", err)
+	}
+	if result.Applied || result.Current == nil || string(result.Current.Value) != "first" {
+		t.Errorf("Expected the current value 'first' on conflict, got %+v", result)
+	}
+
+	value, _, _ := store.Get("k")
+	if string(value) != "first" {
+		t.Errorf("Failed condition must not write, got '%s'", value)
+	}
+}
+
+func TestCompareAndSetIfVersion(t *testing.T) {
+	coord, _ := newTestCoordinator(t)
+	ctx := context.Background()
+
+	put, err := coord.Put(ctx, "k", []byte("v1"), types.ConsistencyOptions{})
+	if err != nil {
+		t.Fatalf("Put failed: %v", err)
+	}
+
+	stale := types.CASCondition{IfVersion: put.Timestamp - 1}
+	if _, err := coord.CompareAndSet(ctx, "k", []byte("v2"), stale, types.ConsistencyOptions{}); !errors.Is(err, ErrConditionFailed) {
+		t.Errorf("Expected a stale version to fail, got %v", err)
+	}
+
+	current := types.CASCondition{IfVersion: put.Timestamp}
+	result, err := coord.CompareAndSet(ctx, "k", []byte("v2"), current, types.ConsistencyOptions{})
+	if err != nil || !result.Applied {
+		t.Fatalf("Expected matching version to apply: %+v (%v)", result, err)
+	}
+	if result.Timestamp <= put.Timestamp {
+		t.Errorf("CAS version %d should supersede %d", result.Timestamp, put.Timestamp)
+	}
+
+	// The old version no longer matches
+	if _, err := coord.CompareAndSet(ctx, "k", []byte("v3"), current, types.ConsistencyOptions{}); !errors.Is(err, ErrConditionFailed) {
+		t.Errorf("Expected the replaced version to fail, got %v", err)
+	}
+}
+
+func TestCompareAndSetRejectsSkewedVersion(t *testing.T) {
+	coord, store := newTestCoordinator(t)
+	coord.config.MaxClockSkew = time.Second
+
+	// A version written by a node whose clock is an hour ahead
+	future := time.Now().Add(time.Hour).UnixNano()
+	store.Put("k", []byte("v1"), future)
+
+	start := time.Now()
+	_, err := coord.CompareAndSet(context.Background(), "k", []byte("v2"), types.CASCondition{IfVersion: future}, types.ConsistencyOptions{})
+	if !errors.Is(err, versioning.ErrClockSkew) {
+		t.Fatalf("Expected ErrClockSkew, got %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > 100*time.Millisecond {
+		t.Errorf("Expected no retries, took %v", elapsed)
+	}
+	if value, _, _ := store.Get("k"); string(value) != "v1" {
+		t.Errorf("Expected v1 to stay, got '%s'", value)
+	}
+}
+
+func TestPaxosAcceptorPromises(t *testing.T) {
+	coord, _ := newTestCoordinator(t)
+	high := types.Ballot{Timestamp: 200, NodeID: "node2"}
+	low := types.Ballot{Timestamp: 100, NodeID: "node3"}
+
+	resp, err := coord.HandlePaxos(paxosPrepare, types.PaxosRequest{Key: "k", Ballot: high})
+	if err != nil || !resp.OK {
+		t.Fatalf("First prepare should be promised: %+v (%v)", resp, err)
+	}
+
+	resp, _ = coord.HandlePaxos(paxosPrepare, types.PaxosRequest{Key: "k", Ballot: low})
+	if resp.OK || resp.Promised != high {
+		t.Errorf("Lower ballot should be rejected with the promised ballot, got %+v", resp)
+	}
+
+	entry := types.KeyValueEntry{Key: "k", Value: []byte("v"), Timestamp: 100}
+	resp, _ = coord.HandlePaxos(paxosPropose, types.PaxosRequest{Key: "k", Ballot: low, Entry: &entry})
+	if resp.OK {
+		t.Error("Proposal below the promised ballot should be rejected")
+	}
+}
+
+func TestCompareAndSetFinishesInterruptedProposal(t *testing.T) {
+	coord, store := newTestCoordinator(t)
+	ctx := context.Background()
+
+	// A proposer crashed after its value was accepted but before commit
+	ballot := types.Ballot{Timestamp: coord.Clock().Now(), NodeID: "node2"}
+	entry := types.KeyValueEntry{Key: "k", Value: []byte("accepted"), Timestamp: ballot.Timestamp}
+	coord.HandlePaxos(paxosPrepare, types.PaxosRequest{Key: "k", Ballot: ballot})
+	coord.HandlePaxos(paxosPropose, types.PaxosRequest{Key: "k", Ballot: ballot, Entry: &entry})
+
+	if store.Has("k") {
+		t.Fatal("Accepted proposal should not be visible before commit")
+	}
+
+	_, err := coord.CompareAndSet(ctx, "k", []byte("mine"), types.CASCondition{IfNoneMatch: true}, types.ConsistencyOptions{})
+	if !errors.Is(err, ErrConditionFailed) {
+		t.Errorf("Expected the interrupted proposal to win, got %v", err)
+	}
+
+	value, _, _ := store.Get("k")
+	if string(value) != "accepted" {
+		t.Errorf("Expected the accepted value to be committed, got '%s'", value)
+	}
+}
+
+// paxosReplica is a coordinator serving the internal Paxos API, which can
+// be taken down or slowed to simulate a failed or partitioned acceptor
+type paxosReplica struct {
+	coord      *Coordinator
+	store      *storage.Bitcask
+	down       atomic.Bool
+	dropCommit atomic.Bool  // Refuse commits while still taking part in earlier phases
+	delay      atomic.Int64 // Nanoseconds to wait before answering
+}
+
+// newPaxosCluster starts n replicas of every key, each knowing the others
+func newPaxosCluster(t *testing.T, n int) []*paxosReplica {
+	replicas := make([]*paxosReplica, n)
+	nodes := make([]*types.Node, n)
+	for i := range replicas {
+		store, err := storage.NewBitcask(t.TempDir(), false)
+		if err != nil {
+			t.Fatalf("Failed to create storage: %v", err)
+		}
+		t.Cleanup(func() { store.Close() })
+
+		cfg := config.DefaultConfig()
+		cfg.NodeID = fmt.Sprintf("node%d", i+1)
+		cfg.ReplicationFactor = n
+		pr := &paxosReplica{coord: NewCoordinator(cfg, ring.NewHashRing(10), store), store: store}
+		replicas[i] = pr
+
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			phase := strings.TrimPrefix(r.URL.Path, "/internal/paxos/")
+			if pr.down.Load() || (pr.dropCommit.Load() && phase == paxosCommit) {
+				w.WriteHeader(http.StatusServiceUnavailable)
+				return
+			}
+			time.Sleep(time.Duration(pr.delay.Load()))
+			var req types.PaxosRequest
+			if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+			resp, err := pr.coord.HandlePaxos(phase, req)
+			if err != nil {
+				w.WriteHeader(http.StatusInternalServerError)
+				return
+			}
+			json.NewEncoder(w).Encode(resp)
+		}))
+		t.Cleanup(server.Close)
+
+		fake := &fakeReplica{server: server}
+		nodes[i] = fake.node(t, cfg.NodeID, "")
+	}
+
+	for _, pr := range replicas {
+		for _, node := range nodes {
+			copied := *node
+			registerPlaced(pr.coord, &copied)
+		}
+	}
+	return replicas
+}
+
+// committedValue returns the newest value of a key held by a majority
+func committedValue(t *testing.T, replicas []*paxosReplica, key string) string {
+	counts := make(map[int64]int)
+	values := make(map[int64]string)
+	for _, pr := range replicas {
+		value, ts, err := pr.store.Get(key)
+		if err == nil {
+			counts[ts]++
+			values[ts] = string(value)
+		}
+	}
+	var newest int64
+	for ts, count := range counts {
+		if count > len(replicas)/2 && ts > newest {
+			newest = ts
+		}
+	}
+	if newest == 0 {
+		t.Fatalf("No value of %s is held by a majority: %v", key, values)
+	}
+	return values[newest]
+}
+
+func TestCompareAndSetCompetingProposers(t *testing.T) {
+	replicas := newPaxosCluster(t, 3)
+	ctx := context.Background()
+
+	created, err := replicas[0].coord.CompareAndSet(ctx, "log", []byte("start"), types.CASCondition{IfNoneMatch: true}, types.ConsistencyOptions{})
+	if err != nil {
+		t.Fatalf("Create failed: %v", err)
+	}
+
+	// Every replica appends to the log at once, each from the version it
+	// last saw. Writes reported applied must appear exactly once, rejected
+	// ones never, and those with an unknown outcome at most once.
+	const appends = 5
+	var mu sync.Mutex
+	outcomes := make(map[string]error)
+	var wg sync.WaitGroup
+	for i, pr := range replicas {
+		wg.Add(1)
+		go func(coord *Coordinator, writer int) {
+			defer wg.Done()
+			version, log := created.Timestamp, "start"
+			for attempt, done := 0, 0; done < appends; attempt++ {
+				tag := fmt.Sprintf("%d-%d", writer, attempt)
+				next := log + " " + tag
+				result, err := coord.CompareAndSet(ctx, "log", []byte(next), types.CASCondition{IfVersion: version}, types.ConsistencyOptions{})
+				mu.Lock()
+				outcomes[tag] = err
+				mu.Unlock()
+				switch {
+				case err == nil:
+					version, log = result.Timestamp, next
+					done++
+				case errors.Is(err, ErrConditionFailed):
+					version, log = result.Current.Timestamp, string(result.Current.Value)
+				case errors.Is(err, ErrCASContention):
+				default:
+					t.Errorf("CAS failed: %v", err)
+					return
+				}
+			}
+		}(pr.coord, i)
+	}
+	wg.Wait()
+
+	counts := make(map[string]int)
+	for _, tag := range strings.Fields(committedValue(t, replicas, "log"))[1:] {
+		counts[tag]++
+	}
+	applied := 0
+	for tag, err := range outcomes {
+		switch {
+		case err == nil:
+			applied++
+			if counts[tag] != 1 {
+				t.Errorf("Applied write %s appears %d times", tag, counts[tag])
+			}
+		case errors.Is(err, ErrConditionFailed) && counts[tag] != 0:
+			t.Errorf("Rejected write %s was applied", tag)
+		case counts[tag] > 1:
+			t.Errorf("Write %s was applied %d times", tag, counts[tag])
+		}
+	}
+	if applied != appends*len(replicas) {
+		t.Errorf("Expected %d applied writes, got %d", appends*len(replicas), applied)
+	}
+}
+
+func TestCompareAndSetWithFailedAcceptor(t *testing.T) {
+	replicas := newPaxosCluster(t, 3)
+	ctx := context.Background()
+	ifAbsent := types.CASCondition{IfNoneMatch: true}
+
+	// A majority is enough
+	replicas[2].down.Store(true)
+	first, err := replicas[0].coord.CompareAndSet(ctx, "k", []byte("v1"), ifAbsent, types.ConsistencyOptions{})
+	if err != nil {
+		t.Fatalf("CAS with one acceptor down failed: %v", err)
+	}
+	if replicas[2].store.Has("k") {
+		t.Fatal("The failed acceptor should have missed the write")
+	}
+
+	// The stale acceptor returns while another fails: the remaining majority
+	// still holds v1, so the old condition fails and the new one applies
+	replicas[2].down.Store(false)
+	replicas[0].down.Store(true)
+	if _, err := replicas[1].coord.CompareAndSet(ctx, "k", []byte("v2"), ifAbsent, types.ConsistencyOptions{}); !errors.Is(err, ErrConditionFailed) {
+		t.Errorf("Expected create-if-absent to fail against the majority, got %v", err)
+	}
+	if _, err := replicas[2].coord.CompareAndSet(ctx, "k", []byte("v2"), types.CASCondition{IfVersion: first.Timestamp}, types.ConsistencyOptions{}); err != nil {
+		t.Fatalf("CAS on the current version failed: %v", err)
+	}
+	replicas[0].down.Store(false)
+	if got := committedValue(t, replicas, "k"); got != "v2" {
+		t.Errorf("Expected v2 on a majority, got %s", got)
+	}
+
+	// Without a majority nothing is written
+	replicas[1].down.Store(true)
+	replicas[2].down.Store(true)
+	if _, err := replicas[0].coord.CompareAndSet(ctx, "k", []byte("v3"), types.CASCondition{}, types.ConsistencyOptions{}); err == nil {
+		t.Error("Expected CAS without a majority to fail")
+	}
+	if value, _, _ := replicas[0].store.Get("k"); string(value) == "v3" {
+		t.Error("A CAS without a majority must not commit")
+	}
+}
+
+func TestCompareAndSetWithSlowAcceptor(t *testing.T) {
+	replicas := newPaxosCluster(t, 3)
+	replicas[2].delay.Store(int64(time.Second))
+
+	// Each phase returns once the other two replicas answer
+	start := time.Now()
+	if _, err := replicas[0].coord.CompareAndSet(context.Background(), "k", []byte("v1"), types.CASCondition{IfNoneMatch: true}, types.ConsistencyOptions{}); err != nil {
+		t.Fatalf("CAS with a slow acceptor failed: %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > 500*time.Millisecond {
+		t.Errorf("Expected the slow acceptor not to hold up the CAS, took %v", elapsed)
+	}
+	if got := committedValue(t, replicas[:2], "k"); got != "v1" {
+		t.Errorf("Expected v1 on a majority, got %s", got)
+	}
+}
+
+func TestCompareAndSetCommitWithoutQuorum(t *testing.T) {
+	replicas := newPaxosCluster(t, 3)
+	ctx := context.Background()
+
+	// A quorum accepts the proposal, but only the proposer commits it
+	replicas[1].dropCommit.Store(true)
+	replicas[2].dropCommit.Store(true)
+	_, err := replicas[0].coord.CompareAndSet(ctx, "k", []byte("v1"), types.CASCondition{IfNoneMatch: true}, types.ConsistencyOptions{})
+	if !errors.Is(err, ErrCASContention) {
+		t.Fatalf("Expected ErrCASContention for a commit short of quorum, got %v", err)
+	}
+
+	// The value was chosen: the next round completes it instead of
+	// creating the key anew
+	replicas[1].dropCommit.Store(false)
+	replicas[2].dropCommit.Store(false)
+	if _, err := replicas[1].coord.CompareAndSet(ctx, "k", []byte("v2"), types.CASCondition{IfNoneMatch: true}, types.ConsistencyOptions{}); !errors.Is(err, ErrConditionFailed) {
+		t.Errorf("Expected the chosen value to fail create-if-absent, got %v", err)
+	}
+	if got := committedValue(t, replicas, "k"); got != "v1" {
+		t.Errorf("Expected v1 on a majority, got %s", got)
+	}
+}
@@ -182,6 +182,9 @@ func (qm *QuorumManager) ExecuteRead(ctx context.Context, ops []ReadOperation, c
 
 // getWriteRequirement returns the number of successful writes needed
 func (qm *QuorumManager) getWriteRequirement(consistency types.ConsistencyLevel) int {
+	if n := consistency.ReplicaCount(); n > 0 {
+		return n
+	}
 	switch consistency {
 	case types.ConsistencyOne:
 		return 1
@@ -194,6 +197,9 @@ func (qm *QuorumManager) getWriteRequirement(consistency types.ConsistencyLevel)
 
 // getReadRequirement returns the number of successful reads needed
 func (qm *QuorumManager) getReadRequirement(consistency types.ConsistencyLevel) int {
+	if n := consistency.ReplicaCount(); n > 0 {
+		return n
+	}
 	switch consistency {
 	case types.ConsistencyOne:
 		return 1
@@ -0,0 +1,227 @@
+package replication
+
+import (
+	"bytes"
+	"context"
+	"log"
+	"math/rand"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/mini-dynamo/mini-dynamo/pkg/types"
+)
+
+// ReadRepairStats reports how much repair work reads actually required
+type ReadRepairStats struct {
+	Checks     uint64 `json:"checks"`     // Reads compared for divergence
+	Skipped    uint64 `json:"skipped"`    // Reads not checked due to the repair chance
+	Consistent uint64 `json:"consistent"` // Checked reads where all replicas agreed
+	Needed     uint64 `json:"needed"`     // Stale or missing replicas found
+	Repaired   uint64 `json:"repaired"`   // Repairs delivered successfully
+	Failed     uint64 `json:"failed"`     // Repairs that could not be delivered
+	Dropped    uint64 `json:"dropped"`    // Repairs dropped by the queue or rate limit
+}
+
+// repairTask is a single replica that needs the latest entry
+type repairTask struct {
+	nodeID string
+	entry  types.KeyValueEntry
+}
+
+// ReadRepairer repairs stale replicas found during reads using a bounded
+// pool of workers, so read-heavy keys don't turn into write storms
+type ReadRepairer struct {
+	coordinator *Coordinator
+	chance      float64 // Probability (0-1) that a read is checked
+	workers     int
+	queue       chan repairTask
+	limiter     *rateLimiter
+	stats       ReadRepairStats
+	randMu      sync.Mutex
+	rand        *rand.Rand
+	stopCh      chan struct{}
+	wg          sync.WaitGroup
+}
+
+// NewReadRepairer creates a read repairer. A ratePerSecond of 0 disables
+// rate limiting.
+func NewReadRepairer(coord *Coordinator, chance float64, workers, queueSize, ratePerSecond int) *ReadRepairer {
+	if workers < 1 {
+		workers = 1
+	}
+	if queueSize < 1 {
+		queueSize = 1
+	}
+	return &ReadRepairer{
+		coordinator: coord,
+		chance:      chance,
+		workers:     workers,
+		queue:       make(chan repairTask, queueSize),
+		limiter:     newRateLimiter(ratePerSecond),
+		rand:        rand.New(rand.NewSource(time.Now().UnixNano())),
+		stopCh:      make(chan struct{}),
+	}
+}
+
+// Start starts the repair workers
+func (rr *ReadRepairer) Start() {
+	for i := 0; i < rr.workers; i++ {
+		rr.wg.Add(1)
+		go rr.worker()
+	}
+}
+
+// Stop stops the repair workers, discarding queued repairs
+func (rr *ReadRepairer) Stop() {
+	close(rr.stopCh)
+	rr.wg.Wait()
+}
+
+// Check compares the replica responses of a read against the winning
+// entry and queues a repair for every replica that is stale or missing.
+// Replicas that could not be reached are left to hinted handoff.
+func (rr *ReadRepairer) Check(responses []replicaRead, latest types.KeyValueEntry) {
+	if !rr.sample() {
+		atomic.AddUint64(&rr.stats.Skipped, 1)
+		return
+	}
+	atomic.AddUint64(&rr.stats.Checks, 1)
+
+	stale := 0
+	for _, resp := range responses {
+		if resp.Err != nil || !isStale(resp.Entry, latest) {
+			continue
+		}
+
+		stale++
+		atomic.AddUint64(&rr.stats.Needed, 1)
+
+		if !rr.limiter.Allow() {
+			atomic.AddUint64(&rr.stats.Dropped, 1)
+			continue
+		}
+
+		select {
+		case rr.queue <- repairTask{nodeID: resp.NodeID, entry: latest}:
+		default:
+			atomic.AddUint64(&rr.stats.Dropped, 1)
+		}
+	}
+
+	if stale == 0 {
+		atomic.AddUint64(&rr.stats.Consistent, 1)
+	}
+}
+
+// Stats returns a snapshot of the repair counters
+func (rr *ReadRepairer) Stats() ReadRepairStats {
+	return ReadRepairStats{
+		Checks:     atomic.LoadUint64(&rr.stats.Checks),
+		Skipped:    atomic.LoadUint64(&rr.stats.Skipped),
+		Consistent: atomic.LoadUint64(&rr.stats.Consistent),
+		Needed:     atomic.LoadUint64(&rr.stats.Needed),
+		Repaired:   atomic.LoadUint64(&rr.stats.Repaired),
+		Failed:     atomic.LoadUint64(&rr.stats.Failed),
+		Dropped:    atomic.LoadUint64(&rr.stats.Dropped),
+	}
+}
+
+// sample decides whether a read should be checked for repair
+func (rr *ReadRepairer) sample() bool {
+	if rr.chance >= 1 {
+		return true
+	}
+	if rr.chance <= 0 {
+		return false
+	}
+
+	rr.randMu.Lock()
+	defer rr.randMu.Unlock()
+	return rr.rand.Float64() < rr.chance
+}
+
+// worker delivers queued repairs until stopped
+func (rr *ReadRepairer) worker() {
+	defer rr.wg.Done()
+
+	for {
+		select {
+		case <-rr.stopCh:
+			return
+		case task := <-rr.queue:
+			rr.repair(task)
+		}
+	}
+}
+
+// repair sends the latest entry to a single stale replica
+func (rr *ReadRepairer) repair(task repairTask) {
+	c := rr.coordinator
+
+	success := false
+	if task.nodeID == c.config.NodeID {
+		_, err := c.ApplyEntry(task.entry)
+		success = err == nil
+	} else {
+		ctx, cancel := context.WithTimeout(context.Background(), c.config.RequestTimeout)
+		success = c.sendReplication(ctx, task.nodeID, task.entry)
+		cancel()
+	}
+
+	if success {
+		atomic.AddUint64(&rr.stats.Repaired, 1)
+	} else {
+		atomic.AddUint64(&rr.stats.Failed, 1)
+		log.Printf("Read repair of key %s on %s failed", task.entry.Key, task.nodeID)
+	}
+}
+
+// isStale reports whether a replica's copy is older than the latest entry
+func isStale(entry *types.KeyValueEntry, latest types.KeyValueEntry) bool {
+	if entry == nil {
+		return true
+	}
+	if entry.Timestamp < latest.Timestamp {
+		return true
+	}
+	return entry.Timestamp == latest.Timestamp && !bytes.Equal(entry.Value, latest.Value)
+}
+
+// rateLimiter is a simple token bucket refilled once per second
+type rateLimiter struct {
+	mu       sync.Mutex
+	rate     int
+	tokens   int
+	lastFill time.Time
+}
+
+// newRateLimiter creates a limiter allowing rate events per second (0 = unlimited)
+func newRateLimiter(rate int) *rateLimiter {
+	return &rateLimiter{
+		rate:     rate,
+		tokens:   rate,
+		lastFill: time.Now(),
+	}
+}
+
+// Allow consumes a token if one is available
+func (l *rateLimiter) Allow() bool {
+	if l.rate <= 0 {
+		return true
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if now := time.Now(); now.Sub(l.lastFill) >= time.Second {
+		l.tokens = l.rate
+		l.lastFill = now
+	}
+
+	if l.tokens == 0 {
+		return false
+	}
+	l.tokens--
+	return true
+}
@@ -0,0 +1,119 @@
+package replication
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/mini-dynamo/mini-dynamo/internal/config"
+	"github.com/mini-dynamo/mini-dynamo/internal/ring"
+	"github.com/mini-dynamo/mini-dynamo/internal/storage"
+	"github.com/mini-dynamo/mini-dynamo/pkg/types"
+)
+
+func newTestCoordinator(t *testing.T) (*Coordinator, *storage.Bitcask) {
+	store, err := storage.NewBitcask(t.TempDir(), false)
+	if err != nil {
+		t.Fatalf("Failed to create storage: %v", err)
+	}
+	t.Cleanup(func() { store.Close() })
+
+	cfg := config.DefaultConfig()
+	cfg.NodeID = "node1"
+	cfg.ReplicationFactor = 1
+	cfg.ReadQuorum = 1
+	cfg.WriteQuorum = 1
+
+	coord := NewCoordinator(cfg, ring.NewHashRing(10), store)
+	coord.RegisterNode(&types.Node{ID: "node1", State: types.NodeAlive})
+	return coord, store
+}
+
+func TestReadRepairOnlyStaleReplicas(t *testing.T) {
+	coord, _ := newTestCoordinator(t)
+	rr := NewReadRepairer(coord, 1.0, 1, 10, 0)
+
+	latest := types.KeyValueEntry{Key: "k", Value: []byte("new"), Timestamp: 200}
+	rr.Check([]replicaRead{
+		{NodeID: "node1", Entry: &latest},
+		{NodeID: "node2", Entry: &latest},
+	}, latest)
+
+	stats := rr.Stats()
+	if stats.Consistent != 1 || stats.Needed != 0 {
+		t.Errorf("Agreeing replicas should not need repair: %+v", stats)
+	}
+	if len(rr.queue) != 0 {
+		t.Errorf("Expected no queued repairs, got %d", len(rr.queue))
+	}
+
+	old := types.KeyValueEntry{Key: "k", Value: []byte("old"), Timestamp: 100}
+	rr.Check([]replicaRead{
+		{NodeID: "node1", Entry: &old},
+		{NodeID: "node2", Entry: &latest},
+		{NodeID: "node3"},
+		{NodeID: "node4", Err: errors.New("connection refused")},
+	}, latest)
+
+	stats = rr.Stats()
+	if stats.Needed != 2 {
+		t.Errorf("Expected 2 stale replicas (old and missing), got %d", stats.Needed)
+	}
+	if len(rr.queue) != 2 {
+		t.Errorf("Expected 2 queued repairs, got %d", len(rr.queue))
+	}
+}
+
+func TestReadRepairAppliesLatest(t *testing.T) {
+	coord, store := newTestCoordinator(t)
+	rr := NewReadRepairer(coord, 1.0, 1, 10, 0)
+	rr.Start()
+	defer rr.Stop()
+
+	store.Put("k", []byte("old"), 100)
+	old := types.KeyValueEntry{Key: "k", Value: []byte("old"), Timestamp: 100}
+	latest := types.KeyValueEntry{Key: "k", Value: []byte("new"), Timestamp: 200}
+
+	rr.Check([]replicaRead{{NodeID: "node1", Entry: &old}}, latest)
+
+	deadline := time.Now().Add(2 * time.Second)
+	for rr.Stats().Repaired == 0 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	value, ts, err := store.Get("k")
+	if err != nil || string(value) != "new" || ts != 200 {
+		t.Errorf("Expected repaired value 'new'@200, got '%s'@%d (%v)", value, ts, err)
+	}
+}
+
+func TestReadRepairQueueBound(t *testing.T) {
+	coord, _ := newTestCoordinator(t)
+	rr := NewReadRepairer(coord, 1.0, 1, 1, 0)
+
+	latest := types.KeyValueEntry{Key: "k", Value: []byte("new"), Timestamp: 200}
+	rr.Check([]replicaRead{{NodeID: "node2"}, {NodeID: "node3"}}, latest)
+
+	if stats := rr.Stats(); stats.Dropped != 1 {
+		t.Errorf("Expected 1 dropped repair with a full queue, got %d", stats.Dropped)
+	}
+}
+
+func TestApplyEntryKeepsNewerVersion(t *testing.T) {
+	coord, store := newTestCoordinator(t)
+
+	store.Put("k", []byte("newer"), 200)
+	applied, err := coord.ApplyEntry(types.KeyValueEntry{Key: "k", Value: []byte("older"), Timestamp: 100})
+	if err != nil {
+		t.Fatalf("ApplyEntry failed: %v", err)
+	}
+	if applied {
+		t.Error("Older entry should not overwrite a newer one")
+	}
+
+	store.Delete("k", 300)
+	applied, _ = coord.ApplyEntry(types.KeyValueEntry{Key: "k", Value: []byte("stale"), Timestamp: 250})
+	if applied || store.Has("k") {
+		t.Error("Older entry should not resurrect a newer tombstone")
+	}
+}
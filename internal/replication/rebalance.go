@@ -0,0 +1,441 @@
+package replication
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mini-dynamo/mini-dynamo/internal/ring"
+	"github.com/mini-dynamo/mini-dynamo/pkg/types"
+)
+
+// ErrRebalanceInProgress is returned when a rebalance is started while
+// another one is running
+var ErrRebalanceInProgress = errors.New("rebalance already in progress")
+
+// MoveStatus is the progress of one token move
+type MoveStatus string
+
+const (
+	MovePending   MoveStatus = "pending"   // Waiting for a free stream
+	MoveStreaming MoveStatus = "streaming" // Copying data to the new owners
+	MoveDone      MoveStatus = "done"      // Token reassigned across the cluster
+	MoveFailed    MoveStatus = "failed"    // Left with its current owner
+)
+
+// RebalanceStep reports the execution of one token move
+type RebalanceStep struct {
+	ring.TokenMove
+	Status MoveStatus `json:"status"`
+	Keys   int        `json:"keys"` // Entries copied to new owners
+	Error  string     `json:"error,omitempty"`
+}
+
+// RebalanceStatus reports the progress of the latest rebalance
+type RebalanceStatus struct {
+	Running    bool            `json:"running"`
+	Steps      []RebalanceStep `json:"steps"`
+	StartedAt  time.Time       `json:"started_at"`
+	FinishedAt time.Time       `json:"finished_at"`
+}
+
+// WeightChange reports a change of the local node's weight
+type WeightChange struct {
+	NodeID       string  `json:"node_id"`
+	From         float64 `json:"from"`
+	To           float64 `json:"to"`
+	VNodesBefore int     `json:"vnodes_before"`
+	VNodesAfter  int     `json:"vnodes_after"`
+	Ranges       int     `json:"ranges_moved"` // Ranges copied to nodes gaining them
+	Keys         int     `json:"keys_moved"`
+}
+
+// rangeTransfer is a set of ranges a node takes over from the same
+// current replicas
+type rangeTransfer struct {
+	target  string
+	sources []string
+	ranges  []types.StreamRange
+}
+
+// Rebalancer plans token moves from observed load and executes them. Each
+// move copies the affected ranges to their new owners, reassigns the
+// token on every node, then copies again to pick up writes that reached
+// the old owners in between. At most maxStreams moves run at once.
+type Rebalancer struct {
+	coordinator *Coordinator
+	maxStreams  int
+	onWeight    func(float64)
+	moveMu      sync.Mutex // Serializes ring previews and token reassignments
+	weightMu    sync.Mutex // Allows one weight change at a time
+	mu          sync.Mutex
+	status      RebalanceStatus
+	steps       []*RebalanceStep
+	cancel      context.CancelFunc
+	wg          sync.WaitGroup
+}
+
+// NewRebalancer creates a rebalancer running at most maxStreams token
+// moves at once. onWeight, if set, is called when the local node's weight
+// changes so it can be advertised.
+func NewRebalancer(coord *Coordinator, maxStreams int, onWeight func(float64)) *Rebalancer {
+	if maxStreams < 1 {
+		maxStreams = 1
+	}
+	return &Rebalancer{
+		coordinator: coord,
+		maxStreams:  maxStreams,
+		onWeight:    onWeight,
+	}
+}
+
+// Plan gathers the load of every node in the ring and proposes token moves
+func (rb *Rebalancer) Plan(ctx context.Context, opts ring.RebalanceOptions) (*ring.RebalancePlan, error) {
+	c := rb.coordinator
+
+	var loads []ring.NodeLoad
+	for _, nodeID := range c.ring.GetAllNodes() {
+		var report types.NodeLoadReport
+		if nodeID == c.config.NodeID {
+			report = c.LocalLoad()
+		} else if err := c.getInternal(ctx, nodeID, "/internal/load", &report); err != nil {
+			return nil, fmt.Errorf("failed to get load of %s: %w", nodeID, err)
+		}
+
+		load := ring.NodeLoad{NodeID: nodeID, Keys: report.Keys, Bytes: report.Bytes}
+		if report.UptimeSeconds > 0 {
+			load.RequestRate = float64(report.Requests) / report.UptimeSeconds
+		}
+		loads = append(loads, load)
+	}
+
+	return ring.PlanRebalance(c.ring, loads, opts), nil
+}
+
+// Start executes a plan in the background
+func (rb *Rebalancer) Start(plan *ring.RebalancePlan) error {
+	rb.mu.Lock()
+	defer rb.mu.Unlock()
+
+	if rb.status.Running {
+		return ErrRebalanceInProgress
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	rb.cancel = cancel
+	rb.steps = make([]*RebalanceStep, len(plan.Moves))
+	for i, move := range plan.Moves {
+		rb.steps[i] = &RebalanceStep{TokenMove: move, Status: MovePending}
+	}
+	rb.status = RebalanceStatus{Running: true, StartedAt: time.Now()}
+
+	rb.wg.Add(1)
+	go func() {
+		defer rb.wg.Done()
+		defer cancel()
+		rb.run(ctx)
+	}()
+	return nil
+}
+
+// Stop cancels a running rebalance and waits for it to return
+func (rb *Rebalancer) Stop() {
+	rb.mu.Lock()
+	cancel := rb.cancel
+	rb.mu.Unlock()
+
+	if cancel != nil {
+		cancel()
+	}
+	rb.wg.Wait()
+}
+
+// Status returns the progress of the latest rebalance
+func (rb *Rebalancer) Status() RebalanceStatus {
+	rb.mu.Lock()
+	defer rb.mu.Unlock()
+
+	status := rb.status
+	status.Steps = make([]RebalanceStep, len(rb.steps))
+	for i, step := range rb.steps {
+		status.Steps[i] = *step
+	}
+	return status
+}
+
+// run executes every step, at most maxStreams at a time
+func (rb *Rebalancer) run(ctx context.Context) {
+	log.Printf("Rebalancing: %d token moves, %d at a time", len(rb.steps), rb.maxStreams)
+
+	sem := make(chan struct{}, rb.maxStreams)
+	var wg sync.WaitGroup
+	for _, step := range rb.steps {
+		select {
+		case <-ctx.Done():
+		case sem <- struct{}{}:
+			wg.Add(1)
+			go func(step *RebalanceStep) {
+				defer wg.Done()
+				defer func() { <-sem }()
+				rb.execute(ctx, step)
+			}(step)
+			continue
+		}
+		rb.update(step, func(s *RebalanceStep) {
+			s.Status = MoveFailed
+			s.Error = ctx.Err().Error()
+		})
+	}
+	wg.Wait()
+
+	rb.mu.Lock()
+	rb.status.Running = false
+	rb.status.FinishedAt = time.Now()
+	rb.mu.Unlock()
+	log.Printf("Rebalancing finished")
+}
+
+// execute moves one token: copy, reassign, then copy writes made meanwhile
+func (rb *Rebalancer) execute(ctx context.Context, step *RebalanceStep) {
+	c := rb.coordinator
+	move := step.TokenMove
+	rb.update(step, func(s *RebalanceStep) { s.Status = MoveStreaming })
+
+	fail := func(err error) {
+		log.Printf("Token move %d from %s to %s failed: %v", move.Token, move.From, move.To, err)
+		rb.update(step, func(s *RebalanceStep) {
+			s.Status = MoveFailed
+			s.Error = err.Error()
+		})
+	}
+
+	rb.moveMu.Lock()
+	transfers, err := rb.previewMove(move)
+	rb.moveMu.Unlock()
+	if err != nil {
+		fail(err)
+		return
+	}
+
+	countKeys := func(keys int) {
+		rb.update(step, func(s *RebalanceStep) { s.Keys += keys })
+	}
+	if err := rb.relay(ctx, transfers, countKeys); err != nil {
+		fail(err)
+		return
+	}
+
+	// Other moves may have changed the ring while copying, so the ranges
+	// that change hands are computed again against the ring the token is
+	// reassigned in, and the catch-up copies those
+	rb.moveMu.Lock()
+	transfers, err = rb.previewMove(move)
+	if err == nil {
+		err = c.announceReassign(ctx, move.Token, move.To)
+	}
+	rb.moveMu.Unlock()
+	if err != nil {
+		fail(err)
+		return
+	}
+
+	// Catch up on writes that reached only the old owners while copying
+	if err := rb.relay(ctx, transfers, countKeys); err != nil {
+		fail(fmt.Errorf("token moved but catch-up failed: %w", err))
+		return
+	}
+
+	rb.update(step, func(s *RebalanceStep) { s.Status = MoveDone })
+}
+
+// previewMove checks that a move still applies to the ring and returns
+// the ranges that change hands with it
+func (rb *Rebalancer) previewMove(move ring.TokenMove) ([]*rangeTransfer, error) {
+	c := rb.coordinator
+
+	owner := ""
+	for _, vn := range c.ring.GetRingTokens() {
+		if vn.Hash == move.Token {
+			owner = vn.NodeID
+			break
+		}
+	}
+	if owner != move.From {
+		return nil, fmt.Errorf("token %d is owned by %q, not %s; the plan is stale", move.Token, owner, move.From)
+	}
+
+	preview := c.ring.Clone()
+	if err := preview.ReassignToken(move.Token, move.To); err != nil {
+		return nil, err
+	}
+	return rangeTransfers(c.ring, preview, c.config.ReplicationFactor), nil
+}
+
+// relay copies every transfer to its new owner, reporting the entries
+// copied
+func (rb *Rebalancer) relay(ctx context.Context, transfers []*rangeTransfer, onKeys func(int)) error {
+	for _, t := range transfers {
+		keys, err := rb.coordinator.relayRanges(ctx, t.sources, t.target, t.ranges)
+		onKeys(keys)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// update applies a change to a step under the lock
+func (rb *Rebalancer) update(step *RebalanceStep, change func(*RebalanceStep)) {
+	rb.mu.Lock()
+	defer rb.mu.Unlock()
+	change(step)
+}
+
+// ChangeWeight sets the local node's weight. The ranges that change owner
+// are copied to the nodes gaining them, the new weight and the tokens it
+// places the node at are announced to every node and applied, then the
+// ranges are copied again to pick up writes made in between. Peers apply
+// the announced tokens rather than placing the virtual nodes themselves,
+// since partitioners such as balanced place them by the current ring.
+// Nodes that miss the announcement learn the weight through gossip.
+func (rb *Rebalancer) ChangeWeight(ctx context.Context, weight float64) (*WeightChange, error) {
+	c := rb.coordinator
+	self := c.config.NodeID
+	if weight <= 0 {
+		return nil, fmt.Errorf("weight must be positive")
+	}
+
+	rb.weightMu.Lock()
+	defer rb.weightMu.Unlock()
+
+	rb.moveMu.Lock()
+	preview := c.ring.Clone()
+	preview.SetNodeWeight(self, weight)
+	transfers := rangeTransfers(c.ring, preview, c.config.ReplicationFactor)
+	change := &WeightChange{
+		NodeID:       self,
+		From:         c.ring.GetNodeWeight(self),
+		To:           weight,
+		VNodesBefore: countVNodes(c.ring, self),
+		VNodesAfter:  countVNodes(preview, self),
+	}
+	rb.moveMu.Unlock()
+
+	for _, t := range transfers {
+		change.Ranges += len(t.ranges)
+	}
+	countKeys := func(keys int) { change.Keys += keys }
+
+	log.Printf("Changing weight of %s from %g to %g: %d vnodes -> %d, %d ranges to move",
+		self, change.From, weight, change.VNodesBefore, change.VNodesAfter, change.Ranges)
+	if err := rb.relay(ctx, transfers, countKeys); err != nil {
+		return change, err
+	}
+
+	rb.moveMu.Lock()
+	req := types.WeightChangeRequest{NodeID: self, Weight: weight, Tokens: preview.NodeTokens(self)}
+	for _, node := range c.GetClusterNodes() {
+		if node.ID == self {
+			continue
+		}
+		if err := c.postInternal(ctx, node.ID, "/internal/ring/weight", req, nil); err != nil {
+			log.Printf("Failed to announce weight to %s, it will learn it through gossip: %v", node.ID, err)
+		}
+	}
+	c.SetNodeWeight(self, weight, req.Tokens)
+	rb.moveMu.Unlock()
+	if rb.onWeight != nil {
+		rb.onWeight(weight)
+	}
+
+	// Catch up on writes that reached only the old owners while copying
+	if err := rb.relay(ctx, transfers, countKeys); err != nil {
+		return change, fmt.Errorf("weight changed but catch-up failed: %w", err)
+	}
+	return change, nil
+}
+
+// countVNodes returns the number of virtual nodes a node owns in a ring
+func countVNodes(r *ring.HashRing, nodeID string) int {
+	count := 0
+	for _, vn := range r.GetRingTokens() {
+		if vn.NodeID == nodeID {
+			count++
+		}
+	}
+	return count
+}
+
+// rangeTransfers compares the preference lists of two rings and returns,
+// for every node that gains a range, the ranges it gains grouped by their
+// current replicas
+func rangeTransfers(current, next *ring.HashRing, n int) []*rangeTransfer {
+	transfers := make(map[string]*rangeTransfer)
+	var order []*rangeTransfer
+	for _, move := range ring.Diff(current, next, n).Moves {
+		if len(move.Before) == 0 {
+			continue
+		}
+		for _, target := range move.After {
+			if containsNode(move.Before, target) {
+				continue
+			}
+			id := target + "|" + strings.Join(move.Before, ",")
+			t, exists := transfers[id]
+			if !exists {
+				t = &rangeTransfer{target: target, sources: move.Before}
+				transfers[id] = t
+				order = append(order, t)
+			}
+			t.ranges = append(t.ranges, types.StreamRange{Start: move.StartToken, End: move.EndToken})
+		}
+	}
+	return order
+}
+
+// announceReassign reassigns a token on every known node, then locally.
+// Nodes that miss the change are reported in the error.
+func (c *Coordinator) announceReassign(ctx context.Context, token uint64, nodeID string) error {
+	req := types.TokenReassignRequest{Token: token, NodeID: nodeID, FromNode: c.config.NodeID}
+
+	var missed []string
+	for _, node := range c.GetClusterNodes() {
+		if node.ID == c.config.NodeID {
+			continue
+		}
+		if err := c.postInternal(ctx, node.ID, "/internal/ring/reassign", req, nil); err != nil {
+			log.Printf("Failed to reassign token %d on %s: %v", token, node.ID, err)
+			missed = append(missed, node.ID)
+		}
+	}
+
+	if err := c.ReassignToken(token, nodeID); err != nil {
+		return err
+	}
+	if len(missed) > 0 {
+		return fmt.Errorf("token reassigned, but not acknowledged by %s", strings.Join(missed, ","))
+	}
+	return nil
+}
+
+// ReassignToken hands the virtual node at a token to another node in the
+// local ring
+func (c *Coordinator) ReassignToken(token uint64, nodeID string) error {
+	return c.ring.ReassignToken(token, nodeID)
+}
+
+// LocalLoad reports this node's observed load for rebalancing
+func (c *Coordinator) LocalLoad() types.NodeLoadReport {
+	stats := c.storage.Stats()
+	return types.NodeLoadReport{
+		NodeID:        c.config.NodeID,
+		Keys:          stats.ActiveKeys,
+		Bytes:         stats.DataFileSize,
+		Requests:      stats.TotalReads + stats.TotalWrites,
+		UptimeSeconds: time.Since(c.started).Seconds(),
+	}
+}
@@ -0,0 +1,203 @@
+package replication
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/mini-dynamo/mini-dynamo/internal/ring"
+	"github.com/mini-dynamo/mini-dynamo/pkg/types"
+)
+
+func TestRebalancePlanMovesFromLoadedNode(t *testing.T) {
+	coord, fakes := newJoiningCoordinator(t)
+	coord.SetNodeRingState("node1", types.RingReady)
+	for i := 0; i < 200; i++ {
+		coord.ApplyEntry(types.KeyValueEntry{Key: fmt.Sprintf("key%d", i), Value: []byte("v"), Timestamp: 1})
+	}
+	for _, f := range fakes {
+		f.load = types.NodeLoadReport{Keys: 10, Bytes: 100, Requests: 10, UptimeSeconds: 10}
+	}
+
+	rb := NewRebalancer(coord, 1, nil)
+	plan, err := rb.Plan(context.Background(), ring.RebalanceOptions{Threshold: 0.1, MaxMoves: 4})
+	if err != nil {
+		t.Fatalf("Plan failed: %v", err)
+	}
+
+	if len(plan.Loads) != 3 {
+		t.Fatalf("Expected loads for 3 nodes, got %+v", plan.Loads)
+	}
+	if len(plan.Moves) == 0 {
+		t.Fatal("Expected moves away from node1")
+	}
+	for _, move := range plan.Moves {
+		if move.From != "node1" {
+			t.Errorf("Expected moves from node1 only, got %+v", move)
+		}
+	}
+	if plan.SpreadAfter >= plan.SpreadBefore {
+		t.Errorf("Expected the plan to narrow the spread, got %v -> %v", plan.SpreadBefore, plan.SpreadAfter)
+	}
+}
+
+func TestRebalanceMovesTokenAndData(t *testing.T) {
+	coord, fakes := newJoiningCoordinator(t)
+	coord.SetNodeRingState("node1", types.RingReady)
+	for i := 0; i < 200; i++ {
+		coord.ApplyEntry(types.KeyValueEntry{Key: fmt.Sprintf("key%d", i), Value: []byte("v"), Timestamp: 1})
+	}
+
+	// Move one of node1's tokens to node2
+	var move ring.TokenMove
+	for _, tr := range ring.NewVNodeManager(coord.ring).GetTokenRanges() {
+		if tr.NodeID == "node1" {
+			move = ring.TokenMove{Token: tr.EndToken, RangeStart: tr.StartToken, From: "node1", To: "node2"}
+			break
+		}
+	}
+	next := coord.ring.Clone()
+	if err := next.ReassignToken(move.Token, move.To); err != nil {
+		t.Fatalf("ReassignToken failed: %v", err)
+	}
+
+	// Keys held by node1 that node2 gains with the move
+	var gained []string
+	for i := 0; i < 200; i++ {
+		key := fmt.Sprintf("key%d", i)
+		before, _ := coord.ring.GetNodes(key, 2)
+		after, _ := next.GetNodes(key, 2)
+		if containsNode(before, "node1") && !containsNode(before, "node2") && containsNode(after, "node2") {
+			gained = append(gained, key)
+		}
+	}
+	if len(gained) == 0 {
+		t.Fatal("The move gives node2 no keys held by node1")
+	}
+
+	rb := NewRebalancer(coord, 2, nil)
+	if err := rb.Start(&ring.RebalancePlan{Moves: []ring.TokenMove{move}}); err != nil {
+		t.Fatalf("Start failed: %v", err)
+	}
+	status := waitRebalance(rb)
+	if status.Running || len(status.Steps) != 1 || status.Steps[0].Status != MoveDone {
+		t.Fatalf("Expected the move to be done, got %+v", status)
+	}
+	for _, vn := range coord.ring.GetRingTokens() {
+		if vn.Hash == move.Token && vn.NodeID != "node2" {
+			t.Errorf("Expected token %d owned by node2, got %s", move.Token, vn.NodeID)
+		}
+	}
+	for _, f := range fakes {
+		if f.moves != 1 {
+			t.Errorf("Expected every peer to apply the move, got %d", f.moves)
+		}
+	}
+	for _, key := range gained {
+		if _, exists := fakes[0].entries[key]; !exists {
+			t.Errorf("Key %s not copied to node2", key)
+		}
+	}
+}
+
+func TestRebalanceRejectsStalePlan(t *testing.T) {
+	coord, _ := newJoiningCoordinator(t)
+	coord.SetNodeRingState("node1", types.RingReady)
+
+	var move ring.TokenMove
+	for _, tr := range ring.NewVNodeManager(coord.ring).GetTokenRanges() {
+		if tr.NodeID == "node2" {
+			move = ring.TokenMove{Token: tr.EndToken, From: "node1", To: "node3"}
+			break
+		}
+	}
+
+	rb := NewRebalancer(coord, 1, nil)
+	if err := rb.Start(&ring.RebalancePlan{Moves: []ring.TokenMove{move}}); err != nil {
+		t.Fatalf("Start failed: %v", err)
+	}
+	status := waitRebalance(rb)
+	if status.Steps[0].Status != MoveFailed {
+		t.Errorf("Expected a stale move to fail, got %+v", status.Steps[0])
+	}
+	for _, vn := range coord.ring.GetRingTokens() {
+		if vn.Hash == move.Token && vn.NodeID != "node2" {
+			t.Errorf("Stale move changed the ring: token %d now owned by %s", move.Token, vn.NodeID)
+		}
+	}
+}
+
+// waitRebalance waits for a rebalance to finish and returns its status
+func waitRebalance(rb *Rebalancer) RebalanceStatus {
+	deadline := time.Now().Add(5 * time.Second)
+	for rb.Status().Running && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	return rb.Status()
+}
+
+func TestRebalanceChangeWeightMovesData(t *testing.T) {
+	coord, fakes := newJoiningCoordinator(t)
+	coord.SetNodeRingState("node1", types.RingReady)
+	for i := 0; i < 200; i++ {
+		coord.ApplyEntry(types.KeyValueEntry{Key: fmt.Sprintf("key%d", i), Value: []byte("v"), Timestamp: 1})
+	}
+
+	next := coord.ring.Clone()
+	next.SetNodeWeight("node1", 0.5)
+
+	// Keys held by node1 that another node gains when its weight halves
+	byID := map[string]*fakeReplica{"node2": fakes[0], "node3": fakes[1]}
+	gained := make(map[string]string)
+	for i := 0; i < 200; i++ {
+		key := fmt.Sprintf("key%d", i)
+		before, _ := coord.ring.GetNodes(key, 2)
+		after, _ := next.GetNodes(key, 2)
+		for _, n := range after {
+			if containsNode(before, "node1") && !containsNode(before, n) {
+				gained[key] = n
+			}
+		}
+	}
+	if len(gained) == 0 {
+		t.Fatal("Halving node1's weight moves none of its keys")
+	}
+
+	var advertised float64
+	rb := NewRebalancer(coord, 1, func(weight float64) { advertised = weight })
+	change, err := rb.ChangeWeight(context.Background(), 0.5)
+	if err != nil {
+		t.Fatalf("ChangeWeight failed: %v", err)
+	}
+
+	if change.VNodesBefore != 20 || change.VNodesAfter != 10 || countVNodes(coord.ring, "node1") != 10 {
+		t.Errorf("Expected node1 to go from 20 to 10 vnodes, got %+v", change)
+	}
+	if advertised != 0.5 || coord.GetNodeWeight("node1") != 0.5 {
+		t.Errorf("Expected weight 0.5 applied and advertised, got %v and %v", coord.GetNodeWeight("node1"), advertised)
+	}
+	// Peers are told where node1's vnodes now are rather than placing them
+	tokens := fmt.Sprint(sortedTokens(coord.ring.NodeTokens("node1")))
+	for _, f := range fakes {
+		if f.moves != 1 || len(f.weights) != 1 {
+			t.Fatalf("Expected every peer to learn the weight, got %d", f.moves)
+		}
+		if got := fmt.Sprint(sortedTokens(f.weights[0].Tokens)); got != tokens {
+			t.Errorf("Expected node1's tokens %s announced, got %s", tokens, got)
+		}
+	}
+	for key, target := range gained {
+		if _, exists := byID[target].entries[key]; !exists {
+			t.Errorf("Key %s not copied to %s", key, target)
+		}
+	}
+}
+
+// sortedTokens returns tokens in ascending order
+func sortedTokens(tokens []uint64) []uint64 {
+	sorted := append([]uint64(nil), tokens...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+	return sorted
+}
@@ -0,0 +1,298 @@
+package replication
+
+import (
+	"context"
+	"log"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mini-dynamo/mini-dynamo/internal/ring"
+	"github.com/mini-dynamo/mini-dynamo/pkg/types"
+)
+
+// rereplicationAttempts is how many times a lost range is streamed before
+// it is reported as failed
+const rereplicationAttempts = 3
+
+// RangeRepairStatus is the progress of re-replicating one token range
+type RangeRepairStatus string
+
+const (
+	RangeRepairPending   RangeRepairStatus = "pending"   // Waiting to be streamed
+	RangeRepairStreaming RangeRepairStatus = "streaming" // Fetching from surviving replicas
+	RangeRepairDone      RangeRepairStatus = "done"      // Replication factor restored
+	RangeRepairFailed    RangeRepairStatus = "failed"    // No surviving replica could stream it
+)
+
+// RangeRepair reports the re-replication of a token range the local node
+// took over from a dead node
+type RangeRepair struct {
+	DeadNode  string            `json:"dead_node"`
+	Start     uint64            `json:"start_token"`
+	End       uint64            `json:"end_token"`
+	Sources   []string          `json:"sources"` // Surviving replicas holding the range
+	Status    RangeRepairStatus `json:"status"`
+	Keys      int               `json:"keys"` // Entries streamed
+	Attempts  int               `json:"attempts"`
+	Error     string            `json:"error,omitempty"`
+	UpdatedAt time.Time         `json:"updated_at"`
+}
+
+// lostRange is a token range a node owned when it was declared dead
+type lostRange struct {
+	start, end uint64
+	owners     []string // Preference list including the dead node
+}
+
+// deadNode is a dead node whose ranges wait for the delay to pass
+type deadNode struct {
+	ranges []lostRange
+	cancel chan struct{}
+}
+
+// RereplicationManager restores the replication factor of ranges owned by
+// nodes the failure detector declares dead. After a delay that tolerates
+// flapping, each node streams the ranges it took over from the surviving
+// replicas, so the work is spread over the new owners.
+type RereplicationManager struct {
+	coordinator *Coordinator
+	delay       time.Duration
+	mu          sync.Mutex
+	dead        map[string]*deadNode
+	repairs     map[string][]*RangeRepair // Dead node -> ranges taken over
+	stopCh      chan struct{}
+	wg          sync.WaitGroup
+}
+
+// NewRereplicationManager creates a re-replication manager that waits
+// delay after a node dies before copying its ranges
+func NewRereplicationManager(coord *Coordinator, delay time.Duration) *RereplicationManager {
+	return &RereplicationManager{
+		coordinator: coord,
+		delay:       delay,
+		dead:        make(map[string]*deadNode),
+		repairs:     make(map[string][]*RangeRepair),
+		stopCh:      make(chan struct{}),
+	}
+}
+
+// Stop cancels scheduled re-replication and waits for running streams
+func (m *RereplicationManager) Stop() {
+	close(m.stopCh)
+	m.wg.Wait()
+}
+
+// NodeDead schedules re-replication of a node's ranges. It must be called
+// before the node is removed from the ring, which is what gives up its
+// ranges.
+func (m *RereplicationManager) NodeDead(nodeID string) {
+	c := m.coordinator
+	n := c.config.ReplicationFactor
+
+	var ranges []lostRange
+	for _, r := range ring.NewVNodeManager(c.ring).GetTokenRanges() {
+		owners, err := c.ring.GetNodesForToken(r.EndToken, n, nil)
+		if err == nil && containsNode(owners, nodeID) {
+			ranges = append(ranges, lostRange{start: r.StartToken, end: r.EndToken, owners: owners})
+		}
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if prev, exists := m.dead[nodeID]; exists {
+		close(prev.cancel)
+	}
+	if len(ranges) == 0 {
+		delete(m.dead, nodeID)
+		return
+	}
+
+	dead := &deadNode{ranges: ranges, cancel: make(chan struct{})}
+	m.dead[nodeID] = dead
+	log.Printf("Node %s is dead: re-replicating its %d ranges in %v", nodeID, len(ranges), m.delay)
+
+	m.wg.Add(1)
+	go func() {
+		defer m.wg.Done()
+		select {
+		case <-m.stopCh:
+			return
+		case <-dead.cancel:
+			return
+		case <-time.After(m.delay):
+		}
+
+		m.mu.Lock()
+		if m.dead[nodeID] == dead {
+			delete(m.dead, nodeID)
+		}
+		m.mu.Unlock()
+		m.rereplicate(nodeID, dead.ranges)
+	}()
+}
+
+// NodeAlive cancels re-replication for a node that came back before the
+// delay passed
+func (m *RereplicationManager) NodeAlive(nodeID string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if dead, exists := m.dead[nodeID]; exists {
+		close(dead.cancel)
+		delete(m.dead, nodeID)
+		log.Printf("Node %s is back: re-replication cancelled", nodeID)
+	}
+}
+
+// Status returns the progress of every range taken over by this node,
+// ordered by dead node and token
+func (m *RereplicationManager) Status() []RangeRepair {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	result := make([]RangeRepair, 0)
+	for _, repairs := range m.repairs {
+		for _, repair := range repairs {
+			result = append(result, *repair)
+		}
+	}
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].DeadNode != result[j].DeadNode {
+			return result[i].DeadNode < result[j].DeadNode
+		}
+		return result[i].Start < result[j].Start
+	})
+	return result
+}
+
+// rereplicate streams the lost ranges this node now owns from their
+// surviving replicas
+func (m *RereplicationManager) rereplicate(nodeID string, ranges []lostRange) {
+	c := m.coordinator
+	self := c.config.NodeID
+	pending, _ := c.transitioningNodes()
+
+	// Group the ranges this node took over by their surviving replicas
+	groups := make(map[string][]*RangeRepair)
+	var order []string
+	var repairs []*RangeRepair
+	for _, lr := range ranges {
+		if containsNode(lr.owners, self) {
+			continue // Already held here
+		}
+		owners, err := c.ring.GetNodesForToken(lr.end, c.config.ReplicationFactor, pending)
+		if err != nil || !containsNode(owners, self) {
+			continue // Taken over by another node
+		}
+
+		var sources []string
+		for _, owner := range lr.owners {
+			if owner != nodeID {
+				sources = append(sources, owner)
+			}
+		}
+		repair := &RangeRepair{
+			DeadNode:  nodeID,
+			Start:     lr.start,
+			End:       lr.end,
+			Sources:   sources,
+			Status:    RangeRepairPending,
+			UpdatedAt: time.Now(),
+		}
+		repairs = append(repairs, repair)
+
+		id := strings.Join(sources, ",")
+		if _, exists := groups[id]; !exists {
+			order = append(order, id)
+		}
+		groups[id] = append(groups[id], repair)
+	}
+
+	m.mu.Lock()
+	m.repairs[nodeID] = repairs
+	m.mu.Unlock()
+
+	if len(repairs) == 0 {
+		return
+	}
+	log.Printf("Re-replicating %d ranges of dead node %s", len(repairs), nodeID)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() {
+		select {
+		case <-m.stopCh:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+
+	for _, id := range order {
+		m.streamGroup(ctx, groups[id])
+	}
+}
+
+// streamGroup streams a group of ranges sharing their surviving replicas,
+// retrying before reporting them failed
+func (m *RereplicationManager) streamGroup(ctx context.Context, repairs []*RangeRepair) {
+	ranges := make([]types.StreamRange, len(repairs))
+	for i, repair := range repairs {
+		ranges[i] = types.StreamRange{Start: repair.Start, End: repair.End}
+	}
+	sources := repairs[0].Sources
+
+	for attempt := 1; attempt <= rereplicationAttempts; attempt++ {
+		m.update(repairs, func(r *RangeRepair) {
+			r.Status = RangeRepairStreaming
+			r.Attempts = attempt
+		})
+
+		keys := make(map[*RangeRepair]int, len(repairs))
+		_, err := m.coordinator.streamFrom(ctx, sources, ranges, func(entry types.KeyValueEntry) {
+			token := m.coordinator.ring.KeyToken(entry.Key)
+			for i, r := range ranges {
+				if (ring.TokenRange{StartToken: r.Start, EndToken: r.End}).Contains(token) {
+					keys[repairs[i]]++
+					break
+				}
+			}
+		})
+		if err == nil {
+			m.update(repairs, func(r *RangeRepair) {
+				r.Keys = keys[r]
+				r.Status = RangeRepairDone
+				r.Error = ""
+			})
+			return
+		}
+
+		log.Printf("Re-replication of %d ranges failed (attempt %d): %v", len(repairs), attempt, err)
+		m.update(repairs, func(r *RangeRepair) {
+			r.Status = RangeRepairFailed
+			r.Error = err.Error()
+		})
+
+		if attempt < rereplicationAttempts {
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(bootstrapRetryInterval):
+			}
+		}
+	}
+}
+
+// update applies a change to range repairs under the lock
+func (m *RereplicationManager) update(repairs []*RangeRepair, change func(*RangeRepair)) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := time.Now()
+	for _, repair := range repairs {
+		change(repair)
+		repair.UpdatedAt = now
+	}
+}
@@ -0,0 +1,94 @@
+package replication
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/mini-dynamo/mini-dynamo/pkg/types"
+)
+
+// waitForRepairs waits until every range repair has finished
+func waitForRepairs(t *testing.T, m *RereplicationManager) []RangeRepair {
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		repairs := m.Status()
+		done := len(repairs) > 0
+		for _, r := range repairs {
+			if r.Status != RangeRepairDone && r.Status != RangeRepairFailed {
+				done = false
+			}
+		}
+		if done {
+			return repairs
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatalf("Re-replication did not finish: %+v", m.Status())
+	return nil
+}
+
+func TestRereplicationRestoresDeadNodeRanges(t *testing.T) {
+	coord, fakes := newJoiningCoordinator(t)
+	coord.SetNodeRingState("node1", types.RingReady)
+	dead := newFakeReplica(t)
+	registerPlaced(coord, dead.node(t, "node4", ""))
+
+	// The survivors hold every key
+	for i := 0; i < 200; i++ {
+		entry := types.KeyValueEntry{Key: fmt.Sprintf("key%d", i), Value: []byte("v"), Timestamp: 1}
+		for _, f := range fakes {
+			f.entries[entry.Key] = entry
+		}
+	}
+	before := make(map[string][]string)
+	for i := 0; i < 200; i++ {
+		key := fmt.Sprintf("key%d", i)
+		before[key], _ = coord.ring.GetNodes(key, 2)
+	}
+
+	m := NewRereplicationManager(coord, 0)
+	defer m.Stop()
+	m.NodeDead("node4")
+	coord.ring.RemoveNode("node4")
+
+	repairs := waitForRepairs(t, m)
+	keys := 0
+	for _, r := range repairs {
+		if r.Status != RangeRepairDone || r.DeadNode != "node4" {
+			t.Errorf("Unexpected range repair: %+v", r)
+		}
+		keys += r.Keys
+	}
+
+	// node1 now holds every key it took over from node4
+	expected := 0
+	for key, owners := range before {
+		after, _ := coord.ring.GetNodes(key, 2)
+		if !containsNode(owners, "node4") || containsNode(owners, "node1") || !containsNode(after, "node1") {
+			continue
+		}
+		expected++
+		if !coord.storage.Has(key) {
+			t.Errorf("Key %s not re-replicated to node1", key)
+		}
+	}
+	if expected == 0 || keys != expected {
+		t.Errorf("Expected %d keys re-replicated, got %d", expected, keys)
+	}
+}
+
+func TestRereplicationCancelledWhenNodeReturns(t *testing.T) {
+	coord, _ := newJoiningCoordinator(t)
+	coord.SetNodeRingState("node1", types.RingReady)
+
+	m := NewRereplicationManager(coord, 50*time.Millisecond)
+	defer m.Stop()
+	m.NodeDead("node2")
+	m.NodeAlive("node2")
+
+	time.Sleep(150 * time.Millisecond)
+	if repairs := m.Status(); len(repairs) != 0 {
+		t.Errorf("Expected no re-replication after the node returned, got %+v", repairs)
+	}
+}
@@ -0,0 +1,78 @@
+package replication
+
+import (
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/mini-dynamo/mini-dynamo/internal/ring"
+)
+
+// RingChange is a topology change to preview before applying it
+type RingChange struct {
+	Add     []string           `json:"add,omitempty"`
+	Remove  []string           `json:"remove,omitempty"`
+	Weights map[string]float64 `json:"weights,omitempty"`
+}
+
+// AppliedRingChange is an ownership change made to the local ring
+type AppliedRingChange struct {
+	AppliedAt time.Time `json:"applied_at"`
+	*ring.RingDiff
+}
+
+// ringChanges keeps the latest ownership change applied to the ring
+type ringChanges struct {
+	mu   sync.Mutex
+	last *AppliedRingChange
+}
+
+// recordRingChange keeps a ring change for GET /admin/ring/diff
+func (c *Coordinator) recordRingChange(diff *ring.RingDiff) {
+	if !diff.Empty() {
+		log.Printf("Ring epoch %d -> %d: %d ranges change replicas across %d nodes",
+			diff.FromEpoch, diff.ToEpoch, len(diff.Moves), len(diff.Nodes))
+	}
+
+	c.changes.mu.Lock()
+	c.changes.last = &AppliedRingChange{AppliedAt: time.Now(), RingDiff: diff}
+	c.changes.mu.Unlock()
+}
+
+// LastRingChange returns the latest ownership change applied to the ring,
+// or nil if there was none since the node started
+func (c *Coordinator) LastRingChange() *AppliedRingChange {
+	c.changes.mu.Lock()
+	defer c.changes.mu.Unlock()
+	return c.changes.last
+}
+
+// PreviewRingChange returns the ranges each node would gain and lose if a
+// change were applied, without applying it. Weights are set before nodes
+// are added, so new nodes join with theirs.
+func (c *Coordinator) PreviewRingChange(change RingChange) (*ring.RingDiff, error) {
+	current := c.ring.Clone()
+	next := current.Clone()
+
+	for nodeID, weight := range change.Weights {
+		if weight <= 0 {
+			return nil, fmt.Errorf("weight of %s must be positive", nodeID)
+		}
+		next.SetNodeWeight(nodeID, weight)
+	}
+	for _, nodeID := range change.Add {
+		if next.HasNode(nodeID) {
+			return nil, fmt.Errorf("node %s is already in the ring", nodeID)
+		}
+		next.AddNode(nodeID)
+	}
+	for _, nodeID := range change.Remove {
+		if !next.HasNode(nodeID) {
+			return nil, fmt.Errorf("node %s is not in the ring", nodeID)
+		}
+		next.RemoveNode(nodeID)
+	}
+
+	return ring.Diff(current, next, c.config.ReplicationFactor), nil
+}
@@ -0,0 +1,77 @@
+package replication
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/mini-dynamo/mini-dynamo/pkg/types"
+)
+
+func TestPreviewRingChange(t *testing.T) {
+	coord, _ := newJoiningCoordinator(t)
+	epoch := coord.ring.Epoch()
+
+	diff, err := coord.PreviewRingChange(RingChange{Add: []string{"node4"}, Weights: map[string]float64{"node4": 2}})
+	if err != nil {
+		t.Fatalf("PreviewRingChange failed: %v", err)
+	}
+	if diff.Replicas != 2 || diff.Node("node4").GainedShare == 0 {
+		t.Errorf("Expected node4 to gain ranges, got %+v", diff.Node("node4"))
+	}
+	if coord.ring.Epoch() != epoch || coord.ring.HasNode("node4") {
+		t.Error("Preview changed the ring")
+	}
+
+	if _, err := coord.PreviewRingChange(RingChange{Remove: []string{"node9"}}); err == nil {
+		t.Error("Expected an error removing a node that is not in the ring")
+	}
+	if _, err := coord.PreviewRingChange(RingChange{Add: []string{"node2"}}); err == nil {
+		t.Error("Expected an error adding a node already in the ring")
+	}
+
+	// A preview of removing node3 matches the change once it is applied
+	preview, err := coord.PreviewRingChange(RingChange{Remove: []string{"node3"}})
+	if err != nil {
+		t.Fatalf("PreviewRingChange failed: %v", err)
+	}
+	coord.UnregisterNode("node3")
+	last := coord.LastRingChange()
+	if last == nil || last.ToEpoch != epoch+1 {
+		t.Fatalf("Expected the removal to be recorded, got %+v", last)
+	}
+	if fmt.Sprint(last.Moves) != fmt.Sprint(preview.Moves) {
+		t.Errorf("Applied change differs from its preview:\n%v\n%v", last.Moves, preview.Moves)
+	}
+}
+
+func TestHintsFollowRingChange(t *testing.T) {
+	coord, _ := newJoiningCoordinator(t)
+	hints := NewHintedHandoffStore(time.Hour, 100)
+	manager := NewHandoffManager(hints, coord, time.Hour)
+	coord.ring.Subscribe(coord.config.ReplicationFactor, manager.OnRingChange)
+
+	// Find a key node3 replicates with node2, which node1 takes over
+	var key string
+	for i := 0; key == ""; i++ {
+		k := fmt.Sprintf("key%d", i)
+		nodes, _ := coord.ring.GetNodes(k, 2)
+		if containsNode(nodes, "node3") && containsNode(nodes, "node2") {
+			key = k
+		}
+	}
+	hints.Store("node3", types.KeyValueEntry{Key: key, Value: []byte("v"), Timestamp: 1})
+	hints.Store("node2", types.KeyValueEntry{Key: key, Value: []byte("v"), Timestamp: 1})
+
+	coord.UnregisterNode("node3")
+
+	if len(hints.GetHints("node3")) != 0 {
+		t.Error("Expected the hint for node3 to move")
+	}
+	if got := hints.GetHints("node1"); len(got) != 1 || got[0].Entry.Key != key {
+		t.Errorf("Expected node1 to receive the hint for %s, got %v", key, got)
+	}
+	if len(hints.GetHints("node2")) != 1 {
+		t.Error("Expected node2 to keep its hint")
+	}
+}
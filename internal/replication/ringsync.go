@@ -0,0 +1,198 @@
+package replication
+
+import (
+	"context"
+	"log"
+	"sync"
+
+	"github.com/mini-dynamo/mini-dynamo/internal/ring"
+	"github.com/mini-dynamo/mini-dynamo/pkg/types"
+)
+
+// RingSyncStats reports how this node's ring compares with its peers'
+type RingSyncStats struct {
+	Epoch          uint64 `json:"epoch"`
+	Checksum       uint64 `json:"checksum"`
+	StaleRequests  uint64 `json:"stale_requests"`  // Replication requests routed with an older ring than ours
+	BehindRequests uint64 `json:"behind_requests"` // Requests and responses from nodes with a newer ring
+	Adopted        uint64 `json:"adopted"`         // Newer rings adopted from peers
+	SyncError      string `json:"sync_error,omitempty"`
+}
+
+// ringSync tracks ring versions seen on peers and fetches newer rings
+type ringSync struct {
+	mu      sync.Mutex
+	syncing bool // A fetch is in flight
+	stats   RingSyncStats
+}
+
+// RingVersion returns the epoch and checksum of the local ring
+func (c *Coordinator) RingVersion() types.RingVersion {
+	epoch, checksum := c.ring.Version()
+	return types.RingVersion{Epoch: epoch, Checksum: checksum}
+}
+
+// RingSnapshot returns the local ring for a peer to adopt
+func (c *Coordinator) RingSnapshot() *ring.Snapshot {
+	return c.ring.Snapshot()
+}
+
+// NodeTokens returns the tokens a node owns in the local ring, sent to
+// nodes joining through this one
+func (c *Coordinator) NodeTokens(nodeID string) []uint64 {
+	return c.ring.NodeTokens(nodeID)
+}
+
+// AdoptRing merges a snapshot into the local ring if it is newer. Members
+// of the local ring the snapshot lacks are kept at their tokens, since
+// they were added here while the sender made changes of its own, unless
+// they have left. A ring that lost track of this node gets it back too,
+// with a new epoch that spreads the correction.
+func (c *Coordinator) AdoptRing(s *ring.Snapshot) bool {
+	adopted, restored := c.ring.Merge(s, c.departedNodes())
+	if !adopted {
+		return false
+	}
+
+	c.ringSync.mu.Lock()
+	c.ringSync.stats.Adopted++
+	c.ringSync.mu.Unlock()
+	log.Printf("Adopted ring at epoch %d with %d nodes", s.Epoch, len(s.Nodes))
+	if len(restored) > 0 {
+		log.Printf("Kept nodes %v missing from the adopted ring", restored)
+	}
+
+	self := c.config.NodeID
+	if !c.ring.HasNode(self) && c.GetNodeRingState(self) != types.RingLeft {
+		c.ring.AddNode(self)
+	}
+	return true
+}
+
+// departedNodes returns the nodes known to have left the ring, which a
+// merged ring must not keep
+func (c *Coordinator) departedNodes() map[string]bool {
+	c.nodesMu.RLock()
+	defer c.nodesMu.RUnlock()
+
+	departed := make(map[string]bool)
+	for id, node := range c.nodes {
+		if node.RingState == types.RingLeft {
+			departed[id] = true
+		}
+	}
+	return departed
+}
+
+// ObserveRingVersion compares a peer's ring version, learned through
+// gossip, with the local ring and fetches the peer's ring if it is newer
+func (c *Coordinator) ObserveRingVersion(nodeID string, v types.RingVersion) {
+	if c.compareRing(v.Epoch, v.Checksum) > 0 {
+		go c.syncRing(nodeID)
+	}
+}
+
+// ObserveRingEpoch checks the ring version a replication request was
+// routed with. An older ring means the sender wrote to replicas chosen
+// from a stale ring, and the response tells it ours; a newer one means
+// this node is behind and fetches the sender's ring. Rings at the same
+// epoch that differ are ordered by checksum, as gossip orders them.
+func (c *Coordinator) ObserveRingEpoch(epoch, checksum uint64, fromNode string) {
+	if epoch == 0 {
+		return
+	}
+	order := c.compareRing(epoch, checksum)
+	if order == 0 {
+		return
+	}
+
+	c.ringSync.mu.Lock()
+	if order < 0 {
+		c.ringSync.stats.StaleRequests++
+	} else {
+		c.ringSync.stats.BehindRequests++
+	}
+	c.ringSync.mu.Unlock()
+
+	if order < 0 {
+		local, localChecksum := c.ring.Version()
+		log.Printf("Stale routing: %s sent a request for ring %d/%x, ours is %d/%x", fromNode, epoch, checksum, local, localChecksum)
+		return
+	}
+	go c.syncRing(fromNode)
+}
+
+// observeReplicaEpoch checks the ring version a replica answered with and
+// fetches its ring if it is newer than ours
+func (c *Coordinator) observeReplicaEpoch(nodeID string, epoch, checksum uint64) {
+	if c.compareRing(epoch, checksum) <= 0 {
+		return
+	}
+
+	c.ringSync.mu.Lock()
+	c.ringSync.stats.BehindRequests++
+	c.ringSync.mu.Unlock()
+	go c.syncRing(nodeID)
+}
+
+// compareRing orders a peer's ring version against the local ring: 1 if
+// the peer's is newer, -1 if it is older and 0 if they match. Ties on epoch
+// go to the higher checksum, as in ring.Snapshot.NewerThan; a peer that
+// sent no checksum is taken to match at the same epoch.
+func (c *Coordinator) compareRing(epoch, checksum uint64) int {
+	local, localChecksum := c.ring.Version()
+	switch {
+	case epoch > local:
+		return 1
+	case epoch < local:
+		return -1
+	case checksum == 0 || checksum == localChecksum:
+		return 0
+	case checksum > localChecksum:
+		return 1
+	}
+	return -1
+}
+
+// GetRingSyncStats returns the local ring version and stale routing seen
+func (c *Coordinator) GetRingSyncStats() RingSyncStats {
+	epoch, checksum := c.ring.Version()
+
+	c.ringSync.mu.Lock()
+	defer c.ringSync.mu.Unlock()
+	stats := c.ringSync.stats
+	stats.Epoch, stats.Checksum = epoch, checksum
+	return stats
+}
+
+// syncRing fetches a peer's ring and adopts it if newer. Only one fetch
+// runs at a time; versions seen meanwhile are picked up by later gossip.
+func (c *Coordinator) syncRing(nodeID string) {
+	c.ringSync.mu.Lock()
+	if c.ringSync.syncing {
+		c.ringSync.mu.Unlock()
+		return
+	}
+	c.ringSync.syncing = true
+	c.ringSync.mu.Unlock()
+
+	ctx, cancel := context.WithTimeout(context.Background(), c.config.RequestTimeout)
+	defer cancel()
+
+	var snapshot ring.Snapshot
+	err := c.getInternal(ctx, nodeID, "/internal/ring", &snapshot)
+	if err == nil {
+		c.AdoptRing(&snapshot)
+	} else {
+		log.Printf("Failed to fetch ring from %s: %v", nodeID, err)
+	}
+
+	c.ringSync.mu.Lock()
+	c.ringSync.syncing = false
+	if err != nil {
+		c.ringSync.stats.SyncError = err.Error()
+	} else {
+		c.ringSync.stats.SyncError = ""
+	}
+	c.ringSync.mu.Unlock()
+}
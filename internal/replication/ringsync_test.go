@@ -0,0 +1,171 @@
+package replication
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/mini-dynamo/mini-dynamo/internal/ring"
+	"github.com/mini-dynamo/mini-dynamo/pkg/types"
+)
+
+func TestReplicaWithNewerRingIsAdopted(t *testing.T) {
+	coord, fakes := newJoiningCoordinator(t)
+	coord.SetNodeRingState("node1", types.RingReady)
+
+	// node2 has moved one of node1's tokens to itself
+	newer := coord.ring.Clone()
+	var moved uint64
+	for _, vn := range newer.GetRingTokens() {
+		if vn.NodeID == "node1" {
+			moved = vn.Hash
+			break
+		}
+	}
+	if err := newer.ReassignToken(moved, "node2"); err != nil {
+		t.Fatalf("ReassignToken failed: %v", err)
+	}
+	fakes[0].snap = newer.Snapshot()
+	fakes[1].snap = newer.Snapshot()
+
+	if _, err := coord.Put(context.Background(), "key", []byte("v"), types.ConsistencyOptions{Level: types.ConsistencyAll}); err != nil {
+		t.Fatalf("Put failed: %v", err)
+	}
+
+	deadline := time.Now().Add(2 * time.Second)
+	for coord.ring.Epoch() != newer.Epoch() && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	want := newer.Snapshot()
+	if got := coord.RingVersion(); got.Epoch != want.Epoch || got.Checksum != want.Checksum() {
+		t.Fatalf("Expected ring %d/%x adopted, got %+v", want.Epoch, want.Checksum(), got)
+	}
+	if stats := coord.GetRingSyncStats(); stats.Adopted != 1 || stats.BehindRequests == 0 {
+		t.Errorf("Unexpected ring sync stats: %+v", stats)
+	}
+}
+
+func TestStaleRoutingIsCounted(t *testing.T) {
+	coord, _ := newJoiningCoordinator(t)
+	epoch, checksum := coord.ring.Version()
+
+	coord.ObserveRingEpoch(epoch-1, 0, "node2")
+	coord.ObserveRingEpoch(epoch, checksum, "node2")
+	coord.ObserveRingEpoch(epoch, checksum-1, "node2") // Same epoch, losing checksum
+	coord.ObserveRingEpoch(epoch, 0, "node2")          // Sender without checksums
+	coord.ObserveRingEpoch(0, 0, "node2")              // Sender without epochs
+
+	if stats := coord.GetRingSyncStats(); stats.StaleRequests != 2 || stats.BehindRequests != 0 {
+		t.Errorf("Expected two stale requests, got %+v", stats)
+	}
+}
+
+func TestReplicaWithDifferentRingAtSameEpochIsAdopted(t *testing.T) {
+	coord, fakes := newJoiningCoordinator(t)
+	coord.SetNodeRingState("node1", types.RingReady)
+
+	// node2 reached our next epoch through a different token move, one
+	// that wins the tie on checksum
+	var tokens []uint64
+	for _, vn := range coord.ring.GetRingTokens() {
+		if vn.NodeID == "node1" {
+			tokens = append(tokens, vn.Hash)
+		}
+	}
+	base := coord.ring.Clone()
+	if err := coord.ring.ReassignToken(tokens[0], "node3"); err != nil {
+		t.Fatalf("ReassignToken failed: %v", err)
+	}
+	var peer *ring.Snapshot
+	for _, token := range tokens[1:] {
+		candidate := base.Clone()
+		if err := candidate.ReassignToken(token, "node2"); err != nil {
+			t.Fatalf("ReassignToken failed: %v", err)
+		}
+		if snap := candidate.Snapshot(); snap.Epoch == coord.ring.Epoch() && snap.NewerThan(coord.ring.Version()) {
+			peer = snap
+			break
+		}
+	}
+	if peer == nil {
+		t.Fatal("No move of node1's tokens wins the tie")
+	}
+	fakes[0].snap = peer
+	fakes[1].snap = peer
+
+	if _, err := coord.Put(context.Background(), "key", []byte("v"), types.ConsistencyOptions{Level: types.ConsistencyAll}); err != nil {
+		t.Fatalf("Put failed: %v", err)
+	}
+
+	deadline := time.Now().Add(2 * time.Second)
+	for coord.RingVersion().Checksum != peer.Checksum() && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if got := coord.RingVersion(); got.Epoch != peer.Epoch || got.Checksum != peer.Checksum() {
+		t.Fatalf("Expected ring %d/%x adopted, got %+v", peer.Epoch, peer.Checksum(), got)
+	}
+}
+
+func TestAdoptedRingKeepsLocalNode(t *testing.T) {
+	coord, _ := newJoiningCoordinator(t)
+
+	// A newer ring that has lost node1
+	other := ring.NewHashRing(20)
+	other.AddNode("node2")
+	other.AddNode("node3")
+	for other.Epoch() <= coord.ring.Epoch() {
+		other.RemoveNode("node3")
+		other.AddNode("node3")
+	}
+	snapshot := other.Snapshot()
+
+	if !coord.AdoptRing(snapshot) {
+		t.Fatal("Expected the newer ring to be adopted")
+	}
+	if !coord.ring.HasNode("node1") || coord.ring.Size() != 3 {
+		t.Errorf("Expected node1 back in the ring, got %v", coord.ring.GetAllNodes())
+	}
+	if coord.ring.Epoch() != snapshot.Epoch+1 {
+		t.Errorf("Expected re-adding node1 to advance the epoch to %d, got %d", snapshot.Epoch+1, coord.ring.Epoch())
+	}
+}
+
+func TestAdoptedRingKeepsConcurrentMembers(t *testing.T) {
+	coord, _ := newJoiningCoordinator(t)
+
+	// node2 adds node4 while node1 adds node5
+	peer := coord.ring.Clone()
+	peer.AddNode("node4")
+
+	placed := ring.NewHashRing(20)
+	placed.AddNode("node5")
+	tokens := placed.NodeTokens("node5")
+	coord.RegisterNode(&types.Node{ID: "node5", TokenRing: tokens})
+
+	// node6 left, but this node has not dropped it from its ring yet
+	coord.RegisterNode(&types.Node{ID: "node6", TokenRing: []uint64{1, 2, 3}})
+	coord.SetNodeRingState("node6", types.RingLeft)
+
+	for peer.Epoch() <= coord.ring.Epoch() {
+		peer.SetNodeWeight("node4", float64(peer.Epoch()))
+	}
+	snapshot := peer.Snapshot()
+	if !coord.AdoptRing(snapshot) {
+		t.Fatal("Expected the newer ring to be adopted")
+	}
+
+	if got := sortedTokens(coord.ring.NodeTokens("node4")); !reflect.DeepEqual(got, sortedTokens(peer.NodeTokens("node4"))) {
+		t.Errorf("Expected node4 at its tokens in the adopted ring, got %v", got)
+	}
+	if got := sortedTokens(coord.ring.NodeTokens("node5")); !reflect.DeepEqual(got, sortedTokens(tokens)) {
+		t.Errorf("Expected node5 kept at its tokens, got %v", got)
+	}
+	if coord.ring.HasNode("node6") {
+		t.Error("Expected node6, which left, to be dropped")
+	}
+	if coord.ring.Epoch() != snapshot.Epoch+1 {
+		t.Errorf("Expected keeping node5 to advance the epoch to %d, got %d", snapshot.Epoch+1, coord.ring.Epoch())
+	}
+}
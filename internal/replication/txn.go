@@ -0,0 +1,774 @@
+package replication
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mini-dynamo/mini-dynamo/internal/storage"
+	"github.com/mini-dynamo/mini-dynamo/pkg/types"
+)
+
+// Transaction errors
+var (
+	ErrInvalidTxn  = errors.New("invalid transaction")
+	ErrTxnConflict = errors.New("transaction conflict")
+	ErrTxnAborted  = errors.New("transaction aborted")
+	ErrTxnDecided  = errors.New("transaction already decided")
+)
+
+// Storage prefixes of transaction state. Records are kept by the node
+// coordinating a transaction, intents by every replica that prepared it.
+const (
+	txnRecordPrefix = storage.SystemKeyPrefix + "txn/record/"
+	txnIntentPrefix = storage.SystemKeyPrefix + "txn/intent/"
+)
+
+// txnGroup is the part of a transaction owned by one preference list
+type txnGroup struct {
+	Nodes   []string              `json:"nodes"`
+	Keys    []string              `json:"keys"`    // Keys locked on the group's replicas
+	Entries []types.KeyValueEntry `json:"entries"` // Writes applied on commit
+
+	requirement quorumRequirement
+}
+
+// txnRecord is the coordinator's durable record of a transaction. The
+// transaction commits when its record is persisted as committed; a
+// transaction without a record is presumed aborted.
+type txnRecord struct {
+	ID        string          `json:"id"`
+	Status    types.TxnStatus `json:"status"`
+	Timestamp int64           `json:"timestamp"`
+	Groups    []*txnGroup     `json:"groups"`
+	CreatedAt time.Time       `json:"created_at"`
+}
+
+// txnIntent is a replica's durable record of a prepared transaction
+type txnIntent struct {
+	TxnID       string                `json:"txn_id"`
+	Coordinator string                `json:"coordinator"`
+	Keys        []string              `json:"keys"`
+	Entries     []types.KeyValueEntry `json:"entries"`
+	PreparedAt  time.Time             `json:"prepared_at"`
+}
+
+// TxnCoordinator runs transactions across keys owned by different
+// replica sets with two-phase commit. Every replica of every key involved
+// prepares by persisting an intent that locks the keys; once a quorum of
+// each preference list has prepared and the read set is still current,
+// the coordinator persists its commit decision and tells the replicas to
+// apply the writes. Transactions left in doubt by a failure are resolved
+// in the background once they are older than the timeout.
+//
+// Intents exclude other transactions and client writes: a plain write or
+// batch to a locked key is refused with ErrTxnConflict. Writes are applied
+// at a version taken once the read set is validated, above every version
+// the prepared replicas held of the keys, so no write accepted before the
+// locks can supersede them.
+type TxnCoordinator struct {
+	coord   *Coordinator
+	timeout time.Duration
+
+	mu      sync.Mutex
+	locks   map[string]string    // Key -> ID of the transaction holding an intent on it
+	active  map[string]bool      // Transactions being coordinated by this node
+	decided map[string]time.Time // Transactions decided on this replica -> when
+
+	stopCh chan struct{}
+	wg     sync.WaitGroup
+}
+
+// NewTxnCoordinator creates a transaction coordinator, restoring the locks
+// of transactions prepared on this node before a restart
+func NewTxnCoordinator(coord *Coordinator, timeout time.Duration) *TxnCoordinator {
+	t := &TxnCoordinator{
+		coord:   coord,
+		timeout: timeout,
+		locks:   make(map[string]string),
+		active:  make(map[string]bool),
+		decided: make(map[string]time.Time),
+		stopCh:  make(chan struct{}),
+	}
+	coord.txns = t
+
+	for _, intent := range t.loadIntents() {
+		for _, key := range intent.Keys {
+			t.locks[key] = intent.TxnID
+		}
+	}
+	return t
+}
+
+// Start starts resolving in-doubt transactions in the background
+func (t *TxnCoordinator) Start() {
+	t.wg.Add(1)
+	go t.recoveryLoop()
+}
+
+// Stop stops the recovery loop
+func (t *TxnCoordinator) Stop() {
+	close(t.stopCh)
+	t.wg.Wait()
+}
+
+// Execute runs a transaction that writes ops if every key in reads still
+// has the version the client observed. It returns ErrTxnConflict, with the
+// current versions of changed reads, if the read set is stale or another
+// transaction holds one of the keys, and ErrTxnAborted if a preference
+// list could not reach a quorum.
+func (t *TxnCoordinator) Execute(ctx context.Context, reads []types.TxnRead, ops []types.BatchOperation, opts types.ConsistencyOptions) (*types.TxnResult, error) {
+	c := t.coord
+
+	if err := validateTxn(reads, ops); err != nil {
+		return nil, err
+	}
+
+	if err := c.followSession(opts.MinVersion); err != nil {
+		return nil, err
+	}
+	timestamp := c.clock.Now()
+
+	record, err := t.buildRecord(reads, ops, timestamp, opts)
+	if err != nil {
+		return nil, err
+	}
+	result := &types.TxnResult{ID: record.ID, Status: types.TxnAborted}
+
+	t.mu.Lock()
+	t.active[record.ID] = true
+	t.mu.Unlock()
+	defer func() {
+		t.mu.Lock()
+		delete(t.active, record.ID)
+		t.mu.Unlock()
+	}()
+
+	if err := t.saveRecord(record); err != nil {
+		return nil, err
+	}
+
+	// Phase one: lock the keys on a quorum of every preference list
+	held, err := t.prepare(ctx, record)
+	if err != nil {
+		t.abort(ctx, record)
+		return result, err
+	}
+
+	// Validate the read set while its keys are locked
+	conflicts, err := t.validateReads(ctx, reads, opts)
+	if err != nil || len(conflicts) > 0 {
+		t.abort(ctx, record)
+		if err != nil {
+			return result, fmt.Errorf("%w: %v", ErrTxnAborted, err)
+		}
+		result.Conflicts = conflicts
+		return result, fmt.Errorf("%w: %d read keys changed", ErrTxnConflict, len(conflicts))
+	}
+
+	// The writes must supersede every version the replicas held when they
+	// were locked
+	if err := c.clock.Update(held); err != nil {
+		t.abort(ctx, record)
+		return result, fmt.Errorf("%w: %v", ErrTxnAborted, err)
+	}
+	record.stamp(c.clock.Now())
+
+	// Phase two: the decision is durable once the record says committed
+	record.Status = types.TxnCommitted
+	if err := t.saveRecord(record); err != nil {
+		t.abort(ctx, record)
+		return result, fmt.Errorf("%w: failed to record commit: %v", ErrTxnAborted, err)
+	}
+	t.commit(ctx, record)
+
+	result.Status = types.TxnCommitted
+	result.Timestamp = record.Timestamp
+	return result, nil
+}
+
+// buildRecord groups the keys of a transaction by preference list
+func (t *TxnCoordinator) buildRecord(reads []types.TxnRead, ops []types.BatchOperation, timestamp int64, opts types.ConsistencyOptions) (*txnRecord, error) {
+	c := t.coord
+
+	n, err := c.getReplicaCount(opts)
+	if err != nil {
+		return nil, err
+	}
+
+	record := &txnRecord{
+		ID:        fmt.Sprintf("%s-%d", c.config.NodeID, timestamp),
+		Status:    types.TxnPending,
+		Timestamp: timestamp,
+		CreatedAt: time.Now(),
+	}
+	groups := make(map[string]*txnGroup)
+
+	groupOf := func(key string) (*txnGroup, error) {
+		preferenceList, pending, err := c.writeReplicas(key, n)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get preference list: %w", err)
+		}
+		nodes := append(preferenceList, pending...)
+		id := strings.Join(nodes, ",")
+		if group, exists := groups[id]; exists {
+			return group, nil
+		}
+		requirement, err := c.getWriteQuorum(opts, n, preferenceList)
+		if err != nil {
+			return nil, err
+		}
+		group := &txnGroup{Nodes: nodes, requirement: requirement.withPending(pending)}
+		groups[id] = group
+		record.Groups = append(record.Groups, group)
+		return group, nil
+	}
+
+	locked := make(map[string]bool)
+	for _, op := range ops {
+		group, err := groupOf(op.Key)
+		if err != nil {
+			return nil, err
+		}
+		entry := types.KeyValueEntry{Key: op.Key, Timestamp: timestamp}
+		if op.Op == types.BatchDelete {
+			entry.IsDeleted = true
+		} else {
+			entry.Value = []byte(op.Value)
+		}
+		group.Keys = append(group.Keys, op.Key)
+		group.Entries = append(group.Entries, entry)
+		locked[op.Key] = true
+	}
+	for _, read := range reads {
+		if locked[read.Key] {
+			continue
+		}
+		group, err := groupOf(read.Key)
+		if err != nil {
+			return nil, err
+		}
+		group.Keys = append(group.Keys, read.Key)
+	}
+
+	return record, nil
+}
+
+// stamp sets the version the transaction's writes are applied at
+func (r *txnRecord) stamp(timestamp int64) {
+	r.Timestamp = timestamp
+	for _, group := range r.Groups {
+		for i := range group.Entries {
+			group.Entries[i].Timestamp = timestamp
+		}
+	}
+}
+
+// prepare sends the prepare phase to every group in parallel and returns
+// the newest version the prepared replicas hold of the locked keys
+func (t *TxnCoordinator) prepare(ctx context.Context, record *txnRecord) (int64, error) {
+	var conflict, failed bool
+	var held int64
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+
+	for _, group := range record.Groups {
+		wg.Add(1)
+		go func(group *txnGroup) {
+			defer wg.Done()
+
+			req := types.TxnPrepareRequest{
+				TxnID:       record.ID,
+				Coordinator: t.coord.config.NodeID,
+				Keys:        group.Keys,
+				Entries:     group.Entries,
+			}
+
+			acks := t.coord.writeToNodes(ctx, group.Nodes, group.requirement, func(ctx context.Context, nodeID string) bool {
+				var resp types.TxnPrepareResponse
+				var err error
+				if nodeID == t.coord.config.NodeID {
+					resp.Version, err = t.Prepare(req)
+				} else {
+					err = t.coord.postInternal(ctx, nodeID, "/internal/txn/prepare", req, &resp)
+				}
+				mu.Lock()
+				defer mu.Unlock()
+				if errors.Is(err, ErrTxnConflict) {
+					conflict = true
+				}
+				if err == nil && resp.Version > held {
+					held = resp.Version
+				}
+				return err == nil
+			})
+
+			acked := make([]string, 0, len(acks))
+			for nodeID, success := range acks {
+				if success {
+					acked = append(acked, nodeID)
+				}
+			}
+			if !group.requirement.satisfiedBy(acked, t.coord.datacenterOf) {
+				mu.Lock()
+				failed = true
+				mu.Unlock()
+			}
+		}(group)
+	}
+	wg.Wait()
+
+	// Prepares still outstanding may report in late
+	mu.Lock()
+	defer mu.Unlock()
+	switch {
+	case conflict:
+		return 0, fmt.Errorf("%w: a key is locked by another transaction", ErrTxnConflict)
+	case failed:
+		return 0, fmt.Errorf("%w: prepare did not reach a quorum", ErrTxnAborted)
+	}
+	return held, nil
+}
+
+// validateReads reads every key of the read set at the requested
+// consistency and returns those whose version changed
+func (t *TxnCoordinator) validateReads(ctx context.Context, reads []types.TxnRead, opts types.ConsistencyOptions) ([]types.TxnRead, error) {
+	var conflicts []types.TxnRead
+	for _, read := range reads {
+		var version int64
+		result, err := t.coord.Get(ctx, read.Key, opts)
+		switch {
+		case errors.Is(err, ErrNotFound):
+		case err != nil:
+			return nil, err
+		default:
+			version = result.Timestamp
+		}
+		if version != read.Version {
+			conflicts = append(conflicts, types.TxnRead{Key: read.Key, Version: version})
+		}
+	}
+	return conflicts, nil
+}
+
+// commit tells every replica to apply the transaction's writes. The record
+// is deleted once all of them have, and otherwise kept so the recovery
+// loop retries.
+func (t *TxnCoordinator) commit(ctx context.Context, record *txnRecord) {
+	if t.decide(ctx, record, true) {
+		t.deleteRecord(record.ID)
+	}
+}
+
+// abort tells every replica to release the transaction's intents and
+// deletes its record
+func (t *TxnCoordinator) abort(ctx context.Context, record *txnRecord) {
+	t.decide(ctx, record, false)
+	t.deleteRecord(record.ID)
+}
+
+// decide sends a decision to every replica of every group and reports
+// whether all of them acknowledged it
+func (t *TxnCoordinator) decide(ctx context.Context, record *txnRecord, commit bool) bool {
+	complete := true
+	for _, group := range record.Groups {
+		req := types.TxnDecisionRequest{TxnID: record.ID, Commit: commit}
+		if commit {
+			req.Entries = group.Entries
+		}
+
+		all := quorumRequirement{Total: len(group.Nodes)}
+		acks := t.coord.writeToNodes(ctx, group.Nodes, all, func(ctx context.Context, nodeID string) bool {
+			if nodeID == t.coord.config.NodeID {
+				return t.Decide(req) == nil
+			}
+			return t.coord.postInternal(ctx, nodeID, "/internal/txn/decide", req, nil) == nil
+		})
+		for _, nodeID := range group.Nodes {
+			if !acks[nodeID] {
+				complete = false
+			}
+		}
+	}
+	return complete
+}
+
+// Prepare locks the keys of a transaction on this replica and persists its
+// intent. It returns the newest version held of the keys, ErrTxnConflict if
+// another transaction holds a key, or ErrTxnDecided if the transaction was
+// already decided here: the coordinator stops waiting once a quorum has
+// prepared, so a prepare can arrive after the decision, and its locks
+// would never be released.
+func (t *TxnCoordinator) Prepare(req types.TxnPrepareRequest) (int64, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if _, decided := t.decided[req.TxnID]; decided {
+		return 0, fmt.Errorf("%w: %s", ErrTxnDecided, req.TxnID)
+	}
+
+	var held int64
+	for _, key := range req.Keys {
+		if holder, locked := t.locks[key]; locked && holder != req.TxnID {
+			return 0, fmt.Errorf("%w: key %s is locked by %s", ErrTxnConflict, key, holder)
+		}
+		if timestamp, exists := t.coord.storage.Timestamp(key); exists && timestamp > held {
+			held = timestamp
+		}
+	}
+
+	intent := txnIntent{
+		TxnID:       req.TxnID,
+		Coordinator: req.Coordinator,
+		Keys:        req.Keys,
+		Entries:     req.Entries,
+		PreparedAt:  time.Now(),
+	}
+	data, err := json.Marshal(intent)
+	if err != nil {
+		return 0, err
+	}
+	if err := t.coord.storage.Put(txnIntentPrefix+req.TxnID, data, t.coord.clock.Now()); err != nil {
+		return 0, err
+	}
+
+	for _, key := range req.Keys {
+		t.locks[key] = req.TxnID
+	}
+	return held, nil
+}
+
+// Decide applies the outcome of a transaction on this replica: on commit
+// its writes are applied atomically, then its intent is released
+func (t *TxnCoordinator) Decide(req types.TxnDecisionRequest) error {
+	if req.Commit && len(req.Entries) > 0 {
+		if err := t.coord.ApplyBatch(req.Entries); err != nil {
+			return err
+		}
+	}
+	return t.release(req.TxnID)
+}
+
+// Status returns the status of a transaction coordinated by this node and,
+// once it has committed, the version its writes are applied at. A
+// transaction without a record is presumed aborted.
+func (t *TxnCoordinator) Status(txnID string) (types.TxnStatus, int64) {
+	record, err := t.loadRecord(txnID)
+	if err != nil {
+		return types.TxnAborted, 0
+	}
+	if record.Status != types.TxnCommitted {
+		return record.Status, 0
+	}
+	return record.Status, record.Timestamp
+}
+
+// lockedKey returns a key of the entries locked by a transaction on this
+// replica, and the transaction holding it. The caller must hold t.mu.
+func (t *TxnCoordinator) lockedKey(entries []types.KeyValueEntry) (string, string, bool) {
+	for _, entry := range entries {
+		if holder, locked := t.locks[entry.Key]; locked {
+			return entry.Key, holder, true
+		}
+	}
+	return "", "", false
+}
+
+// txnLock returns the transaction locking a key on this replica, if any
+func (c *Coordinator) txnLock(key string) (string, bool) {
+	t := c.txns
+	if t == nil {
+		return "", false
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	holder, locked := t.locks[key]
+	return holder, locked
+}
+
+// ApplyClientWrite applies the entries of a client write on this replica,
+// atomically if there are several. It returns ErrTxnConflict without
+// applying anything if a transaction locks one of the keys; no transaction
+// can lock them while the write is applied.
+func (c *Coordinator) ApplyClientWrite(entries []types.KeyValueEntry) error {
+	if t := c.txns; t != nil {
+		t.mu.Lock()
+		defer t.mu.Unlock()
+		if key, holder, locked := t.lockedKey(entries); locked {
+			return fmt.Errorf("%w: key %s is locked by transaction %s", ErrTxnConflict, key, holder)
+		}
+	}
+
+	if len(entries) == 1 {
+		_, err := c.ApplyEntry(entries[0])
+		return err
+	}
+	return c.ApplyBatch(entries)
+}
+
+// release deletes a transaction's intent, unlocks its keys and remembers
+// the transaction as decided. A prepare is sent before the decision and
+// gives up after the request timeout, so older decisions are forgotten.
+func (t *TxnCoordinator) release(txnID string) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	now := time.Now()
+	for id, at := range t.decided {
+		if now.Sub(at) > t.coord.config.RequestTimeout {
+			delete(t.decided, id)
+		}
+	}
+	t.decided[txnID] = now
+
+	for key, holder := range t.locks {
+		if holder == txnID {
+			delete(t.locks, key)
+		}
+	}
+
+	if !t.coord.storage.Has(txnIntentPrefix + txnID) {
+		return nil
+	}
+	return t.coord.storage.Delete(txnIntentPrefix+txnID, t.coord.clock.Now())
+}
+
+// recoveryLoop periodically resolves in-doubt transactions
+func (t *TxnCoordinator) recoveryLoop() {
+	defer t.wg.Done()
+
+	t.Recover(context.Background())
+
+	ticker := time.NewTicker(t.timeout)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-t.stopCh:
+			return
+		case <-ticker.C:
+			t.Recover(context.Background())
+		}
+	}
+}
+
+// Recover resolves transactions older than the timeout. Records of
+// transactions this node was coordinating when it failed are finished:
+// pending ones are aborted and committed ones are committed again.
+// Intents left on this replica are resolved by asking their coordinator.
+func (t *TxnCoordinator) Recover(ctx context.Context) {
+	for _, record := range t.loadRecords() {
+		t.mu.Lock()
+		active := t.active[record.ID]
+		t.mu.Unlock()
+		if active || time.Since(record.CreatedAt) < t.timeout {
+			continue
+		}
+
+		log.Printf("Recovering %s transaction %s", record.Status, record.ID)
+		if record.Status == types.TxnCommitted {
+			t.commit(ctx, record)
+		} else {
+			t.abort(ctx, record)
+		}
+	}
+
+	for _, intent := range t.loadIntents() {
+		if time.Since(intent.PreparedAt) < t.timeout {
+			continue
+		}
+
+		status, err := t.coordinatorStatus(ctx, intent)
+		if err != nil {
+			log.Printf("Transaction %s is in doubt: %v", intent.TxnID, err)
+			continue
+		}
+		if status.Status == types.TxnPending {
+			continue
+		}
+
+		log.Printf("Resolving in-doubt transaction %s as %s", intent.TxnID, status.Status)
+		req := types.TxnDecisionRequest{TxnID: intent.TxnID, Commit: status.Status == types.TxnCommitted}
+		if req.Commit {
+			req.Entries = intent.Entries
+			for i := range req.Entries {
+				req.Entries[i].Timestamp = status.Timestamp
+			}
+		}
+		if err := t.Decide(req); err != nil {
+			log.Printf("Failed to resolve transaction %s: %v", intent.TxnID, err)
+		}
+	}
+}
+
+// coordinatorStatus asks the coordinator of an intent for its status
+func (t *TxnCoordinator) coordinatorStatus(ctx context.Context, intent txnIntent) (types.TxnStatusResponse, error) {
+	if intent.Coordinator == t.coord.config.NodeID {
+		status, timestamp := t.Status(intent.TxnID)
+		return types.TxnStatusResponse{TxnID: intent.TxnID, Status: status, Timestamp: timestamp}, nil
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, t.coord.config.RequestTimeout)
+	defer cancel()
+
+	var resp types.TxnStatusResponse
+	req := types.TxnStatusRequest{TxnID: intent.TxnID}
+	if err := t.coord.postInternal(ctx, intent.Coordinator, "/internal/txn/status", req, &resp); err != nil {
+		return resp, err
+	}
+	if resp.Status == types.TxnCommitted && resp.Timestamp == 0 {
+		return resp, fmt.Errorf("coordinator %s reported no commit version", intent.Coordinator)
+	}
+	return resp, nil
+}
+
+// saveRecord persists a transaction record
+func (t *TxnCoordinator) saveRecord(record *txnRecord) error {
+	data, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+	return t.coord.storage.Put(txnRecordPrefix+record.ID, data, t.coord.clock.Now())
+}
+
+// loadRecord reads a transaction record
+func (t *TxnCoordinator) loadRecord(txnID string) (*txnRecord, error) {
+	data, _, err := t.coord.storage.Get(txnRecordPrefix + txnID)
+	if err != nil {
+		return nil, err
+	}
+	var record txnRecord
+	if err := json.Unmarshal(data, &record); err != nil {
+		return nil, err
+	}
+	return &record, nil
+}
+
+// deleteRecord deletes a transaction record
+func (t *TxnCoordinator) deleteRecord(txnID string) {
+	if err := t.coord.storage.Delete(txnRecordPrefix+txnID, t.coord.clock.Now()); err != nil {
+		log.Printf("Failed to delete transaction record %s: %v", txnID, err)
+	}
+}
+
+// loadRecords reads every transaction record on this node
+func (t *TxnCoordinator) loadRecords() []*txnRecord {
+	var records []*txnRecord
+	for _, key := range t.coord.storage.Keys() {
+		if !strings.HasPrefix(key, txnRecordPrefix) {
+			continue
+		}
+		record, err := t.loadRecord(strings.TrimPrefix(key, txnRecordPrefix))
+		if err != nil {
+			log.Printf("Failed to load transaction record %s: %v", key, err)
+			continue
+		}
+		records = append(records, record)
+	}
+	return records
+}
+
+// loadIntents reads every transaction intent on this replica
+func (t *TxnCoordinator) loadIntents() []txnIntent {
+	var intents []txnIntent
+	for _, key := range t.coord.storage.Keys() {
+		if !strings.HasPrefix(key, txnIntentPrefix) {
+			continue
+		}
+		data, _, err := t.coord.storage.Get(key)
+		if err != nil {
+			continue
+		}
+		var intent txnIntent
+		if err := json.Unmarshal(data, &intent); err != nil {
+			log.Printf("Failed to load transaction intent %s: %v", key, err)
+			continue
+		}
+		intents = append(intents, intent)
+	}
+	return intents
+}
+
+// validateTxn checks the read and write sets of a transaction
+func validateTxn(reads []types.TxnRead, ops []types.BatchOperation) error {
+	if err := validateOperations(ops, ErrInvalidTxn); err != nil {
+		return err
+	}
+
+	seen := make(map[string]bool, len(reads))
+	for i, read := range reads {
+		switch {
+		case read.Key == "":
+			return fmt.Errorf("%w: read %d has no key", ErrInvalidTxn, i)
+		case strings.HasPrefix(read.Key, storage.SystemKeyPrefix):
+			return fmt.Errorf("%w: keys starting with %s are reserved", ErrInvalidTxn, storage.SystemKeyPrefix)
+		case seen[read.Key]:
+			return fmt.Errorf("%w: key %s is read more than once", ErrInvalidTxn, read.Key)
+		}
+		seen[read.Key] = true
+	}
+	return nil
+}
+
+// postInternal sends a JSON request to an internal endpoint of a node and
+// decodes the response into resp unless it is nil. A 409 response is
+// reported as ErrTxnConflict.
+func (c *Coordinator) postInternal(ctx context.Context, nodeID, path string, req, resp interface{}) error {
+	body, _ := json.Marshal(req)
+	return c.callInternal(ctx, "POST", nodeID, path, body, resp)
+}
+
+// getInternal reads an internal endpoint of a node into resp
+func (c *Coordinator) getInternal(ctx context.Context, nodeID, path string, resp interface{}) error {
+	return c.callInternal(ctx, "GET", nodeID, path, nil, resp)
+}
+
+// callInternal sends a request to an internal endpoint of a node
+func (c *Coordinator) callInternal(ctx context.Context, method, nodeID, path string, body []byte, resp interface{}) error {
+	c.nodesMu.RLock()
+	node, exists := c.nodes[nodeID]
+	c.nodesMu.RUnlock()
+
+	if !exists {
+		return fmt.Errorf("node %s not found", nodeID)
+	}
+
+	if err := c.simulateInterDCLatency(ctx, nodeID); err != nil {
+		return err
+	}
+
+	url := fmt.Sprintf("http://%s:%d%s", node.Address, node.Port, path)
+	httpReq, err := http.NewRequestWithContext(ctx, method, url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	if body != nil {
+		httpReq.Header.Set("Content-Type", "application/json")
+	}
+
+	httpResp, err := c.httpClient.Do(httpReq)
+	if err != nil {
+		return err
+	}
+	defer httpResp.Body.Close()
+
+	switch httpResp.StatusCode {
+	case http.StatusOK:
+	case http.StatusConflict:
+		return fmt.Errorf("%w: rejected by %s", ErrTxnConflict, nodeID)
+	default:
+		return fmt.Errorf("node %s returned status %d", nodeID, httpResp.StatusCode)
+	}
+
+	if resp == nil {
+		return nil
+	}
+	return json.NewDecoder(httpResp.Body).Decode(resp)
+}
@@ -0,0 +1,265 @@
+package replication
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mini-dynamo/mini-dynamo/pkg/types"
+)
+
+// txnState returns the transaction records and intents left in storage
+func txnState(t *TxnCoordinator) []string {
+	var keys []string
+	for _, key := range t.coord.storage.Keys() {
+		if strings.HasPrefix(key, txnRecordPrefix) || strings.HasPrefix(key, txnIntentPrefix) {
+			keys = append(keys, key)
+		}
+	}
+	return keys
+}
+
+func TestTxnCommitsAcrossPreferenceLists(t *testing.T) {
+	coord, fakes := newMultiDCCoordinator(t, 0)
+	txns := NewTxnCoordinator(coord, time.Minute)
+	opts := types.ConsistencyOptions{N: 2, Level: types.ConsistencyAll}
+
+	var ops []types.BatchOperation
+	for i := 0; i < 10; i++ {
+		ops = append(ops, types.BatchOperation{Op: types.BatchPut, Key: fmt.Sprintf("key%d", i), Value: "v"})
+	}
+
+	result, err := txns.Execute(context.Background(), nil, ops, opts)
+	if err != nil {
+		t.Fatalf("Transaction failed: %v", err)
+	}
+	if result.Status != types.TxnCommitted {
+		t.Fatalf("Expected committed, got %s", result.Status)
+	}
+
+	// Every replica of every key applied the write
+	for _, op := range ops {
+		nodes, _ := coord.ring.GetNodes(op.Key, 2)
+		for _, nodeID := range nodes {
+			var found bool
+			if nodeID == "node1" {
+				_, ts, err := coord.storage.Get(op.Key)
+				found = err == nil && ts == result.Timestamp
+			} else {
+				f := fakes[map[string]int{"node2": 0, "node3": 1, "node4": 2}[nodeID]]
+				f.mu.Lock()
+				found = f.entries[op.Key].Timestamp == result.Timestamp
+				f.mu.Unlock()
+			}
+			if !found {
+				t.Errorf("Key %s missing on %s", op.Key, nodeID)
+			}
+		}
+	}
+
+	if left := txnState(txns); len(left) > 0 {
+		t.Errorf("Expected no transaction state after commit, got %v", left)
+	}
+}
+
+func TestTxnValidatesReadSet(t *testing.T) {
+	coord, _ := newTestCoordinator(t)
+	txns := NewTxnCoordinator(coord, time.Minute)
+	ctx := context.Background()
+
+	put, _ := coord.Put(ctx, "alice", []byte("100"), types.ConsistencyOptions{})
+	transfer := []types.BatchOperation{
+		{Op: types.BatchPut, Key: "alice", Value: "50"},
+		{Op: types.BatchPut, Key: "bob", Value: "50"},
+	}
+
+	// A stale read of alice and a read of bob as absent
+	stale := []types.TxnRead{{Key: "alice", Version: put.Timestamp - 1}, {Key: "bob"}}
+	result, err := txns.Execute(ctx, stale, transfer, types.ConsistencyOptions{})
+	if !errors.Is(err, ErrTxnConflict) {
+		t.Fatalf("Expected ErrTxnConflict, got %v", err)
+	}
+	if len(result.Conflicts) != 1 || result.Conflicts[0].Key != "alice" || result.Conflicts[0].Version != put.Timestamp {
+		t.Errorf("Expected alice to conflict at %d, got %+v", put.Timestamp, result.Conflicts)
+	}
+	if value, _, _ := coord.storage.Get("alice"); string(value) != "100" {
+		t.Errorf("Aborted transaction changed alice to %s", value)
+	}
+	if coord.storage.Has("bob") {
+		t.Error("Aborted transaction wrote bob")
+	}
+	if len(txns.locks) != 0 || len(txnState(txns)) != 0 {
+		t.Errorf("Expected abort to release everything, got locks %v state %v", txns.locks, txnState(txns))
+	}
+
+	current := []types.TxnRead{{Key: "alice", Version: put.Timestamp}, {Key: "bob"}}
+	result, err = txns.Execute(ctx, current, transfer, types.ConsistencyOptions{})
+	if err != nil || result.Status != types.TxnCommitted {
+		t.Fatalf("Expected commit, got %v %+v", err, result)
+	}
+	if value, _, _ := coord.storage.Get("bob"); string(value) != "50" {
+		t.Errorf("Expected bob = 50, got %s", value)
+	}
+}
+
+func TestTxnConflictsWithPreparedTransaction(t *testing.T) {
+	coord, _ := newTestCoordinator(t)
+	txns := NewTxnCoordinator(coord, time.Minute)
+
+	txns.Prepare(types.TxnPrepareRequest{TxnID: "other", Coordinator: "node1", Keys: []string{"a"}})
+
+	ops := []types.BatchOperation{{Op: types.BatchPut, Key: "a", Value: "1"}, {Op: types.BatchPut, Key: "b", Value: "1"}}
+	if _, err := txns.Execute(context.Background(), nil, ops, types.ConsistencyOptions{}); !errors.Is(err, ErrTxnConflict) {
+		t.Fatalf("Expected ErrTxnConflict, got %v", err)
+	}
+	if len(txns.locks) != 1 || txns.locks["a"] != "other" {
+		t.Errorf("Expected only the other transaction's lock, got %v", txns.locks)
+	}
+}
+
+func TestTxnRecoversInDoubtTransactions(t *testing.T) {
+	coord, store := newTestCoordinator(t)
+	txns := NewTxnCoordinator(coord, time.Millisecond)
+	opts := types.ConsistencyOptions{}
+
+	// The coordinator failed after deciding to commit one transaction and
+	// while preparing another
+	prepare := func(key string, status types.TxnStatus) {
+		ops := []types.BatchOperation{{Op: types.BatchPut, Key: key, Value: "v"}}
+		record, err := txns.buildRecord(nil, ops, coord.clock.Now(), opts)
+		if err != nil {
+			t.Fatalf("Failed to build record: %v", err)
+		}
+		record.Status = status
+		txns.saveRecord(record)
+		group := record.Groups[0]
+		txns.Prepare(types.TxnPrepareRequest{TxnID: record.ID, Coordinator: "node1", Keys: group.Keys, Entries: group.Entries})
+	}
+	prepare("committed", types.TxnCommitted)
+	prepare("pending", types.TxnPending)
+
+	// After a restart the intents still lock their keys
+	recovered := NewTxnCoordinator(coord, time.Millisecond)
+	if len(recovered.locks) != 2 {
+		t.Fatalf("Expected 2 restored locks, got %v", recovered.locks)
+	}
+
+	time.Sleep(5 * time.Millisecond)
+	recovered.Recover(context.Background())
+
+	if !store.Has("committed") {
+		t.Error("Committed transaction was not applied")
+	}
+	if store.Has("pending") {
+		t.Error("Pending transaction was applied")
+	}
+	if len(recovered.locks) != 0 || len(txnState(recovered)) != 0 {
+		t.Errorf("Expected recovery to resolve everything, got locks %v state %v", recovered.locks, txnState(recovered))
+	}
+}
+
+func TestTxnLocksRefuseClientWrites(t *testing.T) {
+	coord, store := newTestCoordinator(t)
+	txns := NewTxnCoordinator(coord, time.Minute)
+	ctx := context.Background()
+
+	if _, err := txns.Prepare(types.TxnPrepareRequest{TxnID: "transfer", Coordinator: "node1", Keys: []string{"alice"}}); err != nil {
+		t.Fatalf("Prepare failed: %v", err)
+	}
+
+	// A write landing between validation and commit would otherwise win
+	// over the transaction's write to the same key
+	if _, err := coord.Put(ctx, "alice", []byte("0"), types.ConsistencyOptions{}); !errors.Is(err, ErrTxnConflict) {
+		t.Errorf("Expected a put to a locked key to fail with ErrTxnConflict, got %v", err)
+	}
+	ops := []types.BatchOperation{{Op: types.BatchPut, Key: "alice", Value: "0"}}
+	result, err := coord.Batch(ctx, ops, types.ConsistencyOptions{})
+	if err != nil || result.Failed() != 1 || !strings.Contains(result.Results[0].Error, "locked") {
+		t.Errorf("Expected the batch to be refused for a locked key, got %+v (%v)", result, err)
+	}
+	if _, err := coord.CompareAndSet(ctx, "alice", []byte("0"), types.CASCondition{}, types.ConsistencyOptions{}); !errors.Is(err, ErrTxnConflict) {
+		t.Errorf("Expected a compare-and-set on a locked key to fail with ErrTxnConflict, got %v", err)
+	}
+	if store.Has("alice") {
+		t.Error("Refused writes reached storage")
+	}
+	store.Put("alice", []byte("100"), coord.clock.Now())
+	if _, err := coord.Delete(ctx, "alice", types.ConsistencyOptions{}); !errors.Is(err, ErrTxnConflict) {
+		t.Errorf("Expected a delete of a locked key to fail with ErrTxnConflict, got %v", err)
+	}
+	if !store.Has("alice") {
+		t.Error("Refused delete reached storage")
+	}
+
+	// An accepted proposal cannot be committed over the lock either
+	entry := types.KeyValueEntry{Key: "alice", Value: []byte("0"), Timestamp: coord.clock.Now()}
+	resp, err := coord.HandlePaxos(paxosCommit, types.PaxosRequest{Key: "alice", Ballot: types.Ballot{Timestamp: entry.Timestamp, NodeID: "node2"}, Entry: &entry})
+	if err != nil || resp.OK || !resp.Locked {
+		t.Errorf("Expected the commit to be refused as locked, got %+v (%v)", resp, err)
+	}
+	if value, _, _ := store.Get("alice"); string(value) != "100" {
+		t.Errorf("Expected alice to stay 100, got %s", value)
+	}
+
+	// Unrelated keys are not affected, and the key is writable once the
+	// transaction is decided
+	if _, err := coord.Put(ctx, "bob", []byte("0"), types.ConsistencyOptions{}); err != nil {
+		t.Errorf("Put to an unlocked key failed: %v", err)
+	}
+	txns.Decide(types.TxnDecisionRequest{TxnID: "transfer"})
+	if _, err := coord.Put(ctx, "alice", []byte("0"), types.ConsistencyOptions{}); err != nil {
+		t.Errorf("Put after the transaction released the key failed: %v", err)
+	}
+	if _, err := coord.Delete(ctx, "alice", types.ConsistencyOptions{}); err != nil || store.Has("alice") {
+		t.Errorf("Delete after the transaction released the key failed: %v", err)
+	}
+}
+
+func TestTxnCommitsAboveHeldVersions(t *testing.T) {
+	coord, store := newTestCoordinator(t)
+	txns := NewTxnCoordinator(coord, time.Minute)
+
+	// A write coordinated by a node whose clock runs ahead
+	ahead := coord.clock.Now() + int64(time.Second)
+	store.Put("alice", []byte("100"), ahead)
+
+	ops := []types.BatchOperation{{Op: types.BatchPut, Key: "alice", Value: "50"}}
+	result, err := txns.Execute(context.Background(), nil, ops, types.ConsistencyOptions{})
+	if err != nil {
+		t.Fatalf("Transaction failed: %v", err)
+	}
+	if result.Timestamp <= ahead {
+		t.Errorf("Expected a commit version above %d, got %d", ahead, result.Timestamp)
+	}
+	if value, ts, _ := store.Get("alice"); string(value) != "50" || ts != result.Timestamp {
+		t.Errorf("Expected alice = 50 @%d, got %s @%d", result.Timestamp, value, ts)
+	}
+}
+
+func TestTxnRefusesPrepareAfterDecision(t *testing.T) {
+	coord, _ := newTestCoordinator(t)
+	txns := NewTxnCoordinator(coord, time.Minute)
+	ctx := context.Background()
+
+	// The coordinator decided once a quorum prepared; this replica's
+	// prepare was still in flight and arrives after the decision
+	txns.Decide(types.TxnDecisionRequest{TxnID: "transfer", Commit: true})
+	req := types.TxnPrepareRequest{TxnID: "transfer", Coordinator: "node2", Keys: []string{"alice"}}
+	if _, err := txns.Prepare(req); !errors.Is(err, ErrTxnDecided) {
+		t.Fatalf("Expected ErrTxnDecided, got %v", err)
+	}
+	if len(txns.locks) != 0 || len(txnState(txns)) != 0 {
+		t.Errorf("Expected no lock or intent, got locks %v state %v", txns.locks, txnState(txns))
+	}
+	if _, err := coord.Put(ctx, "alice", []byte("0"), types.ConsistencyOptions{}); err != nil {
+		t.Errorf("Put after a late prepare failed: %v", err)
+	}
+
+	// Other transactions still prepare
+	if _, err := txns.Prepare(types.TxnPrepareRequest{TxnID: "other", Coordinator: "node2", Keys: []string{"alice"}}); err != nil {
+		t.Errorf("Prepare of another transaction failed: %v", err)
+	}
+}
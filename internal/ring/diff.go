@@ -0,0 +1,210 @@
+package ring
+
+import (
+	"math"
+	"sort"
+	"strings"
+)
+
+// RangeMove is a token range whose replicas differ between two rings
+type RangeMove struct {
+	StartToken uint64   `json:"start_token"`
+	EndToken   uint64   `json:"end_token"`
+	Before     []string `json:"before"` // Replicas in the old ring
+	After      []string `json:"after"`  // Replicas in the new ring
+}
+
+// Range returns the moved token range
+func (m RangeMove) Range() TokenRange {
+	return TokenRange{StartToken: m.StartToken, EndToken: m.EndToken}
+}
+
+// NodeDiff lists the ranges a node starts and stops replicating
+type NodeDiff struct {
+	NodeID      string       `json:"node_id"`
+	Gained      []TokenRange `json:"gained,omitempty"`
+	Lost        []TokenRange `json:"lost,omitempty"`
+	GainedShare float64      `json:"gained_share"` // Fraction of the token space gained
+	LostShare   float64      `json:"lost_share"`
+}
+
+// RingDiff is how replica ownership changes between two ring states
+type RingDiff struct {
+	FromEpoch uint64      `json:"from_epoch"`
+	ToEpoch   uint64      `json:"to_epoch"`
+	Replicas  int         `json:"replicas"`
+	Moves     []RangeMove `json:"moves"`
+	Nodes     []NodeDiff  `json:"nodes"` // Sorted by node ID, only nodes that gain or lose ranges
+}
+
+// Empty reports whether no range changes replicas
+func (d *RingDiff) Empty() bool {
+	return len(d.Moves) == 0
+}
+
+// Node returns the ranges one node gains and loses
+func (d *RingDiff) Node(nodeID string) NodeDiff {
+	for _, n := range d.Nodes {
+		if n.NodeID == nodeID {
+			return n
+		}
+	}
+	return NodeDiff{NodeID: nodeID}
+}
+
+// Diff compares the preference lists of two rings for the given number of
+// replicas. Ranges are split at the tokens of both rings and adjacent
+// ranges with the same change are merged.
+func Diff(from, to *HashRing, replicas int) *RingDiff {
+	d := &RingDiff{FromEpoch: from.Epoch(), ToEpoch: to.Epoch(), Replicas: replicas, Moves: make([]RangeMove, 0)}
+
+	for _, tr := range tokenBoundaries(from, to) {
+		before, _ := from.GetNodesForToken(tr.EndToken, replicas, nil)
+		after, _ := to.GetNodesForToken(tr.EndToken, replicas, nil)
+		if sameNodes(before, after) {
+			continue
+		}
+
+		if n := len(d.Moves); n > 0 {
+			last := &d.Moves[n-1]
+			if last.EndToken+1 == tr.StartToken && sameList(last.Before, before) && sameList(last.After, after) {
+				last.EndToken = tr.EndToken
+				continue
+			}
+		}
+		d.Moves = append(d.Moves, RangeMove{StartToken: tr.StartToken, EndToken: tr.EndToken, Before: before, After: after})
+	}
+
+	nodes := make(map[string]*NodeDiff)
+	node := func(id string) *NodeDiff {
+		if nodes[id] == nil {
+			nodes[id] = &NodeDiff{NodeID: id}
+		}
+		return nodes[id]
+	}
+	for _, m := range d.Moves {
+		for _, id := range m.After {
+			if !contains(m.Before, id) {
+				n := node(id)
+				n.Gained = appendRange(n.Gained, TokenRange{StartToken: m.StartToken, EndToken: m.EndToken, NodeID: id})
+				n.GainedShare += m.Range().Size() / math.Pow(2, 64)
+			}
+		}
+		for _, id := range m.Before {
+			if !contains(m.After, id) {
+				n := node(id)
+				n.Lost = appendRange(n.Lost, TokenRange{StartToken: m.StartToken, EndToken: m.EndToken, NodeID: id})
+				n.LostShare += m.Range().Size() / math.Pow(2, 64)
+			}
+		}
+	}
+
+	d.Nodes = make([]NodeDiff, 0, len(nodes))
+	for _, n := range nodes {
+		d.Nodes = append(d.Nodes, *n)
+	}
+	sort.Slice(d.Nodes, func(i, j int) bool { return d.Nodes[i].NodeID < d.Nodes[j].NodeID })
+	return d
+}
+
+// subscriber receives the diff of every ownership change
+type subscriber struct {
+	replicas int
+	fn       func(*RingDiff)
+}
+
+// Subscribe calls fn with the diff of every later ownership change,
+// computed for the given number of replicas. Calls are made one at a
+// time after the change is applied; changes made while one is running
+// may arrive together in one diff. fn must not change the ring.
+func (r *HashRing) Subscribe(replicas int, fn func(*RingDiff)) {
+	r.notifyMu.Lock()
+	defer r.notifyMu.Unlock()
+
+	if r.published == nil {
+		r.published = r.Clone()
+	}
+	r.subscribers = append(r.subscribers, subscriber{replicas: replicas, fn: fn})
+}
+
+// notify sends subscribers the diff between the ring they last saw and the
+// current one. The caller must not hold mu.
+func (r *HashRing) notify() {
+	r.notifyMu.Lock()
+	defer r.notifyMu.Unlock()
+
+	if len(r.subscribers) == 0 {
+		return
+	}
+	epoch, checksum := r.Version()
+	if e, c := r.published.Version(); e == epoch && c == checksum {
+		return
+	}
+
+	current := r.Clone()
+	for _, s := range r.subscribers {
+		s.fn(Diff(r.published, current, s.replicas))
+	}
+	r.published = current
+}
+
+// tokenBoundaries returns the token ranges delimited by the virtual nodes
+// of either ring
+func tokenBoundaries(a, b *HashRing) []TokenRange {
+	seen := make(map[uint64]bool)
+	var tokens []uint64
+	for _, r := range []*HashRing{a, b} {
+		for _, vn := range r.GetRingTokens() {
+			if !seen[vn.Hash] {
+				seen[vn.Hash] = true
+				tokens = append(tokens, vn.Hash)
+			}
+		}
+	}
+	sort.Slice(tokens, func(i, j int) bool { return tokens[i] < tokens[j] })
+
+	ranges := make([]TokenRange, len(tokens))
+	for i, token := range tokens {
+		prev := tokens[(i+len(tokens)-1)%len(tokens)]
+		ranges[i] = TokenRange{StartToken: prev + 1, EndToken: token}
+	}
+	return ranges
+}
+
+// appendRange adds a range, extending the last one if they are adjacent
+func appendRange(ranges []TokenRange, tr TokenRange) []TokenRange {
+	if n := len(ranges); n > 0 && ranges[n-1].EndToken+1 == tr.StartToken {
+		ranges[n-1].EndToken = tr.EndToken
+		return ranges
+	}
+	return append(ranges, tr)
+}
+
+// sameNodes reports whether two preference lists hold the same nodes,
+// in any order
+func sameNodes(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for _, id := range a {
+		if !contains(b, id) {
+			return false
+		}
+	}
+	return true
+}
+
+// sameList reports whether two preference lists are identical
+func sameList(a, b []string) bool {
+	return strings.Join(a, ",") == strings.Join(b, ",")
+}
+
+// contains reports whether a node is in a list
+func contains(nodes []string, nodeID string) bool {
+	for _, id := range nodes {
+		if id == nodeID {
+			return true
+		}
+	}
+	return false
+}
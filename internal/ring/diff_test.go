@@ -0,0 +1,89 @@
+package ring
+
+import (
+	"fmt"
+	"math"
+	"testing"
+)
+
+func TestDiffAddNode(t *testing.T) {
+	before := NewHashRing(50)
+	before.AddNode("node1")
+	before.AddNode("node2")
+	before.AddNode("node3")
+
+	after := before.Clone()
+	after.AddNode("node4")
+
+	diff := Diff(before, after, 2)
+	if diff.Empty() || diff.FromEpoch != 3 || diff.ToEpoch != 4 {
+		t.Fatalf("Unexpected diff header: epochs %d -> %d, %d moves", diff.FromEpoch, diff.ToEpoch, len(diff.Moves))
+	}
+
+	// The new node gains what the others lose, about 2/4 of the ring
+	gained := diff.Node("node4")
+	if len(gained.Lost) != 0 || gained.GainedShare < 0.4 || gained.GainedShare > 0.6 {
+		t.Errorf("Expected node4 to gain about half the ring, got %.3f (lost %d ranges)", gained.GainedShare, len(gained.Lost))
+	}
+	lost := 0.0
+	for _, n := range diff.Nodes {
+		if n.NodeID != "node4" {
+			lost += n.LostShare
+			if len(n.Gained) != 0 {
+				t.Errorf("Existing node %s gained ranges", n.NodeID)
+			}
+		}
+	}
+	if math.Abs(lost-gained.GainedShare) > 1e-9 {
+		t.Errorf("Other nodes lost %.6f, node4 gained %.6f", lost, gained.GainedShare)
+	}
+
+	// Every key whose replicas changed falls in a move with the right lists
+	for i := 0; i < 1000; i++ {
+		key := fmt.Sprintf("key%d", i)
+		old, _ := before.GetNodes(key, 2)
+		now, _ := after.GetNodes(key, 2)
+		token := after.KeyToken(key)
+
+		var move *RangeMove
+		for j := range diff.Moves {
+			if diff.Moves[j].Range().Contains(token) {
+				move = &diff.Moves[j]
+			}
+		}
+		if sameNodes(old, now) != (move == nil) {
+			t.Fatalf("Key %s moved from %v to %v, diff has %+v", key, old, now, move)
+		}
+		if move != nil && (!sameList(move.Before, old) || !sameList(move.After, now)) {
+			t.Errorf("Key %s moved from %v to %v, diff says %v to %v", key, old, now, move.Before, move.After)
+		}
+	}
+
+	if !Diff(after, after.Clone(), 2).Empty() {
+		t.Error("Expected no moves between identical rings")
+	}
+}
+
+func TestSubscribeReceivesChanges(t *testing.T) {
+	ring := NewHashRing(20)
+	ring.AddNode("node1")
+	ring.AddNode("node2")
+
+	var diffs []*RingDiff
+	ring.Subscribe(1, func(d *RingDiff) { diffs = append(diffs, d) })
+
+	ring.AddNode("node3")
+	ring.AddNode("node3") // No change
+	owned := NewVNodeManager(ring).CalculateLoadDistribution()["node1"] / 100
+	ring.RemoveNode("node1")
+
+	if len(diffs) != 2 {
+		t.Fatalf("Expected 2 change events, got %d", len(diffs))
+	}
+	if diffs[0].FromEpoch != 2 || diffs[0].ToEpoch != 3 || diffs[0].Node("node3").GainedShare == 0 {
+		t.Errorf("Unexpected first event: %d -> %d, node3 %+v", diffs[0].FromEpoch, diffs[0].ToEpoch, diffs[0].Node("node3"))
+	}
+	if n := diffs[1].Node("node1"); math.Abs(n.LostShare-owned) > 1e-9 || len(n.Gained) != 0 {
+		t.Errorf("Expected node1 to lose its %.4f of the ring, got %.4f", owned, n.LostShare)
+	}
+}
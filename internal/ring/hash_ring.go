@@ -2,6 +2,7 @@ package ring
 
 import (
 	"fmt"
+	"math"
 	"sort"
 	"sync"
 
@@ -15,23 +16,87 @@ type VNode struct {
 	VNodeIdx int    // Virtual node index (0 to K-1)
 }
 
+// Topology describes where a physical node is located
+type Topology struct {
+	Datacenter string `json:"datacenter"`
+	Rack       string `json:"rack"`
+}
+
 // HashRing implements consistent hashing with virtual nodes
 type HashRing struct {
 	mu           sync.RWMutex
 	vnodes       []VNode              // Sorted list of virtual nodes
 	nodeVNodes   map[string][]uint64  // NodeID -> list of vnode hashes
 	virtualCount int                  // Number of virtual nodes per physical node
+	topology     map[string]Topology  // NodeID -> datacenter and rack
+	dcReplicas   map[string]int       // Datacenter -> replicas (empty = rack-aware only)
+	weights      map[string]float64   // NodeID -> capacity relative to the default of 1
+	epoch        uint64               // Ownership changes applied, compared to adopt newer rings
+	checksum     uint64               // Checksum of the current snapshot
+	state        *StateFile           // Where the ring is persisted (optional)
+	partitioner  Partitioner          // Places keys and virtual nodes on the ring
+	notifyMu     sync.Mutex           // Serializes change notifications
+	subscribers  []subscriber         // Receive a diff after each change
+	published    *HashRing            // Ring as of the last notification
 }
 
 // NewHashRing creates a new consistent hash ring
 func NewHashRing(virtualNodes int) *HashRing {
+	return NewHashRingWithPartitioner(virtualNodes, Murmur3Partitioner{})
+}
+
+// NewHashRingWithPartitioner creates a consistent hash ring that places
+// keys and virtual nodes with the given partitioner
+func NewHashRingWithPartitioner(virtualNodes int, partitioner Partitioner) *HashRing {
 	if virtualNodes < 1 {
 		virtualNodes = 150 // Default
 	}
 	return &HashRing{
+		partitioner:  partitioner,
 		vnodes:       make([]VNode, 0),
 		nodeVNodes:   make(map[string][]uint64),
 		virtualCount: virtualNodes,
+		topology:     make(map[string]Topology),
+		dcReplicas:   make(map[string]int),
+		weights:      make(map[string]float64),
+	}
+}
+
+// SetNodeTopology records the datacenter and rack of a node so replicas
+// can be spread across failure domains
+func (r *HashRing) SetNodeTopology(nodeID, datacenter, rack string) {
+	defer r.notify()
+	defer r.persist()
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	topo := Topology{Datacenter: datacenter, Rack: rack}
+	if r.topology[nodeID] == topo {
+		return
+	}
+	r.topology[nodeID] = topo
+	if _, exists := r.nodeVNodes[nodeID]; exists {
+		r.changed()
+	}
+}
+
+// GetNodeTopology returns the datacenter and rack of a node
+func (r *HashRing) GetNodeTopology(nodeID string) Topology {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.topology[nodeID]
+}
+
+// SetDatacenterReplicas configures how many replicas each datacenter
+// holds. When set, preference lists take that many nodes from each
+// datacenter, truncated to the requested count.
+func (r *HashRing) SetDatacenterReplicas(replicas map[string]int) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.dcReplicas = make(map[string]int, len(replicas))
+	for dc, n := range replicas {
+		r.dcReplicas[dc] = n
 	}
 }
 
@@ -42,8 +107,11 @@ func hash(key string) uint64 {
 	return h.Sum64()
 }
 
-// AddNode adds a physical node to the ring with virtual nodes
+// AddNode adds a physical node to the ring with virtual nodes in
+// proportion to its weight
 func (r *HashRing) AddNode(nodeID string) {
+	defer r.notify()
+	defer r.persist()
 	r.mu.Lock()
 	defer r.mu.Unlock()
 
@@ -52,22 +120,231 @@ func (r *HashRing) AddNode(nodeID string) {
 		return
 	}
 
-	vnodeHashes := make([]uint64, 0, r.virtualCount)
+	r.nodeVNodes[nodeID] = make([]uint64, 0, r.vnodeCount(nodeID))
+	r.addVNodes(nodeID, r.vnodeCount(nodeID))
+	r.changed()
+}
 
-	for i := 0; i < r.virtualCount; i++ {
-		// Create unique key for each virtual node
-		vnodeKey := fmt.Sprintf("%s#vnode%d", nodeID, i)
-		h := hash(vnodeKey)
+// AddNodeAt adds a physical node at the tokens it owns in another node's
+// ring, as learned when joining, so both rings agree on its ranges. Tokens
+// already taken are skipped; a node left with none is placed by the
+// partitioner instead.
+func (r *HashRing) AddNodeAt(nodeID string, tokens []uint64) {
+	defer r.notify()
+	defer r.persist()
+	r.mu.Lock()
+	defer r.mu.Unlock()
 
+	if _, exists := r.nodeVNodes[nodeID]; exists {
+		return
+	}
+
+	if !r.placeAt(nodeID, tokens) {
+		r.addVNodes(nodeID, r.vnodeCount(nodeID))
+	}
+	r.changed()
+}
+
+// placeAt adds a node's virtual nodes at the given tokens, skipping those
+// another node holds, and reports whether any was placed. The caller must
+// hold mu.
+func (r *HashRing) placeAt(nodeID string, tokens []uint64) bool {
+	taken := make(map[uint64]bool, len(r.vnodes))
+	for _, vn := range r.vnodes {
+		taken[vn.Hash] = true
+	}
+	r.nodeVNodes[nodeID] = make([]uint64, 0, len(tokens))
+	for _, h := range tokens {
+		if taken[h] {
+			continue
+		}
+		taken[h] = true
 		r.vnodes = append(r.vnodes, VNode{
 			Hash:     h,
 			NodeID:   nodeID,
-			VNodeIdx: i,
+			VNodeIdx: len(r.nodeVNodes[nodeID]),
 		})
-		vnodeHashes = append(vnodeHashes, h)
+		r.nodeVNodes[nodeID] = append(r.nodeVNodes[nodeID], h)
+	}
+
+	if len(r.nodeVNodes[nodeID]) == 0 {
+		return false
+	}
+	sort.Slice(r.vnodes, func(i, j int) bool {
+		return r.vnodes[i].Hash < r.vnodes[j].Hash
+	})
+	return true
+}
+
+// NodeTokens returns the tokens of a node's virtual nodes, or nil if it is
+// not in the ring
+func (r *HashRing) NodeTokens(nodeID string) []uint64 {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	hashes, exists := r.nodeVNodes[nodeID]
+	if !exists {
+		return nil
+	}
+	return append([]uint64(nil), hashes...)
+}
+
+// SetNodeWeight sets a node's capacity relative to the default weight of
+// 1; it owns that many times the configured virtual nodes, and at least
+// one. If the node is in the ring, virtual nodes are added or removed to
+// match, so only the ranges next to them change owner.
+func (r *HashRing) SetNodeWeight(nodeID string, weight float64) {
+	defer r.notify()
+	defer r.persist()
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if weight <= 0 {
+		weight = 1
+	}
+	if previous, exists := r.weights[nodeID]; exists && previous == weight {
+		return
+	}
+	r.weights[nodeID] = weight
+
+	hashes, exists := r.nodeVNodes[nodeID]
+	if !exists {
+		return
+	}
+	defer r.changed()
+	target := r.vnodeCount(nodeID)
+	if target > len(hashes) {
+		r.addVNodes(nodeID, target-len(hashes))
+		return
+	}
+
+	// Drop the most recently added virtual nodes first
+	removed := make(map[uint64]bool)
+	for _, h := range hashes[target:] {
+		removed[h] = true
+	}
+	r.nodeVNodes[nodeID] = hashes[:target:target]
+
+	remaining := make([]VNode, 0, len(r.vnodes)-len(removed))
+	for _, vn := range r.vnodes {
+		if !removed[vn.Hash] {
+			remaining = append(remaining, vn)
+		}
+	}
+	r.vnodes = remaining
+}
+
+// SetNodeWeightAt sets a node's weight and moves its virtual nodes to the
+// tokens the node placed them at for that weight, so every ring agrees on
+// its ranges whatever the partitioner would choose locally. Tokens held by
+// other nodes are skipped. Without tokens it behaves as SetNodeWeight.
+func (r *HashRing) SetNodeWeightAt(nodeID string, weight float64, tokens []uint64) {
+	if len(tokens) == 0 {
+		r.SetNodeWeight(nodeID, weight)
+		return
+	}
+
+	defer r.notify()
+	defer r.persist()
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if weight <= 0 {
+		weight = 1
+	}
+	previous, weighted := r.weights[nodeID]
+	r.weights[nodeID] = weight
+
+	hashes, exists := r.nodeVNodes[nodeID]
+	if !exists {
+		return
+	}
+
+	// Keep the order of the tokens the node still holds, so the most
+	// recently added are still dropped first
+	want := make(map[uint64]bool, len(tokens))
+	for _, h := range tokens {
+		want[h] = true
+	}
+	taken := make(map[uint64]bool, len(r.vnodes))
+	for _, vn := range r.vnodes {
+		taken[vn.Hash] = true
+	}
+	placed := make([]uint64, 0, len(tokens))
+	for _, h := range hashes {
+		if want[h] {
+			placed = append(placed, h)
+			delete(want, h)
+		}
+	}
+	kept := len(placed)
+	for _, h := range tokens {
+		if want[h] && !taken[h] {
+			placed = append(placed, h)
+			delete(want, h)
+		}
+	}
+
+	if kept == len(hashes) && len(placed) == kept {
+		if !weighted || previous != weight {
+			r.changed()
+		}
+		return
 	}
 
-	r.nodeVNodes[nodeID] = vnodeHashes
+	remaining := make([]VNode, 0, len(r.vnodes)-len(hashes)+len(placed))
+	for _, vn := range r.vnodes {
+		if vn.NodeID != nodeID {
+			remaining = append(remaining, vn)
+		}
+	}
+	for i, h := range placed {
+		remaining = append(remaining, VNode{Hash: h, NodeID: nodeID, VNodeIdx: i})
+	}
+	sort.Slice(remaining, func(i, j int) bool {
+		return remaining[i].Hash < remaining[j].Hash
+	})
+	r.vnodes = remaining
+	r.nodeVNodes[nodeID] = placed
+	r.changed()
+}
+
+// GetNodeWeight returns a node's weight, 1 unless set otherwise
+func (r *HashRing) GetNodeWeight(nodeID string) float64 {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	if weight, exists := r.weights[nodeID]; exists {
+		return weight
+	}
+	return 1
+}
+
+// vnodeCount returns how many virtual nodes a node's weight gives it. The
+// caller must hold mu.
+func (r *HashRing) vnodeCount(nodeID string) int {
+	weight, exists := r.weights[nodeID]
+	if !exists {
+		return r.virtualCount
+	}
+	count := int(math.Round(float64(r.virtualCount) * weight))
+	if count < 1 {
+		count = 1
+	}
+	return count
+}
+
+// addVNodes places count more virtual nodes for a node where the
+// partitioner puts them. The caller must hold mu.
+func (r *HashRing) addVNodes(nodeID string, count int) {
+	for _, h := range r.partitioner.Place(nodeID, count, r.vnodes) {
+		r.vnodes = append(r.vnodes, VNode{
+			Hash:     h,
+			NodeID:   nodeID,
+			VNodeIdx: len(r.nodeVNodes[nodeID]),
+		})
+		r.nodeVNodes[nodeID] = append(r.nodeVNodes[nodeID], h)
+	}
 
 	// Keep vnodes sorted by hash
 	sort.Slice(r.vnodes, func(i, j int) bool {
@@ -77,6 +354,8 @@ func (r *HashRing) AddNode(nodeID string) {
 
 // RemoveNode removes a physical node and all its virtual nodes from the ring
 func (r *HashRing) RemoveNode(nodeID string) {
+	defer r.notify()
+	defer r.persist()
 	r.mu.Lock()
 	defer r.mu.Unlock()
 
@@ -85,7 +364,7 @@ func (r *HashRing) RemoveNode(nodeID string) {
 	}
 
 	// Filter out vnodes belonging to this node
-	newVNodes := make([]VNode, 0, len(r.vnodes)-r.virtualCount)
+	newVNodes := make([]VNode, 0, len(r.vnodes)-len(r.nodeVNodes[nodeID]))
 	for _, vn := range r.vnodes {
 		if vn.NodeID != nodeID {
 			newVNodes = append(newVNodes, vn)
@@ -94,6 +373,7 @@ func (r *HashRing) RemoveNode(nodeID string) {
 
 	r.vnodes = newVNodes
 	delete(r.nodeVNodes, nodeID)
+	r.changed()
 }
 
 // GetNode returns the node responsible for a given key
@@ -105,7 +385,7 @@ func (r *HashRing) GetNode(key string) (string, error) {
 		return "", fmt.Errorf("no nodes in ring")
 	}
 
-	h := hash(key)
+	h := r.partitioner.Token(key)
 
 	// Binary search for the first vnode with hash >= key hash
 	idx := sort.Search(len(r.vnodes), func(i int) bool {
@@ -123,39 +403,125 @@ func (r *HashRing) GetNode(key string) (string, error) {
 // GetNodes returns N distinct physical nodes for a key (preference list)
 // These are the nodes where the data will be replicated
 func (r *HashRing) GetNodes(key string, n int) ([]string, error) {
+	return r.GetNodesForToken(r.KeyToken(key), n, nil)
+}
+
+// GetNodesExcluding returns the preference list of a key as if the
+// excluded nodes were not in the ring
+func (r *HashRing) GetNodesExcluding(key string, n int, exclude map[string]bool) ([]string, error) {
+	return r.GetNodesForToken(r.KeyToken(key), n, exclude)
+}
+
+// GetNodesForToken returns the preference list of a position on the ring,
+// skipping excluded nodes
+func (r *HashRing) GetNodesForToken(token uint64, n int, exclude map[string]bool) ([]string, error) {
 	r.mu.RLock()
 	defer r.mu.RUnlock()
 
-	if len(r.vnodes) == 0 {
+	available := 0
+	for nodeID := range r.nodeVNodes {
+		if !exclude[nodeID] {
+			available++
+		}
+	}
+	if available == 0 {
 		return nil, fmt.Errorf("no nodes in ring")
 	}
 
-	h := hash(key)
-
 	// Binary search for starting position
 	startIdx := sort.Search(len(r.vnodes), func(i int) bool {
-		return r.vnodes[i].Hash >= h
+		return r.vnodes[i].Hash >= token
 	})
 
 	if startIdx >= len(r.vnodes) {
 		startIdx = 0
 	}
 
-	// Collect N distinct physical nodes
+	// Place a fixed number of replicas in each datacenter if configured
+	if len(r.dcReplicas) > 0 {
+		dcs := make([]string, 0, len(r.dcReplicas))
+		for dc := range r.dcReplicas {
+			dcs = append(dcs, dc)
+		}
+		sort.Strings(dcs)
+
+		nodes := make([]string, 0)
+		for _, dc := range dcs {
+			nodes = append(nodes, r.collectReplicas(startIdx, r.dcReplicas[dc], dc, exclude)...)
+		}
+		if len(nodes) > n {
+			nodes = nodes[:n]
+		}
+		return nodes, nil
+	}
+
+	return r.collectReplicas(startIdx, n, "", exclude), nil
+}
+
+// collectReplicas walks the ring from startIdx and picks n distinct nodes
+// that are not excluded, optionally restricted to one datacenter. Nodes on
+// a rack that already holds a replica are deferred until every rack has
+// one, so replicas land on as many racks as possible. Without topology
+// this is plain ring order.
+func (r *HashRing) collectReplicas(startIdx int, n int, datacenter string, exclude map[string]bool) []string {
+	// Count the racks available to this placement
+	racks := make(map[string]bool)
+	for nodeID := range r.nodeVNodes {
+		if exclude[nodeID] {
+			continue
+		}
+		topo := r.topology[nodeID]
+		if datacenter == "" || topo.Datacenter == datacenter {
+			racks[topo.Datacenter+"/"+topo.Rack] = true
+		}
+	}
+
 	nodes := make([]string, 0, n)
 	seen := make(map[string]bool)
+	usedRacks := make(map[string]bool)
+	skipped := make([]string, 0)
 
 	for i := 0; i < len(r.vnodes) && len(nodes) < n; i++ {
 		idx := (startIdx + i) % len(r.vnodes)
 		nodeID := r.vnodes[idx].NodeID
 
-		if !seen[nodeID] {
-			seen[nodeID] = true
-			nodes = append(nodes, nodeID)
+		if seen[nodeID] || exclude[nodeID] {
+			continue
+		}
+		seen[nodeID] = true
+
+		topo := r.topology[nodeID]
+		if datacenter != "" && topo.Datacenter != datacenter {
+			continue
+		}
+
+		rack := topo.Datacenter + "/" + topo.Rack
+		if len(usedRacks) < len(racks) && usedRacks[rack] {
+			// Rack already has a replica, use this node only if we run out
+			skipped = append(skipped, nodeID)
+			continue
+		}
+
+		usedRacks[rack] = true
+		nodes = append(nodes, nodeID)
+
+		// Once every rack holds a replica, deferred nodes go next in ring order
+		if len(usedRacks) == len(racks) {
+			for len(skipped) > 0 && len(nodes) < n {
+				nodes = append(nodes, skipped[0])
+				skipped = skipped[1:]
+			}
 		}
 	}
 
-	return nodes, nil
+	for _, nodeID := range skipped {
+		if len(nodes) >= n {
+			break
+		}
+		nodes = append(nodes, nodeID)
+	}
+
+	return nodes
 }
 
 // GetAllNodes returns all physical nodes in the ring
@@ -202,7 +568,86 @@ func (r *HashRing) GetRingTokens() []VNode {
 	return tokens
 }
 
-// GetKeyHash returns the hash of a key (for testing/debugging)
+// ReassignToken hands the virtual node at a token to another physical
+// node already in the ring. The token keeps its position, so only the
+// ownership of the range ending at it moves. A node's last token cannot
+// be reassigned.
+func (r *HashRing) ReassignToken(token uint64, nodeID string) error {
+	defer r.notify()
+	defer r.persist()
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, exists := r.nodeVNodes[nodeID]; !exists {
+		return fmt.Errorf("node %s is not in the ring", nodeID)
+	}
+
+	idx := sort.Search(len(r.vnodes), func(i int) bool {
+		return r.vnodes[i].Hash >= token
+	})
+	if idx >= len(r.vnodes) || r.vnodes[idx].Hash != token {
+		return fmt.Errorf("no virtual node at token %d", token)
+	}
+
+	from := r.vnodes[idx].NodeID
+	if from == nodeID {
+		return nil
+	}
+	if len(r.nodeVNodes[from]) == 1 {
+		return fmt.Errorf("token %d is the last one owned by %s", token, from)
+	}
+
+	r.vnodes[idx].NodeID = nodeID
+	r.nodeVNodes[nodeID] = append(r.nodeVNodes[nodeID], token)
+
+	remaining := make([]uint64, 0, len(r.nodeVNodes[from])-1)
+	for _, h := range r.nodeVNodes[from] {
+		if h != token {
+			remaining = append(remaining, h)
+		}
+	}
+	r.nodeVNodes[from] = remaining
+	r.changed()
+	return nil
+}
+
+// Clone returns an independent copy of the ring, used to preview changes
+// before applying them
+func (r *HashRing) Clone() *HashRing {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	clone := NewHashRingWithPartitioner(r.virtualCount, r.partitioner)
+	clone.vnodes = make([]VNode, len(r.vnodes))
+	copy(clone.vnodes, r.vnodes)
+	for nodeID, hashes := range r.nodeVNodes {
+		clone.nodeVNodes[nodeID] = append([]uint64(nil), hashes...)
+	}
+	for nodeID, topo := range r.topology {
+		clone.topology[nodeID] = topo
+	}
+	for dc, n := range r.dcReplicas {
+		clone.dcReplicas[dc] = n
+	}
+	for nodeID, weight := range r.weights {
+		clone.weights[nodeID] = weight
+	}
+	clone.epoch, clone.checksum = r.epoch, r.checksum
+	return clone
+}
+
+// KeyToken returns the position of a key on the ring
+func (r *HashRing) KeyToken(key string) uint64 {
+	return r.partitioner.Token(key)
+}
+
+// Partitioner returns the partitioner placing keys and virtual nodes
+func (r *HashRing) Partitioner() Partitioner {
+	return r.partitioner
+}
+
+// GetKeyHash returns the MurmurHash3 of a key, its token under the default
+// partitioner (for testing/debugging)
 func GetKeyHash(key string) uint64 {
 	return hash(key)
 }
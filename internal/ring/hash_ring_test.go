@@ -2,6 +2,7 @@ package ring
 
 import (
 	"fmt"
+	"sort"
 	"testing"
 )
 
@@ -22,6 +23,32 @@ func TestHashRingAddNode(t *testing.T) {
 	}
 }
 
+func TestHashRingAddNodeAt(t *testing.T) {
+	// A joining node copies the seed's balanced ring, whose tokens depend
+	// on the order nodes were added in
+	seed := NewHashRingWithPartitioner(10, BalancedPartitioner{})
+	seed.AddNode("node1")
+	seed.AddNode("node2")
+	seed.AddNode("node3")
+
+	joiner := NewHashRingWithPartitioner(10, BalancedPartitioner{})
+	for _, nodeID := range []string{"node3", "node1", "node2"} {
+		joiner.AddNodeAt(nodeID, seed.NodeTokens(nodeID))
+	}
+
+	_, seedChecksum := seed.Version()
+	_, joinerChecksum := joiner.Version()
+	if seedChecksum != joinerChecksum {
+		t.Errorf("Expected the same ring on both nodes, got %v and %v", seed.GetRingTokens(), joiner.GetRingTokens())
+	}
+
+	// Taken tokens are skipped, and a node with none left is still placed
+	joiner.AddNodeAt("node4", seed.NodeTokens("node1"))
+	if tokens := joiner.NodeTokens("node4"); len(tokens) != 10 {
+		t.Errorf("Expected node4 to be placed by the partitioner, got %d tokens", len(tokens))
+	}
+}
+
 func TestHashRingRemoveNode(t *testing.T) {
 	ring := NewHashRing(10)
 
@@ -204,3 +231,312 @@ func TestVNodeManager(t *testing.T) {
 		}
 	}
 }
+
+func TestHashRingRackAwarePlacement(t *testing.T) {
+	ring := NewHashRing(50)
+
+	racks := map[string]string{
+		"node1": "rack1", "node2": "rack1",
+		"node3": "rack2", "node4": "rack2",
+		"node5": "rack3", "node6": "rack3",
+	}
+	for nodeID, rack := range racks {
+		ring.SetNodeTopology(nodeID, "dc1", rack)
+		ring.AddNode(nodeID)
+	}
+
+	for i := 0; i < 200; i++ {
+		key := fmt.Sprintf("key-%d", i)
+		nodes, err := ring.GetNodes(key, 3)
+		if err != nil {
+			t.Fatalf("GetNodes failed: %v", err)
+		}
+
+		used := make(map[string]bool)
+		for _, n := range nodes {
+			used[racks[n]] = true
+		}
+		if len(used) != 3 {
+			t.Fatalf("Key %s: replicas %v not spread across 3 racks", key, nodes)
+		}
+	}
+}
+
+func TestHashRingRackAwareMoreReplicasThanRacks(t *testing.T) {
+	ring := NewHashRing(50)
+
+	ring.SetNodeTopology("node1", "dc1", "rack1")
+	ring.SetNodeTopology("node2", "dc1", "rack1")
+	ring.SetNodeTopology("node3", "dc1", "rack2")
+	ring.AddNode("node1")
+	ring.AddNode("node2")
+	ring.AddNode("node3")
+
+	nodes, _ := ring.GetNodes("testkey", 3)
+	if len(nodes) != 3 {
+		t.Errorf("Expected 3 replicas when racks run out, got %v", nodes)
+	}
+}
+
+func TestHashRingDatacenterReplicas(t *testing.T) {
+	ring := NewHashRing(50)
+
+	for i := 1; i <= 4; i++ {
+		ring.SetNodeTopology(fmt.Sprintf("east%d", i), "east", fmt.Sprintf("rack%d", i%2))
+		ring.AddNode(fmt.Sprintf("east%d", i))
+		ring.SetNodeTopology(fmt.Sprintf("west%d", i), "west", fmt.Sprintf("rack%d", i%2))
+		ring.AddNode(fmt.Sprintf("west%d", i))
+	}
+	ring.SetDatacenterReplicas(map[string]int{"east": 2, "west": 1})
+
+	for i := 0; i < 100; i++ {
+		nodes, _ := ring.GetNodes(fmt.Sprintf("key-%d", i), 3)
+
+		perDC := make(map[string]int)
+		for _, n := range nodes {
+			perDC[ring.GetNodeTopology(n).Datacenter]++
+		}
+		if perDC["east"] != 2 || perDC["west"] != 1 {
+			t.Fatalf("Expected 2 east and 1 west replica, got %v", nodes)
+		}
+	}
+}
+
+func TestHashRingGetNodesExcluding(t *testing.T) {
+	ring := NewHashRing(50)
+	for i := 1; i <= 4; i++ {
+		ring.AddNode(fmt.Sprintf("node%d", i))
+	}
+	exclude := map[string]bool{"node2": true}
+
+	for i := 0; i < 100; i++ {
+		key := fmt.Sprintf("key-%d", i)
+		all, _ := ring.GetNodes(key, 4)
+		nodes, err := ring.GetNodesExcluding(key, 2, exclude)
+		if err != nil {
+			t.Fatalf("GetNodesExcluding failed: %v", err)
+		}
+
+		// The result is the full preference list with node2 left out
+		var want []string
+		for _, n := range all {
+			if n != "node2" && len(want) < 2 {
+				want = append(want, n)
+			}
+		}
+		if fmt.Sprint(nodes) != fmt.Sprint(want) {
+			t.Fatalf("Key %s: expected %v, got %v", key, want, nodes)
+		}
+	}
+
+	all := map[string]bool{"node1": true, "node2": true, "node3": true, "node4": true}
+	if _, err := ring.GetNodesExcluding("key", 2, all); err == nil {
+		t.Error("Expected error when every node is excluded")
+	}
+}
+
+func TestHashRingWeightedNodes(t *testing.T) {
+	ring := NewHashRing(50)
+	ring.SetNodeWeight("big", 2)
+	ring.AddNode("big")
+	ring.AddNode("small")
+
+	counts := make(map[string]int)
+	for _, vn := range ring.GetRingTokens() {
+		counts[vn.NodeID]++
+	}
+	if counts["big"] != 100 || counts["small"] != 50 {
+		t.Fatalf("Expected 100 and 50 vnodes, got %v", counts)
+	}
+
+	// Record owners before halving the big node's weight
+	owners := make(map[string]string)
+	for i := 0; i < 1000; i++ {
+		key := fmt.Sprintf("key%d", i)
+		owners[key], _ = ring.GetNode(key)
+	}
+
+	ring.SetNodeWeight("big", 1)
+	counts = make(map[string]int)
+	for _, vn := range ring.GetRingTokens() {
+		counts[vn.NodeID]++
+	}
+	if counts["big"] != 50 || counts["small"] != 50 {
+		t.Fatalf("Expected 50 vnodes each, got %v", counts)
+	}
+
+	// Only keys owned by the big node may move, and only to the small one
+	for key, before := range owners {
+		after, _ := ring.GetNode(key)
+		if before != after && (before != "big" || after != "small") {
+			t.Errorf("Key %s moved from %s to %s", key, before, after)
+		}
+	}
+
+	ring.SetNodeWeight("big", 2)
+	for key, before := range owners {
+		if after, _ := ring.GetNode(key); after != before {
+			t.Errorf("Key %s owned by %s after restoring the weight, was %s", key, after, before)
+		}
+	}
+}
+
+// ownershipSpread returns the smallest and largest percentage of the
+// keyspace owned by a node
+func ownershipSpread(ring *HashRing) (min, max float64) {
+	min = 100
+	for _, pct := range NewVNodeManager(ring).CalculateLoadDistribution() {
+		if pct < min {
+			min = pct
+		}
+		if pct > max {
+			max = pct
+		}
+	}
+	return min, max
+}
+
+func TestPartitionerDistribution(t *testing.T) {
+	spreads := make(map[string]float64)
+	for _, partitioner := range []Partitioner{Murmur3Partitioner{}, BalancedPartitioner{}} {
+		ring := NewHashRingWithPartitioner(150, partitioner)
+		for i := 0; i < 10; i++ {
+			ring.AddNode(fmt.Sprintf("node%d", i))
+		}
+
+		min, max := ownershipSpread(ring)
+		spreads[partitioner.Name()] = max - min
+		t.Logf("%s: ownership from %.2f%% to %.2f%% (ideal 10%%)", partitioner.Name(), min, max)
+	}
+
+	if spreads[PartitionerBalanced] >= spreads[PartitionerMurmur3] {
+		t.Errorf("Balanced spread %.2f%% is no better than murmur3's %.2f%%",
+			spreads[PartitionerBalanced], spreads[PartitionerMurmur3])
+	}
+	if spreads[PartitionerBalanced] > 1 {
+		t.Errorf("Balanced ownership spread %.2f%% exceeds 1%%", spreads[PartitionerBalanced])
+	}
+}
+
+func TestBalancedPartitionerFollowsWeight(t *testing.T) {
+	ring := NewHashRingWithPartitioner(100, BalancedPartitioner{})
+	ring.AddNode("node1")
+	ring.AddNode("node2")
+	ring.SetNodeWeight("big", 2)
+	ring.AddNode("big")
+
+	distribution := NewVNodeManager(ring).CalculateLoadDistribution()
+	if big := distribution["big"]; big < 48 || big > 52 {
+		t.Errorf("Expected the double weight node to own about 50%%, got %v", distribution)
+	}
+
+	// Removing a node leaves the others' tokens where they were
+	before := ring.GetRingTokens()
+	ring.RemoveNode("node2")
+	remaining := make(map[uint64]bool)
+	for _, vn := range ring.GetRingTokens() {
+		remaining[vn.Hash] = true
+	}
+	for _, vn := range before {
+		if vn.NodeID != "node2" && !remaining[vn.Hash] {
+			t.Errorf("Token %d of %s moved when node2 left", vn.Hash, vn.NodeID)
+		}
+	}
+}
+
+func TestHashRingSetNodeWeightAt(t *testing.T) {
+	origin := NewHashRingWithPartitioner(20, BalancedPartitioner{})
+	origin.AddNode("node1")
+	origin.AddNode("node2")
+	origin.AddNode("node3")
+
+	// The peer has not heard of node4 yet, so the balanced partitioner
+	// would place node1's new vnodes elsewhere there
+	peer := origin.Clone()
+	origin.AddNode("node4")
+
+	sameTokens := func(a, b []uint64) bool {
+		sort.Slice(a, func(i, j int) bool { return a[i] < a[j] })
+		sort.Slice(b, func(i, j int) bool { return b[i] < b[j] })
+		return fmt.Sprint(a) == fmt.Sprint(b)
+	}
+
+	for _, weight := range []float64{2, 0.5} {
+		origin.SetNodeWeight("node1", weight)
+		tokens := origin.NodeTokens("node1")
+		peer.SetNodeWeightAt("node1", weight, tokens)
+
+		if got := peer.NodeTokens("node1"); !sameTokens(got, tokens) {
+			t.Errorf("Weight %g: expected node1 at %v, got %v", weight, tokens, got)
+		}
+		if peer.GetNodeWeight("node1") != weight {
+			t.Errorf("Expected weight %g, got %g", weight, peer.GetNodeWeight("node1"))
+		}
+	}
+
+	// Applying the same placement again is not a change
+	epoch := peer.Epoch()
+	peer.SetNodeWeightAt("node1", 0.5, origin.NodeTokens("node1"))
+	if peer.Epoch() != epoch {
+		t.Error("Reapplying the same tokens advanced the epoch")
+	}
+}
+
+func TestOrderedPartitionerScanRanges(t *testing.T) {
+	ring := NewHashRingWithPartitioner(10, OrderedPartitioner{})
+	ring.AddNode("node1")
+	ring.AddNode("node2")
+	ring.AddNode("node3")
+
+	keys := []string{"apple", "apricot", "banana", "cherry", "user:0001", "user:0002", "zebra"}
+	for i := 1; i < len(keys); i++ {
+		if ring.KeyToken(keys[i-1]) > ring.KeyToken(keys[i]) {
+			t.Errorf("Token of %s is after the token of %s", keys[i-1], keys[i])
+		}
+	}
+
+	// Tokens are spread over printable keys, so every node owns some
+	owners := make(map[string]bool)
+	for c := byte(' '); c < 0x7f; c++ {
+		owner, _ := ring.GetNode(string([]byte{c}))
+		owners[owner] = true
+	}
+	if len(owners) != 3 {
+		t.Errorf("Expected printable keys to be spread over 3 nodes, got %v", owners)
+	}
+
+	ranges, err := ring.ScanRanges("apple", "cherry")
+	if err != nil {
+		t.Fatalf("ScanRanges failed: %v", err)
+	}
+	for _, key := range []string{"apple", "apricot", "banana", "cherry"} {
+		token := ring.KeyToken(key)
+		found := false
+		for _, r := range ranges {
+			if r.Contains(token) {
+				found = true
+				owner, _ := ring.GetNode(key)
+				if owner != r.NodeID {
+					t.Errorf("Range holding %s is owned by %s, key by %s", key, r.NodeID, owner)
+				}
+			}
+		}
+		if !found {
+			t.Errorf("No scan range holds %s", key)
+		}
+	}
+	if len(ranges) >= len(ring.GetRingTokens()) {
+		t.Errorf("Expected a short key range to span few ranges, got %d", len(ranges))
+	}
+
+	if _, err := NewHashRing(10).ScanRanges("a", "b"); err == nil {
+		t.Error("Expected ScanRanges to fail with a hashing partitioner")
+	}
+
+	// A ring placed by another partitioner is never adopted
+	other := NewHashRing(10)
+	other.AddNode("node1")
+	if ring.Adopt(other.Snapshot()) {
+		t.Error("Adopted a ring placed by another partitioner")
+	}
+}
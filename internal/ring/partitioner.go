@@ -0,0 +1,244 @@
+package ring
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math"
+	"sort"
+)
+
+// Partitioner names accepted by NewPartitioner
+const (
+	PartitionerMurmur3  = "murmur3"
+	PartitionerBalanced = "balanced"
+	PartitionerOrdered  = "ordered"
+)
+
+// Partitioner decides where keys and virtual nodes sit on the ring. Every
+// node of a cluster must use the same one.
+type Partitioner interface {
+	// Name identifies the partitioner in the config and in ring snapshots
+	Name() string
+
+	// Token returns the position of a key on the ring
+	Token(key string) uint64
+
+	// Place returns count new tokens for a node, given the virtual nodes
+	// already on the ring sorted by hash. Tokens never collide with
+	// existing ones, but fewer than count may be returned if the ring
+	// has no room left.
+	Place(nodeID string, count int, vnodes []VNode) []uint64
+}
+
+// NewPartitioner returns the partitioner with the given name
+func NewPartitioner(name string) (Partitioner, error) {
+	switch name {
+	case "", PartitionerMurmur3:
+		return Murmur3Partitioner{}, nil
+	case PartitionerBalanced:
+		return BalancedPartitioner{}, nil
+	case PartitionerOrdered:
+		return OrderedPartitioner{}, nil
+	}
+	return nil, fmt.Errorf("unknown partitioner %q", name)
+}
+
+// Murmur3Partitioner hashes keys with MurmurHash3 and places each virtual
+// node at the hash of "nodeID#vnodeN". Placement is random, so ownership
+// varies between nodes by a few percent even with many virtual nodes.
+type Murmur3Partitioner struct{}
+
+// Name implements Partitioner
+func (Murmur3Partitioner) Name() string { return PartitionerMurmur3 }
+
+// Token implements Partitioner
+func (Murmur3Partitioner) Token(key string) uint64 { return hash(key) }
+
+// Place implements Partitioner, skipping indexes whose position is taken
+func (Murmur3Partitioner) Place(nodeID string, count int, vnodes []VNode) []uint64 {
+	taken := make(map[uint64]bool, len(vnodes))
+	for _, vn := range vnodes {
+		taken[vn.Hash] = true
+	}
+
+	tokens := make([]uint64, 0, count)
+	for i := 0; len(tokens) < count; i++ {
+		h := hash(fmt.Sprintf("%s#vnode%d", nodeID, i))
+		if taken[h] {
+			continue
+		}
+		taken[h] = true
+		tokens = append(tokens, h)
+	}
+	return tokens
+}
+
+// BalancedPartitioner hashes keys with MurmurHash3 like the default, but
+// chooses virtual node tokens instead of hashing them: each new token
+// takes an equal share of the keyspace from the node owning the most
+// beyond its share, which keeps ownership close to proportional to weight.
+type BalancedPartitioner struct{}
+
+// Name implements Partitioner
+func (BalancedPartitioner) Name() string { return PartitionerBalanced }
+
+// Token implements Partitioner
+func (BalancedPartitioner) Token(key string) uint64 { return hash(key) }
+
+// Place implements Partitioner
+func (BalancedPartitioner) Place(nodeID string, count int, vnodes []VNode) []uint64 {
+	return fullSpan.place(nodeID, count, vnodes)
+}
+
+// OrderedPartitioner keeps keys in order on the ring: a key's token is its
+// first eight bytes, so neighbouring keys land on the same node and a key
+// range maps to a few consecutive token ranges (see HashRing.ScanRanges).
+// Keys sharing those eight bytes share a token. Virtual nodes are placed
+// like BalancedPartitioner's, but only over keys starting with a printable
+// ASCII byte, where nearly all keys fall.
+type OrderedPartitioner struct{}
+
+// Name implements Partitioner
+func (OrderedPartitioner) Name() string { return PartitionerOrdered }
+
+// Token implements Partitioner
+func (OrderedPartitioner) Token(key string) uint64 {
+	var prefix [8]byte
+	copy(prefix[:], key)
+	return binary.BigEndian.Uint64(prefix[:])
+}
+
+// Place implements Partitioner
+func (OrderedPartitioner) Place(nodeID string, count int, vnodes []VNode) []uint64 {
+	return printableSpan.place(nodeID, count, vnodes)
+}
+
+// span is the stretch of the ring a partitioner places tokens in, treated
+// as a ring of its own
+type span struct {
+	lo, hi uint64
+}
+
+var (
+	fullSpan      = span{lo: 0, hi: ^uint64(0)}
+	printableSpan = span{lo: 0x20 << 56, hi: 0x7f<<56 - 1}
+)
+
+// distance returns how many positions follow a, up to and including b,
+// wrapping from hi to lo. A token's distance from itself is the whole span.
+func (s span) distance(a, b uint64) uint64 {
+	switch {
+	case a < b:
+		return b - a
+	case a == b:
+		return s.hi - s.lo
+	}
+	return (s.hi - a) + (b - s.lo) + 1
+}
+
+// advance returns the position d steps after a, wrapping from hi to lo
+func (s span) advance(a, d uint64) uint64 {
+	if d <= s.hi-a {
+		return a + d
+	}
+	return s.lo + (d - (s.hi - a) - 1)
+}
+
+// place picks count tokens for a node one at a time. Once all are placed,
+// every virtual node on the ring should own an equal share of the span, so
+// each token takes that share from the largest range of the node owning
+// the most beyond its share. A node alone on the ring spreads its tokens
+// evenly instead, starting from the hash of its ID.
+func (s span) place(nodeID string, count int, vnodes []VNode) []uint64 {
+	ring := append([]VNode(nil), vnodes...)
+	tokens := make([]uint64, 0, count)
+	if len(ring) == 0 && count > 0 {
+		first := s.advance(s.lo, hash(nodeID)%(s.hi-s.lo))
+		ring = append(ring, VNode{Hash: first, NodeID: nodeID})
+		tokens = append(tokens, first)
+	}
+	share := (s.hi - s.lo) / uint64(len(vnodes)+count)
+
+	for len(tokens) < count {
+		owned := make(map[string]float64)
+		vcount := make(map[string]int)
+		for i, vn := range ring {
+			owned[vn.NodeID] += float64(s.distance(ring[(i+len(ring)-1)%len(ring)].Hash, vn.Hash))
+			vcount[vn.NodeID]++
+		}
+
+		// The node being placed only gives up ranges if it is alone
+		donor, most := "", math.Inf(-1)
+		for id, o := range owned {
+			if id == nodeID && len(owned) > 1 {
+				continue
+			}
+			if excess := o - float64(share)*float64(vcount[id]); excess > most || (excess == most && id < donor) {
+				donor, most = id, excess
+			}
+		}
+
+		idx, size := -1, uint64(0)
+		for i, vn := range ring {
+			if vn.NodeID != donor {
+				continue
+			}
+			if d := s.distance(ring[(i+len(ring)-1)%len(ring)].Hash, vn.Hash); d > size {
+				idx, size = i, d
+			}
+		}
+		if size < 2 {
+			break
+		}
+
+		// The new token owns the start of the range, up to its share
+		step := size / 2
+		if donor != nodeID && share > 0 && share < size {
+			step = share
+		}
+		token := s.advance(ring[(idx+len(ring)-1)%len(ring)].Hash, step)
+		at := sort.Search(len(ring), func(i int) bool { return ring[i].Hash >= token })
+		ring = append(ring, VNode{})
+		copy(ring[at+1:], ring[at:])
+		ring[at] = VNode{Hash: token, NodeID: nodeID}
+		tokens = append(tokens, token)
+	}
+	return tokens
+}
+
+// ScanRanges returns the token ranges holding the keys from start to end
+// inclusive, in key order, with the primary owner of each. It needs the
+// ordered partitioner; with a hashing one a key range is scattered over
+// the whole ring.
+func (r *HashRing) ScanRanges(start, end string) ([]TokenRange, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	if _, ok := r.partitioner.(OrderedPartitioner); !ok {
+		return nil, fmt.Errorf("partitioner %s does not preserve key order", r.partitioner.Name())
+	}
+	if start > end {
+		return nil, fmt.Errorf("range start %q is after its end %q", start, end)
+	}
+	if len(r.vnodes) == 0 {
+		return nil, fmt.Errorf("no nodes in ring")
+	}
+
+	first, last := r.partitioner.Token(start), r.partitioner.Token(end)
+	idx := sort.Search(len(r.vnodes), func(i int) bool {
+		return r.vnodes[i].Hash >= first
+	})
+
+	// Walk ranges from the one holding start until one holds end, which
+	// is the wrapping range if end is past the last token
+	ranges := make([]TokenRange, 0)
+	for i := 0; i < len(r.vnodes); i++ {
+		j := (idx + i) % len(r.vnodes)
+		prev := r.vnodes[(j+len(r.vnodes)-1)%len(r.vnodes)].Hash
+		ranges = append(ranges, TokenRange{StartToken: prev + 1, EndToken: r.vnodes[j].Hash, NodeID: r.vnodes[j].NodeID})
+		if idx+i >= len(r.vnodes) || r.vnodes[j].Hash >= last {
+			break
+		}
+	}
+	return ranges, nil
+}
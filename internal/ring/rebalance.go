@@ -0,0 +1,207 @@
+package ring
+
+import (
+	"math"
+	"sort"
+)
+
+// NodeLoad is the observed load of a physical node
+type NodeLoad struct {
+	NodeID      string  `json:"node_id"`
+	Ownership   float64 `json:"ownership"`    // Percentage of the keyspace owned as primary
+	Keys        int64   `json:"keys"`         // Live keys stored
+	Bytes       int64   `json:"bytes"`        // Size of the data files
+	RequestRate float64 `json:"request_rate"` // Storage operations per second
+	Score       float64 `json:"score"`        // Load relative to the cluster mean (1 = average)
+}
+
+// TokenMove hands one virtual node, and the range ending at its token, to
+// another physical node
+type TokenMove struct {
+	Token      uint64  `json:"token"`
+	RangeStart uint64  `json:"range_start"`
+	From       string  `json:"from"`
+	To         string  `json:"to"`
+	Load       float64 `json:"load"` // Estimated score moved with the range
+}
+
+// RebalanceOptions bounds a rebalance plan
+type RebalanceOptions struct {
+	Threshold float64 // Nodes whose score is within this of the mean are balanced
+	MaxMoves  int     // Maximum token moves in one plan
+}
+
+// RebalancePlan is a sequence of token moves and the load it should leave
+type RebalancePlan struct {
+	Loads        []NodeLoad         `json:"loads"`
+	Moves        []TokenMove        `json:"moves"`
+	Projected    map[string]float64 `json:"projected_scores"` // Scores once every move is done
+	SpreadBefore float64            `json:"spread_before"`    // Highest minus lowest score now
+	SpreadAfter  float64            `json:"spread_after"`     // Highest minus lowest score after the moves
+}
+
+// plannedVNode is a virtual node and its share of its owner's load
+type plannedVNode struct {
+	token uint64
+	start uint64
+	load  float64
+	moved bool
+}
+
+// PlanRebalance proposes vnode moves from the most to the least loaded
+// nodes. Each node's score averages its token ownership, key count, bytes
+// and request rate, each relative to the cluster mean, and is split over
+// its vnodes in proportion to the keyspace they cover. Moves are chosen
+// greedily, each halving the gap between the hottest and coldest node as
+// closely as a single vnode allows, until every node is within the
+// threshold or no move helps. Only nodes present in loads take part.
+func PlanRebalance(r *HashRing, loads []NodeLoad, opts RebalanceOptions) *RebalancePlan {
+	manager := NewVNodeManager(r)
+	ownership := manager.CalculateLoadDistribution()
+
+	// Score every node relative to the mean of each metric
+	plan := &RebalancePlan{Projected: make(map[string]float64)}
+	participating := make(map[string]bool)
+	for _, load := range loads {
+		if _, inRing := ownership[load.NodeID]; inRing {
+			load.Ownership = ownership[load.NodeID]
+			plan.Loads = append(plan.Loads, load)
+			participating[load.NodeID] = true
+		}
+	}
+	if len(plan.Loads) < 2 {
+		return plan
+	}
+	scoreLoads(plan.Loads)
+	sort.Slice(plan.Loads, func(i, j int) bool { return plan.Loads[i].NodeID < plan.Loads[j].NodeID })
+
+	// Split each node's score over its vnodes by the keyspace they cover
+	vnodes := make(map[string][]*plannedVNode)
+	owned := make(map[string]float64)
+	ranges := manager.GetTokenRanges()
+	for _, tr := range ranges {
+		owned[tr.NodeID] += tr.Size()
+	}
+	scores := make(map[string]float64)
+	for _, load := range plan.Loads {
+		scores[load.NodeID] = load.Score
+	}
+	for _, tr := range ranges {
+		if !participating[tr.NodeID] {
+			continue
+		}
+		vnodes[tr.NodeID] = append(vnodes[tr.NodeID], &plannedVNode{
+			token: tr.EndToken,
+			start: tr.StartToken,
+			load:  scores[tr.NodeID] * tr.Size() / owned[tr.NodeID],
+		})
+	}
+
+	plan.SpreadBefore = spread(scores)
+	for len(plan.Moves) < opts.MaxMoves {
+		hot, cold := extremes(scores)
+		if scores[hot] <= 1+opts.Threshold && scores[cold] >= 1-opts.Threshold {
+			break
+		}
+
+		// Pick the vnode closest to half the gap that still narrows it
+		gap := scores[hot] - scores[cold]
+		var best *plannedVNode
+		remaining := 0
+		for _, vn := range vnodes[hot] {
+			if vn.moved {
+				continue
+			}
+			remaining++
+			if vn.load <= 0 || vn.load >= gap {
+				continue
+			}
+			if best == nil || math.Abs(vn.load-gap/2) < math.Abs(best.load-gap/2) {
+				best = vn
+			}
+		}
+		if best == nil || remaining < 2 {
+			break
+		}
+
+		best.moved = true
+		scores[hot] -= best.load
+		scores[cold] += best.load
+		plan.Moves = append(plan.Moves, TokenMove{
+			Token:      best.token,
+			RangeStart: best.start,
+			From:       hot,
+			To:         cold,
+			Load:       best.load,
+		})
+	}
+
+	plan.SpreadAfter = spread(scores)
+	for nodeID, score := range scores {
+		plan.Projected[nodeID] = score
+	}
+	return plan
+}
+
+// scoreLoads sets each load's score to the mean, over the metrics with
+// any load at all, of its value relative to the cluster mean
+func scoreLoads(loads []NodeLoad) {
+	metrics := []func(NodeLoad) float64{
+		func(l NodeLoad) float64 { return l.Ownership },
+		func(l NodeLoad) float64 { return float64(l.Keys) },
+		func(l NodeLoad) float64 { return float64(l.Bytes) },
+		func(l NodeLoad) float64 { return l.RequestRate },
+	}
+
+	for i := range loads {
+		loads[i].Score = 0
+	}
+	used := 0
+	for _, metric := range metrics {
+		var total float64
+		for _, load := range loads {
+			total += metric(load)
+		}
+		if total <= 0 {
+			continue
+		}
+		mean := total / float64(len(loads))
+		for i := range loads {
+			loads[i].Score += metric(loads[i]) / mean
+		}
+		used++
+	}
+	for i := range loads {
+		loads[i].Score /= float64(used)
+	}
+}
+
+// extremes returns the nodes with the highest and lowest scores, breaking
+// ties by node ID so plans are deterministic
+func extremes(scores map[string]float64) (hot, cold string) {
+	ids := make([]string, 0, len(scores))
+	for nodeID := range scores {
+		ids = append(ids, nodeID)
+	}
+	sort.Strings(ids)
+
+	hot, cold = ids[0], ids[0]
+	for _, nodeID := range ids[1:] {
+		if scores[nodeID] > scores[hot] {
+			hot = nodeID
+		}
+		if scores[nodeID] < scores[cold] {
+			cold = nodeID
+		}
+	}
+	return hot, cold
+}
+
+// spread returns the difference between the highest and lowest score
+func spread(scores map[string]float64) float64 {
+	if len(scores) == 0 {
+		return 0
+	}
+	hot, cold := extremes(scores)
+	return scores[hot] - scores[cold]
+}
@@ -0,0 +1,92 @@
+package ring
+
+import (
+	"testing"
+)
+
+func TestPlanRebalanceMovesLoadOffHotNode(t *testing.T) {
+	ring := NewHashRing(20)
+	ring.AddNode("node1")
+	ring.AddNode("node2")
+	ring.AddNode("node3")
+
+	loads := []NodeLoad{
+		{NodeID: "node1", Keys: 3000, Bytes: 300000, RequestRate: 300},
+		{NodeID: "node2", Keys: 1000, Bytes: 100000, RequestRate: 100},
+		{NodeID: "node3", Keys: 1000, Bytes: 100000, RequestRate: 100},
+	}
+	plan := PlanRebalance(ring, loads, RebalanceOptions{Threshold: 0.1, MaxMoves: 20})
+
+	if len(plan.Moves) == 0 {
+		t.Fatal("Expected moves off the hot node")
+	}
+	if plan.SpreadAfter >= plan.SpreadBefore {
+		t.Errorf("Expected the plan to narrow the spread, got %.2f -> %.2f", plan.SpreadBefore, plan.SpreadAfter)
+	}
+	if plan.Moves[0].From != "node1" {
+		t.Errorf("Expected the first move from node1, got %+v", plan.Moves[0])
+	}
+
+	// The plan applies cleanly to the ring
+	for _, move := range plan.Moves {
+		if err := ring.ReassignToken(move.Token, move.To); err != nil {
+			t.Fatalf("ReassignToken failed: %v", err)
+		}
+	}
+	total := 0.0
+	for _, load := range NewVNodeManager(ring).CalculateLoadDistribution() {
+		total += load
+	}
+	if total < 99.9 || total > 100.1 {
+		t.Errorf("Load distribution should still sum to 100%%, got %.2f%%", total)
+	}
+}
+
+func TestPlanRebalanceBalancedClusterNoMoves(t *testing.T) {
+	ring := NewHashRing(50)
+	ring.AddNode("node1")
+	ring.AddNode("node2")
+
+	loads := []NodeLoad{{NodeID: "node1"}, {NodeID: "node2"}}
+	plan := PlanRebalance(ring, loads, RebalanceOptions{Threshold: 0.5, MaxMoves: 10})
+	if len(plan.Moves) != 0 {
+		t.Errorf("Expected no moves within the threshold, got %+v", plan.Moves)
+	}
+}
+
+func TestHashRingReassignToken(t *testing.T) {
+	ring := NewHashRing(2)
+	ring.AddNode("node1")
+	ring.AddNode("node2")
+
+	var tokens []uint64
+	for _, vn := range ring.GetRingTokens() {
+		if vn.NodeID == "node1" {
+			tokens = append(tokens, vn.Hash)
+		}
+	}
+
+	clone := ring.Clone()
+	if err := ring.ReassignToken(tokens[0], "node2"); err != nil {
+		t.Fatalf("ReassignToken failed: %v", err)
+	}
+	if err := ring.ReassignToken(tokens[1], "node2"); err == nil {
+		t.Error("Expected an error reassigning node1's last token")
+	}
+	if err := ring.ReassignToken(tokens[1], "node3"); err == nil {
+		t.Error("Expected an error reassigning to a node outside the ring")
+	}
+
+	owners := make(map[string]int)
+	for _, vn := range ring.GetRingTokens() {
+		owners[vn.NodeID]++
+	}
+	if owners["node1"] != 1 || owners["node2"] != 3 {
+		t.Errorf("Expected 1 and 3 tokens, got %v", owners)
+	}
+	for _, vn := range clone.GetRingTokens() {
+		if vn.Hash == tokens[0] && vn.NodeID != "node1" {
+			t.Error("Reassigning a token changed the clone")
+		}
+	}
+}
@@ -0,0 +1,306 @@
+package ring
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"log"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+
+	"github.com/spaolacci/murmur3"
+)
+
+// stateFileName is the file in the data directory holding the ring
+const stateFileName = "ring.json"
+
+// Snapshot is the ownership state of a ring: its members, their tokens and
+// the epoch of the change that produced it. Snapshots are persisted in the
+// data directory and exchanged between nodes, and a node adopts another's
+// only when it is newer and was built by the same partitioner.
+type Snapshot struct {
+	Epoch       uint64         `json:"epoch"`
+	Partitioner string         `json:"partitioner,omitempty"` // Empty for rings saved before partitioners were configurable
+	Nodes       []SnapshotNode `json:"nodes"`
+}
+
+// SnapshotNode is one physical node in a snapshot
+type SnapshotNode struct {
+	ID         string   `json:"id"`
+	Datacenter string   `json:"datacenter,omitempty"`
+	Rack       string   `json:"rack,omitempty"`
+	Weight     float64  `json:"weight,omitempty"`
+	Tokens     []uint64 `json:"tokens"`
+}
+
+// Checksum identifies the contents of a snapshot regardless of its epoch,
+// so rings that reached the same epoch through different changes can tell
+// they disagree
+func (s *Snapshot) Checksum() uint64 {
+	h := murmur3.New64()
+	buf := make([]byte, 8)
+	for _, node := range s.Nodes {
+		h.Write([]byte(node.ID + "\x00" + node.Datacenter + "\x00" + node.Rack + "\x00"))
+		binary.BigEndian.PutUint64(buf, math.Float64bits(node.Weight))
+		h.Write(buf)
+		for _, token := range node.Tokens {
+			binary.BigEndian.PutUint64(buf, token)
+			h.Write(buf)
+		}
+	}
+	return h.Sum64()
+}
+
+// NewerThan reports whether a snapshot should replace a ring at the given
+// epoch and checksum. Ties on epoch go to the higher checksum so that
+// every node settles on the same ring.
+func (s *Snapshot) NewerThan(epoch, checksum uint64) bool {
+	if s.Epoch != epoch {
+		return s.Epoch > epoch
+	}
+	return s.Checksum() > checksum
+}
+
+// PartitionerName returns the partitioner that built the snapshot
+func (s *Snapshot) PartitionerName() string {
+	if s.Partitioner == "" {
+		return PartitionerMurmur3
+	}
+	return s.Partitioner
+}
+
+// Epoch returns the number of ownership changes the ring has been through
+func (r *HashRing) Epoch() uint64 {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.epoch
+}
+
+// Version returns the ring's epoch and the checksum of its contents
+func (r *HashRing) Version() (epoch, checksum uint64) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.epoch, r.checksum
+}
+
+// Snapshot returns the ring's current ownership state
+func (r *HashRing) Snapshot() *Snapshot {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.snapshot()
+}
+
+// snapshot builds a snapshot with nodes and tokens in sorted order. The
+// caller must hold mu.
+func (r *HashRing) snapshot() *Snapshot {
+	s := &Snapshot{
+		Epoch:       r.epoch,
+		Partitioner: r.partitioner.Name(),
+		Nodes:       make([]SnapshotNode, 0, len(r.nodeVNodes)),
+	}
+	for nodeID, hashes := range r.nodeVNodes {
+		topo := r.topology[nodeID]
+		tokens := append([]uint64(nil), hashes...)
+		sort.Slice(tokens, func(i, j int) bool { return tokens[i] < tokens[j] })
+		s.Nodes = append(s.Nodes, SnapshotNode{
+			ID:         nodeID,
+			Datacenter: topo.Datacenter,
+			Rack:       topo.Rack,
+			Weight:     r.weights[nodeID],
+			Tokens:     tokens,
+		})
+	}
+	sort.Slice(s.Nodes, func(i, j int) bool { return s.Nodes[i].ID < s.Nodes[j].ID })
+	return s
+}
+
+// Adopt replaces the ring with a snapshot if the snapshot is newer,
+// reporting whether it did. A snapshot from another partitioner is never
+// adopted, since its tokens mean something else here.
+func (r *HashRing) Adopt(s *Snapshot) bool {
+	defer r.notify()
+	defer r.persist()
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if !r.adoptable(s) {
+		return false
+	}
+	r.replace(s)
+	return true
+}
+
+// Merge adopts a snapshot if it is newer, like Adopt, then puts back at
+// their tokens the nodes the ring had and the snapshot lacks, except those
+// in departed. Nodes that made different membership changes at the same
+// time so converge on the union of their members rather than on one
+// node's change. Putting nodes back advances the epoch once, so the merged
+// ring spreads. It returns whether the snapshot was adopted and the nodes
+// put back.
+func (r *HashRing) Merge(s *Snapshot, departed map[string]bool) (bool, []string) {
+	defer r.notify()
+	defer r.persist()
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if !r.adoptable(s) {
+		return false, nil
+	}
+	previous := r.snapshot()
+	r.replace(s)
+
+	var restored []string
+	for _, node := range previous.Nodes {
+		if _, exists := r.nodeVNodes[node.ID]; exists || departed[node.ID] {
+			continue
+		}
+		if r.placeAt(node.ID, node.Tokens) {
+			restored = append(restored, node.ID)
+		} else {
+			delete(r.nodeVNodes, node.ID)
+		}
+	}
+	if len(restored) > 0 {
+		r.changed()
+	}
+	return true, restored
+}
+
+// adoptable reports whether a snapshot is newer than the ring and was
+// placed by the same partitioner. The caller must hold mu.
+func (r *HashRing) adoptable(s *Snapshot) bool {
+	if !s.NewerThan(r.epoch, r.checksum) {
+		return false
+	}
+	if name := s.PartitionerName(); name != r.partitioner.Name() {
+		log.Printf("Ignoring ring at epoch %d placed by partitioner %s, ours is %s", s.Epoch, name, r.partitioner.Name())
+		return false
+	}
+	return true
+}
+
+// replace sets the ring to a snapshot. The caller must hold mu.
+func (r *HashRing) replace(s *Snapshot) {
+	r.vnodes = make([]VNode, 0)
+	r.nodeVNodes = make(map[string][]uint64, len(s.Nodes))
+	for _, node := range s.Nodes {
+		r.topology[node.ID] = Topology{Datacenter: node.Datacenter, Rack: node.Rack}
+		if node.Weight > 0 {
+			r.weights[node.ID] = node.Weight
+		}
+		r.nodeVNodes[node.ID] = append([]uint64(nil), node.Tokens...)
+		for i, token := range node.Tokens {
+			r.vnodes = append(r.vnodes, VNode{Hash: token, NodeID: node.ID, VNodeIdx: i})
+		}
+	}
+	sort.Slice(r.vnodes, func(i, j int) bool {
+		return r.vnodes[i].Hash < r.vnodes[j].Hash
+	})
+
+	r.epoch = s.Epoch
+	r.checksum = r.snapshot().Checksum()
+}
+
+// SetStateFile persists the ring to a state file after every change
+func (r *HashRing) SetStateFile(f *StateFile) {
+	r.mu.Lock()
+	r.state = f
+	r.mu.Unlock()
+	r.persist()
+}
+
+// changed records an ownership change. The caller must hold mu.
+func (r *HashRing) changed() {
+	r.epoch++
+	r.checksum = r.snapshot().Checksum()
+}
+
+// persist saves the ring if it changed since it was last saved. The
+// caller must not hold mu.
+func (r *HashRing) persist() {
+	r.mu.RLock()
+	state, epoch, checksum := r.state, r.epoch, r.checksum
+	r.mu.RUnlock()
+
+	if state == nil || !state.behind(epoch, checksum) {
+		return
+	}
+	if err := state.Save(r.Snapshot()); err != nil {
+		log.Printf("Failed to persist ring at epoch %d: %v", epoch, err)
+	}
+}
+
+// StateFile stores ring snapshots in a data directory. Saves are atomic,
+// and a snapshot older than the last one saved is never written over it.
+type StateFile struct {
+	path     string
+	mu       sync.Mutex
+	epoch    uint64 // Epoch of the snapshot last saved or loaded
+	checksum uint64
+}
+
+// NewStateFile returns the ring state file in a data directory
+func NewStateFile(dataDir string) *StateFile {
+	return &StateFile{path: filepath.Join(dataDir, stateFileName)}
+}
+
+// Load reads the saved snapshot, or returns nil if none was saved
+func (f *StateFile) Load() (*Snapshot, error) {
+	data, err := os.ReadFile(f.path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read ring state: %w", err)
+	}
+
+	var s Snapshot
+	if err := json.Unmarshal(data, &s); err != nil {
+		return nil, fmt.Errorf("failed to parse ring state %s: %w", f.path, err)
+	}
+
+	f.mu.Lock()
+	f.epoch, f.checksum = s.Epoch, s.Checksum()
+	f.mu.Unlock()
+	return &s, nil
+}
+
+// Save writes a snapshot unless a newer one was already saved
+func (f *StateFile) Save(s *Snapshot) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	checksum := s.Checksum()
+	if s.Epoch < f.epoch || (s.Epoch == f.epoch && checksum == f.checksum) {
+		return nil
+	}
+
+	data, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(f.path), 0755); err != nil {
+		return err
+	}
+
+	tmp := f.path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return fmt.Errorf("failed to write ring state: %w", err)
+	}
+	if err := os.Rename(tmp, f.path); err != nil {
+		return fmt.Errorf("failed to replace ring state: %w", err)
+	}
+
+	f.epoch, f.checksum = s.Epoch, checksum
+	return nil
+}
+
+// behind reports whether the file holds an older ring than the one given
+func (f *StateFile) behind(epoch, checksum uint64) bool {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return epoch != f.epoch || checksum != f.checksum
+}
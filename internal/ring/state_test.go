@@ -0,0 +1,149 @@
+package ring
+
+import (
+	"testing"
+)
+
+func TestHashRingEpochAdvancesOnChange(t *testing.T) {
+	ring := NewHashRing(10)
+	ring.AddNode("node1")
+	ring.AddNode("node2")
+	ring.AddNode("node2")                      // Already present
+	ring.SetNodeTopology("node3", "dc1", "r1") // Not in the ring
+
+	if epoch := ring.Epoch(); epoch != 2 {
+		t.Fatalf("Expected epoch 2, got %d", epoch)
+	}
+
+	ring.SetNodeWeight("node1", 2)
+	ring.ReassignToken(ring.GetRingTokens()[0].Hash, "node2")
+	ring.RemoveNode("node2")
+	if epoch := ring.Epoch(); epoch != 5 {
+		t.Errorf("Expected epoch 5, got %d", epoch)
+	}
+}
+
+func TestHashRingStatePersistsAndReloads(t *testing.T) {
+	dir := t.TempDir()
+
+	ring := NewHashRing(10)
+	ring.SetStateFile(NewStateFile(dir))
+	ring.SetNodeTopology("node1", "dc1", "r1")
+	ring.AddNode("node1")
+	ring.AddNode("node2")
+	ring.ReassignToken(ring.GetRingTokens()[0].Hash, "node1")
+
+	saved, err := NewStateFile(dir).Load()
+	if err != nil || saved == nil {
+		t.Fatalf("Failed to load ring state: %v", err)
+	}
+
+	restored := NewHashRing(10)
+	if !restored.Adopt(saved) {
+		t.Fatal("Expected an empty ring to adopt the saved state")
+	}
+
+	epoch, checksum := ring.Version()
+	restoredEpoch, restoredChecksum := restored.Version()
+	if restoredEpoch != epoch || restoredChecksum != checksum {
+		t.Errorf("Restored ring at %d/%x, expected %d/%x", restoredEpoch, restoredChecksum, epoch, checksum)
+	}
+	if topo := restored.GetNodeTopology("node1"); topo.Datacenter != "dc1" || topo.Rack != "r1" {
+		t.Errorf("Topology not restored: %+v", topo)
+	}
+	for _, key := range []string{"a", "b", "c", "d", "e"} {
+		want, _ := ring.GetNodes(key, 2)
+		got, _ := restored.GetNodes(key, 2)
+		if len(want) != len(got) || want[0] != got[0] || want[1] != got[1] {
+			t.Errorf("Key %s placed on %v, expected %v", key, got, want)
+		}
+	}
+}
+
+func TestHashRingAdoptOnlyNewer(t *testing.T) {
+	older := NewHashRing(10)
+	older.AddNode("node1")
+
+	newer := NewHashRing(10)
+	newer.AddNode("node1")
+	newer.AddNode("node2")
+
+	if newer.Adopt(older.Snapshot()) {
+		t.Error("Adopted a ring with an older epoch")
+	}
+	if !older.Adopt(newer.Snapshot()) || older.Size() != 2 {
+		t.Error("Did not adopt a ring with a newer epoch")
+	}
+
+	// Rings at the same epoch settle on the higher checksum
+	a := NewHashRing(10)
+	a.AddNode("a")
+	b := NewHashRing(10)
+	b.AddNode("b")
+	adoptedByA := a.Adopt(b.Snapshot())
+	adoptedByB := b.Adopt(a.Snapshot())
+	if adoptedByA == adoptedByB {
+		t.Fatalf("Expected exactly one ring to adopt the other, got %v and %v", adoptedByA, adoptedByB)
+	}
+	_, checksumA := a.Version()
+	_, checksumB := b.Version()
+	if checksumA != checksumB {
+		t.Error("Rings did not converge")
+	}
+}
+
+func TestHashRingMergeKeepsConcurrentAdds(t *testing.T) {
+	base := NewHashRing(10)
+	base.AddNode("node1")
+	base.AddNode("node2")
+
+	// Two nodes each add a different member to the same ring
+	a := base.Clone()
+	a.AddNode("node3")
+	b := base.Clone()
+	b.AddNode("node4")
+
+	for i := 0; i < 3; i++ {
+		a.Merge(b.Snapshot(), nil)
+		b.Merge(a.Snapshot(), nil)
+	}
+
+	epochA, checksumA := a.Version()
+	epochB, checksumB := b.Version()
+	if epochA != epochB || checksumA != checksumB {
+		t.Fatalf("Rings did not converge: %d/%x and %d/%x", epochA, checksumA, epochB, checksumB)
+	}
+	for _, node := range []string{"node1", "node2", "node3", "node4"} {
+		if !a.HasNode(node) {
+			t.Errorf("Expected %s in the merged ring, got %v", node, a.GetAllNodes())
+		}
+	}
+
+	// Each member keeps the tokens it was placed at
+	reference := base.Clone()
+	reference.AddNode("node3")
+	reference.AddNode("node4")
+	if reference.Snapshot().Checksum() != checksumA {
+		t.Errorf("Expected the merged ring to hold every member at its own tokens")
+	}
+}
+
+func TestHashRingMergeDropsDeparted(t *testing.T) {
+	local := NewHashRing(10)
+	local.AddNode("node1")
+	local.AddNode("node2")
+
+	newer := NewHashRing(10)
+	newer.AddNode("node1")
+	for newer.Epoch() <= local.Epoch() {
+		newer.SetNodeWeight("node1", float64(newer.Epoch()+2))
+	}
+
+	adopted, restored := local.Merge(newer.Snapshot(), map[string]bool{"node2": true})
+	if !adopted || len(restored) != 0 || local.HasNode("node2") {
+		t.Errorf("Expected node2 to stay out of the ring, got adopted %v, restored %v", adopted, restored)
+	}
+	if local.Epoch() != newer.Epoch() {
+		t.Errorf("Expected epoch %d, got %d", newer.Epoch(), local.Epoch())
+	}
+}
@@ -11,6 +11,21 @@ type TokenRange struct {
 	NodeID     string `json:"node_id"`
 }
 
+// Contains reports whether a token falls in the range. A range whose
+// start is past its end wraps around the top of the ring.
+func (t TokenRange) Contains(token uint64) bool {
+	if t.StartToken <= t.EndToken {
+		return token >= t.StartToken && token <= t.EndToken
+	}
+	return token >= t.StartToken || token <= t.EndToken
+}
+
+// Size returns the number of tokens in the range. Unsigned subtraction
+// wraps, so this also holds for ranges that wrap around the ring.
+func (t TokenRange) Size() float64 {
+	return float64(t.EndToken-t.StartToken) + 1
+}
+
 // VNodeManager provides higher-level virtual node operations
 type VNodeManager struct {
 	ring *HashRing
@@ -69,24 +84,20 @@ func (m *VNodeManager) CalculateLoadDistribution() map[string]float64 {
 		return nil
 	}
 
-	nodeLoad := make(map[string]uint64)
-	var totalSpace uint64
+	// The ranges cover the whole 2^64 keyspace, which overflows a uint64,
+	// so sizes are summed as floats
+	nodeLoad := make(map[string]float64)
+	var totalSpace float64
 
 	for _, r := range ranges {
-		var rangeSize uint64
-		if r.EndToken >= r.StartToken {
-			rangeSize = r.EndToken - r.StartToken + 1
-		} else {
-			// Wraps around (shouldn't happen normally but handle it)
-			rangeSize = (^uint64(0) - r.StartToken) + r.EndToken + 2
-		}
+		rangeSize := r.Size()
 		nodeLoad[r.NodeID] += rangeSize
 		totalSpace += rangeSize
 	}
 
 	distribution := make(map[string]float64)
 	for nodeID, load := range nodeLoad {
-		distribution[nodeID] = float64(load) / float64(totalSpace) * 100
+		distribution[nodeID] = load / totalSpace * 100
 	}
 
 	return distribution
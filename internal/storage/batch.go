@@ -0,0 +1,36 @@
+package storage
+
+// batchOp is a single put or delete in a write batch
+type batchOp struct {
+	key       string
+	value     []byte
+	timestamp int64
+	isDeleted bool
+}
+
+// WriteBatch collects puts and deletes that are applied atomically by
+// Engine.Write: after a crash either every operation in the batch is
+// visible or none is
+type WriteBatch struct {
+	ops []batchOp
+}
+
+// NewWriteBatch creates an empty write batch
+func NewWriteBatch() *WriteBatch {
+	return &WriteBatch{}
+}
+
+// Put adds a put of a key-value pair to the batch
+func (b *WriteBatch) Put(key string, value []byte, timestamp int64) {
+	b.ops = append(b.ops, batchOp{key: key, value: value, timestamp: timestamp})
+}
+
+// Delete adds a tombstone for a key to the batch
+func (b *WriteBatch) Delete(key string, timestamp int64) {
+	b.ops = append(b.ops, batchOp{key: key, timestamp: timestamp, isDeleted: true})
+}
+
+// Len returns the number of operations in the batch
+func (b *WriteBatch) Len() int {
+	return len(b.ops)
+}
@@ -3,9 +3,11 @@ package storage
 import (
 	"bufio"
 	"encoding/binary"
+	"errors"
 	"fmt"
 	"hash/crc32"
 	"io"
+	"log"
 	"os"
 	"path/filepath"
 	"sync"
@@ -13,12 +15,21 @@ import (
 )
 
 const (
-	// File format: CRC32(4) + Timestamp(8) + KeyLen(4) + ValueLen(4) + Deleted(1) + Key + Value
+	// File format: CRC32(4) + Timestamp(8) + KeyLen(4) + ValueLen(4) + Flags(1) + Key + Value
 	headerSize    = 4 + 8 + 4 + 4 + 1 // 21 bytes
 	dataFileName  = "data.db"
 	hintFileName  = "hint.db"
 )
 
+// Record flags. Records written by a batch carry flagBatch and only take
+// effect once the batch's commit record (flagBatchCommit, whose value is
+// the number of records in the batch) has been read.
+const (
+	flagDeleted     byte = 1 << 0
+	flagBatch       byte = 1 << 1
+	flagBatchCommit byte = 1 << 2
+)
+
 // Bitcask implements the Bitcask storage model
 // - All writes are appended to a single file
 // - In-memory hash map stores key -> file offset
@@ -71,71 +82,116 @@ func NewBitcask(dataDir string, syncWrite bool) (*Bitcask, error) {
 
 	// Rebuild index from existing data
 	if pos > 0 {
-		if err := bc.rebuildIndex(); err != nil {
+		validSize, err := bc.rebuildIndex()
+		if err != nil {
 			dataFile.Close()
 			return nil, fmt.Errorf("failed to rebuild index: %w", err)
 		}
+
+		// Drop a torn or uncommitted tail left by a crash so new writes
+		// are not appended after it
+		if validSize < pos {
+			log.Printf("Truncating %d bytes of incomplete writes from %s", pos-validSize, dataPath)
+			if err := dataFile.Truncate(validSize); err != nil {
+				dataFile.Close()
+				return nil, fmt.Errorf("failed to truncate data file: %w", err)
+			}
+			bc.position = validSize
+		}
 	}
 
 	return bc, nil
 }
 
-// rebuildIndex reads the data file and rebuilds the in-memory index
-func (bc *Bitcask) rebuildIndex() error {
+// rebuildIndex reads the data file and rebuilds the in-memory index. It
+// returns the size of the valid prefix of the file: a record cut short by
+// a crash, and batch records without a commit record, are not applied.
+func (bc *Bitcask) rebuildIndex() (int64, error) {
 	file, err := os.Open(filepath.Join(bc.dataDir, dataFileName))
 	if err != nil {
-		return err
+		return 0, err
 	}
 	defer file.Close()
 
 	reader := bufio.NewReaderSize(file, 64*1024)
-	var offset int64
+	var offset, validSize int64
+	var pending []*Entry
+
+	apply := func(entry *Entry) {
+		if entry.IsDeleted {
+			bc.index.Delete(entry.Key, entry.Timestamp)
+		} else {
+			bc.index.Put(entry.Key, entry.Offset, entry.Size, entry.Timestamp)
+		}
+	}
 
 	for {
-		entry, bytesRead, err := bc.readEntry(reader, offset)
-		if err == io.EOF {
+		entry, flags, bytesRead, err := bc.readRecord(reader, offset)
+		if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+			// End of file, or a record cut short by a crash
 			break
 		}
 		if err != nil {
-			return fmt.Errorf("error at offset %d: %w", offset, err)
+			return 0, fmt.Errorf("error at offset %d: %w", offset, err)
 		}
+		offset += int64(bytesRead)
 
-		if entry.IsDeleted {
-			bc.index.Delete(entry.Key, entry.Timestamp)
-		} else {
-			bc.index.Put(entry.Key, offset, entry.Size, entry.Timestamp)
+		switch {
+		case flags&flagBatchCommit != 0:
+			// Records left over from a batch that failed part way are
+			// followed by a complete batch, so only the last count apply
+			count := int(binary.BigEndian.Uint32(entry.Value))
+			if count > len(pending) {
+				return 0, fmt.Errorf("error at offset %d: batch commit for %d records, found %d: %w",
+					entry.Offset, count, len(pending), ErrCorruptData)
+			}
+			for _, e := range pending[len(pending)-count:] {
+				apply(e)
+			}
+			pending = pending[:0]
+			validSize = offset
+		case flags&flagBatch != 0:
+			pending = append(pending, entry)
+		default:
+			pending = pending[:0]
+			apply(entry)
+			validSize = offset
 		}
-
-		offset += int64(bytesRead)
 	}
 
-	return nil
+	return validSize, nil
 }
 
 // readEntry reads a single entry from the data file
 func (bc *Bitcask) readEntry(reader io.Reader, offset int64) (*Entry, int, error) {
+	entry, _, n, err := bc.readRecord(reader, offset)
+	return entry, n, err
+}
+
+// readRecord reads a single record and its flags from the data file
+func (bc *Bitcask) readRecord(reader io.Reader, offset int64) (*Entry, byte, int, error) {
 	header := make([]byte, headerSize)
 	n, err := io.ReadFull(reader, header)
 	if err != nil {
-		return nil, n, err
+		return nil, 0, n, err
 	}
 
 	storedCRC := binary.BigEndian.Uint32(header[0:4])
 	timestamp := int64(binary.BigEndian.Uint64(header[4:12]))
 	keyLen := binary.BigEndian.Uint32(header[12:16])
 	valueLen := binary.BigEndian.Uint32(header[16:20])
-	isDeleted := header[20] == 1
+	flags := header[20]
 
 	// Read key
 	key := make([]byte, keyLen)
 	if _, err := io.ReadFull(reader, key); err != nil {
-		return nil, n, fmt.Errorf("failed to read key: %w", err)
+		return nil, 0, n, fmt.Errorf("failed to read key: %w", err)
 	}
 
 	// Read value
 	value := make([]byte, valueLen)
 	if _, err := io.ReadFull(reader, value); err != nil {
-		return nil, n, fmt.Errorf("failed to read value: %w", err)
+		return nil, 0, n, fmt.Errorf("failed to read value: %w", err)
 	}
 
 	// Verify CRC
@@ -143,7 +199,7 @@ func (bc *Bitcask) readEntry(reader io.Reader, offset int64) (*Entry, int, error
 	data = append(data, value...)
 	calculatedCRC := crc32.ChecksumIEEE(data)
 	if storedCRC != calculatedCRC {
-		return nil, n, ErrCorruptData
+		return nil, 0, n, ErrCorruptData
 	}
 
 	totalBytes := headerSize + int(keyLen) + int(valueLen)
@@ -152,14 +208,45 @@ func (bc *Bitcask) readEntry(reader io.Reader, offset int64) (*Entry, int, error
 		Key:       string(key),
 		Value:     value,
 		Timestamp: timestamp,
-		IsDeleted: isDeleted,
+		IsDeleted: flags&flagDeleted != 0,
 		Offset:    offset,
 		Size:      int32(valueLen),
-	}, totalBytes, nil
+	}, flags, totalBytes, nil
 }
 
 // writeEntry writes an entry to the data file
 func (bc *Bitcask) writeEntry(key string, value []byte, timestamp int64, isDeleted bool) (int64, error) {
+	var flags byte
+	if isDeleted {
+		flags = flagDeleted
+	}
+
+	offset, err := bc.writeRecord(key, value, timestamp, flags)
+	if err != nil {
+		return 0, err
+	}
+	if err := bc.syncIfConfigured(); err != nil {
+		return 0, err
+	}
+	return offset, nil
+}
+
+// syncIfConfigured flushes and syncs buffered writes when sync writes are enabled
+func (bc *Bitcask) syncIfConfigured() error {
+	if !bc.syncWrite {
+		return nil
+	}
+	if err := bc.writer.Flush(); err != nil {
+		return fmt.Errorf("failed to flush: %w", err)
+	}
+	if err := bc.dataFile.Sync(); err != nil {
+		return fmt.Errorf("failed to sync: %w", err)
+	}
+	return nil
+}
+
+// writeRecord buffers a single record with the given flags
+func (bc *Bitcask) writeRecord(key string, value []byte, timestamp int64, flags byte) (int64, error) {
 	keyBytes := []byte(key)
 	keyLen := uint32(len(keyBytes))
 	valueLen := uint32(len(value))
@@ -169,9 +256,7 @@ func (bc *Bitcask) writeEntry(key string, value []byte, timestamp int64, isDelet
 	binary.BigEndian.PutUint64(header[4:12], uint64(timestamp))
 	binary.BigEndian.PutUint32(header[12:16], keyLen)
 	binary.BigEndian.PutUint32(header[16:20], valueLen)
-	if isDeleted {
-		header[20] = 1
-	}
+	header[20] = flags
 
 	// Calculate CRC
 	data := append(header[4:], keyBytes...)
@@ -195,16 +280,6 @@ func (bc *Bitcask) writeEntry(key string, value []byte, timestamp int64, isDelet
 
 	bc.position += int64(totalSize)
 
-	// Sync if configured
-	if bc.syncWrite {
-		if err := bc.writer.Flush(); err != nil {
-			return 0, fmt.Errorf("failed to flush: %w", err)
-		}
-		if err := bc.dataFile.Sync(); err != nil {
-			return 0, fmt.Errorf("failed to sync: %w", err)
-		}
-	}
-
 	return offset, nil
 }
 
@@ -288,6 +363,53 @@ func (bc *Bitcask) Delete(key string, timestamp int64) error {
 	return nil
 }
 
+// Write applies a batch atomically. Its records are followed by a commit
+// record, and on recovery a batch without one is discarded.
+func (bc *Bitcask) Write(batch *WriteBatch) error {
+	bc.mu.Lock()
+	defer bc.mu.Unlock()
+
+	if bc.closed {
+		return ErrStorageClosed
+	}
+	if batch.Len() == 0 {
+		return nil
+	}
+
+	atomic.AddUint64(&bc.totalWrites, uint64(batch.Len()))
+
+	offsets := make([]int64, len(batch.ops))
+	for i, op := range batch.ops {
+		flags := flagBatch
+		if op.isDeleted {
+			flags |= flagDeleted
+		}
+		offset, err := bc.writeRecord(op.key, op.value, op.timestamp, flags)
+		if err != nil {
+			return err
+		}
+		offsets[i] = offset
+	}
+
+	count := make([]byte, 4)
+	binary.BigEndian.PutUint32(count, uint32(len(batch.ops)))
+	if _, err := bc.writeRecord("", count, batch.ops[len(batch.ops)-1].timestamp, flagBatchCommit); err != nil {
+		return err
+	}
+	if err := bc.syncIfConfigured(); err != nil {
+		return err
+	}
+
+	for i, op := range batch.ops {
+		if op.isDeleted {
+			bc.index.Delete(op.key, op.timestamp)
+		} else {
+			bc.index.Put(op.key, offsets[i], int32(len(op.value)), op.timestamp)
+		}
+	}
+	return nil
+}
+
 // Has checks if a key exists and is not deleted
 func (bc *Bitcask) Has(key string) bool {
 	bc.mu.RLock()
@@ -300,6 +422,22 @@ func (bc *Bitcask) Has(key string) bool {
 	return bc.index.Has(key)
 }
 
+// Timestamp returns the timestamp of the latest write to a key, including tombstones
+func (bc *Bitcask) Timestamp(key string) (int64, bool) {
+	bc.mu.RLock()
+	defer bc.mu.RUnlock()
+
+	if bc.closed {
+		return 0, false
+	}
+
+	entry, exists := bc.index.Get(key)
+	if !exists {
+		return 0, false
+	}
+	return entry.Timestamp, true
+}
+
 // Keys returns all active keys
 func (bc *Bitcask) Keys() []string {
 	bc.mu.RLock()
@@ -312,6 +450,29 @@ func (bc *Bitcask) Keys() []string {
 	return bc.index.Keys()
 }
 
+// MaxTimestamp returns the highest timestamp of any write held, including tombstones
+func (bc *Bitcask) MaxTimestamp() int64 {
+	bc.mu.RLock()
+	defer bc.mu.RUnlock()
+
+	if bc.closed {
+		return 0
+	}
+	return bc.index.MaxTimestamp()
+}
+
+// Tombstones returns the keys whose latest write is a delete
+func (bc *Bitcask) Tombstones() []string {
+	bc.mu.RLock()
+	defer bc.mu.RUnlock()
+
+	if bc.closed {
+		return nil
+	}
+
+	return bc.index.DeletedKeys()
+}
+
 // Count returns the number of active keys
 func (bc *Bitcask) Count() int64 {
 	bc.mu.RLock()
@@ -125,6 +125,33 @@ func TestBitcaskPersistence(t *testing.T) {
 	}
 }
 
+func TestBitcaskMaxTimestamp(t *testing.T) {
+	dir := t.TempDir()
+
+	bc, err := NewBitcask(dir, false)
+	if err != nil {
+		t.Fatalf("Failed to create Bitcask: %v", err)
+	}
+	if ts := bc.MaxTimestamp(); ts != 0 {
+		t.Errorf("Expected 0 for an empty store, got %d", ts)
+	}
+
+	bc.Put("key1", []byte("value1"), 300)
+	bc.Put("key2", []byte("value2"), 100)
+	bc.Delete("key3", 500)
+	bc.Close()
+
+	// The tombstone's timestamp survives a restart
+	bc, err = NewBitcask(dir, false)
+	if err != nil {
+		t.Fatalf("Failed to reopen Bitcask: %v", err)
+	}
+	defer bc.Close()
+	if ts := bc.MaxTimestamp(); ts != 500 {
+		t.Errorf("Expected 500, got %d", ts)
+	}
+}
+
 func TestBitcaskCompaction(t *testing.T) {
 	dir := t.TempDir()
 
@@ -142,6 +169,11 @@ func TestBitcaskCompaction(t *testing.T) {
 	bc.Delete("key2", time.Now().UnixNano())
 	bc.Put("key3", []byte("value3"), time.Now().UnixNano())
 
+	// Flush buffered writes, or the file is still empty
+	if err := bc.Sync(); err != nil {
+		t.Fatalf("Failed to sync: %v", err)
+	}
+
 	// Get initial file size
 	initialSize := getFileSize(filepath.Join(dir, "data.db"))
 
@@ -236,6 +268,104 @@ func TestBitcaskStats(t *testing.T) {
 	}
 }
 
+func TestBitcaskWriteBatch(t *testing.T) {
+	dir := t.TempDir()
+
+	bc, err := NewBitcask(dir, false)
+	if err != nil {
+		t.Fatalf("Failed to create Bitcask: %v", err)
+	}
+
+	bc.Put("key1", []byte("old"), 1)
+
+	batch := NewWriteBatch()
+	batch.Put("key1", []byte("new"), 2)
+	batch.Put("key2", []byte("value2"), 2)
+	batch.Delete("key3", 2)
+	if err := bc.Write(batch); err != nil {
+		t.Fatalf("Failed to write batch: %v", err)
+	}
+
+	value, _, err := bc.Get("key1")
+	if err != nil || string(value) != "new" {
+		t.Errorf("Expected key1 = new, got %q (%v)", value, err)
+	}
+	if bc.Count() != 2 {
+		t.Errorf("Expected count 2, got %d", bc.Count())
+	}
+	bc.Close()
+
+	// The batch survives a restart
+	bc2, err := NewBitcask(dir, false)
+	if err != nil {
+		t.Fatalf("Failed to reopen Bitcask: %v", err)
+	}
+	defer bc2.Close()
+
+	value, _, err = bc2.Get("key2")
+	if err != nil || string(value) != "value2" {
+		t.Errorf("Expected key2 = value2 after restart, got %q (%v)", value, err)
+	}
+	if ts, exists := bc2.Timestamp("key3"); !exists || ts != 2 {
+		t.Errorf("Expected tombstone for key3 at 2, got %d (%v)", ts, exists)
+	}
+}
+
+func TestBitcaskWriteBatchRecovery(t *testing.T) {
+	dir := t.TempDir()
+	dataPath := filepath.Join(dir, "data.db")
+
+	bc, err := NewBitcask(dir, false)
+	if err != nil {
+		t.Fatalf("Failed to create Bitcask: %v", err)
+	}
+
+	bc.Put("key1", []byte("value1"), 1)
+	batch := NewWriteBatch()
+	batch.Put("key1", []byte("batched"), 2)
+	batch.Put("key2", []byte("batched"), 2)
+	bc.Write(batch)
+	bc.Close()
+	committedSize := getFileSize(dataPath)
+
+	// Simulate a crash before the commit record reached the disk, with
+	// part of the commit record written
+	if err := os.Truncate(dataPath, committedSize-10); err != nil {
+		t.Fatalf("Failed to truncate: %v", err)
+	}
+
+	bc2, err := NewBitcask(dir, false)
+	if err != nil {
+		t.Fatalf("Failed to reopen Bitcask: %v", err)
+	}
+
+	value, _, err := bc2.Get("key1")
+	if err != nil || string(value) != "value1" {
+		t.Errorf("Expected key1 = value1 without the batch, got %q (%v)", value, err)
+	}
+	if bc2.Has("key2") {
+		t.Error("key2 from an uncommitted batch should not be visible")
+	}
+
+	// The incomplete batch is dropped so later writes are readable
+	bc2.Put("key3", []byte("value3"), 3)
+	bc2.Close()
+
+	bc3, err := NewBitcask(dir, false)
+	if err != nil {
+		t.Fatalf("Failed to reopen Bitcask after recovery: %v", err)
+	}
+	defer bc3.Close()
+
+	value, _, err = bc3.Get("key3")
+	if err != nil || string(value) != "value3" {
+		t.Errorf("Expected key3 = value3, got %q (%v)", value, err)
+	}
+	if bc3.Has("key2") {
+		t.Error("key2 should stay invisible after recovery")
+	}
+}
+
 func getFileSize(path string) int64 {
 	info, err := os.Stat(path)
 	if err != nil {
@@ -11,6 +11,10 @@ var (
 	ErrStorageClosed = errors.New("storage engine is closed")
 )
 
+// SystemKeyPrefix marks keys holding internal node state (such as Paxos
+// acceptor state) that are not visible to clients
+const SystemKeyPrefix = "__system/"
+
 // Engine defines the interface for the storage backend
 type Engine interface {
 	// Get retrieves a value by key
@@ -24,12 +28,28 @@ type Engine interface {
 	// Delete marks a key as deleted (tombstone)
 	Delete(key string, timestamp int64) error
 
+	// Write applies every operation in a batch atomically; after a crash
+	// either all of them are visible or none are
+	Write(batch *WriteBatch) error
+
 	// Has checks if a key exists and is not deleted
 	Has(key string) bool
 
+	// Timestamp returns the timestamp of the latest write to a key,
+	// including tombstones, and whether the key has ever been written
+	Timestamp(key string) (int64, bool)
+
+	// MaxTimestamp returns the highest timestamp of any write held,
+	// including tombstones, or 0 if nothing was written
+	MaxTimestamp() int64
+
 	// Keys returns all active keys
 	Keys() []string
 
+	// Tombstones returns the keys whose latest write is a delete, until
+	// compaction drops them
+	Tombstones() []string
+
 	// Count returns the number of active keys
 	Count() int64
 
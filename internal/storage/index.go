@@ -118,6 +118,35 @@ func (idx *Index) Keys() []string {
 	return keys
 }
 
+// DeletedKeys returns all deleted keys (tombstones)
+func (idx *Index) DeletedKeys() []string {
+	idx.mu.RLock()
+	defer idx.mu.RUnlock()
+
+	keys := make([]string, 0, idx.stats.deleted)
+	for key, entry := range idx.entries {
+		if entry.IsDeleted {
+			keys = append(keys, key)
+		}
+	}
+	return keys
+}
+
+// MaxTimestamp returns the highest timestamp of any entry, tombstones
+// included, or 0 if the index is empty
+func (idx *Index) MaxTimestamp() int64 {
+	idx.mu.RLock()
+	defer idx.mu.RUnlock()
+
+	var max int64
+	for _, entry := range idx.entries {
+		if entry.Timestamp > max {
+			max = entry.Timestamp
+		}
+	}
+	return max
+}
+
 // Count returns the number of active keys
 func (idx *Index) Count() int64 {
 	idx.mu.RLock()
@@ -0,0 +1,105 @@
+package versioning
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// logicalBits is the number of low-order bits of an HLC timestamp that hold
+// the logical counter. The remaining bits are wall-clock nanoseconds, so HLC
+// timestamps are ordered like (and stay comparable with) UnixNano values.
+const logicalBits = 16
+
+const logicalMask = int64(1)<<logicalBits - 1
+
+// ErrClockSkew is returned when a remote timestamp is further ahead of the
+// local wall clock than the configured bound
+var ErrClockSkew = errors.New("clock skew exceeds bound")
+
+// HLC is a hybrid logical clock. Timestamps it issues never go backwards,
+// are always greater than any timestamp the clock has observed, and stay
+// close to physical time, so last-write-wins respects causality even when
+// node clocks disagree.
+type HLC struct {
+	mu      sync.Mutex
+	last    int64         // Highest timestamp issued or observed
+	maxSkew time.Duration // Maximum tolerated lead of remote clocks (0 = unbounded)
+	now     func() time.Time
+}
+
+// NewHLC creates a hybrid logical clock
+func NewHLC(maxSkew time.Duration) *HLC {
+	return &HLC{
+		maxSkew: maxSkew,
+		now:     time.Now,
+	}
+}
+
+// Now returns a new timestamp greater than every timestamp issued or
+// observed so far
+func (c *HLC) Now() int64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	physical := c.now().UnixNano() &^ logicalMask
+	if physical > c.last {
+		c.last = physical
+	} else {
+		c.last++
+	}
+	return c.last
+}
+
+// Update advances the clock past a timestamp received from another node.
+// A timestamp more than maxSkew ahead of the local wall clock is not
+// applied and ErrClockSkew is returned, so a single bad clock cannot drag
+// the cluster into the future.
+func (c *HLC) Update(remote int64) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.maxSkew > 0 {
+		if skew := time.Duration(remote - c.now().UnixNano()); skew > c.maxSkew {
+			return fmt.Errorf("%w: remote clock ahead by %v (max %v)", ErrClockSkew, skew, c.maxSkew)
+		}
+	}
+
+	if remote > c.last {
+		c.last = remote
+	}
+	return nil
+}
+
+// Restore advances the clock to a timestamp it issued or observed before
+// a restart, such as the newest version in storage, so new timestamps
+// stay above versions already acknowledged even if the wall clock went
+// back or logical ticks ran ahead of it. Unlike Update it is not bounded
+// by the skew limit, since the timestamp came from this node.
+func (c *HLC) Restore(last int64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if last > c.last {
+		c.last = last
+	}
+}
+
+// Last returns the highest timestamp issued or observed without advancing
+// the clock
+func (c *HLC) Last() int64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.last
+}
+
+// PhysicalTime returns the wall-clock component of an HLC timestamp
+func PhysicalTime(ts int64) time.Time {
+	return time.Unix(0, ts&^logicalMask)
+}
+
+// LogicalCount returns the logical counter of an HLC timestamp
+func LogicalCount(ts int64) int64 {
+	return ts & logicalMask
+}
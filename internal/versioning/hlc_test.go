@@ -0,0 +1,86 @@
+package versioning
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func newTestHLC(maxSkew time.Duration, wall *time.Time) *HLC {
+	c := NewHLC(maxSkew)
+	c.now = func() time.Time { return *wall }
+	return c
+}
+
+func TestHLCMonotonic(t *testing.T) {
+	wall := time.Unix(1000, 0)
+	c := newTestHLC(0, &wall)
+
+	first := c.Now()
+	second := c.Now()
+	if second <= first {
+		t.Errorf("Timestamps must increase with a frozen clock: %d <= %d", second, first)
+	}
+	if LogicalCount(second) != 1 {
+		t.Errorf("Expected logical count 1, got %d", LogicalCount(second))
+	}
+
+	// Wall clock stepping backwards must not move timestamps backwards
+	wall = wall.Add(-time.Second)
+	if third := c.Now(); third <= second {
+		t.Errorf("Timestamp went backwards after clock step: %d <= %d", third, second)
+	}
+}
+
+func TestHLCUpdateFromSkewedNode(t *testing.T) {
+	wall := time.Unix(1000, 0)
+	c := newTestHLC(time.Second, &wall)
+
+	// A node 500ms ahead is within bounds; our next write must beat its write
+	remote := wall.Add(500 * time.Millisecond).UnixNano()
+	if err := c.Update(remote); err != nil {
+		t.Fatalf("Update within bound failed: %v", err)
+	}
+	if ts := c.Now(); ts <= remote {
+		t.Errorf("Local timestamp %d should follow observed %d", ts, remote)
+	}
+
+	// A node an hour ahead is rejected and does not advance the clock
+	before := c.Last()
+	err := c.Update(wall.Add(time.Hour).UnixNano())
+	if !errors.Is(err, ErrClockSkew) {
+		t.Errorf("Expected ErrClockSkew, got %v", err)
+	}
+	if c.Last() != before {
+		t.Error("Rejected timestamp should not advance the clock")
+	}
+}
+
+func TestHLCPhysicalTime(t *testing.T) {
+	wall := time.Unix(1000, 123456789)
+	c := newTestHLC(0, &wall)
+
+	ts := c.Now()
+	if d := wall.Sub(PhysicalTime(ts)); d < 0 || d > time.Millisecond {
+		t.Errorf("Physical time %v too far from wall clock %v", PhysicalTime(ts), wall)
+	}
+}
+
+func TestHLCRestore(t *testing.T) {
+	wall := time.Unix(1000, 0)
+	c := newTestHLC(time.Second, &wall)
+
+	// The newest stored version is an hour ahead, beyond the skew bound
+	stored := wall.Add(time.Hour).UnixNano() + 3
+	c.Restore(stored)
+	if ts := c.Now(); ts <= stored {
+		t.Errorf("Timestamp %d not above restored %d", ts, stored)
+	}
+
+	// Restoring an older timestamp never moves the clock back
+	last := c.Last()
+	c.Restore(wall.UnixNano())
+	if c.Last() != last {
+		t.Errorf("Restore moved the clock back from %d to %d", last, c.Last())
+	}
+}
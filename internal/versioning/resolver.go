@@ -7,6 +7,17 @@ import (
 // Resolver handles conflict resolution between versions
 type Resolver struct {
 	strategy ResolveStrategy
+	mergers  []Merger
+}
+
+// Merger merges values of a mergeable data type (such as a CRDT) instead
+// of picking a single winner
+type Merger interface {
+	// CanMerge reports whether the merger handles a value
+	CanMerge(value []byte) bool
+
+	// Merge combines two values the merger handles
+	Merge(a, b []byte) ([]byte, error)
 }
 
 // ResolveStrategy defines how to resolve conflicts
@@ -24,7 +35,30 @@ func NewResolver(strategy ResolveStrategy) *Resolver {
 	return &Resolver{strategy: strategy}
 }
 
-// Resolve picks the winning version from multiple conflicting entries
+// RegisterMerger adds a merger consulted before the resolve strategy
+func (r *Resolver) RegisterMerger(m Merger) {
+	r.mergers = append(r.mergers, m)
+}
+
+// MergeValues merges two values using the first registered merger that
+// handles both, reporting whether one did
+func (r *Resolver) MergeValues(a, b []byte) ([]byte, bool) {
+	for _, m := range r.mergers {
+		if !m.CanMerge(a) || !m.CanMerge(b) {
+			continue
+		}
+		merged, err := m.Merge(a, b)
+		if err != nil {
+			return nil, false
+		}
+		return merged, true
+	}
+	return nil, false
+}
+
+// Resolve picks the winning version from multiple conflicting entries.
+// Entries whose values a registered merger handles are merged instead,
+// taking the newest timestamp.
 func (r *Resolver) Resolve(entries []types.KeyValueEntry) types.KeyValueEntry {
 	if len(entries) == 0 {
 		return types.KeyValueEntry{}
@@ -33,6 +67,10 @@ func (r *Resolver) Resolve(entries []types.KeyValueEntry) types.KeyValueEntry {
 		return entries[0]
 	}
 
+	if merged, ok := r.mergeAll(entries); ok {
+		return merged
+	}
+
 	switch r.strategy {
 	case LastWriteWins:
 		return r.resolveByTimestamp(entries)
@@ -43,6 +81,29 @@ func (r *Resolver) Resolve(entries []types.KeyValueEntry) types.KeyValueEntry {
 	}
 }
 
+// mergeAll merges every entry when all of them are mergeable values
+func (r *Resolver) mergeAll(entries []types.KeyValueEntry) (types.KeyValueEntry, bool) {
+	if len(r.mergers) == 0 {
+		return types.KeyValueEntry{}, false
+	}
+
+	merged := entries[0]
+	for _, e := range entries[1:] {
+		if merged.IsDeleted || e.IsDeleted {
+			return types.KeyValueEntry{}, false
+		}
+		value, ok := r.MergeValues(merged.Value, e.Value)
+		if !ok {
+			return types.KeyValueEntry{}, false
+		}
+		merged.Value = value
+		if e.Timestamp > merged.Timestamp {
+			merged.Timestamp = e.Timestamp
+		}
+	}
+	return merged, true
+}
+
 // resolveByTimestamp picks the entry with the highest timestamp
 func (r *Resolver) resolveByTimestamp(entries []types.KeyValueEntry) types.KeyValueEntry {
 	winner := entries[0]
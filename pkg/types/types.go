@@ -1,6 +1,9 @@
 package types
 
 import (
+	"fmt"
+	"strconv"
+	"strings"
 	"time"
 )
 
@@ -26,14 +29,43 @@ func (s NodeState) String() string {
 	}
 }
 
+// RingState is a node's progress joining or leaving the ring. Unlike
+// NodeState it says whether the node holds its data, not whether it is
+// reachable.
+type RingState string
+
+const (
+	RingJoining   RingState = "joining"   // In the ring, computing the ranges it will own
+	RingStreaming RingState = "streaming" // Receiving the data for its ranges
+	RingReady     RingState = "ready"     // Holds its data and serves reads
+	RingLeaving   RingState = "leaving"   // Handing its ranges to their new owners
+	RingLeft      RingState = "left"      // Out of the ring for good
+)
+
+// ServesReads reports whether a node in this state may answer reads.
+// Nodes that never reported a state are ready.
+func (s RingState) ServesReads() bool {
+	return s == "" || s == RingReady || s == RingLeaving
+}
+
+// Departing reports whether a node in this state is giving up its ranges
+func (s RingState) Departing() bool {
+	return s == RingLeaving || s == RingLeft
+}
+
 // Node represents a node in the distributed cluster
 type Node struct {
-	ID        string    `json:"id"`
-	Address   string    `json:"address"`
-	Port      int       `json:"port"`
-	State     NodeState `json:"state"`
-	LastSeen  time.Time `json:"last_seen"`
-	TokenRing []uint64  `json:"token_ring,omitempty"` // Virtual node positions
+	ID         string    `json:"id"`
+	Address    string    `json:"address"`
+	Port       int       `json:"port"`
+	GossipPort int       `json:"gossip_port,omitempty"`
+	State      NodeState `json:"state"`
+	LastSeen   time.Time `json:"last_seen"`
+	TokenRing  []uint64  `json:"token_ring,omitempty"` // Virtual node positions
+	Datacenter string    `json:"datacenter,omitempty"`
+	Rack       string    `json:"rack,omitempty"`
+	RingState  RingState `json:"ring_state,omitempty"`
+	Weight     float64   `json:"weight,omitempty"` // Capacity relative to the default of 1
 }
 
 // FullAddress returns the complete address string (host:port)
@@ -117,10 +149,184 @@ type ConsistencyLevel string
 
 const (
 	ConsistencyOne    ConsistencyLevel = "one"
+	ConsistencyTwo    ConsistencyLevel = "two"
+	ConsistencyThree  ConsistencyLevel = "three"
 	ConsistencyQuorum ConsistencyLevel = "quorum"
 	ConsistencyAll    ConsistencyLevel = "all"
+
+	// Multi-datacenter levels
+	ConsistencyLocalQuorum ConsistencyLevel = "local_quorum" // Quorum of replicas in the coordinator's datacenter
+	ConsistencyEachQuorum  ConsistencyLevel = "each_quorum"  // Quorum of replicas in every datacenter
+
+	// ConsistencyLinearizable reads from a majority and writes the value back
+	// to a majority before answering, so no later read returns an older value
+	ConsistencyLinearizable ConsistencyLevel = "linearizable"
+)
+
+// ParseConsistencyLevel parses a named level ("one", "quorum", ...) or a
+// numeric replica count such as "4". An empty string yields quorum.
+func ParseConsistencyLevel(s string) (ConsistencyLevel, error) {
+	level := ConsistencyLevel(strings.ToLower(strings.TrimSpace(s)))
+	switch level {
+	case "":
+		return ConsistencyQuorum, nil
+	case ConsistencyOne, ConsistencyTwo, ConsistencyThree, ConsistencyQuorum, ConsistencyAll,
+		ConsistencyLocalQuorum, ConsistencyEachQuorum, ConsistencyLinearizable:
+		return level, nil
+	}
+
+	n, err := strconv.Atoi(string(level))
+	if err != nil || n < 1 {
+		return "", fmt.Errorf("invalid consistency level %q", s)
+	}
+	return level, nil
+}
+
+// ReplicaCount returns the fixed number of replicas the level requires,
+// or 0 for levels that depend on the replication settings
+func (c ConsistencyLevel) ReplicaCount() int {
+	switch c {
+	case ConsistencyOne:
+		return 1
+	case ConsistencyTwo:
+		return 2
+	case ConsistencyThree:
+		return 3
+	case ConsistencyQuorum, ConsistencyAll, ConsistencyLocalQuorum, ConsistencyEachQuorum,
+		ConsistencyLinearizable:
+		return 0
+	}
+	if n, err := strconv.Atoi(string(c)); err == nil && n > 0 {
+		return n
+	}
+	return 0
+}
+
+// ConsistencyOptions carries per-request replication overrides.
+// Explicit R and W take precedence over the level.
+type ConsistencyOptions struct {
+	Level ConsistencyLevel `json:"consistency,omitempty"`
+	N     int              `json:"n,omitempty"` // Replicas to contact (0 = replication factor)
+	R     int              `json:"r,omitempty"` // Read acks required (0 = derived from level)
+	W     int              `json:"w,omitempty"` // Write acks required (0 = derived from level)
+
+	// MinVersion is the oldest version of the key the client's session has
+	// observed; reads wait for a replica at least this fresh (0 = none)
+	MinVersion int64 `json:"min_version,omitempty"`
+}
+
+// WriteResult reports the outcome of a replicated write
+type WriteResult struct {
+	Timestamp int64 `json:"version"`
+	Acks      int   `json:"acks"`     // Replicas that acknowledged the write
+	Required  int   `json:"required"` // Acks needed for success
+	Replicas  int   `json:"replicas"` // Replicas contacted
+}
+
+// ReadResult reports the outcome of a replicated read
+type ReadResult struct {
+	Value     []byte `json:"-"`
+	Timestamp int64  `json:"version"`
+	Acks      int    `json:"acks"`     // Replicas that returned the key
+	Required  int    `json:"required"` // Responses needed for success
+	Replicas  int    `json:"replicas"` // Replicas in the preference list
+}
+
+// CASCondition is the precondition of a compare-and-set write
+type CASCondition struct {
+	IfNoneMatch bool  // Key must not exist (If-None-Match: *)
+	IfExists    bool  // Key must exist (If-Match: *)
+	IfVersion   int64 // Key must currently have this version (If-Match: "<version>")
+}
+
+// Holds reports whether the condition is met by the current value of a
+// key (nil if the key does not exist)
+func (c CASCondition) Holds(current *KeyValueEntry) bool {
+	exists := current != nil && !current.IsDeleted
+	if c.IfNoneMatch && exists {
+		return false
+	}
+	if c.IfExists && !exists {
+		return false
+	}
+	if c.IfVersion != 0 && (!exists || current.Timestamp != c.IfVersion) {
+		return false
+	}
+	return true
+}
+
+// CASResult reports the outcome of a compare-and-set write
+type CASResult struct {
+	Applied   bool           `json:"applied"`
+	Timestamp int64          `json:"version,omitempty"` // Version written when applied
+	Current   *KeyValueEntry `json:"current,omitempty"` // Value that failed the condition
+}
+
+// Batch operation kinds
+const (
+	BatchPut    = "put"
+	BatchDelete = "delete"
+)
+
+// BatchOperation is a single put or delete in a batch write
+type BatchOperation struct {
+	Op    string `json:"op"` // BatchPut or BatchDelete
+	Key   string `json:"key"`
+	Value string `json:"value,omitempty"`
+}
+
+// BatchKeyResult reports the outcome of a batch write for one key
+type BatchKeyResult struct {
+	Key      string `json:"key"`
+	Success  bool   `json:"success"`
+	Acks     int    `json:"acks"`     // Replicas that acknowledged the key's group
+	Required int    `json:"required"` // Acks needed for success
+	Replicas int    `json:"replicas"` // Replicas contacted
+	Error    string `json:"error,omitempty"`
+}
+
+// BatchResult reports the outcome of a batch write. Every operation is
+// written at the same version.
+type BatchResult struct {
+	Timestamp int64            `json:"version"`
+	Results   []BatchKeyResult `json:"results"`
+}
+
+// Failed returns the number of keys whose write did not meet its quorum
+func (r *BatchResult) Failed() int {
+	failed := 0
+	for _, result := range r.Results {
+		if !result.Success {
+			failed++
+		}
+	}
+	return failed
+}
+
+// TxnStatus is the state of a transaction
+type TxnStatus string
+
+const (
+	TxnPending   TxnStatus = "pending"
+	TxnCommitted TxnStatus = "committed"
+	TxnAborted   TxnStatus = "aborted"
 )
 
+// TxnRead is a key read by a transaction and the version it observed
+// (0 if the key did not exist)
+type TxnRead struct {
+	Key     string `json:"key"`
+	Version int64  `json:"version"`
+}
+
+// TxnResult reports the outcome of a transaction
+type TxnResult struct {
+	ID        string    `json:"id"`
+	Status    TxnStatus `json:"status"`
+	Timestamp int64     `json:"version,omitempty"`   // Version of the writes when committed
+	Conflicts []TxnRead `json:"conflicts,omitempty"` // Current versions of reads that changed
+}
+
 // PutRequest represents a request to store a key-value pair
 type PutRequest struct {
 	Key         string           `json:"key"`
@@ -153,10 +359,19 @@ type ClusterStatus struct {
 
 // NodeInfo provides information about a node in the cluster
 type NodeInfo struct {
-	ID       string    `json:"id"`
-	Address  string    `json:"address"`
-	State    string    `json:"state"`
-	LastSeen time.Time `json:"last_seen"`
+	ID          string    `json:"id"`
+	Address     string    `json:"address"`
+	Port        int       `json:"port,omitempty"`        // HTTP port
+	GossipPort  int       `json:"gossip_port,omitempty"` // UDP port for gossip
+	State       string    `json:"state"`
+	Incarnation uint64    `json:"incarnation,omitempty"` // Raised by the node to refute suspicion or change its details
+	Heartbeat   uint64    `json:"heartbeat,omitempty"`   // Counted up by the node every gossip round
+	LastSeen    time.Time `json:"last_seen"`
+	Datacenter  string    `json:"datacenter,omitempty"`
+	Rack        string    `json:"rack,omitempty"`
+	RingState   RingState `json:"ring_state,omitempty"`
+	Weight      float64   `json:"weight,omitempty"` // Capacity relative to the default of 1
+	Tokens      []uint64  `json:"tokens,omitempty"` // Ring positions, sent with full entries
 }
 
 // RingToken represents a position on the hash ring
@@ -175,20 +390,207 @@ type HintedHandoff struct {
 
 // ReplicationRequest is sent between nodes to replicate data
 type ReplicationRequest struct {
-	Entry     KeyValueEntry `json:"entry"`
-	FromNode  string        `json:"from_node"`
-	IsHandoff bool          `json:"is_handoff"`
+	Entry        KeyValueEntry `json:"entry"`
+	FromNode     string        `json:"from_node"`
+	IsHandoff    bool          `json:"is_handoff"`
+	RingEpoch    uint64        `json:"ring_epoch,omitempty"`    // Epoch of the ring the sender routed with
+	RingChecksum uint64        `json:"ring_checksum,omitempty"` // Checksum of the ring the sender routed with
+	ClientWrite  bool          `json:"client_write,omitempty"`  // A client write, refused while a transaction locks the key
+}
+
+// BatchReplicationRequest is sent between nodes to apply a group of
+// entries atomically on a replica
+type BatchReplicationRequest struct {
+	Entries      []KeyValueEntry `json:"entries"`
+	FromNode     string          `json:"from_node"`
+	RingEpoch    uint64          `json:"ring_epoch,omitempty"`    // Epoch of the ring the sender routed with
+	RingChecksum uint64          `json:"ring_checksum,omitempty"` // Checksum of the ring the sender routed with
+	ClientWrite  bool            `json:"client_write,omitempty"`  // A client write, refused while a transaction locks a key
+}
+
+// TxnPrepareRequest asks a replica to lock keys and record the writes of
+// a transaction it must apply if the transaction commits
+type TxnPrepareRequest struct {
+	TxnID       string          `json:"txn_id"`
+	Coordinator string          `json:"coordinator"`
+	Keys        []string        `json:"keys"`
+	Entries     []KeyValueEntry `json:"entries"`
+}
+
+// TxnPrepareResponse reports the newest version a replica holds of the
+// keys it locked, which the transaction's commit version must exceed
+type TxnPrepareResponse struct {
+	Success bool  `json:"success"`
+	Version int64 `json:"version"`
+}
+
+// TxnDecisionRequest tells a replica the outcome of a prepared transaction
+type TxnDecisionRequest struct {
+	TxnID   string          `json:"txn_id"`
+	Commit  bool            `json:"commit"`
+	Entries []KeyValueEntry `json:"entries,omitempty"` // Writes to apply on commit
+}
+
+// TxnStatusRequest asks the coordinator of a transaction for its status
+type TxnStatusRequest struct {
+	TxnID string `json:"txn_id"`
+}
+
+// TxnStatusResponse reports a transaction's status as known to its coordinator
+type TxnStatusResponse struct {
+	TxnID     string    `json:"txn_id"`
+	Status    TxnStatus `json:"status"`
+	Timestamp int64     `json:"timestamp,omitempty"` // Version the writes of a committed transaction are applied at
+}
+
+// Ballot orders Paxos proposals for a key. Ballots compare by timestamp,
+// with the proposing node breaking ties.
+type Ballot struct {
+	Timestamp int64  `json:"timestamp"`
+	NodeID    string `json:"node_id"`
+}
+
+// Less reports whether b is ordered before other
+func (b Ballot) Less(other Ballot) bool {
+	if b.Timestamp != other.Timestamp {
+		return b.Timestamp < other.Timestamp
+	}
+	return b.NodeID < other.NodeID
+}
+
+// IsZero reports whether the ballot is unset
+func (b Ballot) IsZero() bool {
+	return b.Timestamp == 0 && b.NodeID == ""
+}
+
+// PaxosRequest is sent by a proposer for the prepare, propose and commit
+// phases of a single-key Paxos round
+type PaxosRequest struct {
+	Key      string         `json:"key"`
+	Ballot   Ballot         `json:"ballot"`
+	Entry    *KeyValueEntry `json:"entry,omitempty"` // Proposed value (propose and commit)
+	FromNode string         `json:"from_node"`
+}
+
+// PaxosResponse is a replica's answer to a Paxos request
+type PaxosResponse struct {
+	OK            bool           `json:"ok"`
+	Promised      Ballot         `json:"promised"`                 // Highest ballot promised
+	Accepted      Ballot         `json:"accepted"`                 // Ballot of the accepted, uncommitted proposal
+	AcceptedEntry *KeyValueEntry `json:"accepted_entry,omitempty"` // Value of the accepted proposal
+	Committed     Ballot         `json:"committed"`                // Most recently committed ballot
+	Current       *KeyValueEntry `json:"current,omitempty"`        // Replica's current value (prepare)
+	Locked        bool           `json:"locked,omitempty"`         // Refused because a transaction locks the key
+}
+
+// StreamRange is a range of ring tokens, from Start to End inclusive,
+// wrapping around the top of the ring when Start is past End
+type StreamRange struct {
+	Start uint64 `json:"start"`
+	End   uint64 `json:"end"`
+}
+
+// StreamRequest asks a replica for the data it holds in token ranges, one
+// page of keys in key order at a time
+type StreamRequest struct {
+	Ranges   []StreamRange `json:"ranges"`
+	FromNode string        `json:"from_node"`
+	After    string        `json:"after,omitempty"` // Resume after this key
+	Limit    int           `json:"limit,omitempty"` // Maximum entries returned, 0 for all
+}
+
+// StreamResponse carries the entries, including tombstones, a replica
+// holds in the requested ranges
+type StreamResponse struct {
+	Entries []KeyValueEntry `json:"entries"`
+	Next    string          `json:"next,omitempty"` // Key to resume after, empty once the ranges are exhausted
 }
 
 // ReplicationResponse is the response to a replication request
 type ReplicationResponse struct {
-	Success bool   `json:"success"`
-	Message string `json:"message,omitempty"`
+	Success      bool   `json:"success"`
+	Message      string `json:"message,omitempty"`
+	RingEpoch    uint64 `json:"ring_epoch,omitempty"`    // Epoch of the replica's ring
+	RingChecksum uint64 `json:"ring_checksum,omitempty"` // Checksum of the replica's ring
+	Locked       bool   `json:"locked,omitempty"`        // A client write refused because a transaction locks a key
+	Superseded   bool   `json:"superseded,omitempty"`    // The replica kept a newer version of the key instead
 }
 
+// GossipMessageType distinguishes membership gossip from joins and SWIM
+// probes
+type GossipMessageType string
+
+const (
+	GossipMembership GossipMessageType = ""           // Membership dissemination
+	GossipPing       GossipMessageType = "ping"       // Direct probe, answered with an ack
+	GossipAck        GossipMessageType = "ack"        // Answer to a ping, possibly relayed
+	GossipPingReq    GossipMessageType = "ping_req"   // Request to probe Target on the sender's behalf
+	GossipJoin       GossipMessageType = "join"       // A new node introducing itself to a seed
+	GossipJoinAck    GossipMessageType = "join_ack"   // The seed's full membership, with tokens, for a new node
+	GossipDigest     GossipMessageType = "digest"     // Versions of every member, sent each gossip round
+	GossipDigestAck  GossipMessageType = "digest_ack" // Entries the digest's sender lacks, and those it should send back
+	GossipDelta      GossipMessageType = "delta"      // Entries asked for by a digest ack, or a refutation
+)
+
 // GossipMessage is exchanged between nodes for failure detection
 type GossipMessage struct {
-	FromNode   string              `json:"from_node"`
-	Members    map[string]NodeInfo `json:"members"`
-	Timestamp  time.Time           `json:"timestamp"`
+	Type        GossipMessageType   `json:"type,omitempty"`
+	FromNode    string              `json:"from_node"`
+	Incarnation uint64              `json:"incarnation,omitempty"` // Sender's incarnation
+	Members     map[string]NodeInfo `json:"members,omitempty"`
+	Timestamp   time.Time           `json:"timestamp"`
+	HLC         int64               `json:"hlc,omitempty"`      // Sender's hybrid logical clock
+	Ring        *RingVersion        `json:"ring,omitempty"`     // Version of the sender's ring
+	Seq         uint64              `json:"seq,omitempty"`      // Probe sequence number, echoed by the ack
+	Target      string              `json:"target,omitempty"`   // Node probed for a ping_req, or acking through a relay
+	Suspects    []Suspicion         `json:"suspects,omitempty"` // Suspicions piggybacked on any message
+	Digests     []MemberDigest      `json:"digests,omitempty"`  // Member versions, for digest and digest_ack
+	Want        []string            `json:"want,omitempty"`     // Members whose entries a digest_ack asks for
+}
+
+// MemberDigest is the version of one member's entry. Peers compare digests
+// and exchange only the entries that differ.
+type MemberDigest struct {
+	NodeID      string `json:"id"`
+	Incarnation uint64 `json:"incarnation"`
+	State       string `json:"state"`
+	Heartbeat   uint64 `json:"heartbeat"`
+}
+
+// Suspicion is a rumor that a node failed a direct and indirect probe
+type Suspicion struct {
+	NodeID      string `json:"node_id"`
+	Incarnation uint64 `json:"incarnation"` // Incarnation the node was suspected at
+	From        string `json:"from"`        // Node whose probe failed
+}
+
+// RingVersion identifies a node's ring: the epoch of its last ownership
+// change and a checksum that tells apart rings at the same epoch
+type RingVersion struct {
+	Epoch    uint64 `json:"epoch"`
+	Checksum uint64 `json:"checksum"`
+}
+
+// NodeLoadReport is a node's observed load, used to plan rebalancing
+type NodeLoadReport struct {
+	NodeID        string  `json:"node_id"`
+	Keys          int64   `json:"keys"`
+	Bytes         int64   `json:"bytes"`
+	Requests      uint64  `json:"requests"` // Storage reads and writes since start
+	UptimeSeconds float64 `json:"uptime_seconds"`
+}
+
+// TokenReassignRequest hands the virtual node at a token to another node
+type TokenReassignRequest struct {
+	Token    uint64 `json:"token"`
+	NodeID   string `json:"node_id"`
+	FromNode string `json:"from_node"`
+}
+
+// WeightChangeRequest announces a node's new weight, whose data has
+// already moved to the nodes gaining ranges
+type WeightChangeRequest struct {
+	NodeID string   `json:"node_id"`
+	Weight float64  `json:"weight"`
+	Tokens []uint64 `json:"tokens,omitempty"` // Where the node placed its virtual nodes at the new weight
 }
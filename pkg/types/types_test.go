@@ -0,0 +1,42 @@
+package types
+
+import "testing"
+
+func TestParseConsistencyLevel(t *testing.T) {
+	tests := []struct {
+		in       string
+		want     ConsistencyLevel
+		replicas int
+		wantErr  bool
+	}{
+		{in: "", want: ConsistencyQuorum},
+		{in: "one", want: ConsistencyOne, replicas: 1},
+		{in: " TWO ", want: ConsistencyTwo, replicas: 2},
+		{in: "three", want: ConsistencyThree, replicas: 3},
+		{in: "Quorum", want: ConsistencyQuorum},
+		{in: "all", want: ConsistencyAll},
+		{in: "local_quorum", want: ConsistencyLocalQuorum},
+		{in: "each_quorum", want: ConsistencyEachQuorum},
+		{in: "linearizable", want: ConsistencyLinearizable},
+		{in: "4", want: "4", replicas: 4},
+		{in: "0", wantErr: true},
+		{in: "-2", wantErr: true},
+		{in: "most", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		level, err := ParseConsistencyLevel(tt.in)
+		if tt.wantErr {
+			if err == nil {
+				t.Errorf("%q: expected an error, got %q", tt.in, level)
+			}
+			continue
+		}
+		if err != nil || level != tt.want {
+			t.Errorf("%q: expected %q, got %q (%v)", tt.in, tt.want, level, err)
+		}
+		if n := level.ReplicaCount(); n != tt.replicas {
+			t.Errorf("%q: expected %d replicas, got %d", tt.in, tt.replicas, n)
+		}
+	}
+}
@@ -0,0 +1,107 @@
+#!/bin/bash
+
+# Start a Multi-Datacenter Distributed Key-Value Store Cluster Script
+# Usage: ./start_multidc_cluster.sh [nodes_per_dc] [inter_dc_latency]
+#
+# Starts two datacenters (dc1, dc2) with each node on its own rack. Every key
+# gets two replicas per datacenter, and requests between datacenters are
+# delayed by inter_dc_latency to make local_quorum vs each_quorum visible.
+
+set -e
+
+NODES_PER_DC=${1:-3}
+INTER_DC_LATENCY=${2:-50ms}
+BASE_PORT=8000
+BASE_GOSSIP_PORT=7000
+DATA_DIR="/tmp/distributed-kvstore"
+DATACENTERS=("dc1" "dc2")
+
+echo "Starting multi-DC cluster: ${#DATACENTERS[@]} datacenters x $NODES_PER_DC nodes..."
+echo "=============================================="
+
+# Create data directories
+mkdir -p "$DATA_DIR"
+
+# Shared placement config: 2 replicas in each datacenter
+CONFIG_FILE="$DATA_DIR/multidc.json"
+cat > "$CONFIG_FILE" <<JSON
+{
+  "replicas_per_dc": {"dc1": 2, "dc2": 2}
+}
+JSON
+
+# Build the binary first
+echo "Building Distributed Key-Value Store..."
+cd "$(dirname "$0")/.."
+go build -o bin/dynamo ./cmd/dynamo
+
+PIDS=()
+FIRST_GOSSIP=""
+i=0
+
+for DC in "${DATACENTERS[@]}"; do
+    for r in $(seq 1 $NODES_PER_DC); do
+        i=$((i + 1))
+        NODE_ID="node$i"
+        PORT=$((BASE_PORT + i))
+        GOSSIP_PORT=$((BASE_GOSSIP_PORT + i))
+        NODE_DATA="$DATA_DIR/$NODE_ID"
+
+        SEEDS=()
+        if [ -n "$FIRST_GOSSIP" ]; then
+            SEEDS=(--seeds="$FIRST_GOSSIP")
+        fi
+
+        mkdir -p "$NODE_DATA"
+        echo "Starting $NODE_ID ($DC/rack$r) on port $PORT..."
+
+        ./bin/dynamo \
+            --config="$CONFIG_FILE" \
+            --node-id="$NODE_ID" \
+            --address="127.0.0.1" \
+            --port="$PORT" \
+            --gossip-port="$GOSSIP_PORT" \
+            --data-dir="$NODE_DATA" \
+            --replication=4 \
+            --read-quorum=3 \
+            --write-quorum=3 \
+            --datacenter="$DC" \
+            --rack="rack$r" \
+            --inter-dc-latency="$INTER_DC_LATENCY" \
+            "${SEEDS[@]}" \
+            > "$NODE_DATA/output.log" 2>&1 &
+
+        PIDS+=($!)
+        if [ -z "$FIRST_GOSSIP" ]; then
+            FIRST_GOSSIP="127.0.0.1:$GOSSIP_PORT"
+            sleep 2
+        else
+            sleep 1
+        fi
+    done
+done
+
+echo ""
+echo "Cluster started!"
+echo "================"
+echo ""
+echo "Node Endpoints:"
+i=0
+for DC in "${DATACENTERS[@]}"; do
+    for r in $(seq 1 $NODES_PER_DC); do
+        i=$((i + 1))
+        echo "  Node $i ($DC): http://127.0.0.1:$((BASE_PORT + i))"
+    done
+done
+echo ""
+echo "PIDs: ${PIDS[*]}"
+echo ""
+echo "Test commands:"
+echo "  time curl -X PUT 'http://localhost:8001/kv/hello?consistency=local_quorum' -d '{\"value\":\"world\"}'"
+echo "  time curl -X PUT 'http://localhost:8001/kv/hello?consistency=each_quorum' -d '{\"value\":\"world\"}'"
+echo "  curl 'http://localhost:8001/admin/ring?key=hello'"
+echo ""
+echo "To stop: ./stop_cluster.sh"
+
+# Save PIDs to file
+echo "${PIDS[*]}" > "$DATA_DIR/pids.txt"